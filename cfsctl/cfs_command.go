@@ -1,13 +1,18 @@
 package main
 
 import (
+	"time"
+
 	"github.com/c-fs/cfs/client"
 	"github.com/qiniu/log"
 	"github.com/spf13/cobra"
 )
 
 var (
-	address string
+	address     string
+	dialTimeout time.Duration
+	callTimeout time.Duration
+	retries     int
 )
 
 var cfsctlCmd = &cobra.Command{
@@ -24,6 +29,12 @@ Complete documentation is available at https://github.com/c-fs/cfs`,
 func init() {
 	cfsctlCmd.PersistentFlags().StringVarP(&address, "address", "",
 		"localhost:15524", "address of the cfs node server")
+	cfsctlCmd.PersistentFlags().DurationVarP(&dialTimeout, "dial-timeout", "", 5*time.Second,
+		"time to wait for the connection to the server")
+	cfsctlCmd.PersistentFlags().DurationVarP(&callTimeout, "timeout", "", time.Minute,
+		"deadline of each request, 0 for none")
+	cfsctlCmd.PersistentFlags().IntVarP(&retries, "retries", "", 3,
+		"number of times reads are retried after transient failures")
 	addCommand()
 }
 
@@ -36,11 +47,36 @@ func addCommand() {
 	cfsctlCmd.AddCommand(readDirCmd)
 	cfsctlCmd.AddCommand(mkdirCmd)
 	cfsctlCmd.AddCommand(statsCmd)
+	cfsctlCmd.AddCommand(rotateKeysCmd)
+	cfsctlCmd.AddCommand(checksumCmd)
+	cfsctlCmd.AddCommand(watchCmd)
+	cfsctlCmd.AddCommand(duCmd)
+	cfsctlCmd.AddCommand(treeCmd)
+	cfsctlCmd.AddCommand(findCmd)
+	cfsctlCmd.AddCommand(cpCmd)
+	cfsctlCmd.AddCommand(trashCmd)
+	cfsctlCmd.AddCommand(undeleteCmd)
+	cfsctlCmd.AddCommand(purgeTrashCmd)
+	cfsctlCmd.AddCommand(snapshotCmd)
+	cfsctlCmd.AddCommand(snapshotsCmd)
+	cfsctlCmd.AddCommand(deleteSnapshotCmd)
+	cfsctlCmd.AddCommand(restoreSnapshotCmd)
+	cfsctlCmd.AddCommand(linkCmd)
+	cfsctlCmd.AddCommand(symlinkCmd)
+	cfsctlCmd.AddCommand(cloneCmd)
+	cfsctlCmd.AddCommand(statCmd)
+	cfsctlCmd.AddCommand(truncateCmd)
+	cfsctlCmd.AddCommand(mountCmd)
 }
 
 func setUpClient() *client.Client {
 	// Set up a connection to the server.
-	c, err := client.New(0x1234, address)
+	c, err := client.NewWithOptions(0x1234, address, client.Options{
+		DialTimeout: dialTimeout,
+		CallTimeout: callTimeout,
+		Retries:     retries,
+		KeepAlive:   30 * time.Second,
+	})
 	if err != nil {
 		log.Fatalf("Cannot create cfs client: %v", err)
 	}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var (
+	checksumOffset int64
+	checksumName   string
+	checksumLen    int64
+)
+
+var checksumCmd = &cobra.Command{
+	Use:   "checksum",
+	Short: "compute the CRC32C of a file range on a cfs node",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleChecksum(context.TODO(), c)
+	},
+}
+
+func init() {
+	checksumCmd.PersistentFlags().Int64VarP(&checksumOffset, "offset", "o", 0, "range offset")
+	checksumCmd.PersistentFlags().Int64VarP(&checksumLen, "length", "l", -1, "range length, negative for up to the end of the file")
+	checksumCmd.PersistentFlags().StringVarP(&checksumName, "name", "n", "", "file name")
+}
+
+func handleChecksum(ctx context.Context, c *client.Client) error {
+	crc, n, err := c.Checksum(ctx, checksumName, checksumOffset, checksumLen)
+	if err != nil {
+		log.Fatalf("Checksum err (%v)", err)
+	}
+	fmt.Printf("%08x %d\n", crc, n)
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var (
+	cloneSrc string
+	cloneDst string
+)
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone",
+	Short: "clone a file on a cfs node",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleClone(context.TODO(), c)
+	},
+}
+
+func init() {
+	cloneCmd.PersistentFlags().StringVarP(&cloneSrc, "src", "", "", "file to clone")
+	cloneCmd.PersistentFlags().StringVarP(&cloneDst, "dst", "", "", "name of the clone")
+}
+
+func handleClone(ctx context.Context, c *client.Client) error {
+	err := c.Clone(ctx, cloneSrc, cloneDst)
+	if err != nil {
+		log.Fatalf("Clone err (%v)", err)
+	}
+	log.Infof("clone %s into %s", cloneSrc, cloneDst)
+
+	return nil
+}
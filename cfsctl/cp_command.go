@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"path"
+
+	"github.com/c-fs/cfs/client"
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+// cpChunkSize is the number of bytes copied per read and write.
+const cpChunkSize = 1 << 20
+
+var (
+	cpSrc       string
+	cpDst       string
+	cpRecursive bool
+)
+
+var cpCmd = &cobra.Command{
+	Use:   "cp",
+	Short: "copy files on a cfs node",
+	Long: `cp copies the file src to dst. With --recursive, src is a directory,
+which is copied to dst with all its subdirectories and files.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleCp(context.TODO(), c)
+	},
+}
+
+func init() {
+	cpCmd.PersistentFlags().StringVarP(&cpSrc, "src", "s", "", "source name")
+	cpCmd.PersistentFlags().StringVarP(&cpDst, "dst", "d", "", "destination name")
+	cpCmd.PersistentFlags().BoolVarP(&cpRecursive, "recursive", "r", false, "copy a directory recursively")
+}
+
+func handleCp(ctx context.Context, c *client.Client) error {
+	if !cpRecursive {
+		fi, err := c.Stat(ctx, cpSrc)
+		if err != nil {
+			log.Fatalf("Cp err (%v)", err)
+		}
+		if fi.IsDir {
+			log.Fatalf("Cp err (%s is a directory, use --recursive)", cpSrc)
+		}
+		if err := copyFile(ctx, c, cpSrc, cpDst); err != nil {
+			log.Fatalf("Cp err (%v)", err)
+		}
+		return nil
+	}
+
+	if err := c.Mkdir(ctx, cpDst, true); err != nil {
+		log.Fatalf("Cp err (%v)", err)
+	}
+	err := c.Walk(ctx, cpSrc, "", "", func(fi *pb.FileInfo) error {
+		dst := path.Join(cpDst, fi.Name)
+		if fi.IsDir {
+			return c.Mkdir(ctx, dst, false)
+		}
+		return copyFile(ctx, c, path.Join(cpSrc, fi.Name), dst)
+	})
+	if err != nil {
+		log.Fatalf("Cp err (%v)", err)
+	}
+
+	return nil
+}
+
+// copyFile copies the file src to the file dst.
+func copyFile(ctx context.Context, c *client.Client, src, dst string) error {
+	in, err := c.Open(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := c.Create(ctx, dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.CopyBuffer(out, in, make([]byte, cpChunkSize))
+	return err
+}
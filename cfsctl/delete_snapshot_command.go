@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var (
+	deleteSnapshotDisk string
+	deleteSnapshotID   string
+)
+
+var deleteSnapshotCmd = &cobra.Command{
+	Use:   "delete-snapshot",
+	Short: "delete a snapshot of a disk",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleDeleteSnapshot(context.TODO(), c)
+	},
+}
+
+func init() {
+	deleteSnapshotCmd.PersistentFlags().StringVarP(&deleteSnapshotDisk, "disk", "d", "", "disk name")
+	deleteSnapshotCmd.PersistentFlags().StringVarP(&deleteSnapshotID, "id", "i", "", "snapshot id")
+}
+
+func handleDeleteSnapshot(ctx context.Context, c *client.Client) error {
+	if err := c.DeleteSnapshot(ctx, deleteSnapshotDisk, deleteSnapshotID); err != nil {
+		log.Fatalf("DeleteSnapshot err (%v)", err)
+	}
+	log.Info("delete snapshot succeeded")
+
+	return nil
+}
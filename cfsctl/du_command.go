@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var (
+	duName  string
+	duDepth int
+)
+
+var duCmd = &cobra.Command{
+	Use:   "du",
+	Short: "print the space used by directories on a cfs node",
+	Long: `du prints the logical bytes, the bytes on disk, and the numbers of files
+and directories under a directory and under its subdirectories down to
+the given depth. The name may be a disk name alone.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleDu(context.TODO(), c)
+	},
+}
+
+func init() {
+	duCmd.PersistentFlags().StringVarP(&duName, "name", "n", "", "directory name")
+	duCmd.PersistentFlags().IntVarP(&duDepth, "depth", "d", 1, "print subdirectories down to this depth")
+}
+
+func handleDu(ctx context.Context, c *client.Client) error {
+	usages, err := c.DiskUsage(ctx, duName, duDepth)
+	if err != nil {
+		log.Fatalf("DiskUsage err (%v)", err)
+	}
+	fmt.Printf("%14s %14s %10s %8s  %s\n", "LOGICAL", "ON DISK", "FILES", "DIRS", "NAME")
+	for _, u := range usages {
+		fmt.Printf("%14d %14d %10d %8d  %s\n", u.LogicalBytes, u.DiskBytes, u.Files, u.Dirs, path.Join(duName, u.Path))
+	}
+
+	return nil
+}
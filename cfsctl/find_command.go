@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/c-fs/cfs/client"
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var (
+	findName    string
+	findPrefix  string
+	findPattern string
+	findType    string
+)
+
+var findCmd = &cobra.Command{
+	Use:   "find",
+	Short: "find files under a directory on a cfs node",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleFind(context.TODO(), c)
+	},
+}
+
+func init() {
+	findCmd.PersistentFlags().StringVarP(&findName, "name", "n", "", "directory name")
+	findCmd.PersistentFlags().StringVarP(&findPrefix, "prefix", "p", "", "find the entries whose path starts with prefix")
+	findCmd.PersistentFlags().StringVarP(&findPattern, "pattern", "g", "", "find the entries whose name matches the shell pattern")
+	findCmd.PersistentFlags().StringVarP(&findType, "type", "t", "", "find only files (f) or directories (d)")
+}
+
+func handleFind(ctx context.Context, c *client.Client) error {
+	if findType != "" && findType != "f" && findType != "d" {
+		log.Fatalf("Find err (bad type %q)", findType)
+	}
+	err := c.Walk(ctx, findName, findPrefix, findPattern, func(fi *pb.FileInfo) error {
+		if (findType == "f" && fi.IsDir) || (findType == "d" && !fi.IsDir) {
+			return nil
+		}
+		fmt.Println(path.Join(findName, fi.Name))
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Find err (%v)", err)
+	}
+
+	return nil
+}
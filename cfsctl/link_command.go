@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var (
+	linkOld string
+	linkNew string
+)
+
+var linkCmd = &cobra.Command{
+	Use:   "link",
+	Short: "hard link a file on a cfs node",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleLink(context.TODO(), c)
+	},
+}
+
+func init() {
+	linkCmd.PersistentFlags().StringVarP(&linkOld, "oldname", "", "", "name of the file to link")
+	linkCmd.PersistentFlags().StringVarP(&linkNew, "newname", "", "", "new name of the file")
+}
+
+func handleLink(ctx context.Context, c *client.Client) error {
+	err := c.Link(ctx, linkOld, linkNew)
+	if err != nil {
+		log.Fatalf("Link err (%v)", err)
+	}
+	log.Infof("link %s as %s", linkOld, linkNew)
+
+	return nil
+}
@@ -0,0 +1,56 @@
+// +build linux
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/c-fs/cfs/client"
+	"github.com/c-fs/cfs/mount"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mountPoint   string
+	mountAttrTTL time.Duration
+)
+
+var mountCmd = &cobra.Command{
+	Use:   "mount",
+	Short: "mount the disks of a cfs node with FUSE",
+	Long: `mount serves the disks of a cfs node as a FUSE filesystem at the mount
+point, with a directory per disk, until it is interrupted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleMount(c)
+	},
+}
+
+func init() {
+	mountCmd.PersistentFlags().StringVarP(&mountPoint, "dir", "d", "", "mount point")
+	mountCmd.PersistentFlags().DurationVarP(&mountAttrTTL, "attr-ttl", "t", time.Second, "how long file attributes are cached")
+}
+
+func handleMount(c *client.Client) error {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigc
+		if err := mount.Unmount(mountPoint); err != nil {
+			log.Infof("Unmount err (%v)", err)
+		}
+	}()
+
+	log.Infof("mount %s at %s", address, mountPoint)
+	if err := mount.Mount(c, mountPoint, mountAttrTTL); err != nil {
+		log.Fatalf("Mount err (%v)", err)
+	}
+
+	return nil
+}
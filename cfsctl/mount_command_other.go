@@ -0,0 +1,17 @@
+// +build !linux
+
+package main
+
+import (
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+)
+
+var mountCmd = &cobra.Command{
+	Use:   "mount",
+	Short: "mount the disks of a cfs node with FUSE",
+	Long:  "mount is only supported on linux.",
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Fatalf("Mount err (only supported on linux)")
+	},
+}
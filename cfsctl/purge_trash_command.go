@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var (
+	purgeTrashDisk string
+	purgeTrashID   string
+	purgeTrashAll  bool
+)
+
+var purgeTrashCmd = &cobra.Command{
+	Use:   "purge-trash",
+	Short: "delete removed files from the trash of a disk for good",
+	Long: `purge-trash deletes an entry of the trash for good, or all the entries of
+the trash with --all.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handlePurgeTrash(context.TODO(), c)
+	},
+}
+
+func init() {
+	purgeTrashCmd.PersistentFlags().StringVarP(&purgeTrashDisk, "disk", "d", "", "disk name")
+	purgeTrashCmd.PersistentFlags().StringVarP(&purgeTrashID, "id", "i", "", "trash entry id")
+	purgeTrashCmd.PersistentFlags().BoolVarP(&purgeTrashAll, "all", "a", false, "purge all the entries")
+}
+
+func handlePurgeTrash(ctx context.Context, c *client.Client) error {
+	if (purgeTrashID != "") == purgeTrashAll {
+		log.Fatalf("PurgeTrash err (give either --id or --all)")
+	}
+	var n int
+	var err error
+	if purgeTrashAll {
+		n, err = c.PurgeAllTrash(ctx, purgeTrashDisk)
+	} else {
+		n, err = c.PurgeTrash(ctx, purgeTrashDisk, purgeTrashID)
+	}
+	if err != nil {
+		log.Fatalf("PurgeTrash err (%v)", err)
+	}
+	log.Infof("purged %d entries", n)
+
+	return nil
+}
@@ -4,13 +4,17 @@ import (
 	"fmt"
 
 	"github.com/c-fs/cfs/client"
+	pb "github.com/c-fs/cfs/proto"
 	"github.com/qiniu/log"
 	"github.com/spf13/cobra"
 	"golang.org/x/net/context"
 )
 
 var (
-	readDirName string
+	readDirName      string
+	readDirPrefix    string
+	readDirPattern   string
+	readDirRecursive bool
 )
 
 var readDirCmd = &cobra.Command{
@@ -27,17 +31,20 @@ var readDirCmd = &cobra.Command{
 
 func init() {
 	readDirCmd.PersistentFlags().StringVarP(&readDirName, "name", "n", "", "readDir name")
+	readDirCmd.PersistentFlags().StringVarP(&readDirPrefix, "prefix", "p", "", "list the entries whose path starts with prefix")
+	readDirCmd.PersistentFlags().StringVarP(&readDirPattern, "pattern", "g", "", "list the entries whose name matches the shell pattern")
+	readDirCmd.PersistentFlags().BoolVarP(&readDirRecursive, "recursive", "r", false, "list subdirectories recursively")
 }
 
 func handleReadDir(ctx context.Context, c *client.Client) error {
-	fInfos, err := c.ReadDir(ctx, readDirName)
+	opts := client.ListOptions{Prefix: readDirPrefix, Pattern: readDirPattern, Recursive: readDirRecursive}
+	err := c.ListDir(ctx, readDirName, opts, func(stats *pb.FileInfo) error {
+		fmt.Printf("%s: %d %t\n", stats.Name, stats.TotalSize, stats.IsDir == true)
+		return nil
+	})
 	if err != nil {
 		log.Fatalf("ReadDir err (%v)", err)
 	}
 
-	for _, stats := range fInfos {
-		fmt.Printf("%s: %d %t\n", stats.Name, stats.TotalSize, stats.IsDir == true)
-	}
-
 	return nil
 }
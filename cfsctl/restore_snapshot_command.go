@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var (
+	restoreSnapshotDisk string
+	restoreSnapshotID   string
+	restoreSnapshotName string
+)
+
+var restoreSnapshotCmd = &cobra.Command{
+	Use:   "restore-snapshot",
+	Short: "restore a snapshot of a disk",
+	Long: `restore-snapshot copies a snapshot back to the directory or file it was
+taken of, or to the given name, replacing what is there. The replaced
+files go to the trash if the disk has one.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleRestoreSnapshot(context.TODO(), c)
+	},
+}
+
+func init() {
+	restoreSnapshotCmd.PersistentFlags().StringVarP(&restoreSnapshotDisk, "disk", "d", "", "disk name")
+	restoreSnapshotCmd.PersistentFlags().StringVarP(&restoreSnapshotID, "id", "i", "", "snapshot id")
+	restoreSnapshotCmd.PersistentFlags().StringVarP(&restoreSnapshotName, "name", "n", "", "restore to this name rather than the original one")
+}
+
+func handleRestoreSnapshot(ctx context.Context, c *client.Client) error {
+	name, err := c.RestoreSnapshot(ctx, restoreSnapshotDisk, restoreSnapshotID, restoreSnapshotName)
+	if err != nil {
+		log.Fatalf("RestoreSnapshot err (%v)", err)
+	}
+	log.Infof("restored %s", name)
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var rotateKeysCmd = &cobra.Command{
+	Use:   "rotate-keys",
+	Short: "rewrap the data keys of encrypted disks with the current master key",
+	Long: `rotate-keys makes the server reload its key file and rewrap the data keys
+of all encrypted disks with the key on the last line of the file. Keep the
+previous key in the file until the rotation succeeded. The server only rotates
+keys through its admin listener, so --address must be its admin_port, as in
+--address=localhost:15525 on the node.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleRotateKeys(context.TODO(), c)
+	},
+}
+
+func handleRotateKeys(ctx context.Context, c *client.Client) error {
+	disks, err := c.RotateKeys(ctx)
+	for _, d := range disks {
+		fmt.Println(d)
+	}
+	if err != nil {
+		log.Fatalf("RotateKeys err (%v)", err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var snapshotName string
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "take a snapshot of a directory on a cfs node",
+	Long: `snapshot takes a read-only copy of a directory or file as it is at one
+point in time, and prints its id. The copy shares the data of the files
+until they are next written.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleSnapshot(context.TODO(), c)
+	},
+}
+
+func init() {
+	snapshotCmd.PersistentFlags().StringVarP(&snapshotName, "name", "n", "", "directory or file name")
+}
+
+func handleSnapshot(ctx context.Context, c *client.Client) error {
+	id, err := c.Snapshot(ctx, snapshotName)
+	if err != nil {
+		log.Fatalf("Snapshot err (%v)", err)
+	}
+	fmt.Println(id)
+
+	return nil
+}
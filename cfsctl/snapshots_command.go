@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var snapshotsDisk string
+
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "list the snapshots of a disk",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleSnapshots(context.TODO(), c)
+	},
+}
+
+func init() {
+	snapshotsCmd.PersistentFlags().StringVarP(&snapshotsDisk, "disk", "d", "", "disk name")
+}
+
+func handleSnapshots(ctx context.Context, c *client.Client) error {
+	snaps, err := c.ListSnapshots(ctx, snapshotsDisk)
+	if err != nil {
+		log.Fatalf("ListSnapshots err (%v)", err)
+	}
+	for _, s := range snaps {
+		fmt.Printf("%s %s %s\n", s.Id, time.Unix(0, s.CreatedTime).Format(time.RFC3339), s.Name)
+	}
+
+	return nil
+}
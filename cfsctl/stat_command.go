@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var statName string
+
+var statCmd = &cobra.Command{
+	Use:   "stat",
+	Short: "show the file info of a file on a cfs node",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleStat(context.TODO(), c)
+	},
+}
+
+func init() {
+	statCmd.PersistentFlags().StringVarP(&statName, "name", "n", "", "file name")
+}
+
+func handleStat(ctx context.Context, c *client.Client) error {
+	fi, err := c.Stat(ctx, statName)
+	if err != nil {
+		log.Fatalf("Stat err (%v)", err)
+	}
+	fmt.Printf("name: %s\n", fi.Name)
+	fmt.Printf("size: %d\n", fi.Size)
+	fmt.Printf("total size: %d\n", fi.TotalSize)
+	fmt.Printf("modified: %s\n", time.Unix(0, fi.ModTime).Format(time.RFC3339))
+	fmt.Printf("dir: %t\n", fi.IsDir)
+	if fi.Symlink != "" {
+		fmt.Printf("symlink: %s\n", fi.Symlink)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var (
+	symlinkTarget string
+	symlinkName   string
+)
+
+var symlinkCmd = &cobra.Command{
+	Use:   "symlink",
+	Short: "make a symbolic link to a file on a cfs node",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleSymlink(context.TODO(), c)
+	},
+}
+
+func init() {
+	symlinkCmd.PersistentFlags().StringVarP(&symlinkTarget, "target", "", "", "file the link points to")
+	symlinkCmd.PersistentFlags().StringVarP(&symlinkName, "name", "", "", "name of the link")
+}
+
+func handleSymlink(ctx context.Context, c *client.Client) error {
+	err := c.Symlink(ctx, symlinkTarget, symlinkName)
+	if err != nil {
+		log.Fatalf("Symlink err (%v)", err)
+	}
+	log.Infof("link %s as %s", symlinkTarget, symlinkName)
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var trashDisk string
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "list the removed files kept in the trash of a disk",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleTrash(context.TODO(), c)
+	},
+}
+
+func init() {
+	trashCmd.PersistentFlags().StringVarP(&trashDisk, "disk", "d", "", "disk name")
+}
+
+func handleTrash(ctx context.Context, c *client.Client) error {
+	entries, err := c.ListTrash(ctx, trashDisk)
+	if err != nil {
+		log.Fatalf("ListTrash err (%v)", err)
+	}
+	for _, e := range entries {
+		removed := time.Unix(0, e.RemovedTime).Format(time.RFC3339)
+		if e.IsDir {
+			fmt.Printf("%s %s %s/\n", e.Id, removed, e.Name)
+		} else {
+			fmt.Printf("%s %s %s\n", e.Id, removed, e.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/c-fs/cfs/client"
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var treeName string
+
+var treeCmd = &cobra.Command{
+	Use:   "tree",
+	Short: "print the tree of files under a directory on a cfs node",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleTree(context.TODO(), c)
+	},
+}
+
+func init() {
+	treeCmd.PersistentFlags().StringVarP(&treeName, "name", "n", "", "directory name")
+}
+
+func handleTree(ctx context.Context, c *client.Client) error {
+	fmt.Println(treeName)
+	var dirs, files int
+	err := c.Walk(ctx, treeName, "", "", func(fi *pb.FileInfo) error {
+		indent := strings.Repeat("    ", strings.Count(fi.Name, "/"))
+		switch {
+		case fi.IsDir:
+			dirs++
+			fmt.Printf("%s%s/\n", indent, path.Base(fi.Name))
+		case fi.Symlink != "":
+			files++
+			fmt.Printf("%s%s -> %s\n", indent, path.Base(fi.Name), fi.Symlink)
+		default:
+			files++
+			fmt.Printf("%s%s (%d)\n", indent, path.Base(fi.Name), fi.Size)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Walk err (%v)", err)
+	}
+	fmt.Printf("\n%d directories, %d files\n", dirs, files)
+
+	return nil
+}
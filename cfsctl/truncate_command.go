@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var (
+	truncateName string
+	truncateSize int64
+)
+
+var truncateCmd = &cobra.Command{
+	Use:   "truncate",
+	Short: "change the size of a file on a cfs node",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleTruncate(context.TODO(), c)
+	},
+}
+
+func init() {
+	truncateCmd.PersistentFlags().StringVarP(&truncateName, "name", "n", "", "file name")
+	truncateCmd.PersistentFlags().Int64VarP(&truncateSize, "size", "s", 0, "new size")
+}
+
+func handleTruncate(ctx context.Context, c *client.Client) error {
+	err := c.Truncate(ctx, truncateName, truncateSize)
+	if err != nil {
+		log.Fatalf("Truncate err (%v)", err)
+	}
+	log.Infof("truncate %s to %d bytes", truncateName, truncateSize)
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var (
+	undeleteDisk string
+	undeleteID   string
+	undeleteName string
+)
+
+var undeleteCmd = &cobra.Command{
+	Use:   "undelete",
+	Short: "bring a removed file back from the trash of a disk",
+	Long: `undelete moves an entry of the trash, as listed by trash, back to the name
+it had or to the given name. It fails if the file exists.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleUndelete(context.TODO(), c)
+	},
+}
+
+func init() {
+	undeleteCmd.PersistentFlags().StringVarP(&undeleteDisk, "disk", "d", "", "disk name")
+	undeleteCmd.PersistentFlags().StringVarP(&undeleteID, "id", "i", "", "trash entry id")
+	undeleteCmd.PersistentFlags().StringVarP(&undeleteName, "name", "n", "", "restore to this name rather than the original one")
+}
+
+func handleUndelete(ctx context.Context, c *client.Client) error {
+	name, err := c.Undelete(ctx, undeleteDisk, undeleteID, undeleteName)
+	if err != nil {
+		log.Fatalf("Undelete err (%v)", err)
+	}
+	log.Infof("restored %s", name)
+
+	return nil
+}
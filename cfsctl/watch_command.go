@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/c-fs/cfs/client"
+	"github.com/qiniu/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+var (
+	watchPrefix   string
+	watchAfterSeq uint64
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "print the changes of files on a cfs node as they happen",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := setUpClient()
+		defer c.Close()
+
+		handleWatch(context.TODO(), c)
+	},
+}
+
+func init() {
+	watchCmd.PersistentFlags().StringVarP(&watchPrefix, "name", "n", "", "disk name optionally followed by a path")
+	watchCmd.PersistentFlags().Uint64VarP(&watchAfterSeq, "after", "s", 0, "replay the recent events after this seq")
+}
+
+func handleWatch(ctx context.Context, c *client.Client) error {
+	stream, err := c.Watch(ctx, watchPrefix, watchAfterSeq)
+	if err != nil {
+		log.Fatalf("Watch err (%v)", err)
+	}
+	for {
+		e, err := stream.Recv()
+		if err != nil {
+			log.Fatalf("Watch err (%v)", err)
+		}
+		if e.NewName != "" {
+			fmt.Printf("%d %s %s %s\n", e.Seq, e.Op, e.Name, e.NewName)
+		} else {
+			fmt.Printf("%d %s %s\n", e.Seq, e.Op, e.Name)
+		}
+	}
+}
@@ -2,12 +2,24 @@ package client
 
 import (
 	"errors"
+	"io"
+	"os"
+	"time"
 
 	pb "github.com/c-fs/cfs/proto"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
 
+// ErrPreconditionFailed is returned by the conditional operations if the
+// file does not meet their precondition.
+var ErrPreconditionFailed = errors.New("cfs: precondition failed")
+
+// ErrLease is returned if a lease cannot be granted because of a
+// conflicting lease, or if the client does not hold the lease an operation
+// requires.
+var ErrLease = errors.New("cfs: lease conflict or not held")
+
 type Client struct {
 	header         *pb.RequestHeader
 	grpcConn       *grpc.ClientConn
@@ -17,14 +29,21 @@ type Client struct {
 }
 
 func New(clientID int64, address string) (*Client, error) {
+	return NewWithOptions(clientID, address, Options{})
+}
+
+// NewWithOptions returns a Client of the node at address whose connection
+// and rpcs are configured by opts.
+func NewWithOptions(clientID int64, address string, opts Options) (*Client, error) {
 	header := &pb.RequestHeader{ClientID: clientID}
-	conn, err := grpc.Dial(address)
+	conn, err := grpc.Dial(address, opts.dialOptions()...)
 	if err != nil {
 		return nil, err
 	}
-	mc := pb.NewMetadataClient(conn)
-	fc := pb.NewCfsClient(conn)
-	sc := pb.NewStatsClient(conn)
+	cl := &caller{opts: opts}
+	mc := &metadataClient{pb.NewMetadataClient(conn), cl}
+	fc := &cfsClient{pb.NewCfsClient(conn), cl}
+	sc := &statsClient{pb.NewStatsClient(conn), cl}
 
 	return &Client{header: header, grpcConn: conn, metadataClient: mc, fileClient: fc, statsClient: sc}, nil
 }
@@ -37,6 +56,16 @@ func (c *Client) Disks(ctx context.Context) ([]*pb.Disk, error) {
 	return reply.Disks, nil
 }
 
+// RotateKeys makes the server reload its key file and rewrap the data keys
+// of its encrypted disks. It returns the names of the rotated disks.
+func (c *Client) RotateKeys(ctx context.Context) ([]string, error) {
+	reply, err := c.metadataClient.RotateKeys(ctx, &pb.RotateKeysRequest{Header: c.header})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Disks, nil
+}
+
 func (c *Client) Write(ctx context.Context, name string, offset int64, data []byte, isAppend bool) (int64, error) {
 	reply, err := c.fileClient.Write(
 		ctx,
@@ -49,6 +78,22 @@ func (c *Client) Write(ctx context.Context, name string, offset int64, data []by
 	return reply.BytesWritten, parseErr(reply.Error)
 }
 
+// WriteIf writes data to the named file at offset if the file meets pre,
+// checked atomically with the write. It returns the number of bytes written
+// and the generation of the file after the write.
+func (c *Client) WriteIf(ctx context.Context, name string, offset int64, data []byte, pre *pb.Precondition,
+) (int64, uint64, error) {
+	reply, err := c.fileClient.Write(
+		ctx,
+		&pb.WriteRequest{Header: c.header, Name: name, Offset: offset, Data: data, Precondition: pre},
+	)
+
+	if err != nil {
+		return 0, 0, err
+	}
+	return reply.BytesWritten, reply.Generation, parseErr(reply.Error)
+}
+
 func (c *Client) Read(ctx context.Context, name string, offset, length int64, checksum uint32,
 ) (int64, []byte, uint32, error) {
 	reply, err := c.fileClient.Read(
@@ -64,6 +109,51 @@ func (c *Client) Read(ctx context.Context, name string, offset, length int64, ch
 	return reply.BytesRead, reply.Data, reply.Checksum, parseErr(reply.Error)
 }
 
+// ReadWithGeneration reads like Read and also returns the generation the
+// file had no later than the read, to base the preconditions of later
+// changes on.
+func (c *Client) ReadWithGeneration(ctx context.Context, name string, offset, length int64,
+) ([]byte, uint64, error) {
+	reply, err := c.fileClient.Read(
+		ctx,
+		&pb.ReadRequest{Header: c.header, Name: name, Offset: offset, Length: length},
+	)
+
+	if err != nil {
+		return nil, 0, err
+	}
+	return reply.Data, reply.Generation, parseErr(reply.Error)
+}
+
+// Truncate changes the size of the named file, creating it if it does not
+// exist.
+func (c *Client) Truncate(ctx context.Context, name string, size int64) error {
+	reply, err := c.fileClient.Truncate(ctx, &pb.TruncateRequest{Header: c.header, Name: name, Size: size})
+
+	if err != nil {
+		return err
+	}
+	return parseErr(reply.Error)
+}
+
+// Stat returns the file info of the named file or directory, which may be
+// a disk name alone. The error satisfies os.IsNotExist if the file does
+// not exist.
+func (c *Client) Stat(ctx context.Context, name string) (*pb.FileInfo, error) {
+	reply, err := c.fileClient.Stat(ctx, &pb.StatRequest{Header: c.header, Name: name})
+
+	if err != nil {
+		return nil, err
+	}
+	if err := parseErr(reply.Error); err != nil {
+		return nil, err
+	}
+	if reply.Info == nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return reply.Info, nil
+}
+
 func (c *Client) Rename(ctx context.Context, oldName, newName string) error {
 	reply, err := c.fileClient.Rename(
 		ctx,
@@ -76,6 +166,20 @@ func (c *Client) Rename(ctx context.Context, oldName, newName string) error {
 	return parseErr(reply.Error)
 }
 
+// RenameIf renames oldName to newName if newName meets pre, checked
+// atomically with the rename.
+func (c *Client) RenameIf(ctx context.Context, oldName, newName string, pre *pb.Precondition) error {
+	reply, err := c.fileClient.Rename(
+		ctx,
+		&pb.RenameRequest{Header: c.header, Oldname: oldName, Newname: newName, Precondition: pre},
+	)
+
+	if err != nil {
+		return err
+	}
+	return parseErr(reply.Error)
+}
+
 func (c *Client) Remove(ctx context.Context, name string, all bool) error {
 	reply, err := c.fileClient.Remove(ctx, &pb.RemoveRequest{Header: c.header, Name: name, All: all})
 
@@ -85,13 +189,74 @@ func (c *Client) Remove(ctx context.Context, name string, all bool) error {
 	return parseErr(reply.Error)
 }
 
-func (c *Client) ReadDir(ctx context.Context, name string) ([]*pb.FileInfo, error) {
-	reply, err := c.fileClient.ReadDir(ctx, &pb.ReadDirRequest{Header: c.header, Name: name})
+// RemoveIf removes the named file if it meets pre, checked atomically with
+// the remove.
+func (c *Client) RemoveIf(ctx context.Context, name string, all bool, pre *pb.Precondition) error {
+	reply, err := c.fileClient.Remove(
+		ctx,
+		&pb.RemoveRequest{Header: c.header, Name: name, All: all, Precondition: pre},
+	)
 
 	if err != nil {
-		return nil, err
+		return err
+	}
+	return parseErr(reply.Error)
+}
+
+// ReadDir returns all the entries of the named directory, going through
+// as many pages as needed.
+func (c *Client) ReadDir(ctx context.Context, name string) ([]*pb.FileInfo, error) {
+	var infos []*pb.FileInfo
+	err := c.ListDir(ctx, name, ListOptions{}, func(fi *pb.FileInfo) error {
+		infos = append(infos, fi)
+		return nil
+	})
+	return infos, err
+}
+
+// ListOptions select the entries listed by ListDir.
+type ListOptions struct {
+	// Prefix keeps the entries whose path starts with it.
+	Prefix string
+	// Pattern keeps the entries whose name matches the shell pattern.
+	Pattern string
+	// Recursive lists the entries of the subdirectories as well, named
+	// by their path relative to the directory.
+	Recursive bool
+	// PageSize is the number of entries asked per rpc. Zero means a
+	// server default.
+	PageSize int
+}
+
+// ListDir calls fn for the entries of the named directory sorted by name,
+// fetching them a page at a time. It stops at the first error of fn.
+func (c *Client) ListDir(ctx context.Context, name string, opts ListOptions, fn func(*pb.FileInfo) error) error {
+	req := &pb.ReadDirRequest{
+		Header:    c.header,
+		Name:      name,
+		PageSize:  int32(opts.PageSize),
+		Prefix:    opts.Prefix,
+		Pattern:   opts.Pattern,
+		Recursive: opts.Recursive,
+	}
+	for {
+		reply, err := c.fileClient.ReadDir(ctx, req)
+		if err != nil {
+			return err
+		}
+		if err := parseErr(reply.Error); err != nil {
+			return err
+		}
+		for _, fi := range reply.FileInfos {
+			if err := fn(fi); err != nil {
+				return err
+			}
+		}
+		if reply.NextPageToken == "" {
+			return nil
+		}
+		req.PageToken = reply.NextPageToken
 	}
-	return reply.FileInfos, parseErr(reply.Error)
 }
 
 func (c *Client) Mkdir(ctx context.Context, name string, all bool) error {
@@ -103,6 +268,360 @@ func (c *Client) Mkdir(ctx context.Context, name string, all bool) error {
 	return parseErr(reply.Error)
 }
 
+// Extents returns the allocated extents of the named file and the size
+// of its data. The data outside the extents read back as zeros.
+func (c *Client) Extents(ctx context.Context, name string) ([]*pb.Extent, int64, error) {
+	reply, err := c.fileClient.Extents(ctx, &pb.ExtentsRequest{Header: c.header, Name: name})
+
+	if err != nil {
+		return nil, 0, err
+	}
+	return reply.Extents, reply.Size, parseErr(reply.Error)
+}
+
+// Checksum returns the CRC32C of length bytes of the named file starting
+// at offset and the number of bytes it covers. A negative length means up
+// to the end of the file. The data is not transferred.
+func (c *Client) Checksum(ctx context.Context, name string, offset, length int64) (uint32, int64, error) {
+	reply, err := c.fileClient.Checksum(
+		ctx,
+		&pb.ChecksumRequest{Header: c.header, Name: name, Offset: offset, Length: length},
+	)
+
+	if err != nil {
+		return 0, 0, err
+	}
+	return reply.Checksum, reply.Length, parseErr(reply.Error)
+}
+
+// MerkleNodes returns up to count digests of a level of the hash tree of
+// the named file starting at node start, along with the shape of the tree.
+// Comparing trees level by level from the root finds the ranges in which
+// two replicas differ.
+func (c *Client) MerkleNodes(ctx context.Context, name string, level int, start int64, count int,
+) (*pb.MerkleNodesReply, error) {
+	reply, err := c.fileClient.MerkleNodes(
+		ctx,
+		&pb.MerkleNodesRequest{
+			Header: c.header, Name: name, Level: int32(level), Start: start, Count: int32(count),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	return reply, parseErr(reply.Error)
+}
+
+// Batch executes ops in order on the server and returns a result per
+// executed op. If atomic is set, the ops must all work on the same disk and
+// either all of them take effect or none does.
+func (c *Client) Batch(ctx context.Context, ops []*pb.Op, atomic bool) ([]*pb.OpResult, error) {
+	reply, err := c.fileClient.Batch(
+		ctx,
+		&pb.BatchRequest{Header: c.header, Ops: ops, Atomic: atomic},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	return reply.Results, parseErr(reply.Error)
+}
+
+// ReadV reads the given extents of the named file in one rpc and returns
+// the data of each extent, which is short for extents past the end of the
+// file. A negative length reads up to the end of the file.
+func (c *Client) ReadV(ctx context.Context, name string, extents []*pb.Extent) ([][]byte, error) {
+	reply, err := c.fileClient.ReadV(
+		ctx,
+		&pb.ReadVRequest{Header: c.header, Name: name, Extents: extents},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	return reply.Data, parseErr(reply.Error)
+}
+
+// WriteV writes the data of every vector to the named file at its offset
+// in one rpc. The vectors must not overlap.
+func (c *Client) WriteV(ctx context.Context, name string, vecs []*pb.IOVec) (int64, error) {
+	reply, err := c.fileClient.WriteV(
+		ctx,
+		&pb.WriteVRequest{Header: c.header, Name: name, Vecs: vecs},
+	)
+
+	if err != nil {
+		return 0, err
+	}
+	return reply.BytesWritten, parseErr(reply.Error)
+}
+
+// Lock takes a shared or exclusive lease on the named file for ttl, or a
+// server default if zero, and returns the ttl granted. The lease must be
+// renewed before it expires to be kept.
+func (c *Client) Lock(ctx context.Context, name string, exclusive bool, ttl time.Duration,
+) (time.Duration, error) {
+	reply, err := c.fileClient.Lock(
+		ctx,
+		&pb.LockRequest{Header: c.header, Name: name, Exclusive: exclusive, TtlMs: int64(ttl / time.Millisecond)},
+	)
+
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(reply.TtlMs) * time.Millisecond, parseErr(reply.Error)
+}
+
+// Unlock releases the lease of the client on the named file.
+func (c *Client) Unlock(ctx context.Context, name string) error {
+	reply, err := c.fileClient.Unlock(ctx, &pb.UnlockRequest{Header: c.header, Name: name})
+
+	if err != nil {
+		return err
+	}
+	return parseErr(reply.Error)
+}
+
+// RenewLease extends the lease of the client on the named file by ttl
+// from now, or a server default if zero, and returns the ttl granted.
+func (c *Client) RenewLease(ctx context.Context, name string, ttl time.Duration) (time.Duration, error) {
+	reply, err := c.fileClient.RenewLease(
+		ctx,
+		&pb.RenewLeaseRequest{Header: c.header, Name: name, TtlMs: int64(ttl / time.Millisecond)},
+	)
+
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(reply.TtlMs) * time.Millisecond, parseErr(reply.Error)
+}
+
+// WriteLeased writes data to the named file at offset only if the client
+// holds an exclusive lease on the file.
+func (c *Client) WriteLeased(ctx context.Context, name string, offset int64, data []byte) (int64, error) {
+	reply, err := c.fileClient.Write(
+		ctx,
+		&pb.WriteRequest{Header: c.header, Name: name, Offset: offset, Data: data, RequireLease: true},
+	)
+
+	if err != nil {
+		return 0, err
+	}
+	return reply.BytesWritten, parseErr(reply.Error)
+}
+
+// TruncateLeased changes the size of the named file only if the client
+// holds an exclusive lease on the file.
+func (c *Client) TruncateLeased(ctx context.Context, name string, size int64) error {
+	reply, err := c.fileClient.Truncate(
+		ctx,
+		&pb.TruncateRequest{Header: c.header, Name: name, Size: size, RequireLease: true},
+	)
+
+	if err != nil {
+		return err
+	}
+	return parseErr(reply.Error)
+}
+
+// RenameLeased renames oldName to newName only if the client holds
+// exclusive leases on both.
+func (c *Client) RenameLeased(ctx context.Context, oldName, newName string) error {
+	reply, err := c.fileClient.Rename(
+		ctx,
+		&pb.RenameRequest{Header: c.header, Oldname: oldName, Newname: newName, RequireLease: true},
+	)
+
+	if err != nil {
+		return err
+	}
+	return parseErr(reply.Error)
+}
+
+// RemoveLeased removes the named file only if the client holds an
+// exclusive lease on it.
+func (c *Client) RemoveLeased(ctx context.Context, name string, all bool) error {
+	reply, err := c.fileClient.Remove(
+		ctx,
+		&pb.RemoveRequest{Header: c.header, Name: name, All: all, RequireLease: true},
+	)
+
+	if err != nil {
+		return err
+	}
+	return parseErr(reply.Error)
+}
+
+// Watch streams the changes of the files under prefix, a disk name
+// optionally followed by a path. If afterSeq is not zero, the recent
+// events after it are replayed first. The stream ends when ctx is done.
+func (c *Client) Watch(ctx context.Context, prefix string, afterSeq uint64) (pb.Cfs_WatchClient, error) {
+	return c.fileClient.Watch(ctx, &pb.WatchRequest{Header: c.header, Prefix: prefix, AfterSeq: afterSeq})
+}
+
+// Walk calls fn for all the entries under the named directory, a
+// directory coming right before its entries, keeping the entries whose path
+// starts with prefix and whose name matches pattern if they are not empty.
+// The entries are named by their path relative to the directory. It stops
+// at the first error of fn.
+func (c *Client) Walk(ctx context.Context, name, prefix, pattern string, fn func(*pb.FileInfo) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.fileClient.Walk(ctx, &pb.WalkRequest{Header: c.header, Name: name, Prefix: prefix, Pattern: pattern})
+	if err != nil {
+		return err
+	}
+	for {
+		reply, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := parseErr(reply.Error); err != nil {
+			return err
+		}
+		for _, fi := range reply.FileInfos {
+			if err := fn(fi); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// DiskUsage returns the space used under the named directory, which may
+// be a disk name alone, and, down to depth levels, under each of its
+// subdirectories. The directory comes first.
+func (c *Client) DiskUsage(ctx context.Context, name string, depth int) ([]*pb.Usage, error) {
+	reply, err := c.fileClient.DiskUsage(ctx, &pb.DiskUsageRequest{Header: c.header, Name: name, Depth: int32(depth)})
+
+	if err != nil {
+		return nil, err
+	}
+	return reply.Usages, parseErr(reply.Error)
+}
+
+// ListTrash returns the entries of the trash of the named disk, oldest
+// first.
+func (c *Client) ListTrash(ctx context.Context, disk string) ([]*pb.TrashEntry, error) {
+	reply, err := c.fileClient.ListTrash(ctx, &pb.ListTrashRequest{Header: c.header, Disk: disk})
+
+	if err != nil {
+		return nil, err
+	}
+	return reply.Entries, parseErr(reply.Error)
+}
+
+// Undelete moves the entry id of the trash of the named disk back to the
+// name it had, or to name if it is not empty, and returns the name it was
+// restored to. It fails if the file exists.
+func (c *Client) Undelete(ctx context.Context, disk, id, name string) (string, error) {
+	reply, err := c.fileClient.Undelete(ctx, &pb.UndeleteRequest{Header: c.header, Disk: disk, Id: id, Name: name})
+
+	if err != nil {
+		return "", err
+	}
+	return reply.Name, parseErr(reply.Error)
+}
+
+// PurgeTrash deletes the entry id of the trash of the named disk for good
+// and returns how many entries were deleted.
+func (c *Client) PurgeTrash(ctx context.Context, disk, id string) (int, error) {
+	return c.purgeTrash(ctx, &pb.PurgeTrashRequest{Header: c.header, Disk: disk, Id: id})
+}
+
+// PurgeAllTrash deletes all the entries of the trash of the named disk for
+// good and returns how many were deleted.
+func (c *Client) PurgeAllTrash(ctx context.Context, disk string) (int, error) {
+	return c.purgeTrash(ctx, &pb.PurgeTrashRequest{Header: c.header, Disk: disk, All: true})
+}
+
+func (c *Client) purgeTrash(ctx context.Context, req *pb.PurgeTrashRequest) (int, error) {
+	reply, err := c.fileClient.PurgeTrash(ctx, req)
+
+	if err != nil {
+		return 0, err
+	}
+	return int(reply.Purged), parseErr(reply.Error)
+}
+
+// Snapshot takes a read-only copy of the named directory or file, which
+// may be a disk name alone, and returns the id of the snapshot on its disk.
+func (c *Client) Snapshot(ctx context.Context, name string) (string, error) {
+	reply, err := c.fileClient.Snapshot(ctx, &pb.SnapshotRequest{Header: c.header, Name: name})
+
+	if err != nil {
+		return "", err
+	}
+	return reply.Id, parseErr(reply.Error)
+}
+
+// ListSnapshots returns the snapshots of the named disk, oldest first.
+func (c *Client) ListSnapshots(ctx context.Context, disk string) ([]*pb.SnapshotInfo, error) {
+	reply, err := c.fileClient.ListSnapshots(ctx, &pb.ListSnapshotsRequest{Header: c.header, Disk: disk})
+
+	if err != nil {
+		return nil, err
+	}
+	return reply.Snapshots, parseErr(reply.Error)
+}
+
+func (c *Client) DeleteSnapshot(ctx context.Context, disk, id string) error {
+	reply, err := c.fileClient.DeleteSnapshot(ctx, &pb.DeleteSnapshotRequest{Header: c.header, Disk: disk, Id: id})
+
+	if err != nil {
+		return err
+	}
+	return parseErr(reply.Error)
+}
+
+// RestoreSnapshot copies the snapshot id of the named disk back to the name
+// it was taken of, or to name if it is not empty, and returns the name it
+// was restored to. The file there is replaced.
+func (c *Client) RestoreSnapshot(ctx context.Context, disk, id, name string) (string, error) {
+	reply, err := c.fileClient.RestoreSnapshot(ctx, &pb.RestoreSnapshotRequest{Header: c.header, Disk: disk, Id: id, Name: name})
+
+	if err != nil {
+		return "", err
+	}
+	return reply.Name, parseErr(reply.Error)
+}
+
+// Link makes newName a hard link to the regular file oldName on the same
+// disk.
+func (c *Client) Link(ctx context.Context, oldName, newName string) error {
+	reply, err := c.fileClient.Link(ctx, &pb.LinkRequest{Header: c.header, Oldname: oldName, Newname: newName})
+
+	if err != nil {
+		return err
+	}
+	return parseErr(reply.Error)
+}
+
+// Symlink makes name a symbolic link to target, a regular file on the same
+// disk.
+func (c *Client) Symlink(ctx context.Context, target, name string) error {
+	reply, err := c.fileClient.Symlink(ctx, &pb.SymlinkRequest{Header: c.header, Target: target, Name: name})
+
+	if err != nil {
+		return err
+	}
+	return parseErr(reply.Error)
+}
+
+// Clone copies the regular file src to dst on the same disk, sharing its
+// blocks where the disk supports it. dst must not exist.
+func (c *Client) Clone(ctx context.Context, src, dst string) error {
+	reply, err := c.fileClient.Clone(ctx, &pb.CloneRequest{Header: c.header, Src: src, Dst: dst})
+
+	if err != nil {
+		return err
+	}
+	return parseErr(reply.Error)
+}
+
 func (c *Client) ContainerInfo(ctx context.Context) (string, error) {
 	reply, err := c.statsClient.ContainerInfo(ctx, &pb.ContainerInfoRequest{})
 
@@ -132,5 +651,11 @@ func parseErr(pbErr *pb.Error) error {
 	if pbErr == nil {
 		return nil
 	}
+	if pbErr.PreconditionErr != nil {
+		return ErrPreconditionFailed
+	}
+	if pbErr.LeaseErr != nil {
+		return ErrLease
+	}
 	return errors.New(pbErr.String())
 }
@@ -0,0 +1,358 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	pb "github.com/c-fs/cfs/proto"
+	"golang.org/x/net/context"
+)
+
+// fileChunkSize is the most bytes a File reads or writes per rpc.
+const fileChunkSize = 1 << 20
+
+var (
+	errNotWritable = errors.New("file not open for writing")
+	errNotReadable = errors.New("file not open for reading")
+	errIsDir       = errors.New("is a directory")
+	errNotDir      = errors.New("not a directory")
+)
+
+// File is an open file or directory of a cfs disk, named by its full
+// name starting with the disk name. It implements io.ReaderAt,
+// io.WriterAt, io.Seeker and io.Closer, and fs.ReadDirFile for
+// directories. Its methods do their rpcs with the context it was opened
+// with. Data is not buffered, so closing a file sends nothing.
+type File struct {
+	c        *Client
+	ctx      context.Context
+	name     string
+	info     *pb.FileInfo
+	writable bool
+	// writeOnly files are not readable.
+	writeOnly bool
+
+	mu     sync.Mutex
+	offset int64
+	closed bool
+	// entries are the entries of a directory left to ReadDir, listed on
+	// the first call.
+	entries []fs.DirEntry
+	listed  bool
+}
+
+// Open opens the named file or directory for reading.
+func (c *Client) Open(ctx context.Context, name string) (*File, error) {
+	return c.OpenFile(ctx, name, os.O_RDONLY)
+}
+
+// Create creates the named file, or truncates it if it exists, and opens
+// it for reading and writing.
+func (c *Client) Create(ctx context.Context, name string) (*File, error) {
+	return c.OpenFile(ctx, name, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
+}
+
+// OpenFile opens the named file as os.OpenFile does with flag, which is
+// one of os.O_RDONLY, os.O_WRONLY and os.O_RDWR, along with os.O_CREATE or
+// os.O_TRUNC. os.O_CREATE creates the file if a stat finds it missing,
+// which is not atomic: WriteIf under a MustNotExist precondition creates a
+// file only if it is missing, and os.O_EXCL is not supported. Neither is
+// os.O_APPEND.
+func (c *Client) OpenFile(ctx context.Context, name string, flag int) (*File, error) {
+	const (
+		accessModes = os.O_RDONLY | os.O_WRONLY | os.O_RDWR
+		supported   = accessModes | os.O_CREATE | os.O_TRUNC
+	)
+	access := flag & accessModes
+	writable := access == os.O_WRONLY || access == os.O_RDWR
+	if flag&^supported != 0 || access == accessModes || (flag&os.O_TRUNC != 0 && !writable) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	fi, err := c.Stat(ctx, name)
+	switch {
+	case err == nil && fi.IsDir && writable:
+		return nil, &os.PathError{Op: "open", Path: name, Err: errIsDir}
+	case err == nil && flag&os.O_TRUNC != 0 && fi.Size != 0,
+		os.IsNotExist(err) && flag&os.O_CREATE != 0:
+		if err = c.Truncate(ctx, name, 0); err == nil {
+			fi, err = c.Stat(ctx, name)
+		}
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+	}
+	return &File{
+		c: c, ctx: ctx, name: name, info: fi, writable: writable,
+		writeOnly: access == os.O_WRONLY,
+	}, nil
+}
+
+// unwrapPathError returns the error a path error records.
+func unwrapPathError(err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
+
+// Name returns the name the file was opened with.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Stat returns the current file info of the file.
+func (f *File) Stat() (fs.FileInfo, error) {
+	if err := f.check("stat"); err != nil {
+		return nil, err
+	}
+	fi, err := f.c.Stat(f.ctx, f.name)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{fi}, nil
+}
+
+// ReadAt reads len(p) bytes at off. It returns io.EOF if the file ends
+// before.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+	return f.readAt(p, off)
+}
+
+func (f *File) readAt(p []byte, off int64) (int, error) {
+	if f.info.IsDir {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: errIsDir}
+	}
+	if f.writeOnly {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: errNotReadable}
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	read := 0
+	for read < len(p) {
+		want := len(p) - read
+		if want > fileChunkSize {
+			want = fileChunkSize
+		}
+		n, data, _, err := f.c.Read(f.ctx, f.name, off+int64(read), int64(want), 0)
+		if err != nil {
+			return read, &os.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		read += copy(p[read:], data[:n])
+		if int(n) < want {
+			return read, io.EOF
+		}
+	}
+	return read, nil
+}
+
+// Read reads up to len(p) bytes at the offset of the file and advances it.
+func (f *File) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := f.readAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// WriteAt writes p at off.
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.check("write"); err != nil {
+		return 0, err
+	}
+	return f.writeAt(p, off)
+}
+
+func (f *File) writeAt(p []byte, off int64) (int, error) {
+	if !f.writable {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: errNotWritable}
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: fs.ErrInvalid}
+	}
+	written := 0
+	for written < len(p) {
+		chunk := p[written:]
+		if len(chunk) > fileChunkSize {
+			chunk = chunk[:fileChunkSize]
+		}
+		n, err := f.c.Write(f.ctx, f.name, off+int64(written), chunk, false)
+		written += int(n)
+		if err == nil && int(n) < len(chunk) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			return written, &os.PathError{Op: "write", Path: f.name, Err: err}
+		}
+	}
+	return written, nil
+}
+
+// Write writes p at the offset of the file and advances it.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: fs.ErrClosed}
+	}
+	n, err := f.writeAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+// Seek sets the offset of the next Read or Write as in io.Seeker. Seeking
+// from the end asks the server for the size of the file.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("seek"); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		fi, err := f.c.Stat(f.ctx, f.name)
+		if err != nil {
+			return 0, err
+		}
+		offset += fi.Size
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Truncate changes the size of the file.
+func (f *File) Truncate(size int64) error {
+	if err := f.check("truncate"); err != nil {
+		return err
+	}
+	if !f.writable {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: errNotWritable}
+	}
+	return f.c.Truncate(f.ctx, f.name, size)
+}
+
+// ReadDir reads the entries of a directory as in fs.ReadDirFile: up to n
+// entries if n > 0, returning io.EOF after the last one, and all the
+// entries left otherwise.
+func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
+	if err := f.check("readdir"); err != nil {
+		return nil, err
+	}
+	if !f.info.IsDir {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.listed {
+		infos, err := f.c.ReadDir(f.ctx, f.name)
+		if err != nil {
+			return nil, &os.PathError{Op: "readdir", Path: f.name, Err: err}
+		}
+		f.entries = dirEntries(infos)
+		f.listed = true
+	}
+	if n <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(f.entries) {
+		n = len(f.entries)
+	}
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+// Close closes the file. Later calls fail.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+// check returns an error for op if the file is closed.
+func (f *File) check(op string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return &os.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	return nil
+}
+
+// fileInfo is a cfs file info as an fs.FileInfo.
+type fileInfo struct {
+	fi *pb.FileInfo
+}
+
+// Name returns the base name of the file.
+func (i fileInfo) Name() string { return path.Base(i.fi.Name) }
+
+func (i fileInfo) Size() int64 { return i.fi.Size }
+
+func (i fileInfo) Mode() fs.FileMode {
+	switch {
+	case i.fi.IsDir:
+		return fs.ModeDir | 0755
+	case i.fi.Symlink != "":
+		return fs.ModeSymlink | 0777
+	}
+	return 0644
+}
+
+func (i fileInfo) ModTime() time.Time { return time.Unix(0, i.fi.ModTime) }
+
+func (i fileInfo) IsDir() bool { return i.fi.IsDir }
+
+// Sys returns the *pb.FileInfo.
+func (i fileInfo) Sys() interface{} { return i.fi }
+
+// dirEntry is a cfs file info as an fs.DirEntry.
+type dirEntry struct {
+	fileInfo
+}
+
+func (e dirEntry) Type() fs.FileMode { return e.Mode().Type() }
+
+func (e dirEntry) Info() (fs.FileInfo, error) { return e.fileInfo, nil }
+
+func dirEntries(infos []*pb.FileInfo) []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(infos))
+	for i, fi := range infos {
+		entries[i] = dirEntry{fileInfo{fi}}
+	}
+	return entries
+}
@@ -0,0 +1,303 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	pb "github.com/c-fs/cfs/proto"
+	"golang.org/x/net/context"
+)
+
+// memServer serves the files and directories of a disk held in memory,
+// keyed by their full names. The rpcs a File makes are implemented.
+type memServer struct {
+	pb.CfsServer
+	mu    sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+// newMemServer returns a memServer of a disk named disk0 holding files,
+// along with their directories.
+func newMemServer(files map[string]string) *memServer {
+	s := &memServer{files: make(map[string][]byte), dirs: map[string]bool{"disk0": true}}
+	for name, data := range files {
+		s.files[name] = []byte(data)
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			s.dirs[dir] = true
+		}
+	}
+	return s
+}
+
+func (s *memServer) info(name string) *pb.FileInfo {
+	if s.dirs[name] {
+		return &pb.FileInfo{Name: path.Base(name), IsDir: true, ModTime: 1}
+	}
+	if data, ok := s.files[name]; ok {
+		return &pb.FileInfo{Name: path.Base(name), Size: int64(len(data)), ModTime: 1}
+	}
+	return nil
+}
+
+func (s *memServer) Stat(ctx context.Context, req *pb.StatRequest) (*pb.StatReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &pb.StatReply{Info: s.info(req.Name)}, nil
+}
+
+func (s *memServer) Read(ctx context.Context, req *pb.ReadRequest) (*pb.ReadReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[req.Name]
+	if !ok {
+		return &pb.ReadReply{Error: &pb.Error{}}, nil
+	}
+	if req.Offset >= int64(len(data)) {
+		return &pb.ReadReply{}, nil
+	}
+	data = data[req.Offset:]
+	if int64(len(data)) > req.Length {
+		data = data[:req.Length]
+	}
+	return &pb.ReadReply{BytesRead: int64(len(data)), Data: append([]byte(nil), data...)}, nil
+}
+
+func (s *memServer) Write(ctx context.Context, req *pb.WriteRequest) (*pb.WriteReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := s.files[req.Name]
+	if end := req.Offset + int64(len(req.Data)); end > int64(len(data)) {
+		data = append(data, make([]byte, end-int64(len(data)))...)
+	}
+	copy(data[req.Offset:], req.Data)
+	s.files[req.Name] = data
+	return &pb.WriteReply{BytesWritten: int64(len(req.Data))}, nil
+}
+
+func (s *memServer) Truncate(ctx context.Context, req *pb.TruncateRequest) (*pb.TruncateReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := s.files[req.Name]
+	if req.Size <= int64(len(data)) {
+		data = data[:req.Size]
+	} else {
+		data = append(data, make([]byte, req.Size-int64(len(data)))...)
+	}
+	s.files[req.Name] = data
+	return &pb.TruncateReply{}, nil
+}
+
+func (s *memServer) ReadDir(ctx context.Context, req *pb.ReadDirRequest) (*pb.ReadDirReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.files {
+		if path.Dir(name) == req.Name {
+			names = append(names, name)
+		}
+	}
+	for name := range s.dirs {
+		if path.Dir(name) == req.Name {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	reply := &pb.ReadDirReply{}
+	for _, name := range names {
+		reply.FileInfos = append(reply.FileInfos, s.info(name))
+	}
+	return reply, nil
+}
+
+// newMemClient returns a Client of s, and a function closing it.
+func newMemClient(t *testing.T, s *memServer) (*Client, func()) {
+	addr, stop := serve(t, s)
+	c, err := New(1, addr)
+	if err != nil {
+		stop()
+		t.Fatalf("error = %v", err)
+	}
+	return c, func() {
+		c.Close()
+		stop()
+	}
+}
+
+func TestFS(t *testing.T) {
+	c, cleanup := newMemClient(t, newMemServer(map[string]string{
+		"disk0/a":       "hello",
+		"disk0/empty":   "",
+		"disk0/dir/b":   "world",
+		"disk0/dir/c/d": strings.Repeat("long ", 1000),
+	}))
+	defer cleanup()
+
+	fsys := c.FS(context.Background(), "disk0")
+	if err := fstest.TestFS(fsys, "a", "empty", "dir/b", "dir/c/d"); err != nil {
+		t.Error(err)
+	}
+	if _, err := fsys.Open("missing"); !os.IsNotExist(err) {
+		t.Errorf("open of a missing file error = %v, want not exist", err)
+	}
+	if _, err := fsys.Open("../a"); err == nil {
+		t.Errorf("open of an invalid name succeeded")
+	}
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	c, cleanup := newMemClient(t, newMemServer(nil))
+	defer cleanup()
+	ctx := context.Background()
+
+	// more than a chunk, so that reads and writes take several rpcs
+	data := make([]byte, 2*fileChunkSize+100)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	f, err := c.Create(ctx, "disk0/a")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if n, err := io.Copy(f, bytes.NewReader(data)); err != nil || n != int64(len(data)) {
+		t.Fatalf("io.Copy to the file = %d, %v, want %d", n, err, len(data))
+	}
+
+	if off, err := f.Seek(0, io.SeekStart); err != nil || off != 0 {
+		t.Fatalf("Seek = %d, %v, want 0", off, err)
+	}
+	var buf bytes.Buffer
+	if n, err := io.Copy(&buf, f); err != nil || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("io.Copy from the file = %d, %v, want the %d bytes written", n, err, len(data))
+	}
+
+	tests := []struct {
+		offset int64
+		whence int
+		want   int64
+	}{
+		{10, io.SeekStart, 10},
+		// past the 2 bytes read
+		{5, io.SeekCurrent, 17},
+		{-3, io.SeekEnd, int64(len(data)) - 3},
+	}
+	for _, tt := range tests {
+		off, err := f.Seek(tt.offset, tt.whence)
+		if err != nil || off != tt.want {
+			t.Errorf("Seek(%d, %d) = %d, %v, want %d", tt.offset, tt.whence, off, err, tt.want)
+			continue
+		}
+		p := make([]byte, 2)
+		if n, err := f.Read(p); err != nil || !bytes.Equal(p[:n], data[off:off+2]) {
+			t.Errorf("Read after Seek(%d, %d) = %q, %v, want %q", tt.offset, tt.whence, p[:n], err, data[off:off+2])
+		}
+	}
+	if _, err := f.Seek(-1, io.SeekStart); err == nil {
+		t.Errorf("Seek to a negative offset succeeded")
+	}
+
+	// WriteAt across a chunk boundary, then ReadAt of the same range
+	patch := []byte("patched")
+	off := int64(fileChunkSize - 3)
+	if n, err := f.WriteAt(patch, off); err != nil || n != len(patch) {
+		t.Fatalf("WriteAt = %d, %v, want %d", n, err, len(patch))
+	}
+	copy(data[off:], patch)
+	p := make([]byte, 20)
+	if n, err := f.ReadAt(p, off-5); err != nil || !bytes.Equal(p[:n], data[off-5:off+15]) {
+		t.Errorf("ReadAt = %q, %v, want %q", p[:n], err, data[off-5:off+15])
+	}
+	// reading past the end returns what is left and io.EOF
+	if n, err := f.ReadAt(p, int64(len(data))-4); err != io.EOF || !bytes.Equal(p[:n], data[len(data)-4:]) {
+		t.Errorf("ReadAt at the end = %q, %v, want %q, EOF", p[:n], err, data[len(data)-4:])
+	}
+
+	if err := f.Close(); err != nil {
+		t.Errorf("Close error = %v", err)
+	}
+	if _, err := f.Read(p); err == nil {
+		t.Errorf("Read of a closed file succeeded")
+	}
+
+	f, err = c.Open(ctx, "disk0/a")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	defer f.Close()
+	got, err := ioutil.ReadAll(f)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("ReadAll of the reopened file = %d bytes, %v, want %d", len(got), err, len(data))
+	}
+	if _, err := f.WriteAt(patch, 0); err == nil {
+		t.Errorf("WriteAt of a file opened for reading succeeded")
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	s := newMemServer(map[string]string{"disk0/a": "hello", "disk0/dir/b": "b"})
+	c, cleanup := newMemClient(t, s)
+	defer cleanup()
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		flag int
+		ok   bool
+		// data is what the file holds after a write of "HE" at offset 0
+		data     string
+		readable bool
+	}{
+		{"disk0/a", os.O_RDONLY, true, "hello", true},
+		{"disk0/a", os.O_RDWR, true, "HEllo", true},
+		{"disk0/a", os.O_WRONLY, true, "HEllo", false},
+		{"disk0/a", os.O_WRONLY | os.O_TRUNC, true, "HE", false},
+		{"disk0/a", os.O_RDWR | os.O_CREATE, true, "HEllo", true},
+		{"disk0/new", os.O_RDWR | os.O_CREATE, true, "HE", true},
+		{"disk0/missing", os.O_RDWR, false, "", false},
+		{"disk0/dir", os.O_RDONLY, true, "", false},
+		{"disk0/dir", os.O_RDWR, false, "", false},
+		{"disk0/a", os.O_RDONLY | os.O_TRUNC, false, "", false},
+		{"disk0/a", os.O_RDWR | os.O_APPEND, false, "", false},
+		{"disk0/a", os.O_RDWR | os.O_CREATE | os.O_EXCL, false, "", false},
+	}
+	for _, tt := range tests {
+		s.mu.Lock()
+		s.files["disk0/a"] = []byte("hello")
+		delete(s.files, "disk0/new")
+		s.mu.Unlock()
+
+		f, err := c.OpenFile(ctx, tt.name, tt.flag)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("OpenFile(%s, %#x) succeeded", tt.name, tt.flag)
+				f.Close()
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("OpenFile(%s, %#x) error = %v", tt.name, tt.flag, err)
+			continue
+		}
+		if tt.data != "" {
+			f.WriteAt([]byte("HE"), 0)
+			s.mu.Lock()
+			data := string(s.files[tt.name])
+			s.mu.Unlock()
+			if data != tt.data {
+				t.Errorf("OpenFile(%s, %#x): data = %q, want %q", tt.name, tt.flag, data, tt.data)
+			}
+		}
+		if _, err = f.ReadAt(make([]byte, 1), 0); (err == nil) != tt.readable {
+			t.Errorf("OpenFile(%s, %#x): ReadAt error = %v, want readable %v", tt.name, tt.flag, err, tt.readable)
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"io/fs"
+	"os"
+
+	"golang.org/x/net/context"
+)
+
+// FS is a cfs disk as a read-only fs.FS, so that the helpers of io/fs
+// such as fs.WalkDir and fs.ReadFile work on it. Names are slash
+// separated paths relative to the root of the disk, as io/fs requires.
+// It also implements fs.ReadDirFS and fs.StatFS.
+type FS struct {
+	c    *Client
+	ctx  context.Context
+	disk string
+}
+
+// FS returns the named disk as an fs.FS whose rpcs use ctx.
+func (c *Client) FS(ctx context.Context, disk string) *FS {
+	return &FS{c: c, ctx: ctx, disk: disk}
+}
+
+// fullName returns the cfs name of the file of the disk with the io/fs
+// name name, checking that name is valid.
+func (fsys *FS) fullName(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &os.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return fsys.disk, nil
+	}
+	return fsys.disk + "/" + name, nil
+}
+
+func (fsys *FS) Open(name string) (fs.File, error) {
+	full, err := fsys.fullName("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fsys.c.Open(fsys.ctx, full)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+	}
+	return f, nil
+}
+
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	full, err := fsys.fullName("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := fsys.c.Stat(fsys.ctx, full)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: unwrapPathError(err)}
+	}
+	return fileInfo{fi}, nil
+}
+
+// ReadDir returns the entries of the named directory sorted by name.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	full, err := fsys.fullName("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	// listing a missing directory is not an error for the server
+	fi, err := fsys.c.Stat(fsys.ctx, full)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: unwrapPathError(err)}
+	}
+	if !fi.IsDir {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	infos, err := fsys.c.ReadDir(fsys.ctx, full)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return dirEntries(infos), nil
+}
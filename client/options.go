@@ -0,0 +1,45 @@
+package client
+
+import (
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Options configure the connection and the rpcs of a Client. The zero
+// Options connect in the background and make every rpc once without a
+// deadline, as New does.
+type Options struct {
+	// DialTimeout makes dialing wait for the connection to the node, for
+	// up to the timeout. Zero connects in the background.
+	DialTimeout time.Duration
+	// CallTimeout is the deadline of each rpc, streams aside. Zero
+	// leaves the deadline to the context of the call.
+	CallTimeout time.Duration
+	// Retries is the number of times a read, or a change made under a
+	// precondition, is retried after a transient failure.
+	Retries int
+	// Backoff is the delay before the first retry, doubled for every next
+	// retry up to MaxBackoff. They default to 50ms and 2s.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// KeepAlive is the period of the TCP keepalives of the connection,
+	// which find nodes gone without closing it. Zero disables them.
+	KeepAlive time.Duration
+}
+
+// dialOptions returns the grpc options dialing a node with o.
+func (o Options) dialOptions() []grpc.DialOption {
+	var opts []grpc.DialOption
+	if o.DialTimeout > 0 {
+		opts = append(opts, grpc.WithBlock(), grpc.WithTimeout(o.DialTimeout))
+	}
+	if o.KeepAlive > 0 {
+		opts = append(opts, grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			d := &net.Dialer{Timeout: timeout, KeepAlive: o.KeepAlive}
+			return d.Dial("tcp", addr)
+		}))
+	}
+	return opts
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"errors"
+	"sync"
+)
+
+// Pool holds a Client per node, dialed on first use with the same client
+// ID and options, so that the connections to a set of nodes are shared.
+type Pool struct {
+	clientID int64
+	opts     Options
+
+	mu      sync.Mutex
+	clients map[string]*Client
+}
+
+func NewPool(clientID int64, opts Options) *Pool {
+	return &Pool{clientID: clientID, opts: opts, clients: make(map[string]*Client)}
+}
+
+// Get returns the Client of the node at address. It must not be closed
+// but through the pool.
+func (p *Pool) Get(address string) (*Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.clients[address]; ok {
+		return c, nil
+	}
+	c, err := NewWithOptions(p.clientID, address, p.opts)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[address] = c
+	return c, nil
+}
+
+// errNoAddress is returned by Do given no address.
+var errNoAddress = errors.New("cfs: no address")
+
+// Do calls f with the Client of each node at addresses in turn, until f
+// succeeds or fails with an error that is not transient, and returns the
+// error of the last call. Nodes that cannot be dialed are skipped. It
+// fails over from a node that is down to the others holding the same data.
+func (p *Pool) Do(addresses []string, f func(c *Client) error) error {
+	err := errNoAddress
+	for _, address := range addresses {
+		var c *Client
+		if c, err = p.Get(address); err != nil {
+			continue
+		}
+		if err = f(c); err == nil || !transient(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// Close closes the Clients of the pool.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for address, c := range p.clients {
+		c.Close()
+		delete(p.clients, address)
+	}
+}
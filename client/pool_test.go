@@ -0,0 +1,78 @@
+package client
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestPoolDo(t *testing.T) {
+	up := &flakyServer{data: []byte("up")}
+	upAddr, stop := serve(t, up)
+	defer stop()
+	denied := &flakyServer{fails: 1 << 20, code: codes.PermissionDenied}
+	deniedAddr, stopDenied := serve(t, denied)
+	defer stopDenied()
+	// nothing listens at downAddr
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	downAddr := lis.Addr().String()
+	lis.Close()
+
+	p := NewPool(1, Options{CallTimeout: 200 * time.Millisecond})
+	defer p.Close()
+
+	tests := []struct {
+		addresses []string
+		// err is the error wanted: none, transient or denied
+		err string
+		// calls is the number of rpcs made to the node up
+		calls int
+	}{
+		{[]string{upAddr}, "none", 1},
+		{[]string{downAddr, upAddr}, "none", 1},
+		{[]string{upAddr, downAddr}, "none", 1},
+		{[]string{downAddr}, "transient", 0},
+		// a node refusing the rpc is not failed over from
+		{[]string{deniedAddr, upAddr}, "denied", 0},
+	}
+	for _, tt := range tests {
+		before, _ := up.stats()
+		var data []byte
+		err := p.Do(tt.addresses, func(c *Client) error {
+			var err error
+			_, data, _, err = c.Read(context.Background(), "disk0/a", 0, 2, 0)
+			return err
+		})
+		switch {
+		case tt.err == "none" && err != nil:
+			t.Errorf("%v: error = %v", tt.addresses, err)
+		case tt.err == "none" && string(data) != "up":
+			t.Errorf("%v: data = %q, want %q", tt.addresses, data, "up")
+		case tt.err == "transient" && !transient(err):
+			t.Errorf("%v: error = %v, want a transient error", tt.addresses, err)
+		case tt.err == "denied" && grpc.Code(err) != codes.PermissionDenied:
+			t.Errorf("%v: error = %v, want permission denied", tt.addresses, err)
+		}
+		if after, _ := up.stats(); after-before != tt.calls {
+			t.Errorf("%v: %d calls to the node up, want %d", tt.addresses, after-before, tt.calls)
+		}
+	}
+
+	if err := p.Do(nil, func(c *Client) error { return nil }); err != errNoAddress {
+		t.Errorf("no address: error = %v, want %v", err, errNoAddress)
+	}
+	c1, err := p.Get(upAddr)
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if c2, _ := p.Get(upAddr); c1 != c2 {
+		t.Errorf("Get returned two clients of the same node")
+	}
+}
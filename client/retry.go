@@ -0,0 +1,385 @@
+package client
+
+import (
+	"math/rand"
+	"time"
+
+	pb "github.com/c-fs/cfs/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// The defaults of the backoff between retries.
+const (
+	defaultBackoff    = 50 * time.Millisecond
+	defaultMaxBackoff = 2 * time.Second
+)
+
+// caller makes the rpcs of a Client with the deadline and the retries of
+// its options.
+type caller struct {
+	opts Options
+}
+
+// call calls rpc with the call timeout of the options. If idempotent, rpc
+// is retried after transient failures, such as the node restarting, until
+// it succeeds, the retries are used up or ctx is done.
+func (c *caller) call(ctx context.Context, idempotent bool, rpc func(ctx context.Context) error) error {
+	backoff := c.opts.Backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	maxBackoff := c.opts.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	for retry := 0; ; retry++ {
+		err := c.once(ctx, rpc)
+		if err == nil || !idempotent || retry >= c.opts.Retries || !transient(err) || ctx.Err() != nil {
+			return err
+		}
+		// half of the backoff is random, so that clients failing together
+		// do not retry together
+		select {
+		case <-time.After(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))):
+		case <-ctx.Done():
+			return err
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// once calls rpc once with the call timeout.
+func (c *caller) once(ctx context.Context, rpc func(ctx context.Context) error) error {
+	if c.opts.CallTimeout <= 0 {
+		return rpc(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.opts.CallTimeout)
+	defer cancel()
+	return rpc(ctx)
+}
+
+// transient reports whether err may go away if the rpc is retried.
+func transient(err error) bool {
+	switch grpc.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// guarded reports whether a change made under p fails rather than apply
+// twice when retried. An empty precondition does not guard anything.
+func guarded(p *pb.Precondition) bool {
+	return p != nil && (p.MustNotExist || p.CheckSize || p.Generation != 0 || p.CheckChecksum)
+}
+
+// cfsClient, metadataClient and statsClient make the rpcs of the services
+// through a caller. Reads are retried, and so are changes guarded by a
+// precondition, as they fail rather than apply twice. Streams are made
+// once without a call timeout.
+type cfsClient struct {
+	pb.CfsClient
+	*caller
+}
+
+type metadataClient struct {
+	pb.MetadataClient
+	*caller
+}
+
+type statsClient struct {
+	pb.StatsClient
+	*caller
+}
+
+func (c *cfsClient) Write(ctx context.Context, in *pb.WriteRequest, opts ...grpc.CallOption,
+) (reply *pb.WriteReply, err error) {
+	err = c.call(ctx, guarded(in.Precondition), func(ctx context.Context) error {
+		reply, err = c.CfsClient.Write(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Read(ctx context.Context, in *pb.ReadRequest, opts ...grpc.CallOption,
+) (reply *pb.ReadReply, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Read(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Rename(ctx context.Context, in *pb.RenameRequest, opts ...grpc.CallOption,
+) (reply *pb.RenameReply, err error) {
+	err = c.call(ctx, guarded(in.Precondition), func(ctx context.Context) error {
+		reply, err = c.CfsClient.Rename(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Remove(ctx context.Context, in *pb.RemoveRequest, opts ...grpc.CallOption,
+) (reply *pb.RemoveReply, err error) {
+	err = c.call(ctx, guarded(in.Precondition), func(ctx context.Context) error {
+		reply, err = c.CfsClient.Remove(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) ReadDir(ctx context.Context, in *pb.ReadDirRequest, opts ...grpc.CallOption,
+) (reply *pb.ReadDirReply, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		reply, err = c.CfsClient.ReadDir(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Mkdir(ctx context.Context, in *pb.MkdirRequest, opts ...grpc.CallOption,
+) (reply *pb.MkdirReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Mkdir(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Extents(ctx context.Context, in *pb.ExtentsRequest, opts ...grpc.CallOption,
+) (reply *pb.ExtentsReply, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Extents(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Checksum(ctx context.Context, in *pb.ChecksumRequest, opts ...grpc.CallOption,
+) (reply *pb.ChecksumReply, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Checksum(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) MerkleNodes(ctx context.Context, in *pb.MerkleNodesRequest, opts ...grpc.CallOption,
+) (reply *pb.MerkleNodesReply, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		reply, err = c.CfsClient.MerkleNodes(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Batch(ctx context.Context, in *pb.BatchRequest, opts ...grpc.CallOption,
+) (reply *pb.BatchReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Batch(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) ReadV(ctx context.Context, in *pb.ReadVRequest, opts ...grpc.CallOption,
+) (reply *pb.ReadVReply, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		reply, err = c.CfsClient.ReadV(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) WriteV(ctx context.Context, in *pb.WriteVRequest, opts ...grpc.CallOption,
+) (reply *pb.WriteVReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.WriteV(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Lock(ctx context.Context, in *pb.LockRequest, opts ...grpc.CallOption,
+) (reply *pb.LockReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Lock(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Unlock(ctx context.Context, in *pb.UnlockRequest, opts ...grpc.CallOption,
+) (reply *pb.UnlockReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Unlock(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) RenewLease(ctx context.Context, in *pb.RenewLeaseRequest, opts ...grpc.CallOption,
+) (reply *pb.RenewLeaseReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.RenewLease(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) DiskUsage(ctx context.Context, in *pb.DiskUsageRequest, opts ...grpc.CallOption,
+) (reply *pb.DiskUsageReply, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		reply, err = c.CfsClient.DiskUsage(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) ListTrash(ctx context.Context, in *pb.ListTrashRequest, opts ...grpc.CallOption,
+) (reply *pb.ListTrashReply, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		reply, err = c.CfsClient.ListTrash(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Undelete(ctx context.Context, in *pb.UndeleteRequest, opts ...grpc.CallOption,
+) (reply *pb.UndeleteReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Undelete(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) PurgeTrash(ctx context.Context, in *pb.PurgeTrashRequest, opts ...grpc.CallOption,
+) (reply *pb.PurgeTrashReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.PurgeTrash(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Snapshot(ctx context.Context, in *pb.SnapshotRequest, opts ...grpc.CallOption,
+) (reply *pb.SnapshotReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Snapshot(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) ListSnapshots(ctx context.Context, in *pb.ListSnapshotsRequest, opts ...grpc.CallOption,
+) (reply *pb.ListSnapshotsReply, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		reply, err = c.CfsClient.ListSnapshots(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) DeleteSnapshot(ctx context.Context, in *pb.DeleteSnapshotRequest, opts ...grpc.CallOption,
+) (reply *pb.DeleteSnapshotReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.DeleteSnapshot(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) RestoreSnapshot(ctx context.Context, in *pb.RestoreSnapshotRequest, opts ...grpc.CallOption,
+) (reply *pb.RestoreSnapshotReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.RestoreSnapshot(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Link(ctx context.Context, in *pb.LinkRequest, opts ...grpc.CallOption,
+) (reply *pb.LinkReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Link(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Symlink(ctx context.Context, in *pb.SymlinkRequest, opts ...grpc.CallOption,
+) (reply *pb.SymlinkReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Symlink(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Clone(ctx context.Context, in *pb.CloneRequest, opts ...grpc.CallOption,
+) (reply *pb.CloneReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Clone(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Stat(ctx context.Context, in *pb.StatRequest, opts ...grpc.CallOption,
+) (reply *pb.StatReply, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Stat(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *cfsClient) Truncate(ctx context.Context, in *pb.TruncateRequest, opts ...grpc.CallOption,
+) (reply *pb.TruncateReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.CfsClient.Truncate(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *metadataClient) Disks(ctx context.Context, in *pb.DisksRequest, opts ...grpc.CallOption,
+) (reply *pb.DisksReply, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		reply, err = c.MetadataClient.Disks(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *metadataClient) RotateKeys(ctx context.Context, in *pb.RotateKeysRequest, opts ...grpc.CallOption,
+) (reply *pb.RotateKeysReply, err error) {
+	err = c.call(ctx, false, func(ctx context.Context) error {
+		reply, err = c.MetadataClient.RotateKeys(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *statsClient) ContainerInfo(ctx context.Context, in *pb.ContainerInfoRequest, opts ...grpc.CallOption,
+) (reply *pb.ContainerInfoReply, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		reply, err = c.StatsClient.ContainerInfo(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
+
+func (c *statsClient) Metrics(ctx context.Context, in *pb.MetricsRequest, opts ...grpc.CallOption,
+) (reply *pb.MetricsReply, err error) {
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		reply, err = c.StatsClient.Metrics(ctx, in, opts...)
+		return err
+	})
+	return reply, err
+}
@@ -0,0 +1,259 @@
+package client
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/c-fs/cfs/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// flakyServer serves reads and writes of a single file held in memory. Its
+// first fails rpcs fail with code, Unavailable by default, as those of a
+// node restarting do. The other rpcs are not implemented.
+type flakyServer struct {
+	pb.CfsServer
+	mu    sync.Mutex
+	fails int
+	code  codes.Code
+	// delay is how long every rpc takes.
+	delay time.Duration
+	calls int
+	// timeouts are the time left to the deadline of every rpc, zero for
+	// no deadline.
+	timeouts []time.Duration
+	data     []byte
+}
+
+// begin records an rpc, and returns its error if it fails.
+func (s *flakyServer) begin(ctx context.Context) error {
+	s.mu.Lock()
+	s.calls++
+	var timeout time.Duration
+	if d, ok := ctx.Deadline(); ok {
+		timeout = d.Sub(time.Now())
+	}
+	s.timeouts = append(s.timeouts, timeout)
+	fail := s.fails > 0
+	if fail {
+		s.fails--
+	}
+	code, delay := s.code, s.delay
+	s.mu.Unlock()
+	if fail {
+		if code == codes.OK {
+			code = codes.Unavailable
+		}
+		return grpc.Errorf(code, "failing")
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *flakyServer) Read(ctx context.Context, req *pb.ReadRequest) (*pb.ReadReply, error) {
+	if err := s.begin(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := append([]byte(nil), s.data...)
+	return &pb.ReadReply{BytesRead: int64(len(data)), Data: data}, nil
+}
+
+func (s *flakyServer) Write(ctx context.Context, req *pb.WriteRequest) (*pb.WriteReply, error) {
+	if err := s.begin(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = append([]byte(nil), req.Data...)
+	return &pb.WriteReply{BytesWritten: int64(len(req.Data))}, nil
+}
+
+func (s *flakyServer) stats() (int, []time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls, append([]time.Duration(nil), s.timeouts...)
+}
+
+// serve serves s on a local port, and returns its address and a function
+// stopping it.
+func serve(t *testing.T, s pb.CfsServer) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	gs := grpc.NewServer()
+	pb.RegisterCfsServer(gs, s)
+	go gs.Serve(lis)
+	return lis.Addr().String(), gs.Stop
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      string // read, write or writeIf
+		fails   int
+		retries int
+		ok      bool
+		calls   int
+	}{
+		{"read recovers", "read", 2, 3, true, 3},
+		{"read gives up", "read", 5, 2, false, 3},
+		{"read without retries", "read", 1, 0, false, 1},
+		{"write is not retried", "write", 1, 3, false, 1},
+		{"write under a precondition is retried", "writeIf", 1, 3, true, 2},
+	}
+	for _, tt := range tests {
+		s := &flakyServer{fails: tt.fails, data: []byte("data")}
+		addr, stop := serve(t, s)
+		c, err := NewWithOptions(1, addr, Options{Retries: tt.retries, Backoff: time.Millisecond})
+		if err != nil {
+			stop()
+			t.Fatalf("%s: error = %v", tt.name, err)
+		}
+		ctx := context.Background()
+		switch tt.op {
+		case "read":
+			_, _, _, err = c.Read(ctx, "disk0/a", 0, 4, 0)
+		case "write":
+			_, err = c.Write(ctx, "disk0/a", 0, []byte("new"), false)
+		case "writeIf":
+			_, _, err = c.WriteIf(ctx, "disk0/a", 0, []byte("new"), &pb.Precondition{CheckSize: true, Size: 4})
+		}
+		if tt.ok && err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+		}
+		if !tt.ok && grpc.Code(err) != codes.Unavailable {
+			t.Errorf("%s: error = %v, want unavailable", tt.name, err)
+		}
+		if calls, _ := s.stats(); calls != tt.calls {
+			t.Errorf("%s: %d calls, want %d", tt.name, calls, tt.calls)
+		}
+		c.Close()
+		stop()
+	}
+}
+
+func TestGuarded(t *testing.T) {
+	tests := []struct {
+		p       *pb.Precondition
+		guarded bool
+	}{
+		{nil, false},
+		{&pb.Precondition{}, false},
+		{&pb.Precondition{Size: 4}, false},
+		{&pb.Precondition{MustNotExist: true}, true},
+		{&pb.Precondition{CheckSize: true}, true},
+		{&pb.Precondition{Generation: 7}, true},
+		{&pb.Precondition{CheckChecksum: true}, true},
+	}
+	for _, tt := range tests {
+		if g := guarded(tt.p); g != tt.guarded {
+			t.Errorf("guarded(%v) = %v, want %v", tt.p, g, tt.guarded)
+		}
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	const callTimeout = 50 * time.Millisecond
+	tests := []struct {
+		name        string
+		callTimeout time.Duration
+		delay       time.Duration
+		ok          bool
+		calls       int
+	}{
+		{"no timeout", 0, 0, true, 1},
+		{"in time", callTimeout, 0, true, 1},
+		// every attempt gets its own deadline
+		{"too slow", callTimeout, time.Second, false, 2},
+	}
+	for _, tt := range tests {
+		s := &flakyServer{delay: tt.delay}
+		addr, stop := serve(t, s)
+		c, err := NewWithOptions(1, addr, Options{CallTimeout: tt.callTimeout, Retries: 1, Backoff: time.Millisecond})
+		if err != nil {
+			stop()
+			t.Fatalf("%s: error = %v", tt.name, err)
+		}
+		start := time.Now()
+		_, _, _, err = c.Read(context.Background(), "disk0/a", 0, 4, 0)
+		elapsed := time.Since(start)
+		if tt.ok && err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+		}
+		if !tt.ok && grpc.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("%s: error = %v, want deadline exceeded", tt.name, err)
+		}
+		if !tt.ok && elapsed > tt.delay/2 {
+			t.Errorf("%s: took %v, want about %v", tt.name, elapsed, time.Duration(tt.calls)*tt.callTimeout)
+		}
+		calls, timeouts := s.stats()
+		if calls != tt.calls {
+			t.Errorf("%s: %d calls, want %d", tt.name, calls, tt.calls)
+		}
+		for i, timeout := range timeouts {
+			if timeout < 0 || timeout > tt.callTimeout || (tt.callTimeout > 0 && timeout == 0) {
+				t.Errorf("%s: call #%d has %v left to its deadline, want up to %v", tt.name, i, timeout, tt.callTimeout)
+			}
+		}
+		c.Close()
+		stop()
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	const (
+		backoff    = 2 * time.Millisecond
+		maxBackoff = 8 * time.Millisecond
+		retries    = 8
+	)
+	c := &caller{opts: Options{Retries: retries, Backoff: backoff, MaxBackoff: maxBackoff}}
+	var times []time.Time
+	err := c.call(context.Background(), true, func(ctx context.Context) error {
+		times = append(times, time.Now())
+		return grpc.Errorf(codes.Unavailable, "down")
+	})
+	if grpc.Code(err) != codes.Unavailable {
+		t.Errorf("error = %v, want unavailable", err)
+	}
+	if len(times) != retries+1 {
+		t.Fatalf("%d calls, want %d", len(times), retries+1)
+	}
+	// Every backoff is at least half its nominal delay, which doubles up
+	// to maxBackoff. Unbounded, the last ones would last over 100ms.
+	b := backoff
+	for i := 1; i < len(times); i++ {
+		gap := times[i].Sub(times[i-1])
+		if gap < b/2 || gap > maxBackoff+40*time.Millisecond {
+			t.Errorf("backoff #%d = %v, want between %v and about %v", i, gap, b/2, b)
+		}
+		if b *= 2; b > maxBackoff {
+			b = maxBackoff
+		}
+	}
+
+	// the context ends a backoff
+	c = &caller{opts: Options{Retries: 1, Backoff: time.Hour}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = c.call(ctx, true, func(ctx context.Context) error {
+		return grpc.Errorf(codes.Unavailable, "down")
+	})
+	if grpc.Code(err) != codes.Unavailable {
+		t.Errorf("error = %v, want unavailable", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("canceled backoff took %v", elapsed)
+	}
+}
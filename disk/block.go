@@ -8,20 +8,40 @@ import (
 	"os"
 )
 
+const (
+	// DefaultBlockSize is the block size of disks that do not choose one.
+	DefaultBlockSize = 4096
+	// MinBlockSize and MaxBlockSize bound the block size of a disk.
+	// Block sizes must be powers of two so blocks stay aligned for O_DIRECT.
+	MinBlockSize = 4096
+	MaxBlockSize = 1 << maxPoolShift
+)
+
 var (
 	crc32cTable = crc32.MakeTable(crc32.Castagnoli)
 	crc32Len    = 4
-	blockSize   = 4096
-	payloadSize = blockSize - crc32Len
+	// blockSize and payloadSize are the ones of defaultLayout.
+	blockSize     = DefaultBlockSize
+	payloadSize   = blockSize - crc32Len
+	defaultLayout = newLayout(DefaultBlockSize, crc32cChecksum{}, nil, nil)
+	// maxSpanSize bounds the number of bytes moved by a single pread or
+	// pwrite so that span buffers stay within the pooled size classes.
+	maxSpanSize = 1 << maxPoolShift
 
 	// ErrPayloadSizeTooLarge indicates the input payload size is too big
 	ErrPayloadSizeTooLarge = errors.New("disk: bad payload size")
-	// ErrBadCRC indicates there is not CRC can be found in the block
+	// ErrBadCRC indicates there is not CRC can be found in the block,
+	// or the block checksum does not match its payload
 	ErrBadCRC = errors.New("disk: not a valid CRC")
+	// ErrBadBlockSize indicates the block size is not a power of two
+	// between MinBlockSize and MaxBlockSize
+	ErrBadBlockSize = errors.New("disk: bad block size")
 )
 
 // Block is a buffer aligned with disk data block with two offset (left and right)
 // representing the start and end of the effective payload inside the buffer
+//
+// The length of buf is the payload size of the disk layout the block belongs to.
 type Block struct {
 	buf   []byte
 	left  int
@@ -64,7 +84,7 @@ func (b *Block) CRC() uint32 {
 
 // IsPartial checks if effective payload is a partial payload
 func (b *Block) IsPartial() bool {
-	return !(b.left == 0 && b.right == payloadSize)
+	return !(b.left == 0 && b.right == len(b.buf))
 }
 
 // Merge uses current block as a base and
@@ -81,69 +101,531 @@ func (b *Block) Reset() {
 	b.EndAt(0)
 }
 
-func newBlock() *Block {
-	return &Block{make([]byte, payloadSize), 0, payloadSize}
+type readerWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
 }
 
-func seekToIndex(s io.Seeker, index int) error {
-	_, err := s.Seek(int64(index*blockSize), os.SEEK_SET)
-	return err
+// slotFile is implemented by files that can give back the unused tails
+// of the slots of compressed blocks.
+type slotFile interface {
+	Truncate(size int64) error
+	Fd() uintptr
+}
+
+// layout describes how data is laid out in the blocks of a disk.
+// Every block is stored at index*blockSize in the file and consists of
+// a header holding the payload checksum followed by up to payloadSize
+// bytes of payload. Only the last block of a file may be partial.
+//
+// With compression the header also holds the stored length of the payload
+// and each block is written to its own slot, which it may not fill.
+// With encryption the header also holds the salt of the block key, and
+// the stored payload is followed by its authentication tag, which is
+// accounted for in headerSize. The checksum of transformed blocks covers
+// everything after it, so corruption is told apart from a wrong key.
+// Files of encrypted disks also start with a file header of base bytes
+// holding the ID of the file, and their blocks follow it.
+type layout struct {
+	blockSize  int
+	headerSize int
+	sum        Checksum
+	// comp is nil if the disk is not compressed.
+	comp     Compressor
+	counters *CompressionStats
+	// enc is nil if the disk is not encrypted.
+	enc *blockCipher
+	// base is the offset of the first block of a file.
+	base int
+	// fileID is the ID of the file the layout was set up for by forFile.
+	fileID []byte
+	// payloadShift combines the CRC32C of a range with that of the whole
+	// payload of the next block. It is nil unless the layout is combinable.
+	payloadShift *crc32Shift
+}
+
+// newLayout returns the layout of a disk with the given block size,
+// checksum, compressor and cipher. comp and enc may be nil.
+func newLayout(blockSize int, sum Checksum, comp Compressor, enc *blockCipher) layout {
+	l := layout{blockSize: blockSize, headerSize: sum.Size(), sum: sum, comp: comp, enc: enc}
+	if comp != nil {
+		l.headerSize += lengthSize
+		l.counters = &CompressionStats{}
+	}
+	if enc != nil {
+		l.headerSize += saltSize + tagSize
+		l.base = fileHeaderSize
+	}
+	if l.combinable() {
+		l.payloadShift = newCRC32Shift(l.payloadSize())
+	}
+	return l
 }
 
-func seekToOffset(s io.Seeker, offset int) error {
-	_, err := s.Seek(int64(offset), os.SEEK_CUR)
+// transformed tells if payloads are stored other than as is.
+func (l layout) transformed() bool {
+	return l.comp != nil || l.enc != nil
+}
+
+// bodyOffset is the offset of the stored payload in a block.
+func (l layout) bodyOffset() int {
+	if l.enc != nil {
+		return l.headerSize - tagSize
+	}
+	return l.headerSize
+}
+
+func (l layout) payloadSize() int {
+	return l.blockSize - l.headerSize
+}
+
+// spanBlocks is the number of blocks moved by a single pread or pwrite.
+// It keeps span buffers within the pooled size classes.
+func (l layout) spanBlocks() int {
+	return max(1, maxSpanSize/l.blockSize)
+}
+
+func (l layout) newBlock() *Block {
+	return &Block{make([]byte, l.payloadSize()), 0, l.payloadSize()}
+}
+
+// blockOffset returns the offset of the block at index in a file.
+func (l layout) blockOffset(index int) int64 {
+	return int64(l.base + index*l.blockSize)
+}
+
+func (l layout) seekToIndex(s io.Seeker, index int) error {
+	_, err := s.Seek(l.blockOffset(index), os.SEEK_SET)
 	return err
 }
 
-func blockIndexAndOffset(dataOffset int) (int, int) {
-	index := dataOffset / payloadSize
-	offset := dataOffset - index*payloadSize
+func (l layout) blockIndexAndOffset(dataOffset int) (int, int) {
+	index := dataOffset / l.payloadSize()
+	offset := dataOffset - index*l.payloadSize()
 	return index, offset
 }
 
-func readBlock(f io.ReadSeeker, b *Block, index int) error {
-	b.Reset()
-	if err := seekToIndex(f, index); err != nil {
-		return err
+// dataSize returns the size of data in a file of fileSize bytes
+// (excluding the headers). It only holds for uncompressed layouts.
+func (l layout) dataSize(fileSize int) int {
+	fileSize = max(fileSize-l.base, 0)
+	blockNum := (fileSize + l.blockSize - 1) / l.blockSize
+	return fileSize - blockNum*l.headerSize
+}
+
+// fileDataSize returns the size of data in f. Compressed blocks do not fill
+// their slots, so the size is told by the payload of the last block.
+func (l layout) fileDataSize(f file) (int, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := int(fi.Size())
+	if l.comp == nil || size <= l.base {
+		return l.dataSize(size), nil
+	}
+	if l, err = l.forFile(f, false); err != nil {
+		return 0, err
+	}
+	last := (size - l.base - 1) / l.blockSize
+	scratch := getBuffer(l.payloadSize())
+	defer putBuffer(scratch)
+	n, err := l.readPayload(f, scratch, last)
+	if err != nil {
+		return 0, err
+	}
+	return last*l.payloadSize() + n, nil
+}
+
+// readSpan reads raw blocks starting at index into buf with a single pread.
+// Reaching the end of the file is not an error; the number of bytes read
+// tells how many (possibly partial) blocks are in buf.
+func (l layout) readSpan(f io.ReaderAt, buf []byte, index int) (int, error) {
+	n, err := f.ReadAt(buf, l.blockOffset(index))
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// verifyBlock checks the checksum of the raw block at index of f in place
+// and returns its payload. The payload of plain blocks still points into raw;
+// encrypted blocks are decrypted in place and compressed payloads are
+// decompressed into scratch, which must hold payloadSize bytes.
+func (l layout) verifyBlock(f io.ReaderAt, raw, scratch []byte, index int) ([]byte, error) {
+	// Cannot read full checksum
+	if len(raw) < l.headerSize {
+		return nil, ErrBadCRC
+	}
+	sumSize := l.sum.Size()
+	if !l.transformed() {
+		payload := raw[l.headerSize:]
+		if !l.sum.Verify(raw[:sumSize], payload) {
+			return l.hole(f, raw, index)
+		}
+		return payload, nil
+	}
+	off, end := sumSize, len(raw)
+	var info uint32
+	if l.comp != nil {
+		info = binary.BigEndian.Uint32(raw[off:])
+		off += lengthSize
+		end = l.headerSize + int(info&^compressedFlag)
+		if end > len(raw) {
+			return l.hole(f, raw, index)
+		}
 	}
-	buf := make([]byte, blockSize)
-	n, err := f.Read(buf)
-	// Cannot read full crc
-	if n > 0 && n < 4 {
-		return ErrBadCRC
+	if !l.sum.Verify(raw[:sumSize], raw[sumSize:end]) {
+		return l.hole(f, raw, index)
 	}
+	body := raw[l.bodyOffset():end]
+	if l.enc != nil {
+		var err error
+		if body, err = l.enc.open(raw[off:off+saltSize], body, l.blockAD(index)); err != nil {
+			return nil, err
+		}
+	}
+	if info&compressedFlag == 0 {
+		return body, nil
+	}
+	n, err := l.comp.Decompress(scratch[:l.payloadSize()], body)
 	if err != nil {
+		return nil, ErrBadCompressedBlock
+	}
+	return scratch[:n], nil
+}
+
+// hole returns the zero payload of a block that was never written, which
+// is an unallocated hole of f and reads back as zeros. Any other raw block
+// failing its checksum is corrupted, even if it reads as zeros.
+func (l layout) hole(f io.ReaderAt, raw []byte, index int) ([]byte, error) {
+	if len(raw) != l.blockSize || !isZero(raw) || l.allocated(f, index, index+1) {
+		return nil, ErrBadCRC
+	}
+	return raw[l.headerSize:], nil
+}
+
+// sealBlock stores the payload of the block at index in its slot together
+// with the block header and returns the number of bytes of the slot in use.
+// payload may already be in place at slot[headerSize:].
+func (l layout) sealBlock(slot, payload []byte, index int) (int, error) {
+	sumSize := l.sum.Size()
+	if !l.transformed() {
+		used := l.headerSize + len(payload)
+		if len(payload) > 0 && &payload[0] != &slot[l.headerSize] {
+			copy(slot[l.headerSize:], payload)
+		}
+		l.sum.Sum(slot[:sumSize], slot[l.headerSize:used])
+		return used, nil
+	}
+	body := l.bodyOffset()
+	info := uint32(len(payload))
+	stored := len(payload)
+	if l.comp == nil {
+		copy(slot[body:], payload)
+	} else if n, ok := l.comp.Compress(slot[body:body+l.payloadSize()], payload); ok && n < len(payload) {
+		info, stored = uint32(n)|compressedFlag, n
+	} else {
+		copy(slot[body:], payload)
+	}
+	off := sumSize
+	if l.comp != nil {
+		binary.BigEndian.PutUint32(slot[off:], info)
+		off += lengthSize
+	}
+	if l.enc != nil {
+		if err := l.enc.seal(slot[off:off+saltSize], slot[body:body+stored], l.blockAD(index)); err != nil {
+			return 0, err
+		}
+	}
+	used := l.headerSize + stored
+	l.sum.Sum(slot[:sumSize], slot[sumSize:used])
+	if l.comp != nil {
+		l.counters.add(len(payload), used)
+	}
+	return used, nil
+}
+
+// scratch returns a buffer to decompress payloads into, or nil
+// if the layout is not compressed.
+func (l layout) scratch() []byte {
+	if l.comp == nil {
+		return nil
+	}
+	return getBuffer(l.payloadSize())
+}
+
+func (l layout) putScratch(b []byte) {
+	if b != nil {
+		putBuffer(b)
+	}
+}
+
+// writeSlot writes a compressed block into its slot. The unused tail of
+// the slot is punched out, or cut off if the block is the last one.
+func (l layout) writeSlot(f io.WriterAt, slot []byte, index int, last bool) error {
+	off := l.blockOffset(index)
+	if _, err := f.WriteAt(slot, off); err != nil {
 		return err
 	}
-	crc := binary.BigEndian.Uint32(buf[:crc32Len])
-	v := copy(b.buf, buf[crc32Len:n])
-	b.EndAt(v)
-	// Invalid crc
-	if crc != b.CRC() {
-		return ErrBadCRC
+	sf, ok := f.(slotFile)
+	if !ok {
+		return nil
 	}
-	return nil
+	if last {
+		return sf.Truncate(off + int64(len(slot)))
+	}
+	return punchHole(sf, off+int64(len(slot)), int64(l.blockSize-len(slot)))
 }
 
-func writeBlock(f io.WriteSeeker, b *Block, index int) error {
-	if b.right > payloadSize {
+// readPayload reads the block at index, verifies it and copies
+// its payload into dst. It returns io.EOF if the block does not exist.
+func (l layout) readPayload(f io.ReaderAt, dst []byte, index int) (int, error) {
+	buf := getBuffer(l.blockSize)
+	defer putBuffer(buf)
+	n, err := l.readSpan(f, buf, index)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	scratch := l.scratch()
+	defer l.putScratch(scratch)
+	payload, err := l.verifyBlock(f, buf[:n], scratch, index)
+	if err != nil {
+		return 0, err
+	}
+	return copy(dst, payload), nil
+}
+
+func (l layout) readBlock(f io.ReaderAt, b *Block, index int) error {
+	b.Reset()
+	n, err := l.readPayload(f, b.buf, index)
+	b.EndAt(n)
+	return err
+}
+
+func (l layout) writeBlock(f io.WriterAt, b *Block, index int) error {
+	if b.right > l.payloadSize() {
 		return ErrPayloadSizeTooLarge
 	}
 	if b.left != 0 {
 		panic("block is not left aligned")
 	}
-	if err := seekToIndex(f, index); err != nil {
+	buf := getBuffer(l.blockSize)
+	defer putBuffer(buf)
+	used, err := l.sealBlock(buf, b.Payload(), index)
+	if err != nil {
 		return err
 	}
+	_, err = f.WriteAt(buf[:used], l.blockOffset(index))
+	return err
+}
 
-	crcBuf := make([]byte, crc32Len+len(b.Payload()))
-	binary.BigEndian.PutUint32(crcBuf, b.CRC())
-	copy(crcBuf[crc32Len:], b.Payload())
-	_, err := f.Write(crcBuf)
+// readAt fills p with data starting at offset inside the block at index.
+// Blocks are fetched in spans with one pread each and verified in place
+// in the span buffer, so the only copy made is the one into p.
+// If fill is not nil, it is called with every verified payload.
+func (l layout) readAt(f io.ReaderAt, p []byte, index, offset int, fill func(index int, payload []byte)) (int, error) {
+	blockSize, payloadSize := l.blockSize, l.payloadSize()
+	scratch := l.scratch()
+	defer l.putScratch(scratch)
+	read := 0
+	for len(p) > 0 {
+		count := min((offset+len(p)+payloadSize-1)/payloadSize, l.spanBlocks())
+		span := getBuffer(count * blockSize)
+		n, err := l.readSpan(f, span, index)
+		if err != nil {
+			putBuffer(span)
+			return read, err
+		}
+		i := index
+		for raw := span[:n]; len(raw) > 0 && len(p) > 0; raw = raw[min(blockSize, len(raw)):] {
+			payload, err := l.verifyBlock(f, raw[:min(blockSize, len(raw))], scratch, i)
+			if err != nil {
+				putBuffer(span)
+				return read, err
+			}
+			if fill != nil {
+				fill(i, payload)
+			}
+			i++
+			if offset < len(payload) {
+				copied := copy(p, payload[offset:])
+				// We just copied some data into p, shrink p
+				p = p[copied:]
+				read += copied
+			}
+			offset = 0
+		}
+		putBuffer(span)
+		if n < count*blockSize {
+			break
+		}
+		index += count
+	}
+	if len(p) > 0 {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+// writeAt writes p at dataOffset into f, whose current data size is size.
+// The gap between the end of the data and dataOffset reads back as zeros;
+// the blocks entirely inside it are left as holes, or filled with zero
+// blocks if the filesystem keeps them allocated.
+// Affected blocks are assembled together with their headers in pooled
+// span buffers, merging partially overwritten blocks with their existing
+// payload, and each span is written with a single pwrite. If sealed is not
+// nil, it is called with the full payload of every block written. Transformed
+// payloads are assembled apart from their slots; compressed blocks do not
+// fill their slots and are written one by one.
+func (l layout) writeAt(f readerWriterAt, p []byte, dataOffset, size int, sealed func(index int, payload []byte)) (int, error) {
+	blockSize, payloadSize, spanBlocks := l.blockSize, l.payloadSize(), l.spanBlocks()
+	index, _ := l.blockIndexAndOffset(dataOffset)
+	sizeIndex, _ := l.blockIndexAndOffset(size)
+	end := dataOffset + len(p)
+	lastIndex, _ := l.blockIndexAndOffset(end - 1)
+	fileLastIndex, _ := l.blockIndexAndOffset(max(end, size) - 1)
+	var plain []byte
+	if l.transformed() {
+		plain = getBuffer(payloadSize)
+		defer putBuffer(plain)
+	}
+
+	if sizeIndex < index {
+		// Blocks between the end of the data and the first written block are
+		// left as holes. Only the old last block gets padded, as all blocks
+		// but the last one must be full.
+		if _, offset := l.blockIndexAndOffset(size); offset > 0 {
+			pad := getBuffer(payloadSize - offset)
+			zero(pad)
+			_, err := l.writeAt(f, pad, size, size, sealed)
+			putBuffer(pad)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	written := 0
+	for start := index; start <= lastIndex; start += spanBlocks {
+		count := min(lastIndex-start+1, spanBlocks)
+		span := getBuffer(count * blockSize)
+		n := 0
+		for i := start; i < start+count; i++ {
+			slot := span[(i-start)*blockSize : (i-start+1)*blockSize]
+			payload := slot[l.headerSize:]
+			if plain != nil {
+				payload = plain
+			}
+			blockStart := i * payloadSize
+			// [lo, hi) is the part of the payload overwritten by p.
+			lo := max(dataOffset-blockStart, 0)
+			hi := min(end-blockStart, payloadSize)
+			base := 0
+			if (lo > 0 || hi < payloadSize) && blockStart < size {
+				// Merge with existing
+				m, err := l.readPayload(f, payload, i)
+				if err != nil && err != io.EOF {
+					putBuffer(span)
+					return written, err
+				}
+				base = m
+			}
+			zero(payload[base:])
+			copy(payload[lo:hi], p[blockStart+lo-dataOffset:])
+			if sealed != nil {
+				sealed(i, payload[:max(hi, base)])
+			}
+			used, err := l.sealBlock(slot, payload[:max(hi, base)], i)
+			if err != nil {
+				putBuffer(span)
+				return written, err
+			}
+			n = (i-start)*blockSize + used
+			if l.comp != nil {
+				if err := l.writeSlot(f, slot[:used], i, i == fileLastIndex); err != nil {
+					putBuffer(span)
+					return written, err
+				}
+			}
+		}
+		var err error
+		if l.comp == nil {
+			_, err = f.WriteAt(span[:n], l.blockOffset(start))
+		}
+		putBuffer(span)
+		if err != nil {
+			return written, err
+		}
+		written = max(written, min(len(p), (start+count)*payloadSize-dataOffset))
+	}
+
+	// Only unallocated blocks read back as holes, so a gap the filesystem
+	// did not keep as holes is filled with sealed zero blocks.
+	if first := (size + payloadSize - 1) / payloadSize; first < index && l.allocated(f, first, index) {
+		if err := l.fillZeros(f, first, index, max(end, size), sealed); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// fillZeros writes zero blocks from first up to last into f, whose data
+// size is size.
+func (l layout) fillZeros(f readerWriterAt, first, last, size int, sealed func(index int, payload []byte)) error {
+	payloadSize := l.payloadSize()
+	zeros := getBuffer(l.spanBlocks() * payloadSize)
+	defer putBuffer(zeros)
+	zero(zeros)
+	for i := first; i < last; i += l.spanBlocks() {
+		count := min(last-i, l.spanBlocks())
+		if _, err := l.writeAt(f, zeros[:count*payloadSize], i*payloadSize, size, sealed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate shrinks the data of f to size bytes. The new last block is
+// rewritten with the part of its payload that remains.
+func (l layout) truncate(f file, size int) error {
+	index, offset := l.blockIndexAndOffset(size)
+	if offset == 0 {
+		return f.Truncate(l.blockOffset(index))
+	}
+	payload := getBuffer(l.payloadSize())
+	defer putBuffer(payload)
+	if _, err := l.readPayload(f, payload, index); err != nil {
+		return err
+	}
+	slot := getBuffer(l.blockSize)
+	defer putBuffer(slot)
+	used, err := l.sealBlock(slot, payload[:offset], index)
 	if err != nil {
 		return err
 	}
-	return nil
+	if _, err := f.WriteAt(slot[:used], l.blockOffset(index)); err != nil {
+		return err
+	}
+	return f.Truncate(l.blockOffset(index) + int64(used))
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
 }
 
 func min(a, b int) int {
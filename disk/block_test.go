@@ -45,14 +45,14 @@ func TestPartlyReadBlock(t *testing.T) {
 	f := setUpBlockTestFile(payloadSize, t)
 
 	// writeBlock to set a correct CRC
-	b := newBlock()
-	err := writeBlock(f, b, 4)
+	b := defaultLayout.newBlock()
+	err := defaultLayout.writeBlock(f, b, 4)
 	if err != nil {
 		t.Errorf("error = %v", err)
 	}
 	// try to read out a block
-	rb := newBlock()
-	err = readBlock(f, rb, 4)
+	rb := defaultLayout.newBlock()
+	err = defaultLayout.readBlock(f, rb, 4)
 
 	// FIXME do we expect error = io.EOF here?
 	if err != nil {
@@ -68,7 +68,7 @@ func BenchmarkBlockWrite(b *testing.B) {
 		f, _ := os.OpenFile(
 			path.Join(os.TempDir(), tmpTestFile),
 			os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
-		writeBlock(f, newBlock(), i)
+		defaultLayout.writeBlock(f, defaultLayout.newBlock(), i)
 		defer os.Remove(tmpTestFile)
 	}
 }
@@ -90,8 +90,8 @@ func TestCRCErrCheck(t *testing.T) {
 		f := setUpBlockTestFile(tt.fileSize, t)
 		// writeBlock to set a correct CRC
 
-		b := newBlock()
-		err := readBlock(f, b, tt.index)
+		b := defaultLayout.newBlock()
+		err := defaultLayout.readBlock(f, b, tt.index)
 		if err != ErrBadCRC {
 			t.Errorf("%d: expect error %v got %v", i, ErrBadCRC, err)
 		}
@@ -120,17 +120,17 @@ func TestReadWriteBlock(t *testing.T) {
 	for i, tt := range tests {
 		f := setUpBlockTestFile(tt.fileSize, t)
 
-		block := newBlock()
+		block := defaultLayout.newBlock()
 		for i := 0; i < payloadSize; i++ {
 			block.buf[i] = 'X'
 		}
-		err := writeBlock(f, block, tt.index)
+		err := defaultLayout.writeBlock(f, block, tt.index)
 		if err != nil {
 			t.Errorf("%d: error = %v", i, err)
 		}
 
-		rb := newBlock()
-		err = readBlock(f, rb, tt.index)
+		rb := defaultLayout.newBlock()
+		err = defaultLayout.readBlock(f, rb, tt.index)
 		if err != nil {
 			t.Fatalf("%d: error = %v", i, err)
 		}
@@ -143,7 +143,7 @@ func TestReadWriteBlock(t *testing.T) {
 
 		// check crc
 		b := make([]byte, crc32Len)
-		if err := seekToIndex(f, tt.index); err != nil {
+		if err := defaultLayout.seekToIndex(f, tt.index); err != nil {
 			t.Errorf("%d: error = %v", i, err)
 		}
 		if _, err := f.Read(b); err != nil {
@@ -0,0 +1,168 @@
+package disk
+
+import (
+	"container/list"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Cache is an in-memory LRU cache of block payloads that already passed
+// their CRC check. A single Cache can be shared by several disks; entries
+// are keyed by disk name, file name and block index.
+//
+// The cache only sees changes made through Disk. Files modified behind
+// the back of cfs keep being served from the cache until they are evicted.
+type Cache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	// gen is bumped by every invalidation. Readers remember it before going
+	// to the file and only fill the cache if it did not move meanwhile,
+	// so a racing write can never be shadowed by stale data.
+	gen   uint64
+	lru   *list.List
+	files map[fileKey]map[int]*list.Element
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type fileKey struct {
+	disk string
+	file string
+}
+
+type cacheEntry struct {
+	key     fileKey
+	index   int
+	payload []byte
+}
+
+// CacheStats is a snapshot of the cache counters.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Size is the number of payload bytes held by the cache.
+	Size int64
+	// Blocks is the number of blocks held by the cache.
+	Blocks int
+}
+
+// NewCache creates a cache holding at most capacity bytes of payload.
+func NewCache(capacity int64) *Cache {
+	return &Cache{
+		capacity: capacity,
+		lru:      list.New(),
+		files:    make(map[fileKey]map[int]*list.Element),
+	}
+}
+
+// Stats returns the current cache counters.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+		Size:      c.size,
+		Blocks:    c.lru.Len(),
+	}
+}
+
+// generation returns the current invalidation generation.
+func (c *Cache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// get returns the cached payload of a block. The returned slice
+// must not be modified.
+func (c *Cache) get(disk, file string, index int) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.files[fileKey{disk, file}][index]
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	c.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).payload, true
+}
+
+// put adds a copy of payload to the cache unless the cache was
+// invalidated since gen was taken.
+func (c *Cache) put(disk, file string, index int, payload []byte, gen uint64) {
+	if int64(len(payload)) > c.capacity {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	key := fileKey{disk, file}
+	if e, ok := c.files[key][index]; ok {
+		c.remove(e)
+	}
+	blocks := c.files[key]
+	if blocks == nil {
+		blocks = make(map[int]*list.Element)
+		c.files[key] = blocks
+	}
+	p := make([]byte, len(payload))
+	copy(p, payload)
+	blocks[index] = c.lru.PushFront(&cacheEntry{key, index, p})
+	c.size += int64(len(p))
+	for c.size > c.capacity {
+		c.remove(c.lru.Back())
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+// invalidate drops the blocks of a file in the index range [from, to].
+func (c *Cache) invalidate(disk, file string, from, to int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for index, e := range c.files[fileKey{disk, file}] {
+		if index >= from && index <= to {
+			c.remove(e)
+		}
+	}
+}
+
+// invalidateTree drops all blocks of name and of any file under name.
+func (c *Cache) invalidateTree(disk, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	name = path.Clean(name)
+	for key, blocks := range c.files {
+		if key.disk != disk {
+			continue
+		}
+		if key.file != name && name != "." && !strings.HasPrefix(key.file, name+"/") {
+			continue
+		}
+		for _, e := range blocks {
+			c.remove(e)
+		}
+	}
+}
+
+func (c *Cache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*cacheEntry)
+	c.size -= int64(len(entry.payload))
+	blocks := c.files[entry.key]
+	delete(blocks, entry.index)
+	if len(blocks) == 0 {
+		delete(c.files, entry.key)
+	}
+}
@@ -0,0 +1,96 @@
+package disk
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCacheEviction(t *testing.T) {
+	c := NewCache(int64(payloadSize * 2))
+	p := make([]byte, payloadSize)
+	for i := 0; i < 3; i++ {
+		c.put("disk0", "file", i, p, c.generation())
+	}
+	// block 0 is the least recently used one
+	if _, ok := c.get("disk0", "file", 0); ok {
+		t.Errorf("expect block 0 to be evicted")
+	}
+	for i := 1; i < 3; i++ {
+		if _, ok := c.get("disk0", "file", i); !ok {
+			t.Errorf("expect block %d to be cached", i)
+		}
+	}
+	s := c.Stats()
+	if s.Evictions != 1 || s.Hits != 2 || s.Misses != 1 || s.Blocks != 2 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestCacheStalePut(t *testing.T) {
+	c := NewCache(int64(payloadSize))
+	gen := c.generation()
+	c.invalidate("disk0", "file", 0, 0)
+	c.put("disk0", "file", 0, []byte("stale"), gen)
+	if _, ok := c.get("disk0", "file", 0); ok {
+		t.Errorf("expect stale payload not to be cached")
+	}
+}
+
+func TestCacheInvalidateTree(t *testing.T) {
+	c := NewCache(int64(payloadSize * 10))
+	files := []string{"dir/a", "dir/sub/b", "dirx", "other"}
+	for _, f := range files {
+		c.put("disk0", f, 0, []byte(f), c.generation())
+	}
+	c.invalidateTree("disk0", "dir")
+	for _, f := range files {
+		_, ok := c.get("disk0", f, 0)
+		if expected := f == "dirx" || f == "other"; ok != expected {
+			t.Errorf("%s: expect cached %v got %v", f, expected, ok)
+		}
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	d := newTestDisk("disk0", "cache", true)
+	defer d.Remove("", true)
+	d.Cache = NewCache(int64(payloadSize * 10))
+
+	p := make([]byte, payloadSize*2)
+	fillPattern(p, len(p))
+	if _, err := d.WriteAt(tmpTestFile, p, 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	r := make([]byte, len(p))
+	for i := 0; i < 2; i++ {
+		if _, err := d.ReadAt(tmpTestFile, r, 0); err != nil {
+			t.Fatalf("%d: error = %v", i, err)
+		}
+		if !bytes.Equal(p, r) {
+			t.Errorf("%d: read out data is not the same as writen in data", i)
+		}
+	}
+	if s := d.Cache.Stats(); s.Hits != 2 || s.Blocks != 2 {
+		t.Errorf("expect the second read to hit, got stats %+v", s)
+	}
+
+	// overwriting must not leave stale blocks behind
+	w := []byte("XXXX")
+	if _, err := d.WriteAt(tmpTestFile, w, int64(payloadSize)); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	copy(p[payloadSize:], w)
+	if _, err := d.ReadAt(tmpTestFile, r, 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if !bytes.Equal(p, r) {
+		t.Errorf("expect overwritten data to be read out")
+	}
+
+	if err := d.Remove(tmpTestFile, false); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if s := d.Cache.Stats(); s.Blocks != 0 {
+		t.Errorf("expect removed file to be dropped from cache, got stats %+v", s)
+	}
+}
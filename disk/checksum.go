@@ -0,0 +1,170 @@
+package disk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// Checksum is the algorithm protecting the payload of every block of a disk.
+// The checksum is stored in the block header, so the header size of a disk
+// is the size of its checksum.
+type Checksum interface {
+	// Name is the name recorded in the disk format.
+	Name() string
+	// Size is the length in bytes of a checksum.
+	Size() int
+	// Sum stores the checksum of p in the first Size() bytes of dst.
+	Sum(dst, p []byte)
+	// Verify tells if sum is the checksum of p.
+	Verify(sum, p []byte) bool
+}
+
+const (
+	// CRC32C is the Castagnoli CRC32. It is the checksum of disks that
+	// do not choose one, including all disks formatted before checksums
+	// could be chosen.
+	CRC32C = "crc32c"
+	// XXHash64 is the 64-bit xxHash. It is a non-cryptographic hash that is
+	// faster than CRC32C without hardware support and has a wider output.
+	XXHash64 = "xxhash64"
+	// SHA256 is SHA-256 truncated to 128 bits, for workloads requiring
+	// cryptographic integrity of the stored data.
+	SHA256 = "sha256-128"
+)
+
+// ErrUnknownChecksum indicates the checksum algorithm is not supported.
+var ErrUnknownChecksum = errors.New("disk: unknown checksum algorithm")
+
+var checksums = map[string]Checksum{
+	CRC32C:   crc32cChecksum{},
+	XXHash64: xxhash64Checksum{},
+	SHA256:   sha256Checksum{},
+}
+
+// checksumByName returns the checksum with the given name.
+// The empty name is CRC32C.
+func checksumByName(name string) (Checksum, error) {
+	if name == "" {
+		name = CRC32C
+	}
+	c, ok := checksums[name]
+	if !ok {
+		return nil, ErrUnknownChecksum
+	}
+	return c, nil
+}
+
+type crc32cChecksum struct{}
+
+func (crc32cChecksum) Name() string { return CRC32C }
+func (crc32cChecksum) Size() int    { return crc32Len }
+
+func (crc32cChecksum) Sum(dst, p []byte) {
+	binary.BigEndian.PutUint32(dst, crc32.Checksum(p, crc32cTable))
+}
+
+func (crc32cChecksum) Verify(sum, p []byte) bool {
+	return binary.BigEndian.Uint32(sum) == crc32.Checksum(p, crc32cTable)
+}
+
+type xxhash64Checksum struct{}
+
+func (xxhash64Checksum) Name() string { return XXHash64 }
+func (xxhash64Checksum) Size() int    { return 8 }
+
+func (xxhash64Checksum) Sum(dst, p []byte) {
+	binary.BigEndian.PutUint64(dst, xxhash64(p, 0))
+}
+
+func (xxhash64Checksum) Verify(sum, p []byte) bool {
+	return binary.BigEndian.Uint64(sum) == xxhash64(p, 0)
+}
+
+type sha256Checksum struct{}
+
+func (sha256Checksum) Name() string { return SHA256 }
+func (sha256Checksum) Size() int    { return 16 }
+
+func (sha256Checksum) Sum(dst, p []byte) {
+	s := sha256.Sum256(p)
+	copy(dst[:16], s[:16])
+}
+
+func (sha256Checksum) Verify(sum, p []byte) bool {
+	s := sha256.Sum256(p)
+	return bytes.Equal(sum[:16], s[:16])
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxhash64 computes the XXH64 hash of b.
+// See https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+func xxhash64(b []byte, seed uint64) uint64 {
+	n := len(b)
+	var h uint64
+	if n >= 32 {
+		v1 := seed + xxPrime1 + xxPrime2
+		v2 := seed + xxPrime2
+		v3 := seed
+		v4 := seed - xxPrime1
+		for ; len(b) >= 32; b = b[32:] {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(b[0:8]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(b[8:16]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(b[16:24]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(b[24:32]))
+		}
+		h = rotl64(v1, 1) + rotl64(v2, 7) + rotl64(v3, 12) + rotl64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = seed + xxPrime5
+	}
+	h += uint64(n)
+
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b[:8]))
+		h = rotl64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b[:4])) * xxPrime1
+		h = rotl64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for ; len(b) > 0; b = b[1:] {
+		h ^= uint64(b[0]) * xxPrime5
+		h = rotl64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = rotl64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func rotl64(x uint64, r uint) uint64 {
+	return (x << r) | (x >> (64 - r))
+}
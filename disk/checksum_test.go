@@ -0,0 +1,71 @@
+package disk
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestXXHash64(t *testing.T) {
+	tests := []struct {
+		data string
+		sum  uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+	}
+	for i, tt := range tests {
+		if sum := xxhash64([]byte(tt.data), 0); sum != tt.sum {
+			t.Errorf("%d: expect %x got %x", i, tt.sum, sum)
+		}
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	for _, name := range []string{CRC32C, XXHash64, SHA256} {
+		d := newTestDisk("disk0", "checksum", false)
+		d.Checksum = name
+		if err := d.Init(); err != nil {
+			t.Fatalf("%s: error = %v", name, err)
+		}
+		l := d.layout()
+		if l.headerSize != checksums[name].Size() {
+			t.Errorf("%s: expect header size %d got %d", name, checksums[name].Size(), l.headerSize)
+		}
+		p := make([]byte, l.payloadSize()*2+10)
+		fillPattern(p, len(p))
+		if _, err := d.WriteAt(tmpTestFile, p, 0); err != nil {
+			t.Fatalf("%s: error = %v", name, err)
+		}
+		r := make([]byte, len(p))
+		if _, err := d.ReadAt(tmpTestFile, r, 0); err != nil {
+			t.Fatalf("%s: error = %v", name, err)
+		}
+		if !bytes.Equal(p, r) {
+			t.Errorf("%s: writen in data is not the same as read out data", name)
+		}
+
+		// flip one payload bit of the second block
+		raw := make([]byte, 1)
+		rf, err := os.OpenFile(path.Join(d.Root, tmpTestFile), os.O_RDWR, 0600)
+		if err != nil {
+			t.Fatalf("%s: error = %v", name, err)
+		}
+		off := int64(l.blockSize + l.headerSize + 3)
+		rf.ReadAt(raw, off)
+		raw[0] ^= 1
+		rf.WriteAt(raw, off)
+		rf.Close()
+		if _, err := d.ReadAt(tmpTestFile, r, 0); err != ErrBadCRC {
+			t.Errorf("%s: expect error %v got %v", name, ErrBadCRC, err)
+		}
+
+		reopened := &Disk{Name: d.Name, Root: d.Root, Checksum: XXHash64}
+		if err := reopened.Init(); err != ErrFormatMismatch && name != XXHash64 {
+			t.Errorf("%s: expect error %v got %v", name, ErrFormatMismatch, err)
+		}
+		d.Remove("", true)
+	}
+}
@@ -0,0 +1,53 @@
+package disk
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ficlone is the FICLONE ioctl, which makes a file share the extents of
+// another until either is written.
+const ficlone = 0x40049409
+
+// reflink makes dst a copy of src sharing its blocks, on filesystems
+// supporting it such as btrfs and xfs.
+func reflink(dst, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if errno != 0 {
+		return os.NewSyscallError("ioctl FICLONE", errno)
+	}
+	return nil
+}
+
+// copyRange copies n bytes at off of src to the same offset of dst with
+// copy_file_range, which copies in the kernel and may share blocks.
+func copyRange(dst, src *os.File, off, n int64) error {
+	if sysCopyFileRange == 0 {
+		return errors.New("copy_file_range is not supported")
+	}
+	for n > 0 {
+		in, out := off, off
+		r, _, errno := syscall.Syscall6(sysCopyFileRange, src.Fd(), uintptr(unsafe.Pointer(&in)),
+			dst.Fd(), uintptr(unsafe.Pointer(&out)), uintptr(n), 0)
+		if errno != 0 {
+			return os.NewSyscallError("copy_file_range", errno)
+		}
+		if r == 0 {
+			return io.ErrUnexpectedEOF
+		}
+		off += int64(r)
+		n -= int64(r)
+	}
+	return nil
+}
+
+// linkCount returns the number of hard links to a file.
+func linkCount(fi os.FileInfo) int {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return int(st.Nlink)
+	}
+	return 2
+}
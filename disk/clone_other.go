@@ -0,0 +1,24 @@
+// +build !linux
+
+package disk
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink reports that files cannot share blocks.
+func reflink(dst, src *os.File) error {
+	return errors.New("reflink is only supported on linux")
+}
+
+// copyRange reports that files cannot be copied in the kernel.
+func copyRange(dst, src *os.File, off, n int64) error {
+	return errors.New("copy_file_range is only supported on linux")
+}
+
+// linkCount reports a file as linked more than once, so that the files
+// of snapshots are always copied before they are written.
+func linkCount(fi os.FileInfo) int {
+	return 2
+}
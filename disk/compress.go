@@ -0,0 +1,180 @@
+package disk
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Compressor compresses the payload of every block of a disk.
+//
+// A compressed block still occupies its fixed slot of BlockSize bytes in
+// the file, so blocks keep being addressed by index and ReadAt/WriteAt work
+// at any offset. After the checksum, the block header holds the stored
+// length of the payload, which tells how much of the slot is used; the
+// unused tail of the slot is punched out of the file and takes no space.
+// Compression therefore only pays off with blocks much larger than the
+// filesystem block.
+//
+// Packing compressed blocks behind a variable-length block index would
+// save more space, but every write would have to update the index along
+// with the data, and blocks growing on rewrite would have to move. Slots
+// keep writes in place and crash safe as they are for uncompressed disks.
+type Compressor interface {
+	// Name is the name recorded in the disk format.
+	Name() string
+	// Compress compresses src into dst and returns the compressed length.
+	// It returns false if the compressed data does not fit into dst.
+	Compress(dst, src []byte) (int, bool)
+	// Decompress decompresses src into dst and returns the length of the
+	// decompressed data. It returns ErrBadCompressedBlock if src is not
+	// valid or does not fit into dst.
+	Decompress(dst, src []byte) (int, error)
+}
+
+const (
+	// Deflate is DEFLATE at the default compression level.
+	Deflate = "deflate"
+	// DeflateFast is DEFLATE tuned for speed rather than ratio.
+	DeflateFast = "deflate-fast"
+
+	// MinCompressedBlockSize is the smallest block size of a compressed disk.
+	MinCompressedBlockSize = 16 << 10
+
+	// lengthSize is the size of the stored length in the header of
+	// compressed blocks.
+	lengthSize = 4
+	// compressedFlag is set in the stored length of blocks whose payload
+	// is compressed. Payloads that do not shrink are stored as is.
+	compressedFlag = 1 << 31
+)
+
+var (
+	// ErrUnknownCompression indicates the compression algorithm is not supported.
+	ErrUnknownCompression = errors.New("disk: unknown compression algorithm")
+	// ErrBadCompressedBlock indicates a block passed its checksum
+	// but could not be decompressed.
+	ErrBadCompressedBlock = errors.New("disk: bad compressed block")
+)
+
+var compressors = map[string]Compressor{
+	Deflate:     newDeflateCompressor(Deflate, flate.DefaultCompression),
+	DeflateFast: newDeflateCompressor(DeflateFast, flate.BestSpeed),
+}
+
+// compressorByName returns the compressor with the given name.
+// The empty name means no compression and returns nil.
+func compressorByName(name string) (Compressor, error) {
+	if name == "" {
+		return nil, nil
+	}
+	c, ok := compressors[name]
+	if !ok {
+		return nil, ErrUnknownCompression
+	}
+	return c, nil
+}
+
+// CompressionStats counts the payload bytes written to a compressed disk
+// and the bytes stored for them, headers included.
+type CompressionStats struct {
+	Raw    uint64
+	Stored uint64
+}
+
+func (s *CompressionStats) add(raw, stored int) {
+	atomic.AddUint64(&s.Raw, uint64(raw))
+	atomic.AddUint64(&s.Stored, uint64(stored))
+}
+
+// CompressionStats returns the compression counters of the disk since it
+// was initialized. Both counters are zero if the disk is not compressed.
+func (d *Disk) CompressionStats() CompressionStats {
+	c := d.layout().counters
+	if c == nil {
+		return CompressionStats{}
+	}
+	return CompressionStats{
+		Raw:    atomic.LoadUint64(&c.Raw),
+		Stored: atomic.LoadUint64(&c.Stored),
+	}
+}
+
+// deflateCompressor pools its flate writers and readers, which are
+// expensive to allocate.
+type deflateCompressor struct {
+	name    string
+	level   int
+	writers sync.Pool
+	readers sync.Pool
+}
+
+func newDeflateCompressor(name string, level int) *deflateCompressor {
+	return &deflateCompressor{name: name, level: level}
+}
+
+func (c *deflateCompressor) Name() string { return c.name }
+
+func (c *deflateCompressor) Compress(dst, src []byte) (int, bool) {
+	w := &sliceWriter{buf: dst}
+	fw, ok := c.writers.Get().(*flate.Writer)
+	if ok {
+		fw.Reset(w)
+	} else {
+		fw, _ = flate.NewWriter(w, c.level)
+	}
+	defer c.writers.Put(fw)
+	if _, err := fw.Write(src); err != nil {
+		return 0, false
+	}
+	if err := fw.Close(); err != nil {
+		return 0, false
+	}
+	return w.n, true
+}
+
+func (c *deflateCompressor) Decompress(dst, src []byte) (int, error) {
+	r := bytes.NewReader(src)
+	fr, ok := c.readers.Get().(io.ReadCloser)
+	if ok {
+		fr.(flate.Resetter).Reset(r, nil)
+	} else {
+		fr = flate.NewReader(r)
+	}
+	defer c.readers.Put(fr)
+	n := 0
+	for n < len(dst) {
+		m, err := fr.Read(dst[n:])
+		n += m
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			// corrupted or truncated data
+			return 0, ErrBadCompressedBlock
+		}
+	}
+	// the payload must fit into dst
+	var extra [1]byte
+	if m, err := fr.Read(extra[:]); m > 0 || err != io.EOF {
+		return 0, ErrBadCompressedBlock
+	}
+	return n, nil
+}
+
+// sliceWriter writes into a fixed buffer and fails once it is full.
+type sliceWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	if len(p) > len(w.buf)-w.n {
+		return 0, io.ErrShortWrite
+	}
+	w.n += copy(w.buf[w.n:], p)
+	return len(p), nil
+}
@@ -0,0 +1,103 @@
+package disk
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	for _, name := range []string{Deflate, DeflateFast} {
+		d := newTestDisk("disk0", "compress", false)
+		d.BlockSize = MinCompressedBlockSize
+		d.Compression = name
+		if err := d.Init(); err != nil {
+			t.Fatalf("%s: error = %v", name, err)
+		}
+		payloadSize := d.layout().payloadSize()
+
+		// compressible data mixed with random data, which is stored as is
+		rnd := rand.New(rand.NewSource(1))
+		ref := make([]byte, 0, payloadSize*4)
+		for i := 0; i < 6; i++ {
+			p := make([]byte, payloadSize*3/4)
+			if i%2 == 0 {
+				fillPattern(p, len(p))
+			} else {
+				rnd.Read(p)
+			}
+			off := rnd.Intn(len(ref) + 1)
+			if _, err := d.WriteAt(tmpTestFile, p, int64(off)); err != nil {
+				t.Fatalf("%s: %d: error = %v", name, i, err)
+			}
+			if off+len(p) > len(ref) {
+				ref = ref[:off+len(p)]
+			}
+			copy(ref[off:], p)
+
+			size, err := d.Size(tmpTestFile)
+			if err != nil || size != int64(len(ref)) {
+				t.Fatalf("%s: %d: expect size %d got %d (%v)", name, i, len(ref), size, err)
+			}
+			r := make([]byte, len(ref))
+			if _, err := d.ReadAt(tmpTestFile, r, 0); err != nil {
+				t.Fatalf("%s: %d: error = %v", name, i, err)
+			}
+			if !bytes.Equal(ref, r) {
+				t.Fatalf("%s: %d: writen in data is not the same as read out data", name, i)
+			}
+		}
+
+		s := d.CompressionStats()
+		if s.Raw == 0 || s.Stored >= s.Raw {
+			t.Errorf("%s: expect data to be compressed, got stats %+v", name, s)
+		}
+		d.Remove("", true)
+	}
+}
+
+func TestCompressionBlockSize(t *testing.T) {
+	d := newTestDisk("disk0", "compress", false)
+	defer d.Remove("", true)
+	d.Compression = Deflate
+	if err := d.Init(); err != ErrBadBlockSize {
+		t.Errorf("expect error %v got %v", ErrBadBlockSize, err)
+	}
+	d.Compression = "lzw"
+	d.BlockSize = MinCompressedBlockSize
+	if err := d.Init(); err != ErrUnknownCompression {
+		t.Errorf("expect error %v got %v", ErrUnknownCompression, err)
+	}
+}
+
+func TestDecompressErrors(t *testing.T) {
+	c := compressors[Deflate]
+	src := make([]byte, 1000)
+	fillPattern(src, len(src))
+	compressed := make([]byte, len(src))
+	n, ok := c.Compress(compressed, src)
+	if !ok {
+		t.Fatalf("expect pattern to compress")
+	}
+	compressed = compressed[:n]
+
+	dst := make([]byte, len(src))
+	if m, err := c.Decompress(dst, compressed); err != nil || m != len(src) || !bytes.Equal(dst, src) {
+		t.Fatalf("decompressed %d bytes (%v)", m, err)
+	}
+	garbage := bytes.Repeat([]byte{0xff}, n)
+	tests := []struct {
+		name string
+		dst  []byte
+		src  []byte
+	}{
+		{"truncated", dst, compressed[:n/2]},
+		{"garbage", dst, garbage},
+		{"too long", dst[:len(src)-1], compressed},
+	}
+	for _, tt := range tests {
+		if _, err := c.Decompress(tt.dst, tt.src); err != ErrBadCompressedBlock {
+			t.Errorf("%s: expect error %v got %v", tt.name, ErrBadCompressedBlock, err)
+		}
+	}
+}
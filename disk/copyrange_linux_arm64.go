@@ -0,0 +1,4 @@
+package disk
+
+// sysCopyFileRange is the number of the copy_file_range syscall.
+const sysCopyFileRange = 285
@@ -0,0 +1,7 @@
+// +build linux,!amd64,!arm64
+
+package disk
+
+// sysCopyFileRange is zero where the number of the copy_file_range
+// syscall is not known, which leaves copies to user space.
+const sysCopyFileRange = 0
@@ -0,0 +1,329 @@
+package disk
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+const (
+	// AES256GCM encrypts every block with AES-256 in GCM mode.
+	AES256GCM = "aes-256-gcm"
+
+	keyName = "key"
+	// keySize is the size of master and data keys.
+	keySize = 32
+	// saltSize is the size of the random salt stored in the header of
+	// encrypted blocks. Every block write derives a fresh AES key from
+	// the data key and the salt, so blocks can be rewritten any number
+	// of times without ever reusing a GCM nonce.
+	saltSize = 16
+	// tagSize is the size of the GCM authentication tag.
+	tagSize = 16
+
+	// fileHeaderSize is the size of the header starting the files of
+	// encrypted disks. It keeps the blocks after it aligned for O_DIRECT.
+	fileHeaderSize = alignment
+	// fileMagic starts file headers. The random file ID follows it.
+	fileMagic = "cfsfile1"
+	// fileIDSize is the size of the ID of a file.
+	fileIDSize = 16
+)
+
+var (
+	// ErrUnknownEncryption indicates the encryption algorithm is not supported.
+	ErrUnknownEncryption = errors.New("disk: unknown encryption algorithm")
+	// ErrNoKey indicates the master key needed by an encrypted disk is not
+	// in its keyring.
+	ErrNoKey = errors.New("disk: master key not found")
+	// ErrBadKey indicates a block or a data key failed authentication,
+	// so it was tampered with or encrypted with another key.
+	ErrBadKey = errors.New("disk: authentication failed")
+	// ErrBadFileHeader indicates the header of a file of an encrypted disk
+	// is missing or corrupted.
+	ErrBadFileHeader = errors.New("disk: bad file header")
+
+	zeroNonce [12]byte
+)
+
+// Keyring holds the master keys that wrap the data keys of encrypted disks.
+// Blocks are encrypted with the data key of their disk, which is stored in
+// MetaDir wrapped by a master key. Rotating master keys only rewraps data
+// keys and leaves the data untouched.
+type Keyring struct {
+	keys map[string][]byte
+	// current is the id of the key wrapping new data keys.
+	current string
+}
+
+// LoadKeyring reads a key file. Every line holds a key id and a hex encoded
+// 32-byte key separated by blanks; empty lines and lines starting with '#'
+// are skipped. The key on the last line is the current key. The others are
+// only kept to unwrap data keys not rotated yet.
+func LoadKeyring(name string) (*Keyring, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := &Keyring{keys: make(map[string][]byte)}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("disk: key file %s:%d: expect key id and key", name, n)
+		}
+		key, err := hex.DecodeString(fields[1])
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("disk: key file %s:%d: expect %d hex encoded bytes", name, n, keySize)
+		}
+		r.keys[fields[0]] = key
+		r.current = fields[0]
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if r.current == "" {
+		return nil, fmt.Errorf("disk: key file %s holds no key", name)
+	}
+	return r, nil
+}
+
+// wrappedKey is a data key encrypted by a master key.
+type wrappedKey struct {
+	KeyID string `json:"key_id"`
+	Nonce []byte `json:"nonce"`
+	Key   []byte `json:"key"`
+}
+
+func (r *Keyring) aead(id string) (cipher.AEAD, error) {
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, ErrNoKey
+	}
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(b)
+}
+
+// wrap encrypts a data key with the current master key.
+func (r *Keyring) wrap(key []byte) (wrappedKey, error) {
+	aead, err := r.aead(r.current)
+	if err != nil {
+		return wrappedKey{}, err
+	}
+	w := wrappedKey{KeyID: r.current, Nonce: make([]byte, aead.NonceSize())}
+	if _, err := io.ReadFull(rand.Reader, w.Nonce); err != nil {
+		return wrappedKey{}, err
+	}
+	w.Key = aead.Seal(nil, w.Nonce, key, []byte(w.KeyID))
+	return w, nil
+}
+
+// unwrap decrypts a data key with the master key that wrapped it.
+func (r *Keyring) unwrap(w wrappedKey) ([]byte, error) {
+	aead, err := r.aead(w.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(w.Nonce) != aead.NonceSize() {
+		return nil, ErrBadKey
+	}
+	key, err := aead.Open(nil, w.Nonce, w.Key, []byte(w.KeyID))
+	if err != nil {
+		return nil, ErrBadKey
+	}
+	return key, nil
+}
+
+// blockCipher encrypts blocks with keys derived from the data key of a disk.
+// The ID of the file and the index of the block are authenticated with every
+// block, so blocks cannot be moved around inside a file or between files.
+// Files copied as a whole, like the ones of snapshots, keep their ID.
+type blockCipher struct {
+	key []byte
+}
+
+func newBlockCipher(name string, key []byte) (*blockCipher, error) {
+	if name != AES256GCM {
+		return nil, ErrUnknownEncryption
+	}
+	return &blockCipher{key: key}, nil
+}
+
+func (c *blockCipher) aead(salt []byte) (cipher.AEAD, error) {
+	m := hmac.New(sha256.New, c.key)
+	m.Write(salt)
+	b, err := aes.NewCipher(m.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(b)
+}
+
+// seal encrypts p in place and appends the tag to it. A fresh salt is
+// stored into salt.
+func (c *blockCipher) seal(salt, p, ad []byte) error {
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	aead, err := c.aead(salt)
+	if err != nil {
+		return err
+	}
+	aead.Seal(p[:0], zeroNonce[:], p, ad)
+	return nil
+}
+
+// open decrypts p, which ends with its tag, in place.
+func (c *blockCipher) open(salt, p, ad []byte) ([]byte, error) {
+	aead, err := c.aead(salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(p[:0], zeroNonce[:], p, ad)
+	if err != nil {
+		return nil, ErrBadKey
+	}
+	return plain, nil
+}
+
+// blockAD returns the additional data authenticated with the block at
+// index: the ID of the file followed by the index.
+func (l layout) blockAD(index int) []byte {
+	ad := make([]byte, len(l.fileID)+8)
+	copy(ad, l.fileID)
+	binary.BigEndian.PutUint64(ad[len(l.fileID):], uint64(index))
+	return ad
+}
+
+// forFile returns the layout of the blocks of f, which carries the ID of
+// f on encrypted disks. The header holding the ID is written if f has no
+// block yet and create is set. Files without a header have no data.
+func (l layout) forFile(f file, create bool) (layout, error) {
+	if l.enc == nil || l.fileID != nil {
+		return l, nil
+	}
+	buf := getBuffer(fileHeaderSize)
+	defer putBuffer(buf)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return l, err
+	}
+	if n >= len(fileMagic)+fileIDSize && string(buf[:len(fileMagic)]) == fileMagic {
+		l.fileID = append([]byte(nil), buf[len(fileMagic):len(fileMagic)+fileIDSize]...)
+		return l, nil
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return l, err
+	}
+	if fi.Size() > int64(fileHeaderSize) {
+		return l, ErrBadFileHeader
+	}
+	if !create {
+		return l, nil
+	}
+
+	// The file holds no block, or a header torn by a crash
+	id := make([]byte, fileIDSize)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return l, err
+	}
+	for i := range buf {
+		buf[i] = 0
+	}
+	copy(buf, fileMagic)
+	copy(buf[len(fileMagic):], id)
+	if _, err := f.WriteAt(buf, 0); err != nil {
+		return l, err
+	}
+	l.fileID = id
+	return l, nil
+}
+
+// keyMu serializes the updates of the wrapped data keys of all disks.
+var keyMu sync.Mutex
+
+// createDataKey generates the data key of a new encrypted disk and stores
+// it wrapped with the current master key.
+func (d *Disk) createDataKey() error {
+	if d.Keyring == nil {
+		return ErrNoKey
+	}
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+	return d.storeDataKey(key, d.Keyring)
+}
+
+func (d *Disk) storeDataKey(key []byte, r *Keyring) error {
+	w, err := r.wrap(key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path.Join(d.Root, MetaDir, keyName), data)
+}
+
+// loadDataKey unwraps the data key of the disk with r.
+func (d *Disk) loadDataKey(r *Keyring) ([]byte, error) {
+	if r == nil {
+		return nil, ErrNoKey
+	}
+	data, err := ioutil.ReadFile(path.Join(d.Root, MetaDir, keyName))
+	if err != nil {
+		return nil, err
+	}
+	var w wrappedKey
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, err
+	}
+	return r.unwrap(w)
+}
+
+// RotateKey rewraps the data key of an encrypted disk with the current
+// key of r and makes r the keyring of the disk. The key wrapping the data
+// key before must still be in r. Data is not re-encrypted, so RotateKey
+// is cheap whatever the size of the disk.
+func (d *Disk) RotateKey(r *Keyring) error {
+	if d.Encryption == "" {
+		return nil
+	}
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	key, err := d.loadDataKey(r)
+	if err != nil {
+		return err
+	}
+	if err := d.storeDataKey(key, r); err != nil {
+		return err
+	}
+	d.Keyring = r
+	return nil
+}
@@ -0,0 +1,182 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func newTestKeyring(t *testing.T, ids ...string) *Keyring {
+	f, err := ioutil.TempFile("", "cfs-keys")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# test keys\n\n")
+	for _, id := range ids {
+		f.WriteString(id + " " + hex.EncodeToString(bytes.Repeat([]byte(id[:1]), keySize)) + "\n")
+	}
+	f.Close()
+	r, err := LoadKeyring(f.Name())
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	return r
+}
+
+func TestLoadKeyring(t *testing.T) {
+	r := newTestKeyring(t, "a1", "b2")
+	if r.current != "b2" || len(r.keys) != 2 {
+		t.Errorf("expect current key b2 of 2 keys, got %s of %d", r.current, len(r.keys))
+	}
+
+	f, err := ioutil.TempFile("", "cfs-keys")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("a1 abcd\n")
+	f.Close()
+	if _, err := LoadKeyring(f.Name()); err == nil {
+		t.Errorf("expect short key to be rejected")
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	tests := []struct {
+		blockSize   int
+		compression string
+	}{
+		{0, ""},
+		{MinCompressedBlockSize, Deflate},
+	}
+	for i, tt := range tests {
+		d := newTestDisk("disk0", "encrypt", false)
+		d.BlockSize = tt.blockSize
+		d.Compression = tt.compression
+		d.Encryption = AES256GCM
+		if err := d.Init(); err != ErrNoKey {
+			t.Fatalf("%d: expect error %v got %v", i, ErrNoKey, err)
+		}
+		d.Keyring = newTestKeyring(t, "a1")
+		if err := d.Init(); err != nil {
+			t.Fatalf("%d: error = %v", i, err)
+		}
+
+		p := []byte(strings.Repeat("secret data ", d.layout().payloadSize()/4))
+		if _, err := d.WriteAt(tmpTestFile, p, 5); err != nil {
+			t.Fatalf("%d: error = %v", i, err)
+		}
+		// rewriting a block must keep the other ones readable
+		if _, err := d.WriteAt(tmpTestFile, []byte("public"), 5); err != nil {
+			t.Fatalf("%d: error = %v", i, err)
+		}
+		copy(p, "public")
+		raw, err := ioutil.ReadFile(path.Join(d.Root, tmpTestFile))
+		if err != nil {
+			t.Fatalf("%d: error = %v", i, err)
+		}
+		if bytes.Contains(raw, []byte("secret")) {
+			t.Errorf("%d: expect data to be encrypted at rest", i)
+		}
+
+		// rotate to a new master key and drop the old one
+		if err := d.RotateKey(newTestKeyring(t, "a1", "b2")); err != nil {
+			t.Fatalf("%d: error = %v", i, err)
+		}
+		reopened := &Disk{Name: d.Name, Root: d.Root, Keyring: newTestKeyring(t, "b2")}
+		if err := reopened.Init(); err != nil {
+			t.Fatalf("%d: error = %v", i, err)
+		}
+		r := make([]byte, len(p))
+		if _, err := reopened.ReadAt(tmpTestFile, r, 5); err != nil {
+			t.Fatalf("%d: error = %v", i, err)
+		}
+		if !bytes.Equal(p, r) {
+			t.Errorf("%d: writen in data is not the same as read out data", i)
+		}
+
+		// a key with the same id but other bytes must not unwrap the data key
+		wrong := newTestKeyring(t, "b2")
+		wrong.keys["b2"] = bytes.Repeat([]byte("x"), keySize)
+		other := &Disk{Name: d.Name, Root: d.Root, Keyring: wrong}
+		if err := other.Init(); err != ErrBadKey {
+			t.Errorf("%d: expect error %v got %v", i, ErrBadKey, err)
+		}
+		d.Remove("", true)
+	}
+}
+
+func TestEncryptedBlockMoved(t *testing.T) {
+	d := newTestDisk("disk0", "encrypt", false)
+	defer d.Remove("", true)
+	d.Encryption = AES256GCM
+	d.Keyring = newTestKeyring(t, "a1")
+	if err := d.Init(); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	l := d.layout()
+	p := make([]byte, l.payloadSize()*2)
+	fillPattern(p, len(p))
+	if _, err := d.WriteAt(tmpTestFile, p, 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+
+	// swap the two blocks; both stay intact but are at the wrong index
+	fn := path.Join(d.Root, tmpTestFile)
+	raw, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	blocks := raw[l.base:]
+	swapped := append(append(append([]byte{}, raw[:l.base]...), blocks[l.blockSize:]...), blocks[:l.blockSize]...)
+	if err := ioutil.WriteFile(fn, swapped, 0600); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := d.ReadAt(tmpTestFile, p, 0); err != ErrBadKey {
+		t.Errorf("expect error %v got %v", ErrBadKey, err)
+	}
+}
+
+func TestEncryptedBlockMovedBetweenFiles(t *testing.T) {
+	d := newTestDisk("disk0", "encrypt", false)
+	defer d.Remove("", true)
+	d.Encryption = AES256GCM
+	d.Keyring = newTestKeyring(t, "a1")
+	if err := d.Init(); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	l := d.layout()
+	p := make([]byte, l.payloadSize())
+	fillPattern(p, len(p))
+	for _, name := range []string{"a", "b"} {
+		if _, err := d.WriteAt(name, p, 0); err != nil {
+			t.Fatalf("error = %v", err)
+		}
+	}
+
+	// copy the block of a over the one of b at the same index
+	a, err := ioutil.ReadFile(path.Join(d.Root, "a"))
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	fn := path.Join(d.Root, "b")
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if bytes.Equal(a[:l.base], b[:l.base]) {
+		t.Errorf("expect files to have different IDs")
+	}
+	copy(b[l.base:], a[l.base:])
+	if err := ioutil.WriteFile(fn, b, 0600); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := d.ReadAt("b", p, 0); err != ErrBadKey {
+		t.Errorf("expect error %v got %v", ErrBadKey, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"sync"
 )
 
 // TODO: interface?
@@ -14,133 +15,285 @@ type Disk struct {
 	// Usually it is the mount point of a disk or a directory
 	// under the mount point.
 	Root string
+	// Cache caches verified block payloads read from the disk.
+	// A nil Cache disables caching.
+	Cache *Cache
+	// IOMode is how the files of the disk are accessed.
+	IOMode IOMode
+	// BlockSize is the size of the blocks of the disk. Zero means
+	// DefaultBlockSize. Init sets it to the block size recorded on the disk.
+	BlockSize int
+	// Checksum is the name of the block checksum algorithm of the disk.
+	// Empty means CRC32C. Init sets it to the checksum recorded on the disk.
+	Checksum string
+	// Compression is the name of the block compression algorithm of the
+	// disk. Empty means no compression. Init sets it to the compression
+	// recorded on the disk.
+	Compression string
+	// Encryption is the name of the block encryption algorithm of the disk.
+	// Empty means no encryption. Init sets it to the encryption recorded
+	// on the disk.
+	Encryption string
+	// Keyring holds the master key wrapping the data key of an encrypted disk.
+	Keyring *Keyring
+	// Trash makes removed files go to the trash of the disk, from where
+	// they can be undeleted until they are purged.
+	Trash bool
+	// TxnLeftovers are the names of the files that Init found moved aside
+	// by Txns cut short by a crash. Init moved them to the trash if the disk
+	// has one and deleted them otherwise.
+	TxnLeftovers []string
+
+	// l is the layout of the disk format loaded by Init.
+	l layout
+	// snapMu is held for reading by the holders of file locks, and for
+	// writing by snapshots so that they see no file half updated.
+	snapMu sync.RWMutex
 }
 
 // ReadAt reads up to len(p) bytes starting at byte offset off
 // from the File into p.
 // It returns the number of bytes read and an error, if any.
 func (d *Disk) ReadAt(name string, p []byte, off int64) (int, error) {
-	dataOffset := int(off)
+	key := path.Clean(name)
 	name = path.Join(d.Root, name)
+	var f file
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	return d.read(key, func() (file, error) {
+		var err error
+		f, err = d.openFile(name, os.O_RDONLY)
+		return f, err
+	}, p, int(off))
+}
+
+// read reads into p from dataOffset of the file named key. It serves the
+// leading cached blocks by itself and calls open for the file only if some
+// blocks are not cached.
+func (d *Disk) read(key string, open func() (file, error), p []byte, dataOffset int) (int, error) {
 	// nil or zero length payload
 	if len(p) == 0 {
 		return 0, nil
 	}
 
-	f, err := os.OpenFile(name, os.O_RDONLY, 0600)
-	if err != nil {
-		return 0, err
-	}
-	defer f.Close()
-
-	index, offset := blockIndexAndOffset(dataOffset)
-	stream := &BlockReaderStream{index, offset, f}
+	l := d.layout()
+	index, offset := l.blockIndexAndOffset(dataOffset)
 	read := 0
-	for {
-		block, err := stream.NextBlock()
-		copied := copy(p, block.Payload())
-		// We just copied some data into p, shrink p
-		p = p[copied:]
-		read += copied
-		if err != nil {
-			return read, err
+	var fill func(int, []byte)
+	if d.Cache != nil {
+		// Serve the leading cached blocks without touching the file
+		for len(p) > 0 {
+			payload, ok := d.Cache.get(d.Name, key, index)
+			if !ok {
+				break
+			}
+			if offset < len(payload) {
+				copied := copy(p, payload[offset:])
+				p = p[copied:]
+				read += copied
+			}
+			if len(payload) < l.payloadSize() && len(p) > 0 {
+				return read, io.EOF
+			}
+			index++
+			offset = 0
 		}
 		if len(p) == 0 {
 			return read, nil
 		}
-		if block.right < payloadSize {
-			return read, io.EOF
+		gen := d.Cache.generation()
+		fill = func(i int, payload []byte) {
+			d.Cache.put(d.Name, key, i, payload, gen)
 		}
 	}
+
+	f, err := open()
+	if err != nil {
+		return read, err
+	}
+	if l, err = l.forFile(f, false); err != nil {
+		return read, err
+	}
+
+	n, err := l.readAt(f, p, index, offset, fill)
+	return read + n, err
 }
 
 // getDataSize returns the size of data in file (excluding the crc header size)
-func (d *Disk) getDataSize(f *os.File) int {
-	fi, err := f.Stat()
+func (d *Disk) getDataSize(f file) int {
+	size, err := d.layout().fileDataSize(f)
 	if err != nil {
 		return 0
 	}
-	s := int(fi.Size())
-	blockNum := (s + blockSize - 1) / blockSize
-	return s - blockNum*crc32Len
+	return size
 }
 
 // WriteAt writes len(p) bytes to the File starting at byte offset off.
 // It returns the number of bytes written and an error, if any. WriteAt
 // returns a non-nil error when n != len(p).
 func (d *Disk) WriteAt(name string, p []byte, off int64) (int, error) {
-	dataOffset := int(off)
-	name = path.Join(d.Root, name)
+	key := path.Clean(name)
+	mu := d.lockFile(key)
+	defer mu.Unlock()
+	return d.writeAt(key, p, off)
+}
+
+// writeAt is WriteAt on a locked file.
+func (d *Disk) writeAt(key string, p []byte, off int64) (int, error) {
 	// nil or zero length payload
 	if len(p) == 0 {
 		return 0, nil
 	}
-	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0600)
+	if err := d.unshare(key); err != nil {
+		return 0, err
+	}
+	f, err := d.openFile(path.Join(d.Root, key), os.O_CREATE|os.O_RDWR)
 	if err != nil {
 		return 0, err
 	}
 	defer f.Close()
-	fileDataLength := d.getDataSize(f)
-	index, offset := blockIndexAndOffset(dataOffset)
-	fileDataIndex, _ := blockIndexAndOffset(fileDataLength)
-	currentIndex := fileDataIndex
-	// fill with 0 padding
-	for currentIndex < index {
-		block := newBlock()
-		if currentIndex == fileDataIndex {
-			err := readBlock(f, block, currentIndex)
-			if err != nil && err != io.EOF {
-				return 0, err
-			}
-			block.right = payloadSize
+
+	return d.write(f, key, p, int(off), d.getDataSize(f))
+}
+
+// write writes p at dataOffset into f, the open file key holding size
+// bytes of data, and keeps the cache and the Merkle tree of the file in sync.
+func (d *Disk) write(f file, key string, p []byte, dataOffset, size int) (int, error) {
+	l, err := d.layout().forFile(f, true)
+	if err != nil {
+		return 0, err
+	}
+	t := d.beginMerkle(key, int64(size))
+	var leaves []leaf
+	n, err := l.writeAt(f, p, dataOffset, size, func(i int, payload []byte) {
+		leaves = append(leaves, leaf{i, leafDigest(payload)})
+	})
+	d.endMerkle(t, leaves, int64(size), int64(max(size, dataOffset+len(p))), err)
+	d.bumpGeneration(key)
+	if d.Cache != nil {
+		// The old last block is rewritten when it gets padded
+		from, _ := l.blockIndexAndOffset(min(dataOffset, size))
+		to, _ := l.blockIndexAndOffset(dataOffset + len(p) - 1)
+		d.Cache.invalidate(d.Name, key, from, to)
+		if d.linked(key, f) {
+			d.Cache.invalidateTree(d.Name, ".")
 		}
-		writeBlock(f, block, currentIndex)
-		currentIndex += 1
 	}
+	return n, err
+}
 
-	stream := BlockWriterStream{offset, p, f}
-	written := 0
-	for {
-		block, err := stream.NextBlock()
-		if block.IsEmpty() {
-			return written, err
-		}
-		toWrite := len(block.Payload())
-		if block.IsPartial() {
-			// Merge with existing
-			base := newBlock()
-			err := readBlock(f, base, index)
-			if err != nil && err != io.EOF {
-				return written, err
-			}
-			base.Merge(block)
-			block = base
-		}
-		err = writeBlock(f, block, index)
-		if err != nil {
-			return written, err
+// Truncate changes the size of the data of the named file, creating it
+// if it does not exist. Growing the file leaves a hole, which reads back
+// as zeros.
+func (d *Disk) Truncate(name string, size int64) error {
+	key := path.Clean(name)
+	mu := d.lockFile(key)
+	defer mu.Unlock()
+	return d.truncate(key, size)
+}
+
+// truncate is Truncate on a locked file.
+func (d *Disk) truncate(key string, size int64) error {
+	if err := d.unshare(key); err != nil {
+		return err
+	}
+	f, err := d.openFile(path.Join(d.Root, key), os.O_CREATE|os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	l := d.layout()
+	cur, newSize := d.getDataSize(f), int(size)
+	if newSize > cur {
+		_, err := d.write(f, key, []byte{0}, newSize-1, cur)
+		return err
+	}
+	if newSize == cur {
+		return nil
+	}
+	if l, err = l.forFile(f, false); err != nil {
+		return err
+	}
+	d.dropMerkle(key)
+	err = l.truncate(f, newSize)
+	d.bumpGeneration(key)
+	if d.Cache != nil {
+		from, _ := l.blockIndexAndOffset(newSize)
+		to, _ := l.blockIndexAndOffset(cur - 1)
+		d.Cache.invalidate(d.Name, key, from, to)
+		if d.linked(key, f) {
+			d.Cache.invalidateTree(d.Name, ".")
 		}
+	}
+	return err
+}
 
-		written += toWrite
-		index++
+// Size returns the size of data in the named file (excluding the crc header size)
+func (d *Disk) Size(name string) (int64, error) {
+	f, err := d.openFile(path.Join(d.Root, name), os.O_RDONLY)
+	if err != nil {
+		return 0, err
 	}
+	defer f.Close()
+	return int64(d.getDataSize(f)), nil
+}
+
+// Stat returns the file info of the named file. It does not follow
+// symbolic links.
+func (d *Disk) Stat(name string) (os.FileInfo, error) {
+	return os.Lstat(path.Join(d.Root, name))
 }
 
 func (d *Disk) Rename(oldname, newname string) error {
-	oldname = path.Join(d.Root, oldname)
-	newname = path.Join(d.Root, newname)
-	return os.Rename(oldname, newname)
+	mu := d.lockFiles(path.Clean(oldname), path.Clean(newname))
+	defer mu.Unlock()
+	return d.rename(oldname, newname)
+}
+
+// rename is Rename with oldname and newname locked.
+func (d *Disk) rename(oldname, newname string) error {
+	err := os.Rename(path.Join(d.Root, oldname), path.Join(d.Root, newname))
+	if err == nil {
+		d.renameSidecars(oldname, newname)
+	}
+	if d.Cache != nil {
+		d.Cache.invalidateTree(d.Name, oldname)
+		d.Cache.invalidateTree(d.Name, newname)
+	}
+	return err
 }
 
+// Remove removes the named file, or directory with all it contains if all
+// is set. If the disk has a trash, the file goes to the trash.
 func (d *Disk) Remove(name string, all bool) error {
-	name = path.Join(d.Root, name)
+	mu := d.lockFile(path.Clean(name))
+	defer mu.Unlock()
+	return d.discard(name, all)
+}
+
+// remove deletes the named file for good. The file must be locked.
+func (d *Disk) remove(name string, all bool) error {
+	var err error
 	if !all {
-		return os.Remove(name)
+		err = os.Remove(path.Join(d.Root, name))
+	} else {
+		err = os.RemoveAll(path.Join(d.Root, name))
+	}
+	if err == nil {
+		d.removeSidecars(name)
+	}
+	if d.Cache != nil {
+		d.Cache.invalidateTree(d.Name, name)
 	}
-	return os.RemoveAll(name)
+	return err
 }
 
 func (d *Disk) ReadDir(name string) ([]os.FileInfo, error) {
+	isRoot := path.Clean("/"+name) == "/"
 	name = path.Join(d.Root, name)
 	f, err := os.Open(name)
 	if err != nil {
@@ -148,7 +301,16 @@ func (d *Disk) ReadDir(name string) ([]os.FileInfo, error) {
 	}
 	defer f.Close()
 
-	return f.Readdir(0)
+	fis, err := f.Readdir(0)
+	if err != nil || !isRoot {
+		return fis, err
+	}
+	for i, fi := range fis {
+		if fi.Name() == MetaDir {
+			return append(fis[:i], fis[i+1:]...), nil
+		}
+	}
+	return fis, nil
 }
 
 func (d *Disk) Mkdir(name string, all bool) error {
@@ -29,10 +29,10 @@ func setUpDiskTestFile(fileName string, length int, t *testing.T) *os.File {
 		if length < payloadSize {
 			fillLen = length
 		}
-		block := newBlock()
+		block := defaultLayout.newBlock()
 		block.right = 0
 		block.Copy(0, b[:fillLen])
-		if err := writeBlock(f, block, index); err != nil {
+		if err := defaultLayout.writeBlock(f, block, index); err != nil {
 			t.Fatalf("write tmp test file got error: %v", err)
 		}
 		length = length - fillLen
@@ -478,3 +478,125 @@ func TestReadEOF(t *testing.T) {
 		d.Remove("", true)
 	}
 }
+
+func TestReadWriteAcrossSpans(t *testing.T) {
+	defer func(n int) { maxSpanSize = n }(maxSpanSize)
+	maxSpanSize = 2 * blockSize
+
+	tests := []struct {
+		offSet   int
+		writeLen int
+	}{
+		// exactly one span
+		{0, payloadSize * 2},
+		// several spans with a partial head and tail block
+		{payloadSize / 2, payloadSize * 5},
+		// zero padding spanning several spans
+		{payloadSize * 7, 10},
+	}
+	for i, tt := range tests {
+		d := newTestDisk("disk0", "span", true)
+		p := make([]byte, tt.writeLen)
+		fillPattern(p, tt.writeLen)
+		wn, err := d.WriteAt(tmpTestFile, p, int64(tt.offSet))
+		if err != nil || wn != tt.writeLen {
+			t.Errorf("%d: write %d bytes, error = %v", i, wn, err)
+		}
+		r := make([]byte, tt.offSet+tt.writeLen)
+		rn, err := d.ReadAt(tmpTestFile, r, 0)
+		if err != nil || rn != len(r) {
+			t.Errorf("%d: read %d bytes, error = %v", i, rn, err)
+		}
+		if !bytes.Equal(r[:tt.offSet], make([]byte, tt.offSet)) {
+			t.Errorf("%d: expect zero padding before offset %d", i, tt.offSet)
+		}
+		if !bytes.Equal(r[tt.offSet:], p) {
+			t.Errorf("%d: writen in data is not the same as read out data", i)
+		}
+		d.Remove("", true)
+	}
+}
+
+func TestWriteExtendsFile(t *testing.T) {
+	defer func(n int) { maxSpanSize = n }(maxSpanSize)
+	maxSpanSize = 2 * blockSize
+
+	d := newTestDisk("disk0", "extend", true)
+	defer d.Remove("", true)
+	head := bytes.Repeat([]byte{7}, 10)
+	if _, err := d.WriteAt(tmpTestFile, head, 0); err != nil {
+		t.Fatalf("write error = %v", err)
+	}
+	// the padding starts in the partial last block and spans several spans
+	if _, err := d.WriteAt(tmpTestFile, []byte{1}, int64(payloadSize*3)); err != nil {
+		t.Fatalf("write error = %v", err)
+	}
+	r := make([]byte, payloadSize*3+1)
+	if rn, err := d.ReadAt(tmpTestFile, r, 0); err != nil || rn != len(r) {
+		t.Fatalf("read %d bytes, error = %v", rn, err)
+	}
+	if !bytes.Equal(r[:len(head)], head) {
+		t.Errorf("existing data = %v, want %v", r[:len(head)], head)
+	}
+	if !bytes.Equal(r[len(head):payloadSize*3], make([]byte, payloadSize*3-len(head))) {
+		t.Errorf("expect zero padding after the existing data")
+	}
+	if r[payloadSize*3] != 1 {
+		t.Errorf("written byte = %d, want 1", r[payloadSize*3])
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	d := newTestDisk("disk0", "truncate", true)
+	defer d.Remove("", true)
+	p := make([]byte, payloadSize*3)
+	fillPattern(p, len(p))
+	if _, err := d.WriteAt(tmpTestFile, p, 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	for _, size := range []int{payloadSize*2 + 5, payloadSize, 3, payloadSize * 4} {
+		if err := d.Truncate(tmpTestFile, int64(size)); err != nil {
+			t.Fatalf("%d: error = %v", size, err)
+		}
+		if n, _ := d.Size(tmpTestFile); n != int64(size) {
+			t.Fatalf("%d: expect size %d got %d", size, size, n)
+		}
+		if size < len(p) {
+			zero(p[size:])
+		}
+		r := make([]byte, size)
+		if _, err := d.ReadAt(tmpTestFile, r, 0); err != nil {
+			t.Fatalf("%d: error = %v", size, err)
+		}
+		if !bytes.Equal(p[:min(size, len(p))], r[:min(size, len(p))]) || !isZero(r[min(size, len(p)):]) {
+			t.Errorf("%d: unexpected data after truncate", size)
+		}
+	}
+
+	// a missing file is created
+	if err := d.Truncate("created", 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if fi, err := d.Stat("created"); err != nil || !fi.Mode().IsRegular() {
+		t.Errorf("stat of the created file = %v, %v", fi, err)
+	}
+	if n, err := d.Size("created"); err != nil || n != 0 {
+		t.Errorf("size of the created file = %d, %v, want 0", n, err)
+	}
+}
+
+func BenchmarkReadAt(b *testing.B) {
+	d := newTestDisk("disk0", "bench", true)
+	defer d.Remove("", true)
+	p := make([]byte, 1<<20)
+	if _, err := d.WriteAt(tmpTestFile, p, 0); err != nil {
+		b.Fatalf("error = %v", err)
+	}
+	b.SetBytes(int64(len(p)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.ReadAt(tmpTestFile, p, 0); err != nil {
+			b.Fatalf("error = %v", err)
+		}
+	}
+}
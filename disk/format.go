@@ -0,0 +1,204 @@
+package disk
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// MetaDir is the directory under the disk root that holds the cfs
+// metadata of the disk. ReadDir hides it from listings of the root.
+const MetaDir = ".cfs"
+
+const (
+	formatName    = "format"
+	formatVersion = 1
+)
+
+// ErrFormatMismatch indicates the configuration of a disk does not match
+// the format recorded on it.
+var ErrFormatMismatch = errors.New("disk: configuration does not match disk format")
+
+// format is the on-disk format of a disk. Data stored on the disk can only
+// be read back with the same format, so it is recorded in MetaDir when the
+// disk is first initialized.
+type format struct {
+	Version   int `json:"version"`
+	BlockSize int `json:"block_size"`
+	// Checksum is empty on disks formatted before checksums could be
+	// chosen, which use CRC32C.
+	Checksum string `json:"checksum,omitempty"`
+	// Compression is empty on disks that are not compressed.
+	Compression string `json:"compression,omitempty"`
+	// Encryption is empty on disks that are not encrypted.
+	Encryption string `json:"encryption,omitempty"`
+}
+
+// defaultFormat is the format of disks that do not choose one.
+var defaultFormat = format{Version: formatVersion, BlockSize: DefaultBlockSize, Checksum: CRC32C}
+
+// configured returns the format chosen by the Disk fields.
+// Zero fields take the defaults.
+func (d *Disk) configured() format {
+	f := format{Version: formatVersion, BlockSize: d.BlockSize, Checksum: d.Checksum,
+		Compression: d.Compression, Encryption: d.Encryption}
+	if f.BlockSize == 0 {
+		f.BlockSize = defaultFormat.BlockSize
+	}
+	if f.Checksum == "" {
+		f.Checksum = defaultFormat.Checksum
+	}
+	return f
+}
+
+// matches tells if the format satisfies the Disk fields that are set.
+func (d *Disk) matches(f format) bool {
+	return (d.BlockSize == 0 || d.BlockSize == f.BlockSize) &&
+		(d.Checksum == "" || d.Checksum == f.Checksum) &&
+		(d.Compression == "" || d.Compression == f.Compression) &&
+		(d.Encryption == "" || d.Encryption == f.Encryption)
+}
+
+// Init prepares the disk for use. On first use it creates the root and
+// records the format chosen by the Disk fields; afterwards the recorded
+// format is loaded back into them. A root holding data but no format was
+// written before formats were recorded and gets the default format.
+//
+// Init must be called before using a disk that is not in the default format.
+func (d *Disk) Init() error {
+	if err := os.MkdirAll(path.Join(d.Root, MetaDir), 0700); err != nil {
+		return err
+	}
+	if err := d.cleanTxns(); err != nil {
+		return err
+	}
+	fn := path.Join(d.Root, MetaDir, formatName)
+	data, err := ioutil.ReadFile(fn)
+	if err == nil {
+		f := defaultFormat
+		if err := json.Unmarshal(data, &f); err != nil {
+			return err
+		}
+		if f.Checksum == "" {
+			f.Checksum = CRC32C
+		}
+		if !d.matches(f) {
+			return ErrFormatMismatch
+		}
+		return d.load(f)
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	f := d.configured()
+	if !validBlockSize(f.BlockSize) {
+		return ErrBadBlockSize
+	}
+	if _, err := checksumByName(f.Checksum); err != nil {
+		return err
+	}
+	if _, err := compressorByName(f.Compression); err != nil {
+		return err
+	}
+	if f.Compression != "" && f.BlockSize < MinCompressedBlockSize {
+		return ErrBadBlockSize
+	}
+	empty, err := d.isEmpty()
+	if err != nil {
+		return err
+	}
+	if !empty && f != defaultFormat {
+		return ErrFormatMismatch
+	}
+	if f.Encryption != "" {
+		if _, err := newBlockCipher(f.Encryption, nil); err != nil {
+			return err
+		}
+		// The data key must exist before the format refers to it
+		if err := d.createDataKey(); err != nil {
+			return err
+		}
+	}
+	if data, err = json.Marshal(f); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(fn, data); err != nil {
+		return err
+	}
+	return d.load(f)
+}
+
+// load sets up the disk to use the format f.
+func (d *Disk) load(f format) error {
+	sum, err := checksumByName(f.Checksum)
+	if err != nil {
+		return err
+	}
+	comp, err := compressorByName(f.Compression)
+	if err != nil {
+		return err
+	}
+	if !validBlockSize(f.BlockSize) {
+		return ErrBadBlockSize
+	}
+	var enc *blockCipher
+	if f.Encryption != "" {
+		key, err := d.loadDataKey(d.Keyring)
+		if err != nil {
+			return err
+		}
+		if enc, err = newBlockCipher(f.Encryption, key); err != nil {
+			return err
+		}
+	}
+	d.BlockSize = f.BlockSize
+	d.Checksum = f.Checksum
+	d.Compression = f.Compression
+	d.Encryption = f.Encryption
+	d.l = newLayout(f.BlockSize, sum, comp, enc)
+	return nil
+}
+
+// layout returns the block layout of the disk.
+func (d *Disk) layout() layout {
+	if d.l.blockSize == 0 {
+		return defaultLayout
+	}
+	return d.l
+}
+
+// isEmpty tells if the root holds nothing but MetaDir.
+func (d *Disk) isEmpty() (bool, error) {
+	f, err := os.Open(d.Root)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(0)
+	if err != nil {
+		return false, err
+	}
+	for _, n := range names {
+		if n != MetaDir {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func validBlockSize(n int) bool {
+	return n >= MinBlockSize && n <= MaxBlockSize && n&(n-1) == 0
+}
+
+// writeFileAtomic replaces the file name with data, so readers either see
+// the old or the new content.
+func writeFileAtomic(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
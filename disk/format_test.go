@@ -0,0 +1,88 @@
+package disk
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInitFormat(t *testing.T) {
+	tests := []struct {
+		blockSize  int
+		reopenSize int
+		err        error
+	}{
+		// default format
+		{0, 0, nil},
+		// the recorded block size is loaded back
+		{64 << 10, 0, nil},
+		{1 << 20, 1 << 20, nil},
+		// the recorded block size wins over the configuration
+		{64 << 10, 4 << 10, ErrFormatMismatch},
+	}
+	for i, tt := range tests {
+		d := newTestDisk("disk0", "format", false)
+		d.BlockSize = tt.blockSize
+		if err := d.Init(); err != nil {
+			t.Fatalf("%d: error = %v", i, err)
+		}
+		p := make([]byte, d.layout().payloadSize()*2+10)
+		fillPattern(p, len(p))
+		if _, err := d.WriteAt(tmpTestFile, p, 7); err != nil {
+			t.Fatalf("%d: error = %v", i, err)
+		}
+
+		reopened := &Disk{Name: d.Name, Root: d.Root, BlockSize: tt.reopenSize}
+		if err := reopened.Init(); err != tt.err {
+			t.Fatalf("%d: expect error %v got %v", i, tt.err, err)
+		}
+		if tt.err == nil {
+			if reopened.BlockSize != d.BlockSize {
+				t.Errorf("%d: expect block size %d got %d", i, d.BlockSize, reopened.BlockSize)
+			}
+			r := make([]byte, len(p))
+			if _, err := reopened.ReadAt(tmpTestFile, r, 7); err != nil {
+				t.Fatalf("%d: error = %v", i, err)
+			}
+			if !bytes.Equal(p, r) {
+				t.Errorf("%d: writen in data is not the same as read out data", i)
+			}
+		}
+		d.Remove("", true)
+	}
+}
+
+func TestInitLegacyDisk(t *testing.T) {
+	d := newTestDisk("disk0", "legacy", true)
+	defer d.Remove("", true)
+	if _, err := d.WriteAt(tmpTestFile, []byte("data"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	big := &Disk{Name: d.Name, Root: d.Root, BlockSize: 64 << 10}
+	if err := big.Init(); err != ErrFormatMismatch {
+		t.Errorf("expect error %v got %v", ErrFormatMismatch, err)
+	}
+	if err := d.Init(); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if d.BlockSize != DefaultBlockSize {
+		t.Errorf("expect block size %d got %d", DefaultBlockSize, d.BlockSize)
+	}
+	fis, err := d.ReadDir("")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if len(fis) != 1 || fis[0].Name() != tmpTestFile {
+		t.Errorf("expect %s to be hidden from ReadDir", MetaDir)
+	}
+}
+
+func TestInitBadBlockSize(t *testing.T) {
+	for i, size := range []int{1024, 5000, MaxBlockSize * 2} {
+		d := newTestDisk("disk0", "bad-block-size", false)
+		d.BlockSize = size
+		if err := d.Init(); err != ErrBadBlockSize {
+			t.Errorf("%d: expect error %v got %v", i, ErrBadBlockSize, err)
+		}
+		d.Remove("", true)
+	}
+}
@@ -0,0 +1,127 @@
+package disk
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+)
+
+const genDir = "gen"
+
+// lastGeneration is the last generation handed out. Generations are
+// nanosecond timestamps made strictly increasing, so that no two changes
+// of any file share one, even across restarts.
+var lastGeneration uint64
+
+func nextGeneration() uint64 {
+	for {
+		last := atomic.LoadUint64(&lastGeneration)
+		g := uint64(time.Now().UnixNano())
+		if g <= last {
+			g = last + 1
+		}
+		if atomic.CompareAndSwapUint64(&lastGeneration, last, g) {
+			return g
+		}
+	}
+}
+
+// Generation returns the generation of the named file, a number that
+// changes whenever the data of the file does and is never reused, even
+// by other files. A file renamed over another keeps its own generation.
+func (d *Disk) Generation(name string) (uint64, error) {
+	key := path.Clean(name)
+	mu := d.lockFile(key)
+	defer mu.Unlock()
+	return d.generation(key)
+}
+
+// ReadWithGeneration reads up to length bytes of the named file starting at
+// off, and returns them with the generation of the file. Both are taken
+// under the lock of the file, so that the generation is the one of the
+// data read. Fewer bytes are returned if the file ends before.
+func (d *Disk) ReadWithGeneration(name string, off, length int64) ([]byte, uint64, error) {
+	if off < 0 {
+		return nil, 0, ErrNegativeOffset
+	}
+	key := path.Clean(name)
+	mu := d.lockFile(key)
+	defer mu.Unlock()
+	gen, err := d.generation(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := d.openFile(path.Join(d.Root, key), os.O_RDONLY)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	l, err := d.layout().forFile(f, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := l.fileDataSize(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	// size the data by what the file holds rather than by length
+	if remain := int64(size) - off; remain < length {
+		length = remain
+	}
+	if length < 0 {
+		length = 0
+	}
+	p := make([]byte, length)
+	n, err := d.read(key, func() (file, error) { return f, nil }, p, int(off))
+	if err == io.EOF {
+		err = nil
+	}
+	return p[:n], gen, err
+}
+
+// generation returns the generation of the named file, assigning a new
+// one to existing files that have none. The file must be locked.
+func (d *Disk) generation(key string) (uint64, error) {
+	var b [8]byte
+	f, err := os.Open(d.sidecar(genDir, key))
+	if err == nil {
+		_, err = f.ReadAt(b[:], 0)
+		f.Close()
+		if err == nil {
+			return binary.BigEndian.Uint64(b[:]), nil
+		}
+	}
+	if _, err := os.Stat(path.Join(d.Root, key)); err != nil {
+		return 0, err
+	}
+	return d.bumpGeneration(key), nil
+}
+
+// bumpGeneration gives the named file a new generation and returns it.
+// The file must be locked. If the generation cannot be recorded, the old
+// one is dropped so that it is not mistaken for the current one.
+func (d *Disk) bumpGeneration(key string) uint64 {
+	g := nextGeneration()
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], g)
+	fn := d.sidecar(genDir, key)
+	f, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY, 0600)
+	if os.IsNotExist(err) {
+		if err = os.MkdirAll(path.Dir(fn), 0700); err == nil {
+			f, err = os.OpenFile(fn, os.O_CREATE|os.O_WRONLY, 0600)
+		}
+	}
+	if err == nil {
+		_, err = f.WriteAt(b[:], 0)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		os.Remove(fn)
+	}
+	return g
+}
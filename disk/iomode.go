@@ -0,0 +1,112 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// IOMode selects how a disk accesses the files under its root.
+type IOMode int
+
+const (
+	// Buffered reads and writes through the page cache.
+	Buffered IOMode = iota
+	// Direct bypasses the page cache with O_DIRECT. Block spans are
+	// moved with aligned buffers; unaligned tails of writes go through
+	// a buffered descriptor.
+	Direct
+	// Sync writes through the page cache with O_DSYNC, so a write
+	// returns only after its data reached the device.
+	Sync
+)
+
+// ErrIOModeUnsupported indicates the I/O mode is not supported on this platform.
+var ErrIOModeUnsupported = errors.New("disk: unsupported I/O mode")
+
+// ParseIOMode parses the name of an I/O mode. The empty string is Buffered.
+func ParseIOMode(s string) (IOMode, error) {
+	switch s {
+	case "", "buffered":
+		return Buffered, nil
+	case "direct":
+		return Direct, nil
+	case "dsync":
+		return Sync, nil
+	}
+	return Buffered, fmt.Errorf("disk: unknown I/O mode %q", s)
+}
+
+func (m IOMode) String() string {
+	switch m {
+	case Buffered:
+		return "buffered"
+	case Direct:
+		return "direct"
+	case Sync:
+		return "dsync"
+	}
+	return fmt.Sprintf("IOMode(%d)", int(m))
+}
+
+// file is an open disk file. Blocks are only accessed through ReadAt and
+// WriteAt at block aligned offsets.
+type file interface {
+	io.ReaderAt
+	io.WriterAt
+	Stat() (os.FileInfo, error)
+	Truncate(size int64) error
+	Close() error
+}
+
+// openFile opens the file at the absolute path name honoring the disk I/O
+// mode. Symbolic links are not followed.
+func (d *Disk) openFile(name string, flag int) (file, error) {
+	extra, err := ioModeFlag(d.IOMode)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(name, flag|extra|oNoFollow, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if d.IOMode != Direct {
+		return f, nil
+	}
+	return &directFile{File: f, name: name, flag: flag}, nil
+}
+
+// directFile is a file opened with O_DIRECT. O_DIRECT transfers must be
+// aligned in memory, offset and length. Pooled buffers are aligned and
+// blocks start at aligned offsets, but the last block of a file is
+// usually shorter than a block, so the unaligned tail of a write is
+// written through a second, buffered descriptor.
+type directFile struct {
+	*os.File
+	name     string
+	flag     int
+	buffered *os.File
+}
+
+func (f *directFile) WriteAt(p []byte, off int64) (int, error) {
+	aligned := len(p) &^ (alignment - 1)
+	n, err := f.File.WriteAt(p[:aligned], off)
+	if err != nil || aligned == len(p) {
+		return n, err
+	}
+	if f.buffered == nil {
+		if f.buffered, err = os.OpenFile(f.name, f.flag&^os.O_CREATE, 0600); err != nil {
+			return n, err
+		}
+	}
+	m, err := f.buffered.WriteAt(p[aligned:], off+int64(aligned))
+	return n + m, err
+}
+
+func (f *directFile) Close() error {
+	if f.buffered != nil {
+		f.buffered.Close()
+	}
+	return f.File.Close()
+}
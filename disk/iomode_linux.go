@@ -0,0 +1,16 @@
+package disk
+
+import "syscall"
+
+// oNoFollow keeps openFile from following symbolic links.
+const oNoFollow = syscall.O_NOFOLLOW
+
+func ioModeFlag(m IOMode) (int, error) {
+	switch m {
+	case Direct:
+		return syscall.O_DIRECT, nil
+	case Sync:
+		return syscall.O_DSYNC, nil
+	}
+	return 0, nil
+}
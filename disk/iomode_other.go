@@ -0,0 +1,19 @@
+// +build !linux
+
+package disk
+
+import "os"
+
+// oNoFollow is not set on other platforms, where symbolic links are
+// followed.
+const oNoFollow = 0
+
+func ioModeFlag(m IOMode) (int, error) {
+	switch m {
+	case Direct:
+		return 0, ErrIOModeUnsupported
+	case Sync:
+		return os.O_SYNC, nil
+	}
+	return 0, nil
+}
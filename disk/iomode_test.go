@@ -0,0 +1,65 @@
+package disk
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestIOModes(t *testing.T) {
+	tests := []struct {
+		mode     IOMode
+		offSet   int
+		writeLen int
+	}{
+		{Buffered, 0, payloadSize * 3},
+		{Sync, 10, payloadSize * 2},
+		// aligned span followed by an unaligned tail
+		{Direct, 0, payloadSize*3 + 10},
+		// partial block merged with the existing one
+		{Direct, payloadSize / 2, 100},
+	}
+	for i, tt := range tests {
+		d := newTestDisk("disk0", "iomode", true)
+		d.IOMode = tt.mode
+		p := make([]byte, tt.writeLen)
+		fillPattern(p, tt.writeLen)
+		_, err := d.WriteAt(tmpTestFile, p, int64(tt.offSet))
+		if err == ErrIOModeUnsupported || isInvalid(err) {
+			// e.g. O_DIRECT on tmpfs
+			t.Logf("%d: skip %v mode (%v)", i, tt.mode, err)
+			d.Remove("", true)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d: error = %v", i, err)
+		}
+		r := make([]byte, tt.writeLen)
+		if _, err := d.ReadAt(tmpTestFile, r, int64(tt.offSet)); err != nil {
+			t.Fatalf("%d: error = %v", i, err)
+		}
+		if !bytes.Equal(p, r) {
+			t.Errorf("%d: writen in data is not the same as read out data", i)
+		}
+		d.Remove("", true)
+	}
+}
+
+func isInvalid(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err == syscall.EINVAL
+	}
+	return err == syscall.EINVAL
+}
+
+func TestParseIOMode(t *testing.T) {
+	for _, m := range []IOMode{Buffered, Direct, Sync} {
+		if pm, err := ParseIOMode(m.String()); err != nil || pm != m {
+			t.Errorf("expect %v, got %v (%v)", m, pm, err)
+		}
+	}
+	if _, err := ParseIOMode("mmap"); err == nil {
+		t.Errorf("expect error for unknown mode")
+	}
+}
@@ -0,0 +1,306 @@
+package disk
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Files linked by Link are marked with a link sidecar. The names of a file
+// share its generation and Merkle tree, whose sidecars are hard linked too,
+// but not its cached blocks, so writes to a linked file drop the cache of
+// the whole disk.
+const linkDir = "link"
+
+var (
+	errNotRegular  = errors.New("disk: not a regular file")
+	errLinkOutside = errors.New("disk: link target outside of the disk")
+)
+
+// Link makes newname a hard link to the regular file oldname. Writes
+// through either name are seen through the other; they are not serialized
+// with each other, as locks are taken by name. Taking a snapshot of a
+// linked file breaks the link when the file is next written.
+func (d *Disk) Link(oldname, newname string) error {
+	oldkey, newkey := path.Clean(oldname), path.Clean(newname)
+	mu := d.lockFiles(oldkey, newkey)
+	defer mu.Unlock()
+
+	fi, err := os.Lstat(path.Join(d.Root, oldkey))
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errNotRegular}
+	}
+	// the new name must not share data with a snapshot unmarked
+	if err := d.unshare(oldkey); err != nil {
+		return err
+	}
+	if err := os.Link(path.Join(d.Root, oldkey), path.Join(d.Root, newkey)); err != nil {
+		return err
+	}
+	if err := d.linkSidecars(oldkey, newkey); err != nil {
+		os.Remove(path.Join(d.Root, newkey))
+		d.removeSidecars(newkey)
+		return err
+	}
+	if d.Cache != nil {
+		d.Cache.invalidateTree(d.Name, newkey)
+	}
+	return nil
+}
+
+// linkSidecars hard links the generation and Merkle tree of newkey to the
+// ones of oldkey, and marks both files as linked.
+func (d *Disk) linkSidecars(oldkey, newkey string) error {
+	if _, err := d.generation(oldkey); err != nil {
+		return err
+	}
+	t, err := d.openMerkle(oldkey, os.O_CREATE|os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	t.f.Close()
+	for _, kind := range []string{genDir, merkleDir} {
+		fn := d.sidecar(kind, newkey)
+		os.Remove(fn)
+		if err := os.MkdirAll(path.Dir(fn), 0700); err != nil {
+			return err
+		}
+		if err := os.Link(d.sidecar(kind, oldkey), fn); err != nil {
+			return err
+		}
+	}
+	if err := d.mark(linkDir, oldkey); err != nil {
+		return err
+	}
+	return d.mark(linkDir, newkey)
+}
+
+// unlinkSidecars gives the named file its own generation and Merkle tree
+// once it no longer shares its data with its other names. The file must
+// be locked.
+func (d *Disk) unlinkSidecars(key string) {
+	if !d.marked(linkDir, key) {
+		return
+	}
+	os.Remove(d.sidecar(merkleDir, key))
+	os.Remove(d.sidecar(genDir, key))
+	d.bumpGeneration(key)
+	os.Remove(d.sidecar(linkDir, key))
+}
+
+// linked reports whether the named file, open as f, has other names.
+// Stale marks of files whose other names were removed are dropped.
+func (d *Disk) linked(key string, f file) bool {
+	if !d.marked(linkDir, key) {
+		return false
+	}
+	if fi, err := f.Stat(); err == nil && linkCount(fi) < 2 {
+		os.Remove(d.sidecar(linkDir, key))
+		return false
+	}
+	return true
+}
+
+// Symlink makes name a symbolic link to target, a regular file of the
+// disk. The link is recorded with the absolute path of the target so that
+// it stays inside the disk wherever the link is moved. Reads and writes do
+// not follow symbolic links; clients resolve them with Readlink.
+func (d *Disk) Symlink(target, name string) error {
+	tkey := path.Clean("/" + target)[1:]
+	if tkey == "" || tkey == MetaDir || strings.HasPrefix(tkey, MetaDir+"/") {
+		return &os.LinkError{Op: "symlink", Old: target, New: name, Err: errLinkOutside}
+	}
+	fi, err := os.Lstat(path.Join(d.Root, tkey))
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return &os.LinkError{Op: "symlink", Old: target, New: name, Err: errNotRegular}
+	}
+	root, err := filepath.Abs(d.Root)
+	if err != nil {
+		return err
+	}
+	key := path.Clean(name)
+	mu := d.lockFile(key)
+	defer mu.Unlock()
+	return os.Symlink(path.Join(root, tkey), path.Join(d.Root, key))
+}
+
+// Readlink returns the target of the named symbolic link relative to the
+// root of the disk. It fails for targets outside of the disk.
+func (d *Disk) Readlink(name string) (string, error) {
+	fn := path.Join(d.Root, name)
+	link, err := os.Readlink(fn)
+	if err != nil {
+		return "", err
+	}
+	root, err := filepath.Abs(d.Root)
+	if err != nil {
+		return "", err
+	}
+	if !path.IsAbs(link) {
+		abs, err := filepath.Abs(path.Join(path.Dir(fn), link))
+		if err != nil {
+			return "", err
+		}
+		link = abs
+	}
+	rel, err := filepath.Rel(root, link)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") ||
+		rel == MetaDir || strings.HasPrefix(rel, MetaDir+"/") {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: errLinkOutside}
+	}
+	return rel, nil
+}
+
+// Clone copies the regular file src to dst, which must not exist. The copy
+// shares the blocks of src where the filesystem supports reflinks, and is
+// made in the kernel with copy_file_range otherwise. Where neither works,
+// the blocks are read, verified against their checksums and written one
+// by one.
+func (d *Disk) Clone(src, dst string) error {
+	skey, dkey := path.Clean(src), path.Clean(dst)
+	mu := d.lockFiles(skey, dkey)
+	defer mu.Unlock()
+
+	sfn, dfn := path.Join(d.Root, skey), path.Join(d.Root, dkey)
+	fi, err := os.Lstat(sfn)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return &os.LinkError{Op: "clone", Old: src, New: dst, Err: errNotRegular}
+	}
+	if _, err := os.Lstat(dfn); err == nil {
+		return &os.LinkError{Op: "clone", Old: src, New: dst, Err: os.ErrExist}
+	}
+	if d.Cache != nil {
+		defer d.Cache.invalidateTree(d.Name, dkey)
+	}
+
+	tmp := path.Join(d.Root, MetaDir, "clone-"+strconv.FormatUint(nextGeneration(), 10))
+	err = rawCopy(sfn, tmp, fi)
+	if err == nil {
+		// linking rather than renaming fails if dst was created meanwhile
+		err = os.Link(tmp, dfn)
+	}
+	os.Remove(tmp)
+	if os.IsExist(err) {
+		return err
+	}
+	if err != nil {
+		return d.copyBlocks(skey, dkey)
+	}
+	d.removeSidecars(dkey)
+	d.copyMerkle(skey, dkey)
+	d.bumpGeneration(dkey)
+	return nil
+}
+
+// rawCopy copies the bytes of src, whose info is fi, to dst in the kernel:
+// with a reflink if it can, and with copy_file_range of the allocated
+// ranges of src otherwise, keeping its holes.
+func rawCopy(src, dst string, fi os.FileInfo) error {
+	if err := cloneFile(src, dst, fi); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	ranges, err := allocatedRanges(in, fi.Size())
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		if err := copyRange(out, in, r.start, r.end-r.start); err != nil {
+			return err
+		}
+	}
+	if err := out.Truncate(fi.Size()); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// copyMerkle copies the Merkle tree of skey to dkey. A tree that cannot be
+// copied is rebuilt when next asked for.
+func (d *Disk) copyMerkle(skey, dkey string) {
+	src, dst := d.sidecar(merkleDir, skey), d.sidecar(merkleDir, dkey)
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(path.Dir(dst), 0700); err != nil {
+		return
+	}
+	if err := copyFile(src, dst, fi); err != nil {
+		os.Remove(dst)
+	}
+}
+
+// copyBlocks copies the data of skey to dkey block by block, verifying
+// every block read. Holes are kept. Both files must be locked.
+func (d *Disk) copyBlocks(skey, dkey string) error {
+	f, err := d.openFile(path.Join(d.Root, dkey), os.O_CREATE|os.O_EXCL|os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	d.removeSidecars(dkey)
+	if err := d.copyData(skey, dkey); err != nil {
+		d.remove(dkey, false)
+		return err
+	}
+	d.bumpGeneration(dkey)
+	return nil
+}
+
+func (d *Disk) copyData(skey, dkey string) error {
+	size, err := d.Size(skey)
+	if err != nil {
+		return err
+	}
+	extents, err := d.Extents(skey)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 64*d.layout().payloadSize())
+	end := int64(0)
+	for _, e := range extents {
+		for off := e.Offset; off < e.Offset+e.Length; {
+			p := buf[:min64(int64(len(buf)), e.Offset+e.Length-off)]
+			n, err := d.ReadAt(skey, p, off)
+			if err == nil && n == 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := d.writeAt(dkey, p[:n], off); err != nil {
+				return err
+			}
+			off += int64(n)
+		}
+		end = e.Offset + e.Length
+	}
+	if size > end {
+		_, err := d.writeAt(dkey, []byte{0}, size-1)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package disk
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// hasTree reports whether the root of the Merkle tree of the named file is
+// the one of data.
+func hasTree(d *Disk, name string, data []byte) bool {
+	expected := treeOf(data, d.layout().payloadSize())
+	top := len(expected) - 1
+	tree, ds, err := d.MerkleNodes(name, top, 0, 1)
+	return err == nil && tree.Size == int64(len(data)) && len(ds) == 1 && ds[0] == expected[top][0]
+}
+
+func TestLink(t *testing.T) {
+	d := newTestDisk("disk0", "link", true)
+	d.Cache = NewCache(1 << 20)
+	defer d.Remove("", true)
+
+	if _, err := d.WriteAt("a", []byte("hello"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := d.Link("a", "b"); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	// fill the cache of b before writing through a
+	b := make([]byte, 5)
+	if _, err := d.ReadAt("b", b, 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := d.WriteAt("a", []byte("world"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := d.ReadAt("b", b, 0); err != nil || string(b) != "world" {
+		t.Errorf("read b = %q, %v, want world", b, err)
+	}
+	ga, _ := d.Generation("a")
+	gb, _ := d.Generation("b")
+	if ga == 0 || ga != gb {
+		t.Errorf("generations = %d, %d, want the same", ga, gb)
+	}
+	if !hasTree(d, "b", []byte("world")) {
+		t.Errorf("tree of b does not match its data")
+	}
+
+	if err := d.Link("a", "b"); !os.IsExist(err) {
+		t.Errorf("link over b error = %v, want exist", err)
+	}
+	if err := d.Mkdir("dir", false); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := d.Link("dir", "c"); err == nil {
+		t.Errorf("link of a directory succeeded")
+	}
+
+	// removing a name leaves the other alone
+	if err := d.Remove("a", false); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := d.WriteAt("b", []byte("!"), 5); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	b = make([]byte, 6)
+	if _, err := d.ReadAt("b", b, 0); err != nil || string(b) != "world!" {
+		t.Errorf("read b = %q, %v, want world!", b, err)
+	}
+}
+
+func TestSymlink(t *testing.T) {
+	d := newTestDisk("disk0", "symlink", true)
+	defer d.Remove("", true)
+
+	if _, err := d.WriteAt("a", []byte("hello"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := d.Mkdir("dir", false); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := d.Symlink("../../a", "dir/l"); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if target, err := d.Readlink("dir/l"); err != nil || target != "a" {
+		t.Errorf("readlink = %s, %v, want a", target, err)
+	}
+	// the link does not follow its target out of the disk when moved
+	if err := d.Rename("dir/l", "l"); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if target, err := d.Readlink("l"); err != nil || target != "a" {
+		t.Errorf("readlink = %s, %v, want a", target, err)
+	}
+	// data is not read through links
+	if _, err := d.ReadAt("l", make([]byte, 5), 0); err == nil {
+		t.Errorf("read through a link succeeded")
+	}
+	if _, err := d.Size("l"); err == nil {
+		t.Errorf("size through a link succeeded")
+	}
+
+	for _, target := range []string{"", "dir", MetaDir, "missing"} {
+		if err := d.Symlink(target, "x"); err == nil {
+			t.Errorf("symlink to %q succeeded", target)
+		}
+	}
+	if err := os.Symlink("/etc/passwd", d.Root+"/out"); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := d.Readlink("out"); err == nil {
+		t.Errorf("readlink of a link out of the disk succeeded")
+	}
+}
+
+func TestClone(t *testing.T) {
+	d := newTestDisk("disk0", "clone", true)
+	defer d.Remove("", true)
+
+	data := make([]byte, 3*d.layout().payloadSize()+100)
+	fillPattern(data, len(data))
+	if _, err := d.WriteAt("a", data, 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	// a hole at the end
+	if err := d.Truncate("a", int64(len(data))+10000); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	want := append(data, make([]byte, 10000)...)
+
+	check := func(fn string) {
+		if size, err := d.Size(fn); err != nil || size != int64(len(want)) {
+			t.Errorf("size of %s = %d, %v, want %d", fn, size, err, len(want))
+		}
+		b := make([]byte, len(want))
+		if _, err := d.ReadAt(fn, b, 0); err != nil || !bytes.Equal(b, want) {
+			t.Errorf("read %s = %v, want the data of a", fn, err)
+		}
+	}
+
+	if err := d.Clone("a", "b"); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	check("b")
+	if err := d.Clone("a", "b"); !os.IsExist(err) {
+		t.Errorf("clone over b error = %v, want exist", err)
+	}
+
+	// the block copy
+	if err := d.copyBlocks("a", "c"); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	check("c")
+	for _, fn := range []string{"b", "c"} {
+		if !hasTree(d, fn, want) {
+			t.Errorf("tree of %s does not match its data", fn)
+		}
+	}
+
+	// copies are independent of their source
+	if _, err := d.WriteAt("b", []byte("patch"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	check("a")
+	ga, _ := d.Generation("a")
+	gb, _ := d.Generation("b")
+	if ga == gb {
+		t.Errorf("clone shares the generation %d", ga)
+	}
+}
@@ -0,0 +1,194 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ListOptions select and page the entries listed by List.
+type ListOptions struct {
+	// PageToken is the token returned with the previous page. Empty
+	// starts from the first entry.
+	PageToken string
+	// PageSize is the maximum number of entries of a page. Zero means
+	// no limit.
+	PageSize int
+	// Prefix keeps the entries whose path starts with it.
+	Prefix string
+	// Pattern keeps the entries whose name matches it as in path.Match.
+	Pattern string
+	// Recursive lists the entries of the subdirectories as well.
+	Recursive bool
+}
+
+// DirEntry is an entry listed by List.
+type DirEntry struct {
+	// Path is the path of the entry relative to the listed directory.
+	Path string
+	Info os.FileInfo
+}
+
+// List lists the entries of the named directory sorted by path, a
+// directory coming right before its entries in recursive listings. It
+// returns a page of entries and the token of the next page, which is
+// empty after the last page.
+func (d *Disk) List(name string, opts ListOptions) ([]DirEntry, string, error) {
+	if opts.Pattern != "" {
+		// check the pattern once rather than for every entry
+		if _, err := path.Match(opts.Pattern, ""); err != nil {
+			return nil, "", err
+		}
+	}
+	l := &lister{
+		root:  path.Join(d.Root, name),
+		top:   path.Clean("/"+name) == "/",
+		opts:  opts,
+		after: splitPath(opts.PageToken),
+	}
+	if _, err := os.Stat(l.root); err != nil {
+		return nil, "", err
+	}
+	err := l.list("")
+	if err == errPageFull {
+		last := l.entries[len(l.entries)-1].Path
+		return l.entries, last, nil
+	}
+	return l.entries, "", err
+}
+
+// errPageFull stops a listing once a page is full.
+var errPageFull = errors.New("disk: page full")
+
+type lister struct {
+	root    string
+	top     bool
+	opts    ListOptions
+	after   []string
+	entries []DirEntry
+}
+
+// list lists the directory dir relative to the root.
+func (l *lister) list(dir string) error {
+	f, err := os.Open(path.Join(l.root, dir))
+	if err != nil {
+		if dir != "" && os.IsNotExist(err) {
+			// removed while listing
+			return nil
+		}
+		return err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	depth := 0
+	if dir != "" {
+		depth = strings.Count(dir, "/") + 1
+	}
+	// Entries sorting before the token were listed by previous pages,
+	// unless the token is under them.
+	keep := names[:0]
+	for _, n := range names {
+		if l.top && dir == "" && n == MetaDir {
+			continue
+		}
+		if depth < len(l.after) && n < l.after[depth] && l.onTokenPath(dir, depth) {
+			continue
+		}
+		if !l.mayMatch(path.Join(dir, n)) {
+			continue
+		}
+		keep = append(keep, n)
+	}
+	sort.Strings(keep)
+
+	for _, n := range keep {
+		p := path.Join(dir, n)
+		fi, err := os.Lstat(path.Join(l.root, p))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if !l.listed(p) && l.matches(p, n) {
+			if l.opts.PageSize > 0 && len(l.entries) == l.opts.PageSize {
+				return errPageFull
+			}
+			l.entries = append(l.entries, DirEntry{Path: p, Info: fi})
+		}
+		if l.opts.Recursive && fi.IsDir() {
+			if err := l.list(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// onTokenPath reports whether dir, at the given depth, is an ancestor of
+// the token, so that its entries are compared with the token.
+func (l *lister) onTokenPath(dir string, depth int) bool {
+	if depth == 0 {
+		return true
+	}
+	return depth <= len(l.after) && dir == path.Join(l.after[:depth]...)
+}
+
+// listed reports whether p was listed by a previous page, that is whether
+// it is the token or sorts before it.
+func (l *lister) listed(p string) bool {
+	if len(l.after) == 0 {
+		return false
+	}
+	return comparePaths(splitPath(p), l.after) <= 0
+}
+
+// mayMatch reports whether p or, in recursive listings, an entry under p
+// may have the prefix.
+func (l *lister) mayMatch(p string) bool {
+	if l.opts.Prefix == "" {
+		return true
+	}
+	if strings.HasPrefix(p, l.opts.Prefix) {
+		return true
+	}
+	return l.opts.Recursive && strings.HasPrefix(l.opts.Prefix, p+"/")
+}
+
+func (l *lister) matches(p, name string) bool {
+	if !strings.HasPrefix(p, l.opts.Prefix) {
+		return false
+	}
+	if l.opts.Pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(l.opts.Pattern, name)
+	return ok
+}
+
+func splitPath(p string) []string {
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// comparePaths compares paths element by element, so that a directory
+// sorts right before its entries.
+func comparePaths(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,62 @@
+package disk
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	d := newTestDisk("disk0", "list", true)
+	defer d.Remove("", true)
+
+	for _, dir := range []string{"a/b", "a-c", "b"} {
+		if err := d.Mkdir(dir, true); err != nil {
+			t.Fatalf("error = %v", err)
+		}
+	}
+	for _, fn := range []string{"a/x", "a/b/y", "a/b/z.log", "a-c/w.log", "b/v", "c.log"} {
+		if _, err := d.WriteAt(fn, []byte(fn), 0); err != nil {
+			t.Fatalf("error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		dir  string
+		opts ListOptions
+		want []string
+	}{
+		{"", ListOptions{}, []string{"a", "a-c", "b", "c.log"}},
+		{"", ListOptions{Recursive: true},
+			[]string{"a", "a/b", "a/b/y", "a/b/z.log", "a/x", "a-c", "a-c/w.log", "b", "b/v", "c.log"}},
+		{"", ListOptions{Recursive: true, Pattern: "*.log"}, []string{"a/b/z.log", "a-c/w.log", "c.log"}},
+		{"", ListOptions{Recursive: true, Prefix: "a/b/"}, []string{"a/b/y", "a/b/z.log"}},
+		{"", ListOptions{Prefix: "a"}, []string{"a", "a-c"}},
+		{"a", ListOptions{}, []string{"b", "x"}},
+	}
+	for i, tt := range tests {
+		for _, size := range []int{0, 1, 3} {
+			tt.opts.PageSize = size
+			var got []string
+			for pages := 0; ; pages++ {
+				entries, next, err := d.List(tt.dir, tt.opts)
+				if err != nil {
+					t.Fatalf("#%d: error = %v", i, err)
+				}
+				if size > 0 && len(entries) > size {
+					t.Fatalf("#%d: page of %d entries, want at most %d", i, len(entries), size)
+				}
+				for _, e := range entries {
+					got = append(got, e.Path)
+				}
+				if next == "" || pages > len(tt.want) {
+					break
+				}
+				tt.opts.PageToken = next
+			}
+			tt.opts.PageToken = ""
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("#%d, page size %d: got %v, want %v", i, size, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,445 @@
+package disk
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+)
+
+const (
+	merkleDir = "merkle"
+	// MerkleFanout is the number of children of the inner nodes of a
+	// Merkle tree.
+	MerkleFanout = 16
+
+	merkleMagic = "cfsmkl02"
+	// merkleHeaderSize is the space reserved for the header of a tree file.
+	// The header holds the magic, the data size the tree was built for, the
+	// number of leaves its levels are laid out for and the dirty flag.
+	merkleHeaderSize = 4096
+	// merkleMaxLeaves bounds the number of leaves of a tree.
+	merkleMaxLeaves int64 = 1 << 36
+	// merkleMinCapacity is the number of leaves the levels of the smallest
+	// trees are laid out for. Capacities double as trees grow.
+	merkleMinCapacity = 1024
+	// merkleBatch is the number of parents computed per read of their children.
+	merkleBatch = 4096
+)
+
+var (
+	// ErrBadLevel indicates the requested tree level does not exist.
+	ErrBadLevel = errors.New("disk: bad tree level")
+	// ErrFileTooLarge indicates the file has too many blocks to be tracked
+	// by a Merkle tree.
+	ErrFileTooLarge = errors.New("disk: file too large for Merkle tree")
+)
+
+// MerkleTree describes the hash tree of a file. Level 0 holds one leaf per
+// block, the digest of its payload; every other level holds the digests of
+// groups of MerkleFanout nodes of the level below, up to the single root.
+//
+// Digests are CRC32Cs. Zero blocks, holes included, and nodes whose
+// children are all zero have the digest 0, so trees do not depend on how
+// zeros were written. Trees of replicas only compare if their disks have
+// the same payload size.
+type MerkleTree struct {
+	// Size is the size of the file data.
+	Size int64
+	// LeafSize is the size of the data covered by a leaf.
+	LeafSize int64
+	// Levels is the number of levels of the tree. Empty files have no level.
+	Levels int
+}
+
+// levelSize returns the number of nodes at level k of a tree with n leaves.
+func levelSize(n, k int) int {
+	for ; k > 0; k-- {
+		n = (n + MerkleFanout - 1) / MerkleFanout
+	}
+	return n
+}
+
+// levels returns the number of levels of a tree with n leaves.
+func levels(n int) int {
+	if n == 0 {
+		return 0
+	}
+	k := 1
+	for ; n > 1; k++ {
+		n = (n + MerkleFanout - 1) / MerkleFanout
+	}
+	return k
+}
+
+// leafCount returns the number of leaves of the tree of size bytes of data.
+func leafCount(size int64, payloadSize int) (int, error) {
+	n := (size + int64(payloadSize) - 1) / int64(payloadSize)
+	// the count must also fit in an int on 32-bit platforms
+	if n > merkleMaxLeaves || int64(int(n)) != n {
+		return 0, ErrFileTooLarge
+	}
+	return int(n), nil
+}
+
+// capacityFor returns the number of leaves to lay out the levels of a
+// tree with n leaves for.
+func capacityFor(n int) int64 {
+	c := int64(merkleMinCapacity)
+	for c < int64(n) {
+		c *= 2
+	}
+	return c
+}
+
+// levelOffset is the offset of level k in a tree file whose levels are
+// laid out for capacity leaves. Leaves always start after the header.
+func levelOffset(k int, capacity int64) int64 {
+	off := int64(merkleHeaderSize)
+	for n := capacity; k > 0; k-- {
+		off += 4 * n
+		n = (n + MerkleFanout - 1) / MerkleFanout
+	}
+	return off
+}
+
+func leafDigest(payload []byte) uint32 {
+	if isZero(payload) {
+		return 0
+	}
+	return nonZero(crc32.Checksum(payload, crc32cTable))
+}
+
+// nodeDigest returns the digest of a node given the digests of its
+// children. Missing children at the end of a level count as zero.
+func nodeDigest(children []uint32) uint32 {
+	var buf [4 * MerkleFanout]byte
+	zero := true
+	for i, c := range children {
+		binary.BigEndian.PutUint32(buf[4*i:], c)
+		zero = zero && c == 0
+	}
+	if zero {
+		return 0
+	}
+	return nonZero(crc32.Checksum(buf[:], crc32cTable))
+}
+
+// nonZero keeps 0 for zero data.
+func nonZero(d uint32) uint32 {
+	if d == 0 {
+		return 1
+	}
+	return d
+}
+
+// merkleFile is the tree file of a data file with n leaves, whose levels
+// are laid out for capacity leaves.
+type merkleFile struct {
+	f        *os.File
+	n        int
+	capacity int64
+}
+
+// merkleHeader is the header of a tree file.
+type merkleHeader struct {
+	// size is the data size the tree was built for.
+	size int64
+	// capacity is the number of leaves the levels are laid out for.
+	capacity int64
+	// dirty is set while the data is written and cleared once the tree
+	// is updated. Trees left dirty by a crash are stale.
+	dirty bool
+}
+
+func (d *Disk) openMerkle(name string, flag int) (*merkleFile, error) {
+	fn := d.sidecar(merkleDir, name)
+	if flag&os.O_CREATE != 0 {
+		if err := os.MkdirAll(path.Dir(fn), 0700); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(fn, flag, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &merkleFile{f: f}, nil
+}
+
+// header reads the header of the tree. It returns false if the tree
+// was never completed.
+func (t *merkleFile) header() (merkleHeader, bool) {
+	var b [25]byte
+	if _, err := t.f.ReadAt(b[:], 0); err != nil || string(b[:8]) != merkleMagic {
+		return merkleHeader{}, false
+	}
+	return merkleHeader{
+		size:     int64(binary.BigEndian.Uint64(b[8:])),
+		capacity: int64(binary.BigEndian.Uint64(b[16:])),
+		dirty:    b[24] != 0,
+	}, true
+}
+
+func (t *merkleFile) writeHeader(h merkleHeader) error {
+	var b [25]byte
+	copy(b[:], merkleMagic)
+	binary.BigEndian.PutUint64(b[8:], uint64(h.size))
+	binary.BigEndian.PutUint64(b[16:], uint64(h.capacity))
+	if h.dirty {
+		b[24] = 1
+	}
+	_, err := t.f.WriteAt(b[:], 0)
+	return err
+}
+
+// read reads the digests of level k starting at start into ds.
+// Nodes never written read as zero.
+func (t *merkleFile) read(k, start int, ds []uint32) error {
+	buf := getBuffer(4 * len(ds))
+	defer putBuffer(buf)
+	n, err := t.f.ReadAt(buf, levelOffset(k, t.capacity)+4*int64(start))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	zero(buf[n:])
+	for i := range ds {
+		ds[i] = binary.BigEndian.Uint32(buf[4*i:])
+	}
+	return nil
+}
+
+func (t *merkleFile) write(k, start int, ds []uint32) error {
+	buf := getBuffer(4 * len(ds))
+	defer putBuffer(buf)
+	for i, d := range ds {
+		binary.BigEndian.PutUint32(buf[4*i:], d)
+	}
+	_, err := t.f.WriteAt(buf, levelOffset(k, t.capacity)+4*int64(start))
+	return err
+}
+
+// propagate recomputes the ancestors of the nodes [lo, hi] of level k.
+func (t *merkleFile) propagate(k, lo, hi int) error {
+	children := make([]uint32, merkleBatch*MerkleFanout)
+	parents := make([]uint32, merkleBatch)
+	for ; levelSize(t.n, k) > 1; k++ {
+		size := levelSize(t.n, k)
+		lo, hi = lo/MerkleFanout, hi/MerkleFanout
+		for p := lo; p <= hi; p += merkleBatch {
+			count := min(hi-p+1, merkleBatch)
+			cs := children[:min(count*MerkleFanout, size-p*MerkleFanout)]
+			if err := t.read(k, p*MerkleFanout, cs); err != nil {
+				return err
+			}
+			for j := 0; j < count; j++ {
+				parents[j] = nodeDigest(cs[j*MerkleFanout : min((j+1)*MerkleFanout, len(cs))])
+			}
+			if err := t.write(k+1, p, parents[:count]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// leaf is the digest of a written block.
+type leaf struct {
+	index  int
+	digest uint32
+}
+
+// update records the digests of written blocks of a file whose data size
+// went from oldSize to size, recomputes their ancestors and clears the
+// dirty flag of the tree.
+func (t *merkleFile) update(leaves []leaf, oldSize, size int64, payloadSize int) error {
+	oldN, err := leafCount(oldSize, payloadSize)
+	if err != nil {
+		return err
+	}
+	if t.n, err = leafCount(size, payloadSize); err != nil {
+		return err
+	}
+	// The levels above the leaves move when the tree outgrows its layout:
+	// only the leaves are kept and the other levels are recomputed.
+	relaid := int64(t.n) > t.capacity
+	if relaid {
+		t.capacity = capacityFor(t.n)
+		if err := t.f.Truncate(levelOffset(0, t.capacity) + 4*int64(oldN)); err != nil {
+			return err
+		}
+	}
+	// leaves are in ascending order; propagate each run of adjacent ones
+	for i := 0; i < len(leaves); {
+		j := i + 1
+		for j < len(leaves) && leaves[j].index == leaves[j-1].index+1 {
+			j++
+		}
+		ds := make([]uint32, j-i)
+		for k := range ds {
+			ds[k] = leaves[i+k].digest
+		}
+		if err := t.write(0, leaves[i].index, ds); err != nil {
+			return err
+		}
+		if !relaid {
+			if err := t.propagate(0, leaves[i].index, leaves[j-1].index); err != nil {
+				return err
+			}
+		}
+		i = j
+	}
+	if relaid {
+		if err := t.propagate(0, 0, t.n-1); err != nil {
+			return err
+		}
+	} else if old := levels(oldN); old > 0 && levels(t.n) > old {
+		// the old root gets new ancestors when the tree grows
+		if err := t.propagate(old-1, 0, 0); err != nil {
+			return err
+		}
+	}
+	return t.writeHeader(merkleHeader{size: size, capacity: t.capacity})
+}
+
+// beginMerkle opens the tree of the named file, which holds size bytes of
+// data, and sets its dirty flag before the data gets written. It returns
+// nil if the tree is missing or stale, which is then dropped and rebuilt
+// when next asked for. The flag is synced on disks in dsync mode only, so
+// on other disks it covers crashes of the server but not of the machine.
+func (d *Disk) beginMerkle(name string, size int64) *merkleFile {
+	t, err := d.openMerkle(name, os.O_CREATE|os.O_RDWR)
+	if err != nil {
+		return nil
+	}
+	h, ok := t.header()
+	if !ok && size == 0 {
+		// a new file starts with an empty tree
+		h, ok = merkleHeader{}, true
+	}
+	if ok && !h.dirty && h.size == size {
+		h.dirty = true
+		err = t.writeHeader(h)
+		if err == nil && d.IOMode == Sync {
+			err = t.f.Sync()
+		}
+		if err == nil {
+			t.capacity = h.capacity
+			return t
+		}
+	}
+	t.f.Truncate(0)
+	t.f.Close()
+	return nil
+}
+
+// endMerkle records the blocks written to the file of the tree t, begun by
+// beginMerkle, whose data size went from oldSize to size, and closes t.
+// Trees of failed writes are left dirty. Trees that cannot be updated are
+// dropped. Both are rebuilt when next asked for.
+func (d *Disk) endMerkle(t *merkleFile, leaves []leaf, oldSize, size int64, err error) {
+	if t == nil {
+		return
+	}
+	defer t.f.Close()
+	if err != nil {
+		return
+	}
+	if err := t.update(leaves, oldSize, size, d.layout().payloadSize()); err != nil {
+		t.f.Truncate(0)
+	}
+}
+
+// dropMerkle drops the tree of the named file, which gets rebuilt when
+// next asked for.
+func (d *Disk) dropMerkle(name string) {
+	os.Truncate(d.sidecar(merkleDir, name), 0)
+}
+
+// rebuild builds the tree of the data file f of size bytes from scratch.
+func (t *merkleFile) rebuild(l layout, f io.ReaderAt, size int64) error {
+	if err := t.f.Truncate(0); err != nil {
+		return err
+	}
+	payloadSize := l.payloadSize()
+	var err error
+	if t.n, err = leafCount(size, payloadSize); err != nil {
+		return err
+	}
+	t.capacity = capacityFor(t.n)
+	chunk := getBuffer(l.spanBlocks() * payloadSize)
+	defer putBuffer(chunk)
+	ds := make([]uint32, 0, l.spanBlocks())
+	for index := 0; index < t.n; index += l.spanBlocks() {
+		ds = ds[:0]
+		_, err := l.readAt(f, chunk, index, 0, func(i int, payload []byte) {
+			ds = append(ds, leafDigest(payload))
+		})
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err := t.write(0, index, ds); err != nil {
+			return err
+		}
+	}
+	if t.n > 0 {
+		if err := t.propagate(0, 0, t.n-1); err != nil {
+			return err
+		}
+	}
+	return t.writeHeader(merkleHeader{size: size, capacity: t.capacity})
+}
+
+// MerkleNodes returns the Merkle tree of the named file and up to count
+// digests of its level starting at the node start. Trees that are missing,
+// or were left dirty or stale by a crash, are rebuilt from the data.
+func (d *Disk) MerkleNodes(name string, level, start, count int) (MerkleTree, []uint32, error) {
+	mu := d.lockFile(name)
+	defer mu.Unlock()
+
+	f, err := d.openFile(path.Join(d.Root, name), os.O_RDONLY)
+	if err != nil {
+		return MerkleTree{}, nil, err
+	}
+	defer f.Close()
+	l, err := d.layout().forFile(f, false)
+	if err != nil {
+		return MerkleTree{}, nil, err
+	}
+	size, err := l.fileDataSize(f)
+	if err != nil {
+		return MerkleTree{}, nil, err
+	}
+
+	t, err := d.openMerkle(name, os.O_CREATE|os.O_RDWR)
+	if err != nil {
+		return MerkleTree{}, nil, err
+	}
+	defer t.f.Close()
+	if h, ok := t.header(); ok && !h.dirty && h.size == int64(size) {
+		t.capacity = h.capacity
+	} else if err := t.rebuild(l, f, int64(size)); err != nil {
+		t.f.Truncate(0)
+		return MerkleTree{}, nil, err
+	}
+	payloadSize := l.payloadSize()
+	t.n = (size + payloadSize - 1) / payloadSize
+
+	tree := MerkleTree{Size: int64(size), LeafSize: int64(payloadSize), Levels: levels(t.n)}
+	if level < 0 || level >= tree.Levels {
+		if tree.Levels == 0 && level == 0 {
+			return tree, nil, nil
+		}
+		return tree, nil, ErrBadLevel
+	}
+	n := levelSize(t.n, level)
+	if start < 0 || start >= n || count <= 0 {
+		return tree, nil, nil
+	}
+	ds := make([]uint32, min(count, n-start))
+	if err := t.read(level, start, ds); err != nil {
+		return tree, nil, err
+	}
+	return tree, ds, nil
+}
@@ -0,0 +1,168 @@
+package disk
+
+import (
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+)
+
+// treeOf computes the tree of data as MerkleNodes should report it.
+func treeOf(data []byte, payloadSize int) [][]uint32 {
+	var level []uint32
+	for off := 0; off < len(data); off += payloadSize {
+		level = append(level, leafDigest(data[off:min(off+payloadSize, len(data))]))
+	}
+	tree := [][]uint32{level}
+	for len(level) > 1 {
+		var up []uint32
+		for i := 0; i < len(level); i += MerkleFanout {
+			up = append(up, nodeDigest(level[i:min(i+MerkleFanout, len(level))]))
+		}
+		tree = append(tree, up)
+		level = up
+	}
+	return tree
+}
+
+func checkTree(t *testing.T, d *Disk, data []byte, msg string) {
+	expected := treeOf(data, d.layout().payloadSize())
+	for k := range expected {
+		tree, ds, err := d.MerkleNodes(tmpTestFile, k, 0, len(expected[k]))
+		if err != nil {
+			t.Fatalf("%s: level %d: error = %v", msg, k, err)
+		}
+		if tree.Levels != len(expected) || tree.Size != int64(len(data)) {
+			t.Fatalf("%s: expect %d levels of %d bytes got %+v", msg, len(expected), len(data), tree)
+		}
+		for i := range expected[k] {
+			if ds[i] != expected[k][i] {
+				t.Fatalf("%s: level %d node %d: expect %x got %x", msg, k, i, expected[k][i], ds[i])
+			}
+		}
+	}
+}
+
+func TestMerkleUpdate(t *testing.T) {
+	d := newTestDisk("disk0", "merkle", true)
+	defer d.Remove("", true)
+
+	rnd := rand.New(rand.NewSource(1))
+	var data []byte
+	for i := 0; i < 20; i++ {
+		p := make([]byte, rnd.Intn(payloadSize*3)+1)
+		rnd.Read(p)
+		off := rnd.Intn(len(data) + payloadSize*40)
+		if _, err := d.WriteAt(tmpTestFile, p, int64(off)); err != nil {
+			t.Fatalf("%d: error = %v", i, err)
+		}
+		if off+len(p) > len(data) {
+			data = append(data, make([]byte, off+len(p)-len(data))...)
+		}
+		copy(data[off:], p)
+		checkTree(t, d, data, "update")
+	}
+
+	// a dropped tree is rebuilt from the data
+	os.Remove(d.sidecar(merkleDir, tmpTestFile))
+	checkTree(t, d, data, "rebuild")
+
+	// the tree follows its file
+	if err := d.Rename(tmpTestFile, "renamed"); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := os.Stat(d.sidecar(merkleDir, "renamed")); err != nil {
+		t.Errorf("expect tree to be renamed, got %v", err)
+	}
+	if err := d.Remove("renamed", false); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := os.Stat(d.sidecar(merkleDir, "renamed")); !os.IsNotExist(err) {
+		t.Errorf("expect tree to be removed, got %v", err)
+	}
+}
+
+func TestMerkleZeros(t *testing.T) {
+	// holes and written zeros give the same tree
+	sparse := newTestDisk("disk0", "merkle-sparse", true)
+	defer sparse.Remove("", true)
+	dense := newTestDisk("disk1", "merkle-dense", true)
+	defer dense.Remove("", true)
+
+	off := int64(payloadSize * 100)
+	sparse.WriteAt(tmpTestFile, []byte("tail"), off)
+	dense.WriteAt(tmpTestFile, make([]byte, off), 0)
+	dense.WriteAt(tmpTestFile, []byte("tail"), off)
+
+	a, ra, err := sparse.MerkleNodes(tmpTestFile, 2, 0, 1)
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	b, rb, err := dense.MerkleNodes(tmpTestFile, 2, 0, 1)
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if a != b || len(ra) != 1 || len(rb) != 1 || ra[0] != rb[0] {
+		t.Errorf("expect the same roots, got %+v %v and %+v %v", a, ra, b, rb)
+	}
+	if _, _, err := sparse.MerkleNodes(tmpTestFile, 3, 0, 1); err != ErrBadLevel {
+		t.Errorf("expect error %v got %v", ErrBadLevel, err)
+	}
+}
+
+func TestMerkleGrowth(t *testing.T) {
+	d := newTestDisk("disk0", "merkle-growth", true)
+	defer d.Remove("", true)
+
+	// the levels get laid out again past merkleMinCapacity leaves
+	var data []byte
+	for _, index := range []int{10, merkleMinCapacity + 1, merkleMinCapacity * 3, merkleMinCapacity} {
+		p := make([]byte, payloadSize+5)
+		fillPattern(p, len(p))
+		off := index * payloadSize
+		if _, err := d.WriteAt(tmpTestFile, p, int64(off)); err != nil {
+			t.Fatalf("%d: error = %v", index, err)
+		}
+		if off+len(p) > len(data) {
+			data = append(data, make([]byte, off+len(p)-len(data))...)
+		}
+		copy(data[off:], p)
+		checkTree(t, d, data, "growth")
+	}
+	fi, err := os.Stat(d.sidecar(merkleDir, tmpTestFile))
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if fi.Size() > merkleHeaderSize+8*merkleMinCapacity*4 {
+		t.Errorf("expect a tree file of a few pages, got %d bytes", fi.Size())
+	}
+}
+
+func TestMerkleDirty(t *testing.T) {
+	d := newTestDisk("disk0", "merkle-dirty", true)
+	defer d.Remove("", true)
+
+	data := make([]byte, payloadSize*20)
+	fillPattern(data, len(data))
+	if _, err := d.WriteAt(tmpTestFile, data, 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	checkTree(t, d, data, "write")
+
+	// crash between the data write and the update of the tree
+	f, err := d.openFile(path.Join(d.Root, tmpTestFile), os.O_RDWR)
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	tree := d.beginMerkle(tmpTestFile, int64(len(data)))
+	if tree == nil {
+		t.Fatalf("expect the tree to be begun")
+	}
+	copy(data[payloadSize*3:], "crash")
+	if _, err := d.layout().writeAt(f, []byte("crash"), payloadSize*3, len(data), nil); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	tree.f.Close()
+	f.Close()
+	checkTree(t, d, data, "dirty")
+}
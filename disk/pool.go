@@ -0,0 +1,67 @@
+package disk
+
+import (
+	"sync"
+	"unsafe"
+)
+
+const (
+	// minPoolShift is the smallest pooled buffer size class (4 KB).
+	minPoolShift = 12
+	// maxPoolShift is the largest pooled buffer size class (4 MB).
+	// Larger buffers are allocated directly and left to the GC.
+	maxPoolShift = 22
+	// alignment is the memory alignment of pooled buffers. It satisfies
+	// the O_DIRECT requirements of disks with up to 4 KB sectors.
+	alignment = 4096
+)
+
+// pools holds one sync.Pool per power-of-two size class in
+// [1<<minPoolShift, 1<<maxPoolShift].
+var pools [maxPoolShift - minPoolShift + 1]sync.Pool
+
+// sizeClass returns the index into pools of the smallest class that
+// can hold n bytes, or -1 if n is too large to be pooled.
+func sizeClass(n int) int {
+	for c := range pools {
+		if n <= 1<<uint(c+minPoolShift) {
+			return c
+		}
+	}
+	return -1
+}
+
+// getBuffer returns a buffer of length n. The buffer content is undefined;
+// callers must not assume it is zeroed.
+func getBuffer(n int) []byte {
+	c := sizeClass(n)
+	if c < 0 {
+		return alignedBuffer(n)
+	}
+	if b, ok := pools[c].Get().(*[]byte); ok {
+		return (*b)[:n]
+	}
+	return alignedBuffer(1 << uint(c+minPoolShift))[:n]
+}
+
+// alignedBuffer allocates a buffer of length n whose first byte
+// is aligned to alignment.
+func alignedBuffer(n int) []byte {
+	b := make([]byte, n+alignment)
+	off := 0
+	if r := int(uintptr(unsafe.Pointer(&b[0])) & (alignment - 1)); r != 0 {
+		off = alignment - r
+	}
+	return b[off : off+n : off+n]
+}
+
+// putBuffer returns a buffer obtained by getBuffer to its pool.
+// The buffer must not be used after it is put back.
+func putBuffer(b []byte) {
+	c := sizeClass(cap(b))
+	if c < 0 || cap(b) != 1<<uint(c+minPoolShift) {
+		return
+	}
+	b = b[:cap(b)]
+	pools[c].Put(&b)
+}
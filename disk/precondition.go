@@ -0,0 +1,131 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"path"
+)
+
+// ErrPrecondition is returned by the conditional operations of a disk
+// if the file does not meet their precondition.
+var ErrPrecondition = errors.New("disk: precondition failed")
+
+// Precondition is what a file must meet for a conditional operation to
+// go ahead. The zero Precondition is met by any file.
+type Precondition struct {
+	// MustNotExist requires the file not to exist.
+	MustNotExist bool
+	// CheckSize requires the data size of the file to be Size.
+	CheckSize bool
+	Size      int64
+	// Generation is the generation the file must have. Zero means any.
+	Generation uint64
+	// CheckChecksum requires the CRC32C of ChecksumLength bytes of the
+	// file from ChecksumOffset to be Checksum. A negative ChecksumLength
+	// means up to the end of the file.
+	CheckChecksum  bool
+	ChecksumOffset int64
+	ChecksumLength int64
+	Checksum       uint32
+}
+
+// Check returns ErrPrecondition if the named file does not meet p.
+func (d *Disk) Check(name string, p Precondition) error {
+	key := path.Clean(name)
+	mu := d.lockFile(key)
+	defer mu.Unlock()
+	return d.check(key, p)
+}
+
+// check returns ErrPrecondition if the named file does not meet p.
+// The file must be locked.
+func (d *Disk) check(key string, p Precondition) error {
+	if p.CheckChecksum && p.ChecksumOffset < 0 {
+		return ErrNegativeOffset
+	}
+	_, err := os.Stat(path.Join(d.Root, key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	exists := err == nil
+	if p.MustNotExist {
+		if exists {
+			return ErrPrecondition
+		}
+		return nil
+	}
+	if !p.CheckSize && p.Generation == 0 && !p.CheckChecksum {
+		return nil
+	}
+	if !exists {
+		return ErrPrecondition
+	}
+
+	if p.CheckSize {
+		size, err := d.Size(key)
+		if err != nil {
+			return err
+		}
+		if size != p.Size {
+			return ErrPrecondition
+		}
+	}
+	if p.Generation != 0 {
+		g, err := d.generation(key)
+		if err != nil {
+			return err
+		}
+		if g != p.Generation {
+			return ErrPrecondition
+		}
+	}
+	if p.CheckChecksum {
+		sum, _, err := d.RangeChecksum(key, p.ChecksumOffset, p.ChecksumLength)
+		if err != nil {
+			return err
+		}
+		if sum != p.Checksum {
+			return ErrPrecondition
+		}
+	}
+	return nil
+}
+
+// WriteAtIf is WriteAt made conditional on the named file meeting p
+// before the write. It also returns the generation of the file after
+// the write.
+func (d *Disk) WriteAtIf(name string, b []byte, off int64, p Precondition) (int, uint64, error) {
+	key := path.Clean(name)
+	mu := d.lockFile(key)
+	defer mu.Unlock()
+	if err := d.check(key, p); err != nil {
+		return 0, 0, err
+	}
+	n, err := d.writeAt(key, b, off)
+	if err != nil {
+		return n, 0, err
+	}
+	g, err := d.generation(key)
+	return n, g, err
+}
+
+// RenameIf is Rename made conditional on newname meeting p, so that a
+// file can replace another only if that one is in the expected state.
+func (d *Disk) RenameIf(oldname, newname string, p Precondition) error {
+	mu := d.lockFiles(path.Clean(oldname), path.Clean(newname))
+	defer mu.Unlock()
+	if err := d.check(path.Clean(newname), p); err != nil {
+		return err
+	}
+	return d.rename(oldname, newname)
+}
+
+// RemoveIf is Remove made conditional on the named file meeting p.
+func (d *Disk) RemoveIf(name string, all bool, p Precondition) error {
+	mu := d.lockFile(path.Clean(name))
+	defer mu.Unlock()
+	if err := d.check(path.Clean(name), p); err != nil {
+		return err
+	}
+	return d.discard(name, all)
+}
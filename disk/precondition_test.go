@@ -0,0 +1,146 @@
+package disk
+
+import (
+	"hash/crc32"
+	"os"
+	"testing"
+)
+
+func TestConditionalOps(t *testing.T) {
+	d := newTestDisk("disk0", "precondition", true)
+	defer d.Remove("", true)
+
+	_, g0, err := d.WriteAtIf("a", []byte("hello"), 0, Precondition{MustNotExist: true})
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, _, err := d.WriteAtIf("a", []byte("again"), 0, Precondition{MustNotExist: true}); err != ErrPrecondition {
+		t.Fatalf("error = %v, want %v", err, ErrPrecondition)
+	}
+	if g, err := d.Generation("a"); err != nil || g != g0 {
+		t.Fatalf("generation = %d, %v, want %d", g, err, g0)
+	}
+
+	tests := []struct {
+		p  Precondition
+		ok bool
+	}{
+		{Precondition{}, true},
+		{Precondition{CheckSize: true, Size: 5}, true},
+		{Precondition{CheckSize: true, Size: 0}, false},
+		{Precondition{Generation: g0}, true},
+		{Precondition{Generation: g0 + 1}, false},
+		{Precondition{CheckChecksum: true, ChecksumOffset: 1, ChecksumLength: -1,
+			Checksum: crc32.Checksum([]byte("ello"), crc32.MakeTable(crc32.Castagnoli))}, true},
+		{Precondition{CheckChecksum: true, ChecksumLength: -1}, false},
+		{Precondition{CheckChecksum: true, ChecksumOffset: -1, ChecksumLength: -1}, false},
+	}
+	for i, tt := range tests {
+		if err := d.check("a", tt.p); (err == nil) != tt.ok {
+			t.Errorf("#%d: error = %v", i, err)
+		}
+	}
+	if err := d.check("missing", Precondition{CheckSize: true}); err != ErrPrecondition {
+		t.Errorf("error = %v, want %v", err, ErrPrecondition)
+	}
+	if err := d.check("missing", Precondition{MustNotExist: true, CheckChecksum: true, ChecksumOffset: -5}); err != ErrNegativeOffset {
+		t.Errorf("error = %v, want %v", err, ErrNegativeOffset)
+	}
+
+	_, g1, err := d.WriteAtIf("a", []byte("!"), 5, Precondition{Generation: g0})
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if g1 <= g0 {
+		t.Fatalf("generation = %d after %d", g1, g0)
+	}
+	if _, err := d.WriteAt("b", []byte("b"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	gb, err := d.Generation("b")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+
+	if err := d.RenameIf("b", "a", Precondition{Generation: g0}); err != ErrPrecondition {
+		t.Fatalf("error = %v, want %v", err, ErrPrecondition)
+	}
+	if err := d.RenameIf("b", "a", Precondition{Generation: g1}); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if g, err := d.Generation("a"); err != nil || g != gb {
+		t.Fatalf("generation = %d, %v, want %d", g, err, gb)
+	}
+	if err := d.RemoveIf("a", false, Precondition{CheckSize: true, Size: 6}); err != ErrPrecondition {
+		t.Fatalf("error = %v, want %v", err, ErrPrecondition)
+	}
+	if err := d.RemoveIf("a", false, Precondition{CheckSize: true, Size: 1}); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+}
+
+func TestReadWithGeneration(t *testing.T) {
+	d := newTestDisk("disk0", "read-generation", true)
+	defer d.Remove("", true)
+
+	_, g0, err := d.WriteAtIf("a", []byte("hello"), 0, Precondition{})
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	tests := []struct {
+		off, length int64
+		data        string
+		ok          bool
+	}{
+		{0, 5, "hello", true},
+		{1, 100, "ello", true},
+		{5, 1, "", true},
+		{10, 1, "", true},
+		{0, -1, "", true},
+		{-1, 1, "", false},
+	}
+	for _, tt := range tests {
+		data, g, err := d.ReadWithGeneration("a", tt.off, tt.length)
+		if (err == nil) != tt.ok {
+			t.Errorf("read %d+%d: error = %v, want ok %v", tt.off, tt.length, err, tt.ok)
+			continue
+		}
+		if tt.ok && (string(data) != tt.data || g != g0) {
+			t.Errorf("read %d+%d = %q, %d, want %q, %d", tt.off, tt.length, data, g, tt.data, g0)
+		}
+	}
+	if _, _, err := d.ReadWithGeneration("missing", 0, 1); !os.IsNotExist(err) {
+		t.Errorf("read of a missing file error = %v, want not exist", err)
+	}
+
+	// every read sees the data of the generation it returns
+	writes := map[uint64]string{g0: "hello"}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			data := []byte{byte('a' + i%26), byte('a' + i%26)}
+			if _, g, err := d.WriteAtIf("a", data, 0, Precondition{}); err == nil {
+				writes[g] = string(data)
+			}
+		}
+	}()
+	type read struct {
+		data string
+		gen  uint64
+	}
+	var reads []read
+	for i := 0; i < 200; i++ {
+		data, g, err := d.ReadWithGeneration("a", 0, 2)
+		if err != nil {
+			t.Fatalf("error = %v", err)
+		}
+		reads = append(reads, read{string(data), g})
+	}
+	<-done
+	for _, r := range reads {
+		if want, ok := writes[r.gen]; ok && want[:2] != r.data {
+			t.Errorf("read %q at generation %d, which wrote %q", r.data, r.gen, want[:2])
+		}
+	}
+}
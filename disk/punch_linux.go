@@ -0,0 +1,18 @@
+package disk
+
+import "syscall"
+
+const (
+	fallocFlKeepSize  = 0x01
+	fallocFlPunchHole = 0x02
+)
+
+// punchHole deallocates length bytes of f at off, keeping the file size.
+// Filesystems without hole support keep the data allocated.
+func punchHole(f slotFile, off, length int64) error {
+	err := syscall.Fallocate(int(f.Fd()), fallocFlKeepSize|fallocFlPunchHole, off, length)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,8 @@
+// +build !linux
+
+package disk
+
+// punchHole is a no-op; the data stays allocated.
+func punchHole(f slotFile, off, length int64) error {
+	return nil
+}
@@ -0,0 +1,179 @@
+package disk
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path"
+)
+
+// ErrNegativeOffset is returned for ranges starting before the file.
+var ErrNegativeOffset = errors.New("disk: negative offset")
+
+// RangeChecksum returns the CRC32C of length bytes of the named file starting
+// at off, and the number of bytes it covers, which is less than length if
+// the file ends before. A negative length means up to the end of the file.
+//
+// On disks storing plain blocks with CRC32C checksums, the checksum of
+// whole blocks is combined from the block checksum computed to verify them,
+// so every byte is only hashed once.
+func (d *Disk) RangeChecksum(name string, off, length int64) (uint32, int64, error) {
+	if off < 0 {
+		return 0, 0, ErrNegativeOffset
+	}
+	f, err := d.openFile(path.Join(d.Root, name), os.O_RDONLY)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	l, err := d.layout().forFile(f, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	size, err := l.fileDataSize(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	end := int64(size)
+	if length >= 0 && off+length < end {
+		end = off + length
+	}
+	if off >= end {
+		return 0, 0, nil
+	}
+	crc, err := l.rangeCRC(f, int(off), int(end))
+	return crc, end - off, err
+}
+
+// combinable tells if the stored block checksums are the CRC32C of the payloads.
+func (l layout) combinable() bool {
+	return !l.transformed() && l.sum.Name() == CRC32C
+}
+
+// rangeCRC computes the CRC32C of the data in [start, end) of f.
+func (l layout) rangeCRC(f file, start, end int) (uint32, error) {
+	blockSize, payloadSize := l.blockSize, l.payloadSize()
+	scratch := l.scratch()
+	defer l.putScratch(scratch)
+	index, offset := l.blockIndexAndOffset(start)
+	lastIndex, _ := l.blockIndexAndOffset(end - 1)
+
+	var crc uint32
+	for ; index <= lastIndex; index += l.spanBlocks() {
+		count := min(lastIndex-index+1, l.spanBlocks())
+		span := getBuffer(count * blockSize)
+		n, err := l.readSpan(f, span, index)
+		if err != nil {
+			putBuffer(span)
+			return 0, err
+		}
+		i := index
+		for raw := span[:n]; len(raw) > 0 && i <= lastIndex; raw = raw[min(blockSize, len(raw)):] {
+			raw := raw[:min(blockSize, len(raw))]
+			hi := min(end-i*payloadSize, payloadSize)
+			if offset == 0 && hi == payloadSize && len(raw) == blockSize && l.payloadShift != nil {
+				sum := crc32.Checksum(raw[l.headerSize:], crc32cTable)
+				if sum == binary.BigEndian.Uint32(raw) {
+					crc = l.payloadShift.combine(crc, sum)
+					i++
+					continue
+				}
+			}
+			payload, err := l.verifyBlock(f, raw, scratch, i)
+			if err != nil {
+				putBuffer(span)
+				return 0, err
+			}
+			crc = crc32.Update(crc, crc32cTable, payload[offset:min(hi, len(payload))])
+			offset = 0
+			i++
+		}
+		putBuffer(span)
+		if n < count*blockSize {
+			break
+		}
+	}
+	return crc, nil
+}
+
+// crc32Shift is the operator over GF(2) that turns the CRC32C of a byte
+// string into that of the string followed by a given number of zero bytes.
+// Building it squares a matrix twice per bit of the length, while applying
+// it is a single product, so it is built once per length.
+type crc32Shift [32]uint32
+
+// newCRC32Shift returns the operator appending n zero bytes. It follows
+// crc32_combine of zlib, which squares the operator of one zero bit.
+func newCRC32Shift(n int) *crc32Shift {
+	s := new(crc32Shift)
+	for i := range s {
+		s[i] = 1 << uint(i)
+	}
+	if n <= 0 {
+		return s
+	}
+	var even, odd [32]uint32
+
+	// operator for one zero bit in odd
+	odd[0] = crc32.Castagnoli
+	row := uint32(1)
+	for i := 1; i < 32; i++ {
+		odd[i] = row
+		row <<= 1
+	}
+	gf2MatrixSquare(even[:], odd[:]) // two zero bits
+	gf2MatrixSquare(odd[:], even[:]) // four zero bits
+
+	// multiply in the operators of the bits of n, the first squaring puts
+	// the operator for one zero byte, eight zero bits, in even
+	for {
+		gf2MatrixSquare(even[:], odd[:])
+		if n&1 != 0 {
+			s.apply(even[:])
+		}
+		n >>= 1
+		if n == 0 {
+			break
+		}
+		gf2MatrixSquare(odd[:], even[:])
+		if n&1 != 0 {
+			s.apply(odd[:])
+		}
+		n >>= 1
+		if n == 0 {
+			break
+		}
+	}
+	return s
+}
+
+// apply composes mat after s.
+func (s *crc32Shift) apply(mat []uint32) {
+	for i := range s {
+		s[i] = gf2MatrixTimes(mat, s[i])
+	}
+}
+
+// combine returns the CRC32C of the concatenation of two byte strings
+// given their CRCs, the second one being as long as the shift.
+func (s *crc32Shift) combine(crc1, crc2 uint32) uint32 {
+	return gf2MatrixTimes(s[:], crc1) ^ crc2
+}
+
+func gf2MatrixTimes(mat []uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square, mat []uint32) {
+	for n := range square {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
@@ -0,0 +1,64 @@
+package disk
+
+import (
+	"hash/crc32"
+	"testing"
+)
+
+func TestCRC32Combine(t *testing.T) {
+	p := make([]byte, 10000)
+	fillPattern(p, len(p))
+	for _, split := range []int{0, 1, 7, 4092, 9999, 10000} {
+		crc1 := crc32.Checksum(p[:split], crc32cTable)
+		crc2 := crc32.Checksum(p[split:], crc32cTable)
+		shift := newCRC32Shift(len(p) - split)
+		if got, expected := shift.combine(crc1, crc2), crc32.Checksum(p, crc32cTable); got != expected {
+			t.Errorf("%d: expect %x got %x", split, expected, got)
+		}
+	}
+}
+
+func TestDiskChecksum(t *testing.T) {
+	for _, checksum := range []string{CRC32C, XXHash64} {
+		d := newTestDisk("disk0", "rangesum", false)
+		d.Checksum = checksum
+		if err := d.Init(); err != nil {
+			t.Fatalf("%s: error = %v", checksum, err)
+		}
+		p := make([]byte, payloadSize*5+123)
+		fillPattern(p, len(p))
+		if _, err := d.WriteAt(tmpTestFile, p, 0); err != nil {
+			t.Fatalf("%s: error = %v", checksum, err)
+		}
+		tests := []struct {
+			off, length int64
+		}{
+			{0, -1},
+			{0, int64(payloadSize)},
+			{5, int64(payloadSize * 3)},
+			{int64(payloadSize), int64(payloadSize*4 + 123)},
+			{100, 1 << 30},
+			{int64(len(p)), 10},
+		}
+		for i, tt := range tests {
+			end := int64(len(p))
+			if tt.length >= 0 && tt.off+tt.length < end {
+				end = tt.off + tt.length
+			}
+			crc, n, err := d.RangeChecksum(tmpTestFile, tt.off, tt.length)
+			if err != nil {
+				t.Fatalf("%s: %d: error = %v", checksum, i, err)
+			}
+			if n != end-tt.off {
+				t.Errorf("%s: %d: expect %d bytes got %d", checksum, i, end-tt.off, n)
+			}
+			if expected := crc32.Checksum(p[tt.off:end], crc32cTable); crc != expected {
+				t.Errorf("%s: %d: expect %x got %x", checksum, i, expected, crc)
+			}
+		}
+		if _, _, err := d.RangeChecksum(tmpTestFile, -5, 10); err != ErrNegativeOffset {
+			t.Errorf("%s: expect error %v got %v", checksum, ErrNegativeOffset, err)
+		}
+		d.Remove("", true)
+	}
+}
@@ -0,0 +1,103 @@
+package disk
+
+import (
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+)
+
+// Sidecars are per-file metadata kept in a tree mirroring the data under
+// MetaDir/<kind>, so they follow their files through renames and removals.
+var sidecarKinds = []string{merkleDir, genDir, cowDir, linkDir}
+
+// sidecar returns the path of the sidecar of the given kind of the named file.
+func (d *Disk) sidecar(kind, name string) string {
+	return path.Join(d.Root, MetaDir, kind, path.Clean("/"+name))
+}
+
+// renameSidecars moves the sidecars of oldname to newname, replacing
+// the ones of newname.
+func (d *Disk) renameSidecars(oldname, newname string) {
+	for _, kind := range sidecarKinds {
+		newpath := d.sidecar(kind, newname)
+		os.RemoveAll(newpath)
+		if err := os.MkdirAll(path.Dir(newpath), 0700); err != nil {
+			continue
+		}
+		os.Rename(d.sidecar(kind, oldname), newpath)
+	}
+}
+
+// removeSidecars removes the sidecars of name and of any file under name.
+func (d *Disk) removeSidecars(name string) {
+	for _, kind := range sidecarKinds {
+		os.RemoveAll(d.sidecar(kind, name))
+	}
+}
+
+// fileLocks serialize the updates of a file and of its sidecars.
+// Files are mapped to locks by the hash of their path.
+var fileLocks [256]sync.Mutex
+
+// fileLock is a lock of one or two files taken by lockFile or lockFiles.
+// It also holds off snapshots of the disk until it is unlocked.
+type fileLock struct {
+	mu, mu2 *sync.Mutex
+	d       *Disk
+}
+
+func (l fileLock) Unlock() {
+	if l.mu2 != nil {
+		l.mu2.Unlock()
+	}
+	l.mu.Unlock()
+	l.d.snapMu.RUnlock()
+}
+
+func (d *Disk) lockIndex(name string) int {
+	h := fnv.New32a()
+	h.Write([]byte(path.Join(d.Root, path.Clean("/"+name))))
+	return int(h.Sum32() % uint32(len(fileLocks)))
+}
+
+func (d *Disk) lockFile(name string) fileLock {
+	d.snapMu.RLock()
+	mu := &fileLocks[d.lockIndex(name)]
+	mu.Lock()
+	return fileLock{mu: mu, d: d}
+}
+
+// lockFiles locks two files. Locks are taken in the order of their index
+// so that callers locking the same files do not deadlock.
+func (d *Disk) lockFiles(name1, name2 string) fileLock {
+	d.snapMu.RLock()
+	i, j := d.lockIndex(name1), d.lockIndex(name2)
+	if i > j {
+		i, j = j, i
+	}
+	l := fileLock{mu: &fileLocks[i], d: d}
+	l.mu.Lock()
+	if j != i {
+		l.mu2 = &fileLocks[j]
+		l.mu2.Lock()
+	}
+	return l
+}
+
+// mark creates the marker sidecar of the given kind of the named file.
+func (d *Disk) mark(kind, key string) error {
+	marker := d.sidecar(kind, key)
+	if err := os.MkdirAll(path.Dir(marker), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(marker, nil, 0600)
+}
+
+// marked reports whether the named file has the marker sidecar of the
+// given kind.
+func (d *Disk) marked(kind, key string) bool {
+	_, err := os.Lstat(d.sidecar(kind, key))
+	return err == nil
+}
@@ -0,0 +1,297 @@
+package disk
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// The snapshots of a disk are kept in MetaDir/snap. Every snapshot is a
+// directory named by a unique id, which is the time the snapshot was
+// taken in nanoseconds, holding the copy and the name of the file.
+//
+// The files of a copy share their data with the originals: they are
+// reflinks where the filesystem supports them, and hard links otherwise.
+// Hard linked files are marked with a cow sidecar and copied before they
+// are next updated in place, so that the copy keeps the data it had.
+const (
+	snapDir  = "snap"
+	snapData = "data"
+	snapName = "name"
+	cowDir   = "cow"
+)
+
+// ErrNoSnapshot is returned for an id that names no snapshot of the disk.
+var ErrNoSnapshot = errors.New("disk: no such snapshot")
+
+var errRestoreRoot = errors.New("disk: cannot restore over the root of a disk")
+
+// SnapshotInfo describes a snapshot.
+type SnapshotInfo struct {
+	// ID identifies the snapshot on the disk.
+	ID string
+	// Name is the name of the file or directory snapshotted.
+	Name string
+	// Created is when the snapshot was taken.
+	Created time.Time
+}
+
+// Snapshot takes a read-only copy of the named directory or file and
+// returns its id. The updates of the disk wait while the files are linked
+// into the copy, so that it holds the files as they were at one point in
+// time; no data is copied.
+func (d *Disk) Snapshot(name string) (string, error) {
+	d.snapMu.Lock()
+	defer d.snapMu.Unlock()
+	key := path.Clean("/" + name)[1:]
+	fn := path.Join(d.Root, key)
+	if _, err := os.Lstat(fn); err != nil {
+		return "", err
+	}
+	id := strconv.FormatUint(nextGeneration(), 10)
+	dir := path.Join(d.Root, MetaDir, snapDir, id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(path.Join(dir, snapName), []byte(key), 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	if err := d.copyTree(fn, path.Join(dir, snapData), key); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return id, nil
+}
+
+// snapshot returns the directory of the snapshot id.
+func (d *Disk) snapshot(id string) (string, error) {
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", ErrNoSnapshot
+	}
+	dir := path.Join(d.Root, MetaDir, snapDir, id)
+	if _, err := os.Lstat(path.Join(dir, snapData)); err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrNoSnapshot
+		}
+		return "", err
+	}
+	return dir, nil
+}
+
+// ListSnapshots returns the snapshots of the disk, oldest first.
+func (d *Disk) ListSnapshots() ([]SnapshotInfo, error) {
+	ids, err := listIDs(path.Join(d.Root, MetaDir, snapDir))
+	if err != nil {
+		return nil, err
+	}
+	var snaps []SnapshotInfo
+	for _, id := range ids {
+		s := strconv.FormatUint(id, 10)
+		dir := path.Join(d.Root, MetaDir, snapDir, s)
+		if _, err := os.Lstat(path.Join(dir, snapData)); err != nil {
+			// being taken or deleted
+			continue
+		}
+		name, err := ioutil.ReadFile(path.Join(dir, snapName))
+		if err != nil {
+			continue
+		}
+		snaps = append(snaps, SnapshotInfo{ID: s, Name: string(name), Created: time.Unix(0, int64(id))})
+	}
+	return snaps, nil
+}
+
+// DeleteSnapshot deletes the snapshot id.
+func (d *Disk) DeleteSnapshot(id string) error {
+	d.snapMu.Lock()
+	dir, err := d.snapshot(id)
+	if err == nil {
+		// hide the snapshot right away and delete it without holding
+		// off the updates of the disk
+		err = os.Remove(path.Join(dir, snapName))
+	}
+	d.snapMu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// RestoreSnapshot copies the snapshot id back to the name it was taken of,
+// or to name if it is not empty, and returns the name it was restored to.
+// The file there is removed, to the trash if the disk has one. Like taking
+// a snapshot, restoring one shares the data of the files.
+func (d *Disk) RestoreSnapshot(id, name string) (string, error) {
+	d.snapMu.Lock()
+	defer d.snapMu.Unlock()
+	dir, err := d.snapshot(id)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		b, err := ioutil.ReadFile(path.Join(dir, snapName))
+		if err != nil {
+			return "", err
+		}
+		name = string(b)
+	}
+	key := path.Clean("/" + name)[1:]
+	if key == "" {
+		return "", errRestoreRoot
+	}
+	fn := path.Join(d.Root, key)
+	if _, err := os.Lstat(fn); err == nil {
+		if err := d.discard(key, true); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(path.Dir(fn), 0700); err != nil {
+		return "", err
+	}
+	err = d.copyTree(path.Join(dir, snapData), fn, key)
+	if d.Cache != nil {
+		d.Cache.invalidateTree(d.Name, key)
+	}
+	return key, err
+}
+
+// copyTree copies the tree at src to dst sharing the data of the files.
+// The named file of the disk is the live side of the copy, whose files
+// are marked when they are hard linked.
+func (d *Disk) copyTree(src, dst, name string) error {
+	meta := path.Join(d.Root, MetaDir)
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == meta {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := path.Join(dst, rel)
+		switch {
+		case fi.IsDir():
+			return os.Mkdir(target, 0700)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case fi.Mode().IsRegular():
+			if err := cloneFile(p, target, fi); err == nil {
+				return nil
+			}
+			if err := os.Link(p, target); err != nil {
+				return err
+			}
+			return d.mark(cowDir, path.Join(name, rel))
+		}
+		return nil
+	})
+}
+
+// markLinked marks the hard linked files under the named file as sharing
+// their data with a snapshot, for files moved back without their
+// sidecars. Files linked by Link are left alone.
+func (d *Disk) markLinked(key string) {
+	filepath.Walk(path.Join(d.Root, key), func(p string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() || linkCount(fi) < 2 {
+			return nil
+		}
+		if rel, err := filepath.Rel(d.Root, p); err == nil && !d.marked(linkDir, rel) {
+			d.mark(cowDir, rel)
+		}
+		return nil
+	})
+}
+
+// unshare gives the named file its own copy of its data if it shares it
+// with a snapshot, before the file is updated in place. The file must be
+// locked.
+func (d *Disk) unshare(key string) error {
+	if !d.marked(cowDir, key) {
+		return nil
+	}
+	fn := path.Join(d.Root, key)
+	fi, err := os.Lstat(fn)
+	if err == nil && fi.Mode().IsRegular() && linkCount(fi) > 1 {
+		tmp := path.Join(d.Root, MetaDir, cowDir+"-"+strconv.FormatUint(nextGeneration(), 10))
+		if err := copyFile(fn, tmp, fi); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if err := os.Rename(tmp, fn); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		d.unlinkSidecars(key)
+	}
+	return os.Remove(d.sidecar(cowDir, key))
+}
+
+// cloneFile makes dst a reflink of src, whose info is fi.
+func cloneFile(src, dst string, fi os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	err = reflink(out, in)
+	out.Close()
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+// copyFile copies src, whose info is fi, to dst. It makes a reflink if it
+// can, and copies the allocated ranges of src otherwise to keep its holes.
+func copyFile(src, dst string, fi os.FileInfo) error {
+	if err := cloneFile(src, dst, fi); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	ranges, err := allocatedRanges(in, fi.Size())
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 1<<20)
+	for _, r := range ranges {
+		for off := r.start; off < r.end; {
+			n, err := in.ReadAt(buf[:min64(int64(len(buf)), r.end-off)], off)
+			if err != nil {
+				return err
+			}
+			if _, err := out.WriteAt(buf[:n], off); err != nil {
+				return err
+			}
+			off += int64(n)
+		}
+	}
+	if err := out.Truncate(fi.Size()); err != nil {
+		return err
+	}
+	return out.Close()
+}
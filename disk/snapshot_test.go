@@ -0,0 +1,86 @@
+package disk
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	d := newTestDisk("disk0", "snapshot", true)
+	defer d.Remove("", true)
+
+	if err := d.Mkdir("a/b", true); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	for _, fn := range []string{"a/x", "a/b/y", "z"} {
+		if _, err := d.WriteAt(fn, []byte(fn), 0); err != nil {
+			t.Fatalf("error = %v", err)
+		}
+	}
+	id, err := d.Snapshot("a")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+
+	// later updates do not change the snapshot
+	if _, err := d.WriteAt("a/x", []byte("new"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := d.WriteV("a/b/y", []IOVec{{Offset: 5, Data: []byte("more")}}); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := d.Remove("a/b", true); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+
+	snaps, err := d.ListSnapshots()
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if len(snaps) != 1 || snaps[0].ID != id || snaps[0].Name != "a" {
+		t.Fatalf("snapshots = %+v, want %s of a", snaps, id)
+	}
+
+	if name, err := d.RestoreSnapshot(id, "c"); err != nil || name != "c" {
+		t.Fatalf("restore = %s, %v, want c", name, err)
+	}
+	for fn, want := range map[string]string{"a/x": "new", "c/x": "a/x", "c/b/y": "a/b/y"} {
+		b := make([]byte, len(want))
+		if _, err := d.ReadAt(fn, b, 0); err != nil || string(b) != want {
+			t.Errorf("read %s = %q, %v, want %q", fn, b, err, want)
+		}
+	}
+	// the restored files are copied on write too
+	if _, err := d.WriteAt("c/x", []byte("c/x"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+
+	if name, err := d.RestoreSnapshot(id, ""); err != nil || name != "a" {
+		t.Fatalf("restore = %s, %v, want a", name, err)
+	}
+	for fn, want := range map[string]string{"a/x": "a/x", "a/b/y": "a/b/y"} {
+		b := make([]byte, len(want))
+		if _, err := d.ReadAt(fn, b, 0); err != nil || string(b) != want {
+			t.Errorf("read %s = %q, %v, want %q", fn, b, err, want)
+		}
+	}
+	if size, err := d.Size("a/b/y"); err != nil || size != 5 {
+		t.Errorf("size = %d, %v, want 5", size, err)
+	}
+
+	if _, err := d.RestoreSnapshot(id, "/"); err != errRestoreRoot {
+		t.Errorf("restore over root error = %v, want %v", err, errRestoreRoot)
+	}
+	if err := d.DeleteSnapshot(id); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := d.DeleteSnapshot(id); err != ErrNoSnapshot {
+		t.Errorf("delete twice error = %v, want %v", err, ErrNoSnapshot)
+	}
+	if snaps, _ = d.ListSnapshots(); len(snaps) != 0 {
+		t.Errorf("snapshots = %+v, want none", snaps)
+	}
+	if _, err := d.Snapshot("nonexistent"); !os.IsNotExist(err) {
+		t.Errorf("error = %v, want not exist", err)
+	}
+}
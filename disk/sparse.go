@@ -0,0 +1,100 @@
+package disk
+
+import (
+	"io"
+	"os"
+	"path"
+)
+
+// Extent is a range of the data of a file that is allocated on disk.
+// The data outside the extents of a file are holes, which read back as zeros.
+type Extent struct {
+	Offset int64
+	Length int64
+}
+
+// rawRange is a range [start, end) of the bytes of a file.
+type rawRange struct {
+	start, end int64
+}
+
+// Extents returns the allocated extents of the named file in data offsets,
+// in ascending order. Extents are block granular: a block is allocated if
+// any of its bytes is. Platforms that cannot find holes report the whole
+// file as one extent.
+func (d *Disk) Extents(name string) ([]Extent, error) {
+	f, err := os.Open(path.Join(d.Root, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	l := d.layout()
+	size, err := l.fileDataSize(f)
+	if err != nil {
+		return nil, err
+	}
+	ranges, err := allocatedRanges(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	return l.extents(ranges, int64(size)), nil
+}
+
+// fdFile is implemented by files backed by a file descriptor.
+type fdFile interface {
+	Fd() uintptr
+}
+
+// allocated tells if any of the blocks from first up to last of f is
+// allocated. Files whose holes cannot be found are taken as allocated.
+func (l layout) allocated(f io.ReaderAt, first, last int) bool {
+	fd, ok := f.(fdFile)
+	if !ok {
+		return true
+	}
+	return hasData(fd.Fd(), l.blockOffset(first), l.blockOffset(last))
+}
+
+// extents maps the allocated ranges of a file to the extents of its data
+// of size bytes.
+func (l layout) extents(ranges []rawRange, size int64) []Extent {
+	base, blockSize, payloadSize := int64(l.base), int64(l.blockSize), int64(l.payloadSize())
+	var extents []Extent
+	for _, r := range ranges {
+		if r.end <= base {
+			// the file header
+			continue
+		}
+		first, last := max64(r.start-base, 0)/blockSize, (r.end-base-1)/blockSize
+		start := first * payloadSize
+		end := min64((last+1)*payloadSize, size)
+		if start >= end {
+			continue
+		}
+		if n := len(extents); n > 0 && extents[n-1].Offset+extents[n-1].Length >= start {
+			extents[n-1].Length = max64(extents[n-1].Length, end-extents[n-1].Offset)
+			continue
+		}
+		extents = append(extents, Extent{Offset: start, Length: end - start})
+	}
+	return extents
+}
+
+func min64(a, b int64) int64 {
+	if a > b {
+		return b
+	}
+	return a
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,55 @@
+package disk
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// allocatedRanges finds the allocated ranges of f with SEEK_DATA and
+// SEEK_HOLE. Filesystems without hole support report a single range.
+func allocatedRanges(f *os.File, size int64) ([]rawRange, error) {
+	fd := int(f.Fd())
+	var ranges []rawRange
+	for off := int64(0); off < size; {
+		start, err := syscall.Seek(fd, off, seekData)
+		if err == syscall.ENXIO {
+			// no data after off
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		end, err := syscall.Seek(fd, start, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, rawRange{start, end})
+		off = end
+	}
+	return ranges, nil
+}
+
+// hasData tells if the file of fd has data in [start, end), as found with
+// SEEK_DATA. It errs on the side of data.
+func hasData(fd uintptr, start, end int64) bool {
+	off, err := syscall.Seek(int(fd), start, seekData)
+	if err == syscall.ENXIO {
+		// no data after start
+		return false
+	}
+	return err != nil || off < end
+}
+
+// allocatedSize returns the number of bytes allocated to a file, which is
+// less than its size if it has holes.
+func allocatedSize(fi os.FileInfo) int64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Blocks * 512
+	}
+	return fi.Size()
+}
@@ -0,0 +1,171 @@
+package disk
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+)
+
+func TestSparseWrite(t *testing.T) {
+	d := newTestDisk("disk0", "sparse", true)
+	defer d.Remove("", true)
+
+	off := int64(payloadSize*1000 + 10)
+	if _, err := d.WriteAt(tmpTestFile, []byte("head"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := d.WriteAt(tmpTestFile, []byte("tail"), off); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+
+	size, err := d.Size(tmpTestFile)
+	if err != nil || size != off+4 {
+		t.Fatalf("expect size %d got %d (%v)", off+4, size, err)
+	}
+	r := make([]byte, size)
+	if _, err := d.ReadAt(tmpTestFile, r, 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	expected := make([]byte, size)
+	copy(expected, "head")
+	copy(expected[off:], "tail")
+	if !bytes.Equal(expected, r) {
+		t.Errorf("expect holes to read back as zeros")
+	}
+
+	// filling a hole partially keeps the rest of it zero
+	if _, err := d.WriteAt(tmpTestFile, []byte("middle"), int64(payloadSize*500+7)); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	copy(expected[payloadSize*500+7:], "middle")
+	if _, err := d.ReadAt(tmpTestFile, r, 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if !bytes.Equal(expected, r) {
+		t.Errorf("expect written hole to read back")
+	}
+}
+
+func TestExtents(t *testing.T) {
+	d := newTestDisk("disk0", "extents", true)
+	defer d.Remove("", true)
+
+	if _, err := d.WriteAt(tmpTestFile, []byte("head"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	off := int64(payloadSize * 1000)
+	if _, err := d.WriteAt(tmpTestFile, []byte("tail"), off); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	extents, err := d.Extents(tmpTestFile)
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if len(extents) == 0 || extents[0].Offset != 0 {
+		t.Fatalf("expect extents to start with the head, got %v", extents)
+	}
+	last := extents[len(extents)-1]
+	if last.Offset+last.Length != off+4 {
+		t.Errorf("expect extents to end with the tail, got %v", extents)
+	}
+	if runtime.GOOS == "linux" && len(extents) != 2 {
+		t.Errorf("expect two extents around the hole, got %v", extents)
+	}
+}
+
+func TestLayoutExtents(t *testing.T) {
+	l := defaultLayout
+	bs, ps := int64(l.blockSize), int64(l.payloadSize())
+	tests := []struct {
+		ranges []rawRange
+		size   int64
+		out    []Extent
+	}{
+		{nil, 0, nil},
+		{[]rawRange{{0, 10}}, 6, []Extent{{0, 6}}},
+		// ranges inside the same or adjacent blocks merge
+		{[]rawRange{{0, 100}, {200, bs + 1}}, ps * 2, []Extent{{0, ps * 2}}},
+		{[]rawRange{{0, bs}, {bs * 3, bs*3 + 5}}, ps*3 + 1, []Extent{{0, ps}, {ps * 3, 1}}},
+	}
+	for i, tt := range tests {
+		out := l.extents(tt.ranges, tt.size)
+		if len(out) != len(tt.out) {
+			t.Errorf("%d: expect %v got %v", i, tt.out, out)
+			continue
+		}
+		for j := range out {
+			if out[j] != tt.out[j] {
+				t.Errorf("%d: expect %v got %v", i, tt.out, out)
+			}
+		}
+	}
+}
+
+func TestZeroedBlockIsNotHole(t *testing.T) {
+	d := newTestDisk("disk0", "zeroed", true)
+	defer d.Remove("", true)
+
+	p := make([]byte, payloadSize*3)
+	fillPattern(p, len(p))
+	if _, err := d.WriteAt(tmpTestFile, p, 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	// zero the allocated second block, checksum included
+	rf, err := os.OpenFile(path.Join(d.Root, tmpTestFile), os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	rf.WriteAt(make([]byte, blockSize), int64(blockSize))
+	rf.Close()
+	if _, err := d.ReadAt(tmpTestFile, p, 0); err != ErrBadCRC {
+		t.Errorf("expect error %v got %v", ErrBadCRC, err)
+	}
+}
+
+// memFile is a file in memory, whose holes cannot be found.
+type memFile struct {
+	b []byte
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(f.b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.b[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(f.b) {
+		f.b = append(f.b, make([]byte, end-len(f.b))...)
+	}
+	return copy(f.b[off:], p), nil
+}
+
+func TestWriteFillsGapWithoutHoles(t *testing.T) {
+	l := defaultLayout
+	f := &memFile{}
+	if _, err := l.writeAt(f, []byte("head"), 0, 0, nil); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	off := payloadSize*5 + 3
+	if _, err := l.writeAt(f, []byte("tail"), off, 4, nil); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	r := make([]byte, off+4)
+	if _, err := l.readAt(f, r, 0, 0, nil); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	expected := make([]byte, off+4)
+	copy(expected, "head")
+	copy(expected[off:], "tail")
+	if !bytes.Equal(expected, r) {
+		t.Errorf("expect the gap to read back as zeros")
+	}
+}
@@ -5,14 +5,15 @@ import (
 )
 
 type BlockReaderStream struct {
+	layout      layout
 	blockIndex  int
 	blockOffset int
-	file        io.ReadSeeker
+	file        io.ReaderAt
 }
 
 func (brs *BlockReaderStream) NextBlock() (*Block, error) {
-	block := newBlock()
-	err := readBlock(brs.file, block, brs.blockIndex)
+	block := brs.layout.newBlock()
+	err := brs.layout.readBlock(brs.file, block, brs.blockIndex)
 	block.StartFrom(brs.blockOffset)
 	brs.blockOffset = 0
 	brs.blockIndex += 1
@@ -20,14 +21,16 @@ func (brs *BlockReaderStream) NextBlock() (*Block, error) {
 }
 
 type BlockWriterStream struct {
+	layout      layout
 	blockOffset int
 	data        []byte
-	file        io.ReadWriteSeeker
+	file        readerWriterAt
 }
 
 // NextBlock gets the next block from the input stream
 func (bws *BlockWriterStream) NextBlock() (*Block, error) {
-	block := newBlock()
+	payloadSize := bws.layout.payloadSize()
+	block := bws.layout.newBlock()
 	block.EndAt(0)
 	// if this is a full block, return it
 	if bws.blockOffset == 0 && len(bws.data) >= payloadSize {
@@ -0,0 +1,243 @@
+package disk
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The trash of a disk is MetaDir/trash. Every removed file or directory
+// gets an entry there named by a unique id, which is the time of the
+// removal in nanoseconds, holding the data, the sidecars and the name of
+// the file.
+const (
+	trashDir  = "trash"
+	trashData = "data"
+	trashName = "name"
+)
+
+// ErrNoTrashEntry is returned for an id that names no entry of the trash.
+var ErrNoTrashEntry = errors.New("disk: no such trash entry")
+
+// TrashEntry is a file or directory in the trash.
+type TrashEntry struct {
+	// ID identifies the entry in the trash of the disk.
+	ID string
+	// Name is the name the file had.
+	Name string
+	// Removed is when the file was removed.
+	Removed time.Time
+	IsDir   bool
+}
+
+// trashMu serializes the undeletes and purges of trash entries.
+var trashMu sync.Mutex
+
+// discard removes the named file, moving it to the trash if the disk has
+// one. Empty directories are removed rather than kept. The file must be
+// locked.
+func (d *Disk) discard(name string, all bool) error {
+	if !d.Trash || path.Clean("/"+name) == "/" {
+		return d.remove(name, all)
+	}
+	fi, err := os.Lstat(path.Join(d.Root, name))
+	if err != nil || (fi.IsDir() && !all) {
+		// nothing to keep, or a directory that must be empty to be removed
+		return d.remove(name, all)
+	}
+	if err := d.moveToTrash(path.Join(d.Root, name), name, true); err != nil {
+		return err
+	}
+	if d.Cache != nil {
+		d.Cache.invalidateTree(d.Name, name)
+	}
+	return nil
+}
+
+// moveToTrash moves the file at p, which was the named file of the disk,
+// to a new entry of the trash, along with the sidecars of the named file
+// if sidecars is set.
+func (d *Disk) moveToTrash(p, name string, sidecars bool) error {
+	id := strconv.FormatUint(nextGeneration(), 10)
+	dir := path.Join(d.Root, MetaDir, trashDir, id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	key := path.Clean("/" + name)[1:]
+	if err := ioutil.WriteFile(path.Join(dir, trashName), []byte(key), 0600); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	if err := os.Rename(p, path.Join(dir, trashData)); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	if !sidecars {
+		return nil
+	}
+	for _, kind := range sidecarKinds {
+		os.Rename(d.sidecar(kind, name), path.Join(dir, kind))
+	}
+	return nil
+}
+
+// trashEntry returns the directory of the trash entry id.
+func (d *Disk) trashEntry(id string) (string, error) {
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", ErrNoTrashEntry
+	}
+	dir := path.Join(d.Root, MetaDir, trashDir, id)
+	if _, err := os.Lstat(path.Join(dir, trashData)); err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrNoTrashEntry
+		}
+		return "", err
+	}
+	return dir, nil
+}
+
+// listIDs returns the ids naming the entries of dir, which are times in
+// nanoseconds, in ascending order.
+func listIDs(dir string) ([]uint64, error) {
+	f, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	var ids uint64s
+	for _, n := range names {
+		if id, err := strconv.ParseUint(n, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(ids)
+	return ids, nil
+}
+
+type uint64s []uint64
+
+func (s uint64s) Len() int           { return len(s) }
+func (s uint64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// ListTrash returns the entries of the trash of the disk, oldest first.
+func (d *Disk) ListTrash() ([]TrashEntry, error) {
+	ids, err := listIDs(path.Join(d.Root, MetaDir, trashDir))
+	if err != nil {
+		return nil, err
+	}
+	var entries []TrashEntry
+	for _, id := range ids {
+		s := strconv.FormatUint(id, 10)
+		dir := path.Join(d.Root, MetaDir, trashDir, s)
+		fi, err := os.Lstat(path.Join(dir, trashData))
+		if err != nil {
+			// being purged or undeleted, or left over by a failed removal
+			continue
+		}
+		name, err := ioutil.ReadFile(path.Join(dir, trashName))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, TrashEntry{
+			ID:      s,
+			Name:    string(name),
+			Removed: time.Unix(0, int64(id)),
+			IsDir:   fi.IsDir(),
+		})
+	}
+	return entries, nil
+}
+
+// Undelete moves the trash entry id back to the named file, or to the
+// name it had if name is empty, and returns the name it was restored to.
+// It fails if the file exists. Missing parent directories are created.
+func (d *Disk) Undelete(id, name string) (string, error) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	dir, err := d.trashEntry(id)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		b, err := ioutil.ReadFile(path.Join(dir, trashName))
+		if err != nil {
+			return "", err
+		}
+		name = string(b)
+	}
+	key := path.Clean(name)
+	mu := d.lockFile(key)
+	defer mu.Unlock()
+
+	fn := path.Join(d.Root, key)
+	if _, err := os.Lstat(fn); err == nil {
+		return "", &os.PathError{Op: "undelete", Path: fn, Err: syscall.EEXIST}
+	}
+	if err := os.MkdirAll(path.Dir(fn), 0700); err != nil {
+		return "", err
+	}
+	if err := os.Rename(path.Join(dir, trashData), fn); err != nil {
+		return "", err
+	}
+	d.removeSidecars(key)
+	for _, kind := range sidecarKinds {
+		sidecar := d.sidecar(kind, key)
+		if err := os.MkdirAll(path.Dir(sidecar), 0700); err == nil {
+			os.Rename(path.Join(dir, kind), sidecar)
+		}
+	}
+	// Files removed by a Txn come without their sidecars.
+	d.markLinked(key)
+	os.RemoveAll(dir)
+	if d.Cache != nil {
+		d.Cache.invalidateTree(d.Name, key)
+	}
+	return key, nil
+}
+
+// PurgeTrash deletes the trash entry id for good.
+func (d *Disk) PurgeTrash(id string) error {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	dir, err := d.trashEntry(id)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// PurgeTrashBefore deletes for good the trash entries removed before t
+// and returns how many there were.
+func (d *Disk) PurgeTrashBefore(t time.Time) (int, error) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	ids, err := listIDs(path.Join(d.Root, MetaDir, trashDir))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, id := range ids {
+		if !time.Unix(0, int64(id)).Before(t) {
+			break
+		}
+		if err := os.RemoveAll(path.Join(d.Root, MetaDir, trashDir, strconv.FormatUint(id, 10))); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,111 @@
+package disk
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	d := newTestDisk("disk0", "trash", true)
+	defer d.Remove("", true)
+	d.Trash = true
+
+	if err := d.Mkdir("a/b", true); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	for _, fn := range []string{"a/b/x", "y"} {
+		if _, err := d.WriteAt(fn, []byte(fn), 0); err != nil {
+			t.Fatalf("error = %v", err)
+		}
+	}
+	if err := d.Remove("y", false); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := d.Remove("a", false); err == nil {
+		t.Errorf("remove of a non-empty directory error = nil")
+	}
+	if err := d.Remove("a", true); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	for _, fn := range []string{"a", "y"} {
+		if _, err := os.Stat(d.Root + "/" + fn); !os.IsNotExist(err) {
+			t.Errorf("%s stat error = %v, want not exist", fn, err)
+		}
+	}
+
+	entries, err := d.ListTrash()
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "y" || entries[0].IsDir ||
+		entries[1].Name != "a" || !entries[1].IsDir {
+		t.Fatalf("entries = %+v, want y then a", entries)
+	}
+
+	// undelete to the original name and to another one
+	if name, err := d.Undelete(entries[0].ID, ""); err != nil || name != "y" {
+		t.Fatalf("undelete = %s, %v, want y", name, err)
+	}
+	if _, err := d.Undelete(entries[1].ID, "y"); !os.IsExist(err) {
+		t.Errorf("undelete over a file error = %v, want exist", err)
+	}
+	if name, err := d.Undelete(entries[1].ID, "c/a"); err != nil || name != "c/a" {
+		t.Fatalf("undelete = %s, %v, want c/a", name, err)
+	}
+	for fn, want := range map[string]string{"y": "y", "c/a/b/x": "a/b/x"} {
+		b := make([]byte, len(want))
+		if _, err := d.ReadAt(fn, b, 0); err != nil || string(b) != want {
+			t.Errorf("read %s = %q, %v, want %q", fn, b, err, want)
+		}
+	}
+	if _, err := d.Undelete(entries[0].ID, ""); err != ErrNoTrashEntry {
+		t.Errorf("undelete twice error = %v, want %v", err, ErrNoTrashEntry)
+	}
+
+	// removals of a committed Txn go to the trash, the ones rolled back not
+	txn := d.Begin()
+	if err := txn.Remove("y", false); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := txn.Rollback(); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	txn = d.Begin()
+	if err := txn.Remove("c", true); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	entries, err = d.ListTrash()
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "c" {
+		t.Fatalf("entries = %+v, want c", entries)
+	}
+
+	if n, err := d.PurgeTrashBefore(entries[0].Removed); err != nil || n != 0 {
+		t.Errorf("purge = %d, %v, want 0", n, err)
+	}
+	if n, err := d.PurgeTrashBefore(time.Now()); err != nil || n != 1 {
+		t.Errorf("purge = %d, %v, want 1", n, err)
+	}
+	if err := d.Remove("y", false); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	entries, _ = d.ListTrash()
+	if len(entries) != 1 {
+		t.Fatalf("entries = %+v, want y", entries)
+	}
+	if err := d.PurgeTrash(entries[0].ID); err != nil {
+		t.Errorf("error = %v", err)
+	}
+	if err := d.PurgeTrash(entries[0].ID); err != ErrNoTrashEntry {
+		t.Errorf("purge twice error = %v, want %v", err, ErrNoTrashEntry)
+	}
+	if entries, _ = d.ListTrash(); len(entries) != 0 {
+		t.Errorf("entries = %+v, want none", entries)
+	}
+}
@@ -0,0 +1,366 @@
+package disk
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	txnDir = "txn"
+	// txnNameSuffix is appended to the names of the files holding the names
+	// of the files moved aside by a Txn.
+	txnNameSuffix = ".name"
+)
+
+// Txn groups changes to a disk so that they can be undone together.
+// Changes are applied right away and Rollback undoes the ones made so far
+// in reverse order; Commit keeps them. A Txn does not isolate its changes
+// from concurrent users of the disk, and it must not be used concurrently.
+//
+// Files replaced or removed by a Txn are moved aside under MetaDir until
+// it ends. Commit then moves the removed ones to the trash of the disk, if
+// it has one.
+//
+// The undo log only lives in memory, so a Txn is not all-or-nothing across
+// crashes: the changes made before a crash stay. The files a Txn moved aside
+// are left over; Init cleans them up and lists them in TxnLeftovers.
+type Txn struct {
+	d    *Disk
+	dir  string
+	n    int
+	undo []func() error
+	// removed maps the files removed by the Txn to their names.
+	removed map[string]string
+}
+
+// Begin starts a Txn on the disk.
+func (d *Disk) Begin() *Txn {
+	return &Txn{d: d}
+}
+
+// WriteAt writes p to the named file like Disk.WriteAt.
+func (t *Txn) WriteAt(name string, p []byte, off int64) (int, error) {
+	key := path.Clean(name)
+	mu := t.d.lockFile(key)
+	defer mu.Unlock()
+	return t.writeAt(key, p, off)
+}
+
+// writeAt is WriteAt on a locked file.
+func (t *Txn) writeAt(key string, p []byte, off int64) (int, error) {
+	size, err := t.d.Size(key)
+	if os.IsNotExist(err) {
+		t.undo = append(t.undo, func() error { return t.delete(key, false) })
+		return t.d.writeAt(key, p, off)
+	}
+	if err != nil {
+		return 0, err
+	}
+	var old []byte
+	if size > off {
+		old = make([]byte, min(len(p), int(size-off)))
+		if _, err := t.d.ReadAt(key, old, off); err != nil && err != io.EOF {
+			return 0, err
+		}
+	}
+	t.undo = append(t.undo, func() error {
+		mu := t.d.lockFile(key)
+		defer mu.Unlock()
+		if len(old) > 0 {
+			if _, err := t.d.writeAt(key, old, off); err != nil {
+				return err
+			}
+		}
+		return t.d.truncate(key, size)
+	})
+	return t.d.writeAt(key, p, off)
+}
+
+// Mkdir creates a directory like Disk.Mkdir.
+func (t *Txn) Mkdir(name string, all bool) error {
+	// top is the topmost directory created
+	top := ""
+	for dir := path.Clean("/" + name); dir != "/"; dir = path.Dir(dir) {
+		if _, err := os.Stat(path.Join(t.d.Root, dir)); err == nil {
+			break
+		}
+		top = dir
+		if !all {
+			break
+		}
+	}
+	if err := t.d.Mkdir(name, all); err != nil {
+		return err
+	}
+	if top != "" {
+		t.undo = append(t.undo, func() error { return t.delete(top, true) })
+	}
+	return nil
+}
+
+// Rename renames a file like Disk.Rename. A file replaced by the rename
+// is kept until the Txn ends.
+func (t *Txn) Rename(oldname, newname string) error {
+	mu := t.d.lockFiles(path.Clean(oldname), path.Clean(newname))
+	defer mu.Unlock()
+	return t.rename(oldname, newname)
+}
+
+// rename is Rename with oldname and newname locked.
+func (t *Txn) rename(oldname, newname string) error {
+	fi, err := os.Stat(path.Join(t.d.Root, newname))
+	var stashed string
+	if err == nil && !fi.IsDir() {
+		if stashed, err = t.stash(newname); err != nil {
+			return err
+		}
+	}
+	if err := t.d.rename(oldname, newname); err != nil {
+		if stashed != "" {
+			t.restore(stashed, newname)
+		}
+		return err
+	}
+	replacedDir := fi != nil && fi.IsDir()
+	t.undo = append(t.undo, func() error {
+		mu := t.d.lockFiles(path.Clean(oldname), path.Clean(newname))
+		defer mu.Unlock()
+		if err := t.d.rename(newname, oldname); err != nil {
+			return err
+		}
+		if replacedDir {
+			return t.d.Mkdir(newname, false)
+		}
+		if stashed != "" {
+			return t.restore(stashed, newname)
+		}
+		return nil
+	})
+	return nil
+}
+
+// Remove removes a file or directory like Disk.Remove. Removed files are
+// kept until the Txn ends.
+func (t *Txn) Remove(name string, all bool) error {
+	mu := t.d.lockFile(path.Clean(name))
+	defer mu.Unlock()
+	return t.remove(name, all)
+}
+
+// remove is Remove on a locked file.
+func (t *Txn) remove(name string, all bool) error {
+	fn := path.Join(t.d.Root, name)
+	fi, err := os.Stat(fn)
+	if os.IsNotExist(err) && all {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() && !all {
+		if empty, err := isEmptyDir(fn); err != nil || !empty {
+			if err == nil {
+				err = &os.PathError{Op: "remove", Path: fn, Err: syscall.ENOTEMPTY}
+			}
+			return err
+		}
+	}
+	stashed, err := t.stash(name)
+	if err != nil {
+		return err
+	}
+	t.d.removeSidecars(name)
+	if t.removed == nil {
+		t.removed = make(map[string]string)
+	}
+	t.removed[stashed] = name
+	t.undo = append(t.undo, func() error {
+		delete(t.removed, stashed)
+		mu := t.d.lockFile(path.Clean(name))
+		defer mu.Unlock()
+		return t.restore(stashed, name)
+	})
+	return nil
+}
+
+// WriteAtIf is WriteAt made conditional like Disk.WriteAtIf.
+func (t *Txn) WriteAtIf(name string, p []byte, off int64, pre Precondition) (int, uint64, error) {
+	key := path.Clean(name)
+	mu := t.d.lockFile(key)
+	defer mu.Unlock()
+	if err := t.d.check(key, pre); err != nil {
+		return 0, 0, err
+	}
+	n, err := t.writeAt(key, p, off)
+	if err != nil {
+		return n, 0, err
+	}
+	g, err := t.d.generation(key)
+	return n, g, err
+}
+
+// RenameIf is Rename made conditional like Disk.RenameIf.
+func (t *Txn) RenameIf(oldname, newname string, pre Precondition) error {
+	mu := t.d.lockFiles(path.Clean(oldname), path.Clean(newname))
+	defer mu.Unlock()
+	if err := t.d.check(path.Clean(newname), pre); err != nil {
+		return err
+	}
+	return t.rename(oldname, newname)
+}
+
+// RemoveIf is Remove made conditional like Disk.RemoveIf.
+func (t *Txn) RemoveIf(name string, all bool, pre Precondition) error {
+	mu := t.d.lockFile(path.Clean(name))
+	defer mu.Unlock()
+	if err := t.d.check(path.Clean(name), pre); err != nil {
+		return err
+	}
+	return t.remove(name, all)
+}
+
+// Commit ends the Txn keeping its changes.
+func (t *Txn) Commit() error {
+	t.undo = nil
+	if t.dir == "" {
+		return nil
+	}
+	if t.d.Trash {
+		for stashed, name := range t.removed {
+			if err := t.d.moveToTrash(stashed, name, false); err != nil {
+				return err
+			}
+		}
+	}
+	t.removed = nil
+	return os.RemoveAll(t.dir)
+}
+
+// Rollback ends the Txn undoing its changes. If a change cannot be undone,
+// Rollback goes on with the others and returns the first error. Files moved
+// aside are then left under MetaDir until Init cleans them up.
+func (t *Txn) Rollback() error {
+	var first error
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		if err := t.undo[i](); err != nil && first == nil {
+			first = err
+		}
+	}
+	t.undo = nil
+	if first != nil || t.dir == "" {
+		return first
+	}
+	return os.RemoveAll(t.dir)
+}
+
+// delete deletes the named file for good, to undo its creation.
+func (t *Txn) delete(name string, all bool) error {
+	mu := t.d.lockFile(path.Clean(name))
+	defer mu.Unlock()
+	return t.d.remove(name, all)
+}
+
+// stash moves the named file aside and returns where it went.
+func (t *Txn) stash(name string) (string, error) {
+	if t.dir == "" {
+		id := make([]byte, 8)
+		if _, err := io.ReadFull(rand.Reader, id); err != nil {
+			return "", err
+		}
+		dir := path.Join(t.d.Root, MetaDir, txnDir, hex.EncodeToString(id))
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", err
+		}
+		t.dir = dir
+	}
+	t.n++
+	stashed := path.Join(t.dir, strconv.Itoa(t.n))
+	// The name lets Init put the file in the trash if the Txn is cut short
+	if err := ioutil.WriteFile(stashed+txnNameSuffix, []byte(path.Clean("/" + name)[1:]), 0600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(path.Join(t.d.Root, name), stashed); err != nil {
+		os.Remove(stashed + txnNameSuffix)
+		return "", err
+	}
+	if t.d.Cache != nil {
+		t.d.Cache.invalidateTree(t.d.Name, name)
+	}
+	return stashed, nil
+}
+
+// restore moves a stashed file back to name.
+func (t *Txn) restore(stashed, name string) error {
+	if t.d.Cache != nil {
+		defer t.d.Cache.invalidateTree(t.d.Name, name)
+	}
+	if err := os.Rename(stashed, path.Join(t.d.Root, name)); err != nil {
+		return err
+	}
+	t.d.markLinked(name)
+	return nil
+}
+
+// cleanTxns cleans up the files moved aside by the Txns cut short by a
+// crash, and records their names in TxnLeftovers.
+func (d *Disk) cleanTxns() error {
+	d.TxnLeftovers = nil
+	root := path.Join(d.Root, MetaDir, txnDir)
+	txns, err := ioutil.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, txn := range txns {
+		dir := path.Join(root, txn.Name())
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, fi := range files {
+			if strings.HasSuffix(fi.Name(), txnNameSuffix) {
+				continue
+			}
+			stashed := path.Join(dir, fi.Name())
+			name := ""
+			if data, err := ioutil.ReadFile(stashed + txnNameSuffix); err == nil {
+				name = string(data)
+			}
+			if d.Trash && name != "" {
+				if err := d.moveToTrash(stashed, name, false); err != nil {
+					return err
+				}
+			}
+			if name == "" {
+				name = path.Join(MetaDir, txnDir, txn.Name(), fi.Name())
+			}
+			d.TxnLeftovers = append(d.TxnLeftovers, name)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isEmptyDir(name string) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(1)
+	if err == io.EOF {
+		return true, nil
+	}
+	return len(names) == 0, err
+}
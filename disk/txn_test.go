@@ -0,0 +1,195 @@
+package disk
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+)
+
+func TestTxnRollback(t *testing.T) {
+	d := newTestDisk("disk0", "txn", true)
+	defer d.Remove("", true)
+
+	p := make([]byte, payloadSize*2+10)
+	fillPattern(p, len(p))
+	if _, err := d.WriteAt("a", p, 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := d.WriteAt("b", []byte("b"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := d.Mkdir("dir", false); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+
+	txn := d.Begin()
+	if _, err := txn.WriteAt("a", []byte("overwritten"), int64(payloadSize)); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := txn.WriteAt("a", []byte("grown"), int64(len(p)+payloadSize*3)); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := txn.WriteAt("new", []byte("new"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := txn.Mkdir("x/y/z", true); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := txn.Rename("b", "dir/b"); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := txn.Remove("dir", true); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := txn.Rollback(); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+
+	r := make([]byte, len(p))
+	if _, err := d.ReadAt("a", r, 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if !bytes.Equal(p, r) {
+		t.Errorf("expect overwritten data to be restored")
+	}
+	if size, _ := d.Size("a"); size != int64(len(p)) {
+		t.Errorf("expect size %d got %d", len(p), size)
+	}
+	for _, name := range []string{"b", "dir"} {
+		if _, err := os.Stat(path.Join(d.Root, name)); err != nil {
+			t.Errorf("expect %s to be restored, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"new", "x", "dir/b"} {
+		if _, err := os.Stat(path.Join(d.Root, name)); !os.IsNotExist(err) {
+			t.Errorf("expect %s to be undone, got %v", name, err)
+		}
+	}
+	if empty, _ := isEmptyDir(path.Join(d.Root, MetaDir, txnDir)); !empty {
+		t.Errorf("expect moved aside files to be cleaned up")
+	}
+}
+
+func TestTxnCommit(t *testing.T) {
+	d := newTestDisk("disk0", "txn", true)
+	defer d.Remove("", true)
+	if _, err := d.WriteAt("a", []byte("a"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := d.WriteAt("b", []byte("b"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+
+	txn := d.Begin()
+	if err := txn.Rename("a", "b"); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	r := make([]byte, 1)
+	if _, err := d.ReadAt("b", r, 0); err != nil || r[0] != 'a' {
+		t.Errorf("expect b to be replaced, got %q (%v)", r, err)
+	}
+	if empty, _ := isEmptyDir(path.Join(d.Root, MetaDir, txnDir)); !empty {
+		t.Errorf("expect replaced file to be removed")
+	}
+}
+
+func TestTxnLeftovers(t *testing.T) {
+	d := newTestDisk("disk0", "txn", true)
+	defer d.Remove("", true)
+	d.Trash = true
+	if _, err := d.WriteAt("a", []byte("a"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+
+	// the Txn is cut short by a crash
+	txn := d.Begin()
+	if err := txn.Remove("a", false); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	restarted := &Disk{Name: d.Name, Root: d.Root, Trash: true}
+	if err := restarted.Init(); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if len(restarted.TxnLeftovers) != 1 || restarted.TxnLeftovers[0] != "a" {
+		t.Errorf("leftovers = %v, want [a]", restarted.TxnLeftovers)
+	}
+	if empty, _ := isEmptyDir(path.Join(d.Root, MetaDir, txnDir)); !empty {
+		t.Errorf("expect moved aside files to be cleaned up")
+	}
+	entries, err := restarted.ListTrash()
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "a" {
+		t.Errorf("entries = %+v, want a", entries)
+	}
+}
+
+func TestTxnWriteAtIfRace(t *testing.T) {
+	d := newTestDisk("disk0", "txn", true)
+	defer d.Remove("", true)
+	if _, err := d.WriteAt("counter", []byte("00000000"), 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+
+	// Writers increment the counter in batches made conditional on its
+	// generation, so that no increment is lost if the check and the write
+	// are atomic.
+	const writers, increments = 8, 200
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		go func() {
+			for n := 0; n < increments; {
+				g, err := d.Generation("counter")
+				if err != nil {
+					errs <- err
+					return
+				}
+				p := make([]byte, 8)
+				if _, err := d.ReadAt("counter", p, 0); err != nil {
+					errs <- err
+					return
+				}
+				v, err := strconv.Atoi(string(p))
+				if err != nil {
+					errs <- err
+					return
+				}
+				txn := d.Begin()
+				_, _, err = txn.WriteAtIf("counter", []byte(fmt.Sprintf("%08d", v+1)), 0, Precondition{Generation: g})
+				if err == ErrPrecondition {
+					txn.Rollback()
+					continue
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				if err := txn.Commit(); err != nil {
+					errs <- err
+					return
+				}
+				n++
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < writers; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("error = %v", err)
+		}
+	}
+	p := make([]byte, 8)
+	if _, err := d.ReadAt("counter", p, 0); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if want := fmt.Sprintf("%08d", writers*increments); string(p) != want {
+		t.Errorf("counter = %s, want %s", p, want)
+	}
+}
@@ -0,0 +1,105 @@
+package disk
+
+import (
+	"os"
+	"path"
+	"sort"
+)
+
+// Usage is the space used by the files of a directory tree.
+type Usage struct {
+	// Path is the path of the directory relative to the one asked for.
+	Path string
+	// Logical is the size of the data of the files.
+	Logical int64
+	// Allocated is the space allocated to the files on the underlying
+	// filesystem, including block headers and padding, and less the
+	// holes and the space saved by compression.
+	Allocated int64
+	// Files and Dirs are the numbers of files and directories under the
+	// directory.
+	Files int64
+	Dirs  int64
+}
+
+func (u *Usage) add(v Usage) {
+	u.Logical += v.Logical
+	u.Allocated += v.Allocated
+	u.Files += v.Files
+	u.Dirs += v.Dirs
+}
+
+// Usage returns the space used under the named directory and, down to
+// depth levels, under each of its subdirectories. A directory comes
+// before its subdirectories, which are sorted by name.
+func (d *Disk) Usage(name string, depth int) ([]Usage, error) {
+	fi, err := os.Lstat(path.Join(d.Root, name))
+	if err != nil {
+		return nil, err
+	}
+	var usages []Usage
+	if !fi.IsDir() {
+		u := Usage{Files: 1, Allocated: allocatedSize(fi)}
+		if fi.Mode().IsRegular() {
+			u.Logical, err = d.Size(name)
+		}
+		return append(usages, u), err
+	}
+	_, err = d.usage(name, path.Clean("/"+name) == "/", "", depth, &usages)
+	return usages, err
+}
+
+// usage adds up the usage of the directory dir under name, appending it
+// to usages if depth is not negative.
+func (d *Disk) usage(name string, top bool, dir string, depth int, usages *[]Usage) (Usage, error) {
+	u := Usage{Path: dir}
+	i := len(*usages)
+	if depth >= 0 {
+		*usages = append(*usages, u)
+	}
+	f, err := os.Open(path.Join(d.Root, name, dir))
+	if err != nil {
+		return u, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return u, err
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if top && dir == "" && n == MetaDir {
+			continue
+		}
+		p := path.Join(dir, n)
+		fi, err := os.Lstat(path.Join(d.Root, name, p))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return u, err
+		}
+		if fi.IsDir() {
+			sub, err := d.usage(name, top, p, depth-1, usages)
+			if err != nil {
+				return u, err
+			}
+			u.add(sub)
+			u.Dirs++
+			continue
+		}
+		u.Files++
+		u.Allocated += allocatedSize(fi)
+		if fi.Mode().IsRegular() {
+			size, err := d.Size(path.Join(name, p))
+			if err != nil && !os.IsNotExist(err) {
+				return u, err
+			}
+			u.Logical += size
+		}
+	}
+	if depth >= 0 {
+		(*usages)[i] = u
+	}
+	return u, nil
+}
@@ -0,0 +1,58 @@
+package disk
+
+import "testing"
+
+func TestUsage(t *testing.T) {
+	d := newTestDisk("disk0", "usage", true)
+	defer d.Remove("", true)
+
+	if err := d.Mkdir("a/b", true); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	files := map[string]int{"a/x": 10, "a/b/y": 100, "a/b/z": 1000, "w": 1}
+	for fn, n := range files {
+		if _, err := d.WriteAt(fn, make([]byte, n), 0); err != nil {
+			t.Fatalf("error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		depth int
+		want  []Usage
+	}{
+		{"", 0, []Usage{{Path: "", Logical: 1111, Files: 4, Dirs: 2}}},
+		{"", 2, []Usage{
+			{Path: "", Logical: 1111, Files: 4, Dirs: 2},
+			{Path: "a", Logical: 1110, Files: 3, Dirs: 1},
+			{Path: "a/b", Logical: 1100, Files: 2},
+		}},
+		{"a", 1, []Usage{
+			{Path: "", Logical: 1110, Files: 3, Dirs: 1},
+			{Path: "b", Logical: 1100, Files: 2},
+		}},
+		{"a/x", 1, []Usage{{Path: "", Logical: 10, Files: 1}}},
+	}
+	for i, tt := range tests {
+		got, err := d.Usage(tt.name, tt.depth)
+		if err != nil {
+			t.Fatalf("#%d: error = %v", i, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("#%d: usages = %+v, want %+v", i, got, tt.want)
+		}
+		for j, u := range got {
+			if u.Allocated <= 0 {
+				t.Errorf("#%d: %s allocated = %d, want > 0", i, u.Path, u.Allocated)
+			}
+			u.Allocated = 0
+			if u != tt.want[j] {
+				t.Errorf("#%d: usage = %+v, want %+v", i, u, tt.want[j])
+			}
+		}
+	}
+
+	if _, err := d.Usage("nonexistent", 0); err == nil {
+		t.Errorf("error = nil, want not exist")
+	}
+}
@@ -0,0 +1,137 @@
+package disk
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+)
+
+// ErrOverlap is returned by WriteV if the vectors overlap.
+var ErrOverlap = errors.New("disk: overlapping vectors")
+
+// IOVec is a buffer and the data offset of a file it is read from or
+// written to.
+type IOVec struct {
+	Offset int64
+	Data   []byte
+}
+
+// byOffset sorts the indexes of vectors by the offsets of the vectors.
+type byOffset struct {
+	idx  []int
+	vecs []IOVec
+}
+
+func (s byOffset) Len() int           { return len(s.idx) }
+func (s byOffset) Swap(i, j int)      { s.idx[i], s.idx[j] = s.idx[j], s.idx[i] }
+func (s byOffset) Less(i, j int) bool { return s.vecs[s.idx[i]].Offset < s.vecs[s.idx[j]].Offset }
+
+// ordered returns the indexes of vecs in ascending order of offset, so
+// that the blocks of a file are visited once and in order.
+func ordered(vecs []IOVec) []int {
+	s := byOffset{idx: make([]int, len(vecs)), vecs: vecs}
+	for i := range s.idx {
+		s.idx[i] = i
+	}
+	sort.Stable(s)
+	return s.idx
+}
+
+// ReadV reads the named file into the data of every vector from its
+// offset, opening the file once. It returns the number of bytes read into
+// each vector, which is short for the vectors reaching the end of the
+// file, in which case the error is io.EOF. ReadV stops at the first other
+// error.
+func (d *Disk) ReadV(name string, vecs []IOVec) ([]int, error) {
+	if err := checkOffsets(vecs); err != nil {
+		return make([]int, len(vecs)), err
+	}
+	key := path.Clean(name)
+	name = path.Join(d.Root, name)
+	var f file
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	open := func() (file, error) {
+		if f != nil {
+			return f, nil
+		}
+		var err error
+		f, err = d.openFile(name, os.O_RDONLY)
+		return f, err
+	}
+
+	ns := make([]int, len(vecs))
+	var eof error
+	for _, i := range ordered(vecs) {
+		n, err := d.read(key, open, vecs[i].Data, int(vecs[i].Offset))
+		ns[i] = n
+		if err == io.EOF {
+			eof = err
+			continue
+		}
+		if err != nil {
+			return ns, err
+		}
+	}
+	return ns, eof
+}
+
+// WriteV writes the data of every vector to the named file at its offset,
+// opening and locking the file once. The vectors must not overlap. It
+// returns the number of bytes written and stops at the first error.
+func (d *Disk) WriteV(name string, vecs []IOVec) (int, error) {
+	if err := checkOffsets(vecs); err != nil {
+		return 0, err
+	}
+	key := path.Clean(name)
+	name = path.Join(d.Root, name)
+	idx := ordered(vecs)
+	for k := 1; k < len(idx); k++ {
+		prev := vecs[idx[k-1]]
+		if prev.Offset+int64(len(prev.Data)) > vecs[idx[k]].Offset {
+			return 0, ErrOverlap
+		}
+	}
+
+	mu := d.lockFile(key)
+	defer mu.Unlock()
+	if err := d.unshare(key); err != nil {
+		return 0, err
+	}
+	f, err := d.openFile(name, os.O_CREATE|os.O_RDWR)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	size := d.getDataSize(f)
+	written := 0
+	for _, i := range idx {
+		v := vecs[i]
+		if len(v.Data) == 0 {
+			continue
+		}
+		n, err := d.write(f, key, v.Data, int(v.Offset), size)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		size = max(size, int(v.Offset)+len(v.Data))
+	}
+	return written, nil
+}
+
+// checkOffsets returns ErrNegativeOffset if a vector has a negative offset.
+func checkOffsets(vecs []IOVec) error {
+	for _, v := range vecs {
+		if v.Offset < 0 {
+			return ErrNegativeOffset
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package disk
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestVectors(t *testing.T) {
+	d := newTestDisk("disk0", "vector", true)
+	defer d.Remove("", true)
+
+	p := make([]byte, payloadSize*3+10)
+	fillPattern(p, len(p))
+	// out of order, with a gap between the last two vectors
+	vecs := []IOVec{
+		{Offset: int64(payloadSize) * 2, Data: p[payloadSize*2 : payloadSize*2+100]},
+		{Offset: 0, Data: p[:payloadSize+7]},
+		{Offset: int64(payloadSize) + 7, Data: p[payloadSize+7 : payloadSize*2]},
+		{Offset: int64(payloadSize)*3 - 5, Data: p[payloadSize*3-5:]},
+	}
+	n, err := d.WriteV("a", vecs)
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if n != payloadSize*2+100+15 {
+		t.Fatalf("written = %d", n)
+	}
+	copy(p[payloadSize*2+100:payloadSize*3-5], make([]byte, payloadSize))
+
+	reads := []IOVec{
+		{Offset: int64(payloadSize)*3 - 1, Data: make([]byte, 100)},
+		{Offset: 3, Data: make([]byte, payloadSize*2)},
+		{Offset: int64(payloadSize) * 2, Data: make([]byte, 200)},
+	}
+	ns, err := d.ReadV("a", reads)
+	if err != io.EOF {
+		t.Fatalf("error = %v, want EOF", err)
+	}
+	for i, want := range []int{11, payloadSize * 2, 200} {
+		if ns[i] != want {
+			t.Errorf("#%d: read %d, want %d", i, ns[i], want)
+		}
+		off := int(reads[i].Offset)
+		if !bytes.Equal(reads[i].Data[:ns[i]], p[off:off+ns[i]]) {
+			t.Errorf("#%d: data mismatch", i)
+		}
+	}
+
+	if _, err := d.WriteV("a", []IOVec{
+		{Offset: 10, Data: make([]byte, 10)},
+		{Offset: 0, Data: make([]byte, 11)},
+	}); err != ErrOverlap {
+		t.Errorf("error = %v, want %v", err, ErrOverlap)
+	}
+
+	negative := []IOVec{{Offset: -5, Data: make([]byte, 10)}}
+	if _, err := d.ReadV("a", negative); err != ErrNegativeOffset {
+		t.Errorf("error = %v, want %v", err, ErrNegativeOffset)
+	}
+	if _, err := d.WriteV("a", negative); err != ErrNegativeOffset {
+		t.Errorf("error = %v, want %v", err, ErrNegativeOffset)
+	}
+}
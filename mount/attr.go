@@ -0,0 +1,81 @@
+// +build linux
+
+package mount
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/c-fs/cfs/proto"
+)
+
+// maxAttrs is the number of file infos kept by an attrCache before its
+// expired entries are dropped.
+const maxAttrs = 10000
+
+// attrCache caches the file infos of files by name for a short time, so
+// that the lookups and attribute requests the kernel makes for one
+// command do not go to the server one by one.
+type attrCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]attrEntry
+}
+
+type attrEntry struct {
+	fi      *pb.FileInfo
+	expires time.Time
+}
+
+func newAttrCache(ttl time.Duration) *attrCache {
+	return &attrCache{ttl: ttl, entries: make(map[string]attrEntry)}
+}
+
+// get returns the cached info of the named file, or nil.
+func (c *attrCache) get(name string) *pb.FileInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[name]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, name)
+		return nil
+	}
+	return e.fi
+}
+
+func (c *attrCache) put(name string, fi *pb.FileInfo) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= maxAttrs {
+		for n, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, n)
+			}
+		}
+		if len(c.entries) >= maxAttrs {
+			c.entries = make(map[string]attrEntry)
+		}
+	}
+	c.entries[name] = attrEntry{fi: fi, expires: now.Add(c.ttl)}
+}
+
+// drop drops the infos of the named file and of any file under it.
+func (c *attrCache) drop(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, name)
+	for n := range c.entries {
+		if strings.HasPrefix(n, name+"/") {
+			delete(c.entries, n)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// +build linux
+
+// Package mount serves the disks of a cfs node as a FUSE filesystem, so
+// that its files can be used with the standard tools.
+package mount
+
+import (
+	"hash/fnv"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/c-fs/cfs/client"
+	pb "github.com/c-fs/cfs/proto"
+	"golang.org/x/net/context"
+)
+
+// FS is the filesystem of a cfs node. Its root directory holds a
+// directory per disk of the node.
+type FS struct {
+	c *client.Client
+	// mountpoint is the absolute path the filesystem is mounted at, to
+	// map symbolic links.
+	mountpoint string
+	attrs      *attrCache
+}
+
+// Mount mounts the disks of the node c talks to at mountpoint and serves
+// the filesystem until it is unmounted. File attributes are cached for
+// attrTTL.
+func Mount(c *client.Client, mountpoint string, attrTTL time.Duration) error {
+	abs, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return err
+	}
+	conn, err := fuse.Mount(abs, fuse.FSName("cfs"), fuse.Subtype("cfs"))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	filesys := &FS{c: c, mountpoint: abs, attrs: newAttrCache(attrTTL)}
+	if err := fs.Serve(conn, filesys); err != nil {
+		return err
+	}
+	<-conn.Ready
+	return conn.MountError
+}
+
+// Unmount unmounts the filesystem at mountpoint, which makes Mount return.
+func Unmount(mountpoint string) error {
+	return fuse.Unmount(mountpoint)
+}
+
+func (f *FS) Root() (fs.Node, error) {
+	return &Dir{fs: f}, nil
+}
+
+// stat returns the file info of the named file, from the cache if it is
+// there.
+func (f *FS) stat(ctx context.Context, name string) (*pb.FileInfo, error) {
+	if fi := f.attrs.get(name); fi != nil {
+		return fi, nil
+	}
+	fi, err := f.c.Stat(ctx, name)
+	if err != nil {
+		return nil, errno(err)
+	}
+	f.attrs.put(name, fi)
+	return fi, nil
+}
+
+// node returns the node of the named file whose info is fi.
+func (f *FS) node(name string, fi *pb.FileInfo) fs.Node {
+	switch {
+	case fi.IsDir:
+		return &Dir{fs: f, name: name}
+	case fi.Symlink != "":
+		return &Symlink{fs: f, name: name}
+	}
+	return &File{fs: f, name: name}
+}
+
+// fill fills the attributes of the named file from its info.
+func (f *FS) fill(a *fuse.Attr, name string, fi *pb.FileInfo) {
+	a.Valid = f.attrs.ttl
+	a.Inode = inode(name)
+	a.Mtime = time.Unix(0, fi.ModTime)
+	a.Ctime = a.Mtime
+	a.Atime = a.Mtime
+	a.Uid = uint32(os.Getuid())
+	a.Gid = uint32(os.Getgid())
+	switch {
+	case fi.IsDir:
+		a.Mode = os.ModeDir | 0755
+		a.Nlink = 2
+	case fi.Symlink != "":
+		a.Mode = os.ModeSymlink | 0777
+		a.Size = uint64(len(f.linkTarget(fi.Symlink)))
+		a.Nlink = 1
+	default:
+		a.Mode = 0644
+		a.Size = uint64(fi.Size)
+		a.Blocks = uint64(fi.TotalSize+511) / 512
+		a.Nlink = 1
+	}
+}
+
+// linkTarget returns the path under the mountpoint of the target of a
+// symbolic link, which starts with the disk name.
+func (f *FS) linkTarget(target string) string {
+	return path.Join(f.mountpoint, target)
+}
+
+// inode returns the inode number of the named file, which is the hash of
+// its name. The root is inode 1.
+func inode(name string) uint64 {
+	if name == "" {
+		return 1
+	}
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	if n := h.Sum64(); n > 1 {
+		return n
+	}
+	return 2
+}
+
+// errno converts a client error to the error returned to the kernel.
+func errno(err error) error {
+	if os.IsNotExist(err) {
+		return fuse.ENOENT
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+// +build linux
+
+package mount
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c-fs/cfs/client"
+	pb "github.com/c-fs/cfs/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// memServer serves a single disk of flat files held in memory, with the
+// rpcs the filesystem makes for files. The others are not implemented.
+type memServer struct {
+	pb.CfsServer
+	disk  string
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (s *memServer) Disks(ctx context.Context, req *pb.DisksRequest) (*pb.DisksReply, error) {
+	return &pb.DisksReply{Disks: []*pb.Disk{{Name: s.disk}}}, nil
+}
+
+func (s *memServer) RotateKeys(ctx context.Context, req *pb.RotateKeysRequest) (*pb.RotateKeysReply, error) {
+	return &pb.RotateKeysReply{}, nil
+}
+
+func (s *memServer) info(name string, data []byte) *pb.FileInfo {
+	return &pb.FileInfo{Name: path.Base(name), Size: int64(len(data)), TotalSize: int64(len(data))}
+}
+
+func (s *memServer) Stat(ctx context.Context, req *pb.StatRequest) (*pb.StatReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Name == s.disk {
+		return &pb.StatReply{Info: &pb.FileInfo{Name: s.disk, IsDir: true}}, nil
+	}
+	data, ok := s.files[req.Name]
+	if !ok {
+		return &pb.StatReply{}, nil
+	}
+	return &pb.StatReply{Info: s.info(req.Name, data)}, nil
+}
+
+func (s *memServer) ReadDir(ctx context.Context, req *pb.ReadDirRequest) (*pb.ReadDirReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reply := &pb.ReadDirReply{}
+	for name, data := range s.files {
+		reply.FileInfos = append(reply.FileInfos, s.info(name, data))
+	}
+	return reply, nil
+}
+
+func (s *memServer) Read(ctx context.Context, req *pb.ReadRequest) (*pb.ReadReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := s.files[req.Name]
+	if req.Offset >= int64(len(data)) {
+		return &pb.ReadReply{}, nil
+	}
+	data = data[req.Offset:]
+	if int64(len(data)) > req.Length {
+		data = data[:req.Length]
+	}
+	return &pb.ReadReply{BytesRead: int64(len(data)), Data: append([]byte(nil), data...)}, nil
+}
+
+func (s *memServer) Write(ctx context.Context, req *pb.WriteRequest) (*pb.WriteReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := s.files[req.Name]
+	if end := req.Offset + int64(len(req.Data)); end > int64(len(data)) {
+		data = append(data, make([]byte, end-int64(len(data)))...)
+	}
+	copy(data[req.Offset:], req.Data)
+	s.files[req.Name] = data
+	return &pb.WriteReply{BytesWritten: int64(len(req.Data))}, nil
+}
+
+func (s *memServer) Truncate(ctx context.Context, req *pb.TruncateRequest) (*pb.TruncateReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := s.files[req.Name]
+	if req.Size > int64(len(data)) {
+		data = append(data, make([]byte, req.Size-int64(len(data)))...)
+	}
+	s.files[req.Name] = data[:req.Size]
+	return &pb.TruncateReply{}, nil
+}
+
+func (s *memServer) Remove(ctx context.Context, req *pb.RemoveRequest) (*pb.RemoveReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, req.Name)
+	return &pb.RemoveReply{}, nil
+}
+
+func (s *memServer) file(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[name]
+	return data, ok
+}
+
+func TestMount(t *testing.T) {
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skipf("fuse is not available (%v)", err)
+	}
+
+	s := &memServer{disk: "disk0", files: make(map[string][]byte)}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	gs := grpc.NewServer()
+	pb.RegisterCfsServer(gs, s)
+	pb.RegisterMetadataServer(gs, s)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	c, err := client.New(1, lis.Addr().String())
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	defer c.Close()
+
+	dir, err := ioutil.TempDir("", "cfs-mount")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	done := make(chan error, 1)
+	go func() { done <- Mount(c, dir, 0) }()
+	// the disk shows up once the filesystem is served
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if _, err := os.Stat(path.Join(dir, "disk0")); err == nil {
+			break
+		}
+		select {
+		case err := <-done:
+			t.Skipf("cannot mount (%v)", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			Unmount(dir)
+			t.Fatalf("mount timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer func() {
+		if err := Unmount(dir); err != nil {
+			t.Errorf("unmount error = %v", err)
+		}
+		if err := <-done; err != nil {
+			t.Errorf("mount error = %v", err)
+		}
+	}()
+
+	fn := path.Join(dir, "disk0", "a")
+	if err := ioutil.WriteFile(fn, []byte("hello"), 0644); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if data, ok := s.file("disk0/a"); !ok || string(data) != "hello" {
+		t.Errorf("server holds %q, want hello", data)
+	}
+	data, err := ioutil.ReadFile(fn)
+	if err != nil || string(data) != "hello" {
+		t.Errorf("read %q (%v), want hello", data, err)
+	}
+
+	s.Write(context.Background(), &pb.WriteRequest{Name: "disk0/b", Data: []byte("b")})
+	infos, err := ioutil.ReadDir(path.Join(dir, "disk0"))
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") != "a b" {
+		t.Errorf("entries = %v, want [a b]", names)
+	}
+
+	if err := os.Remove(fn); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if _, ok := s.file("disk0/a"); ok {
+		t.Errorf("expect a to be removed")
+	}
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Errorf("stat error = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,257 @@
+// +build linux
+
+package mount
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"golang.org/x/net/context"
+)
+
+// Dir is a directory of a disk, the root directory of a disk, or the root
+// of the filesystem if its name is empty.
+type Dir struct {
+	fs   *FS
+	name string
+}
+
+func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) error {
+	if d.name == "" {
+		a.Valid = d.fs.attrs.ttl
+		a.Inode = inode("")
+		a.Mode = os.ModeDir | 0755
+		a.Nlink = 2
+		return nil
+	}
+	fi, err := d.fs.stat(ctx, d.name)
+	if err != nil {
+		return err
+	}
+	d.fs.fill(a, d.name, fi)
+	return nil
+}
+
+// child returns the name of the entry name of the directory.
+func (d *Dir) child(name string) string {
+	if d.name == "" {
+		return name
+	}
+	return d.name + "/" + name
+}
+
+func (d *Dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	full := d.child(name)
+	fi, err := d.fs.stat(ctx, full)
+	if err != nil {
+		return nil, err
+	}
+	return d.fs.node(full, fi), nil
+}
+
+func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if d.name == "" {
+		disks, err := d.fs.c.Disks(ctx)
+		if err != nil {
+			return nil, err
+		}
+		dirents := make([]fuse.Dirent, len(disks))
+		for i, disk := range disks {
+			dirents[i] = fuse.Dirent{Inode: inode(disk.Name), Type: fuse.DT_Dir, Name: disk.Name}
+		}
+		return dirents, nil
+	}
+
+	infos, err := d.fs.c.ReadDir(ctx, d.name)
+	if err != nil {
+		return nil, errno(err)
+	}
+	dirents := make([]fuse.Dirent, len(infos))
+	for i, fi := range infos {
+		full := d.child(fi.Name)
+		// the kernel asks for the attributes of the entries next
+		d.fs.attrs.put(full, fi)
+		typ := fuse.DT_File
+		switch {
+		case fi.IsDir:
+			typ = fuse.DT_Dir
+		case fi.Symlink != "":
+			typ = fuse.DT_Link
+		}
+		dirents[i] = fuse.Dirent{Inode: inode(full), Type: typ, Name: fi.Name}
+	}
+	return dirents, nil
+}
+
+func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	if d.name == "" {
+		return nil, fuse.EPERM
+	}
+	full := d.child(req.Name)
+	if err := d.fs.c.Mkdir(ctx, full, false); err != nil {
+		return nil, err
+	}
+	d.fs.attrs.drop(full)
+	return &Dir{fs: d.fs, name: full}, nil
+}
+
+func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse,
+) (fs.Node, fs.Handle, error) {
+	if d.name == "" {
+		return nil, nil, fuse.EPERM
+	}
+	full := d.child(req.Name)
+	_, err := d.fs.c.Stat(ctx, full)
+	switch {
+	case err == nil && req.Flags&fuse.OpenExclusive != 0:
+		return nil, nil, fuse.EEXIST
+	case err == nil && req.Flags&fuse.OpenTruncate == 0:
+		// opened as it is
+	case err == nil || errno(err) == fuse.ENOENT:
+		// truncating creates the file
+		if err := d.fs.c.Truncate(ctx, full, 0); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, err
+	}
+	d.fs.attrs.drop(full)
+	fi, err := d.fs.stat(ctx, full)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.fs.fill(&resp.Attr, full, fi)
+	f := &File{fs: d.fs, name: full}
+	return f, f, nil
+}
+
+func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	if d.name == "" {
+		return fuse.EPERM
+	}
+	full := d.child(req.Name)
+	defer d.fs.attrs.drop(full)
+	return d.fs.c.Remove(ctx, full, false)
+}
+
+func (d *Dir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
+	nd, ok := newDir.(*Dir)
+	if !ok || d.name == "" || nd.name == "" {
+		return fuse.EPERM
+	}
+	oldname, newname := d.child(req.OldName), nd.child(req.NewName)
+	defer d.fs.attrs.drop(oldname)
+	defer d.fs.attrs.drop(newname)
+	return d.fs.c.Rename(ctx, oldname, newname)
+}
+
+func (d *Dir) Symlink(ctx context.Context, req *fuse.SymlinkRequest) (fs.Node, error) {
+	if d.name == "" {
+		return nil, fuse.EPERM
+	}
+	// Links point to files of the same disk, which are named under the
+	// mountpoint.
+	target := req.Target
+	if !path.IsAbs(target) {
+		target = path.Join(d.fs.mountpoint, d.name, target)
+	}
+	target = path.Clean(target)
+	if !strings.HasPrefix(target, d.fs.mountpoint+"/") {
+		return nil, fuse.EPERM
+	}
+	full := d.child(req.NewName)
+	if err := d.fs.c.Symlink(ctx, strings.TrimPrefix(target, d.fs.mountpoint+"/"), full); err != nil {
+		return nil, err
+	}
+	d.fs.attrs.drop(full)
+	return &Symlink{fs: d.fs, name: full}, nil
+}
+
+func (d *Dir) Link(ctx context.Context, req *fuse.LinkRequest, old fs.Node) (fs.Node, error) {
+	f, ok := old.(*File)
+	if !ok || d.name == "" {
+		return nil, fuse.EPERM
+	}
+	full := d.child(req.NewName)
+	if err := d.fs.c.Link(ctx, f.name, full); err != nil {
+		return nil, err
+	}
+	d.fs.attrs.drop(full)
+	d.fs.attrs.drop(f.name)
+	return &File{fs: d.fs, name: full}, nil
+}
+
+// File is a regular file of a disk. It is its own handle: reads and
+// writes go to the server as they come.
+type File struct {
+	fs   *FS
+	name string
+}
+
+func (f *File) Attr(ctx context.Context, a *fuse.Attr) error {
+	fi, err := f.fs.stat(ctx, f.name)
+	if err != nil {
+		return err
+	}
+	f.fs.fill(a, f.name, fi)
+	return nil
+}
+
+func (f *File) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	n, data, _, err := f.fs.c.Read(ctx, f.name, req.Offset, int64(req.Size), 0)
+	if err != nil {
+		return err
+	}
+	resp.Data = data[:n]
+	return nil
+}
+
+func (f *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	defer f.fs.attrs.drop(f.name)
+	n, err := f.fs.c.Write(ctx, f.name, req.Offset, req.Data, false)
+	resp.Size = int(n)
+	return err
+}
+
+// Setattr changes the size of the file. Other attributes are fixed.
+func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if req.Valid.Size() {
+		err := f.fs.c.Truncate(ctx, f.name, int64(req.Size))
+		f.fs.attrs.drop(f.name)
+		if err != nil {
+			return err
+		}
+	}
+	return f.Attr(ctx, &resp.Attr)
+}
+
+// Fsync does nothing, as writes are not buffered.
+func (f *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+	return nil
+}
+
+// Symlink is a symbolic link of a disk.
+type Symlink struct {
+	fs   *FS
+	name string
+}
+
+func (l *Symlink) Attr(ctx context.Context, a *fuse.Attr) error {
+	fi, err := l.fs.stat(ctx, l.name)
+	if err != nil {
+		return err
+	}
+	l.fs.fill(a, l.name, fi)
+	return nil
+}
+
+func (l *Symlink) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
+	fi, err := l.fs.stat(ctx, l.name)
+	if err != nil {
+		return "", err
+	}
+	return l.fs.linkTarget(fi.Symlink), nil
+}
@@ -6,16 +6,21 @@
 Package proto is a generated protocol buffer package.
 
 It is generated from these files:
+
 	file.proto
 	metadata.proto
 	stats.proto
 
 It has these top-level messages:
+
 	RequestHeader
 	PathError
 	SyscallError
+	PreconditionError
+	LeaseError
 	Error
 	FileInfo
+	Precondition
 	WriteRequest
 	WriteReply
 	ReadRequest
@@ -32,6 +37,61 @@ It has these top-level messages:
 	ReconstructDst
 	ReconstructRequest
 	ReconstructReply
+	ExtentsRequest
+	Extent
+	ExtentsReply
+	ChecksumRequest
+	ChecksumReply
+	MerkleNodesRequest
+	MerkleNodesReply
+	Op
+	OpResult
+	BatchRequest
+	BatchReply
+	ReadVRequest
+	ReadVReply
+	IOVec
+	WriteVRequest
+	WriteVReply
+	LockRequest
+	LockReply
+	UnlockRequest
+	UnlockReply
+	RenewLeaseRequest
+	RenewLeaseReply
+	WatchRequest
+	WatchEvent
+	WalkRequest
+	WalkReply
+	DiskUsageRequest
+	Usage
+	DiskUsageReply
+	TrashEntry
+	ListTrashRequest
+	ListTrashReply
+	UndeleteRequest
+	UndeleteReply
+	PurgeTrashRequest
+	PurgeTrashReply
+	SnapshotRequest
+	SnapshotReply
+	SnapshotInfo
+	ListSnapshotsRequest
+	ListSnapshotsReply
+	DeleteSnapshotRequest
+	DeleteSnapshotReply
+	RestoreSnapshotRequest
+	RestoreSnapshotReply
+	LinkRequest
+	LinkReply
+	SymlinkRequest
+	SymlinkReply
+	CloneRequest
+	CloneReply
+	StatRequest
+	StatReply
+	TruncateRequest
+	TruncateReply
 */
 package proto
 
@@ -49,6 +109,37 @@ var _ grpc.ClientConn
 // Reference imports to suppress errors if they are not otherwise used.
 var _ = proto1.Marshal
 
+type WatchEvent_Op int32
+
+const (
+	// LOST reports that events were lost, because they are too old to be
+	// replayed or the server could not keep up. The watcher should resync.
+	WatchEvent_LOST   WatchEvent_Op = 0
+	WatchEvent_CREATE WatchEvent_Op = 1
+	WatchEvent_WRITE  WatchEvent_Op = 2
+	WatchEvent_RENAME WatchEvent_Op = 3
+	WatchEvent_REMOVE WatchEvent_Op = 4
+)
+
+var WatchEvent_Op_name = map[int32]string{
+	0: "LOST",
+	1: "CREATE",
+	2: "WRITE",
+	3: "RENAME",
+	4: "REMOVE",
+}
+var WatchEvent_Op_value = map[string]int32{
+	"LOST":   0,
+	"CREATE": 1,
+	"WRITE":  2,
+	"RENAME": 3,
+	"REMOVE": 4,
+}
+
+func (x WatchEvent_Op) String() string {
+	return proto1.EnumName(WatchEvent_Op_name, int32(x))
+}
+
 type RequestHeader struct {
 	ClientID int64 `protobuf:"varint,1,opt,name=clientID" json:"clientID,omitempty"`
 }
@@ -78,9 +169,34 @@ func (m *SyscallError) Reset()         { *m = SyscallError{} }
 func (m *SyscallError) String() string { return proto1.CompactTextString(m) }
 func (*SyscallError) ProtoMessage()    {}
 
+// PreconditionError records that the file of an operation did not meet
+// the precondition of the operation.
+type PreconditionError struct {
+	Op   string `protobuf:"bytes,1,opt,name=op" json:"op,omitempty"`
+	Path string `protobuf:"bytes,2,opt,name=path" json:"path,omitempty"`
+}
+
+func (m *PreconditionError) Reset()         { *m = PreconditionError{} }
+func (m *PreconditionError) String() string { return proto1.CompactTextString(m) }
+func (*PreconditionError) ProtoMessage()    {}
+
+// LeaseError records that a lease of a file could not be granted because
+// of a conflicting lease, or that the client does not hold the lease an
+// operation requires.
+type LeaseError struct {
+	Op   string `protobuf:"bytes,1,opt,name=op" json:"op,omitempty"`
+	Path string `protobuf:"bytes,2,opt,name=path" json:"path,omitempty"`
+}
+
+func (m *LeaseError) Reset()         { *m = LeaseError{} }
+func (m *LeaseError) String() string { return proto1.CompactTextString(m) }
+func (*LeaseError) ProtoMessage()    {}
+
 type Error struct {
-	PathErr *PathError    `protobuf:"bytes,1,opt,name=pathErr" json:"pathErr,omitempty"`
-	SysErr  *SyscallError `protobuf:"bytes,2,opt,name=sysErr" json:"sysErr,omitempty"`
+	PathErr         *PathError         `protobuf:"bytes,1,opt,name=pathErr" json:"pathErr,omitempty"`
+	SysErr          *SyscallError      `protobuf:"bytes,2,opt,name=sysErr" json:"sysErr,omitempty"`
+	PreconditionErr *PreconditionError `protobuf:"bytes,3,opt,name=preconditionErr" json:"preconditionErr,omitempty"`
+	LeaseErr        *LeaseError        `protobuf:"bytes,4,opt,name=leaseErr" json:"leaseErr,omitempty"`
 }
 
 func (m *Error) Reset()         { *m = Error{} }
@@ -101,6 +217,20 @@ func (m *Error) GetSysErr() *SyscallError {
 	return nil
 }
 
+func (m *Error) GetPreconditionErr() *PreconditionError {
+	if m != nil {
+		return m.PreconditionErr
+	}
+	return nil
+}
+
+func (m *Error) GetLeaseErr() *LeaseError {
+	if m != nil {
+		return m.LeaseErr
+	}
+	return nil
+}
+
 type FileInfo struct {
 	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
 	Size int64  `protobuf:"varint,2,opt,name=size" json:"size,omitempty"`
@@ -108,12 +238,38 @@ type FileInfo struct {
 	TotalSize int64 `protobuf:"varint,3,opt,name=total_size" json:"total_size,omitempty"`
 	ModTime   int64 `protobuf:"varint,4,opt,name=mod_time" json:"mod_time,omitempty"`
 	IsDir     bool  `protobuf:"varint,5,opt,name=is_dir" json:"is_dir,omitempty"`
+	// target of a symbolic link, starting with the disk name
+	Symlink string `protobuf:"bytes,6,opt,name=symlink" json:"symlink,omitempty"`
 }
 
 func (m *FileInfo) Reset()         { *m = FileInfo{} }
 func (m *FileInfo) String() string { return proto1.CompactTextString(m) }
 func (*FileInfo) ProtoMessage()    {}
 
+// Precondition is what a file must meet for a write, rename or remove to
+// go ahead. It is checked atomically with the operation. The empty
+// precondition is met by any file.
+type Precondition struct {
+	// must_not_exist requires the file not to exist.
+	MustNotExist bool `protobuf:"varint,1,opt,name=must_not_exist" json:"must_not_exist,omitempty"`
+	// check_size requires the size of the file data to be size.
+	CheckSize bool  `protobuf:"varint,2,opt,name=check_size" json:"check_size,omitempty"`
+	Size      int64 `protobuf:"varint,3,opt,name=size" json:"size,omitempty"`
+	// generation is the generation the file must have. Zero means any.
+	Generation uint64 `protobuf:"varint,4,opt,name=generation" json:"generation,omitempty"`
+	// check_checksum requires the CRC32C of checksum_length bytes of the
+	// file from checksum_offset to be checksum. A negative length means up
+	// to the end of the file.
+	CheckChecksum  bool   `protobuf:"varint,5,opt,name=check_checksum" json:"check_checksum,omitempty"`
+	ChecksumOffset int64  `protobuf:"varint,6,opt,name=checksum_offset" json:"checksum_offset,omitempty"`
+	ChecksumLength int64  `protobuf:"varint,7,opt,name=checksum_length" json:"checksum_length,omitempty"`
+	Checksum       uint32 `protobuf:"fixed32,8,opt,name=checksum" json:"checksum,omitempty"`
+}
+
+func (m *Precondition) Reset()         { *m = Precondition{} }
+func (m *Precondition) String() string { return proto1.CompactTextString(m) }
+func (*Precondition) ProtoMessage()    {}
+
 // Write writes len(b) bytes from the given offset. It returns the number
 // of bytes written and an error, if any.
 // Write returns an error when n != len(b).
@@ -123,6 +279,10 @@ type WriteRequest struct {
 	Offset int64          `protobuf:"varint,3,opt,name=offset" json:"offset,omitempty"`
 	Data   []byte         `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
 	Append bool           `protobuf:"varint,5,opt,name=append" json:"append,omitempty"`
+	// precondition the file must meet before the write
+	Precondition *Precondition `protobuf:"bytes,6,opt,name=precondition" json:"precondition,omitempty"`
+	// require_lease requires the client to hold an exclusive lease on the file.
+	RequireLease bool `protobuf:"varint,7,opt,name=require_lease" json:"require_lease,omitempty"`
 }
 
 func (m *WriteRequest) Reset()         { *m = WriteRequest{} }
@@ -136,9 +296,18 @@ func (m *WriteRequest) GetHeader() *RequestHeader {
 	return nil
 }
 
+func (m *WriteRequest) GetPrecondition() *Precondition {
+	if m != nil {
+		return m.Precondition
+	}
+	return nil
+}
+
 type WriteReply struct {
 	Error        *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
 	BytesWritten int64  `protobuf:"varint,2,opt,name=bytes_written" json:"bytes_written,omitempty"`
+	// generation of the file after the write
+	Generation uint64 `protobuf:"varint,3,opt,name=generation" json:"generation,omitempty"`
 }
 
 func (m *WriteReply) Reset()         { *m = WriteReply{} }
@@ -177,6 +346,8 @@ type ReadReply struct {
 	BytesRead int64  `protobuf:"varint,2,opt,name=bytes_read" json:"bytes_read,omitempty"`
 	Data      []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
 	Checksum  uint32 `protobuf:"fixed32,4,opt,name=checksum" json:"checksum,omitempty"`
+	// generation of the file as of no later than the read
+	Generation uint64 `protobuf:"varint,5,opt,name=generation" json:"generation,omitempty"`
 }
 
 func (m *ReadReply) Reset()         { *m = ReadReply{} }
@@ -194,6 +365,11 @@ type RenameRequest struct {
 	Header  *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
 	Oldname string         `protobuf:"bytes,2,opt,name=oldname" json:"oldname,omitempty"`
 	Newname string         `protobuf:"bytes,3,opt,name=newname" json:"newname,omitempty"`
+	// precondition newname must meet before it is replaced
+	Precondition *Precondition `protobuf:"bytes,4,opt,name=precondition" json:"precondition,omitempty"`
+	// require_lease requires the client to hold exclusive leases on both
+	// oldname and newname.
+	RequireLease bool `protobuf:"varint,5,opt,name=require_lease" json:"require_lease,omitempty"`
 }
 
 func (m *RenameRequest) Reset()         { *m = RenameRequest{} }
@@ -207,6 +383,13 @@ func (m *RenameRequest) GetHeader() *RequestHeader {
 	return nil
 }
 
+func (m *RenameRequest) GetPrecondition() *Precondition {
+	if m != nil {
+		return m.Precondition
+	}
+	return nil
+}
+
 type RenameReply struct {
 	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
 }
@@ -222,9 +405,23 @@ func (m *RenameReply) GetError() *Error {
 	return nil
 }
 
+// ReadDir lists a page of the entries of a directory sorted by name, a
+// directory coming right before its entries in recursive listings.
 type ReadDirRequest struct {
 	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
 	Name   string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	// page_token is the next_page_token of the previous page.
+	PageToken string `protobuf:"bytes,3,opt,name=page_token" json:"page_token,omitempty"`
+	// page_size is the maximum number of entries of the page. Zero means
+	// a server default; the server may cap it.
+	PageSize int32 `protobuf:"varint,4,opt,name=page_size" json:"page_size,omitempty"`
+	// prefix keeps the entries whose path starts with it.
+	Prefix string `protobuf:"bytes,5,opt,name=prefix" json:"prefix,omitempty"`
+	// pattern keeps the entries whose name matches the shell pattern.
+	Pattern string `protobuf:"bytes,6,opt,name=pattern" json:"pattern,omitempty"`
+	// recursive lists the entries of the subdirectories as well, named by
+	// their path relative to the directory.
+	Recursive bool `protobuf:"varint,7,opt,name=recursive" json:"recursive,omitempty"`
 }
 
 func (m *ReadDirRequest) Reset()         { *m = ReadDirRequest{} }
@@ -241,6 +438,8 @@ func (m *ReadDirRequest) GetHeader() *RequestHeader {
 type ReadDirReply struct {
 	Error     *Error      `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
 	FileInfos []*FileInfo `protobuf:"bytes,2,rep,name=fileInfos" json:"fileInfos,omitempty"`
+	// next_page_token is empty after the last page.
+	NextPageToken string `protobuf:"bytes,3,opt,name=next_page_token" json:"next_page_token,omitempty"`
 }
 
 func (m *ReadDirReply) Reset()         { *m = ReadDirReply{} }
@@ -268,6 +467,10 @@ type RemoveRequest struct {
 	// All removes path and any children it contains. It removes everything it can but returns the first error it
 	// encounters. If the path does not exist, RemoveAll returns nil (no error).
 	All bool `protobuf:"varint,3,opt,name=all" json:"all,omitempty"`
+	// precondition the file must meet before the remove
+	Precondition *Precondition `protobuf:"bytes,4,opt,name=precondition" json:"precondition,omitempty"`
+	// require_lease requires the client to hold an exclusive lease on the file.
+	RequireLease bool `protobuf:"varint,5,opt,name=require_lease" json:"require_lease,omitempty"`
 }
 
 func (m *RemoveRequest) Reset()         { *m = RemoveRequest{} }
@@ -281,6 +484,13 @@ func (m *RemoveRequest) GetHeader() *RequestHeader {
 	return nil
 }
 
+func (m *RemoveRequest) GetPrecondition() *Precondition {
+	if m != nil {
+		return m.Precondition
+	}
+	return nil
+}
+
 type RemoveReply struct {
 	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
 }
@@ -431,179 +641,1916 @@ func (m *ReconstructReply) GetError() *Error {
 	return nil
 }
 
-func init() {
+// Extents returns the allocated extents of a file. The data outside the
+// extents are holes, which read back as zeros.
+type ExtentsRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Name   string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
 }
 
-// Client API for Cfs service
+func (m *ExtentsRequest) Reset()         { *m = ExtentsRequest{} }
+func (m *ExtentsRequest) String() string { return proto1.CompactTextString(m) }
+func (*ExtentsRequest) ProtoMessage()    {}
 
-type CfsClient interface {
-	Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteReply, error)
-	Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (*ReadReply, error)
-	Rename(ctx context.Context, in *RenameRequest, opts ...grpc.CallOption) (*RenameReply, error)
-	Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveReply, error)
-	ReadDir(ctx context.Context, in *ReadDirRequest, opts ...grpc.CallOption) (*ReadDirReply, error)
-	Mkdir(ctx context.Context, in *MkdirRequest, opts ...grpc.CallOption) (*MkdirReply, error)
+func (m *ExtentsRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
 }
 
-type cfsClient struct {
-	cc *grpc.ClientConn
+type Extent struct {
+	Offset int64 `protobuf:"varint,1,opt,name=offset" json:"offset,omitempty"`
+	Length int64 `protobuf:"varint,2,opt,name=length" json:"length,omitempty"`
 }
 
-func NewCfsClient(cc *grpc.ClientConn) CfsClient {
-	return &cfsClient{cc}
+func (m *Extent) Reset()         { *m = Extent{} }
+func (m *Extent) String() string { return proto1.CompactTextString(m) }
+func (*Extent) ProtoMessage()    {}
+
+type ExtentsReply struct {
+	Error   *Error    `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	Extents []*Extent `protobuf:"bytes,2,rep,name=extents" json:"extents,omitempty"`
+	// size of the file data
+	Size int64 `protobuf:"varint,3,opt,name=size" json:"size,omitempty"`
 }
 
-func (c *cfsClient) Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteReply, error) {
-	out := new(WriteReply)
-	err := grpc.Invoke(ctx, "/proto.cfs/Write", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (m *ExtentsReply) Reset()         { *m = ExtentsReply{} }
+func (m *ExtentsReply) String() string { return proto1.CompactTextString(m) }
+func (*ExtentsReply) ProtoMessage()    {}
+
+func (m *ExtentsReply) GetError() *Error {
+	if m != nil {
+		return m.Error
 	}
-	return out, nil
+	return nil
 }
 
-func (c *cfsClient) Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (*ReadReply, error) {
-	out := new(ReadReply)
-	err := grpc.Invoke(ctx, "/proto.cfs/Read", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (m *ExtentsReply) GetExtents() []*Extent {
+	if m != nil {
+		return m.Extents
 	}
-	return out, nil
+	return nil
 }
 
-func (c *cfsClient) Rename(ctx context.Context, in *RenameRequest, opts ...grpc.CallOption) (*RenameReply, error) {
-	out := new(RenameReply)
-	err := grpc.Invoke(ctx, "/proto.cfs/Rename", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+// Checksum returns the CRC32C of length bytes of a file starting at offset,
+// computed by the server. A negative length means up to the end of the file.
+type ChecksumRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Name   string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	Offset int64          `protobuf:"varint,3,opt,name=offset" json:"offset,omitempty"`
+	Length int64          `protobuf:"varint,4,opt,name=length" json:"length,omitempty"`
+}
+
+func (m *ChecksumRequest) Reset()         { *m = ChecksumRequest{} }
+func (m *ChecksumRequest) String() string { return proto1.CompactTextString(m) }
+func (*ChecksumRequest) ProtoMessage()    {}
+
+func (m *ChecksumRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
 	}
-	return out, nil
+	return nil
 }
 
-func (c *cfsClient) Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveReply, error) {
-	out := new(RemoveReply)
-	err := grpc.Invoke(ctx, "/proto.cfs/Remove", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+type ChecksumReply struct {
+	Error    *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	Checksum uint32 `protobuf:"fixed32,2,opt,name=checksum" json:"checksum,omitempty"`
+	// number of bytes covered by the checksum
+	Length int64 `protobuf:"varint,3,opt,name=length" json:"length,omitempty"`
+}
+
+func (m *ChecksumReply) Reset()         { *m = ChecksumReply{} }
+func (m *ChecksumReply) String() string { return proto1.CompactTextString(m) }
+func (*ChecksumReply) ProtoMessage()    {}
+
+func (m *ChecksumReply) GetError() *Error {
+	if m != nil {
+		return m.Error
 	}
-	return out, nil
+	return nil
 }
 
-func (c *cfsClient) ReadDir(ctx context.Context, in *ReadDirRequest, opts ...grpc.CallOption) (*ReadDirReply, error) {
-	out := new(ReadDirReply)
-	err := grpc.Invoke(ctx, "/proto.cfs/ReadDir", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+// MerkleNodes returns count digests of a level of the hash tree of a file
+// starting at node start. Level 0 holds the leaves, one per block.
+type MerkleNodesRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Name   string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	Level  int32          `protobuf:"varint,3,opt,name=level" json:"level,omitempty"`
+	Start  int64          `protobuf:"varint,4,opt,name=start" json:"start,omitempty"`
+	Count  int32          `protobuf:"varint,5,opt,name=count" json:"count,omitempty"`
+}
+
+func (m *MerkleNodesRequest) Reset()         { *m = MerkleNodesRequest{} }
+func (m *MerkleNodesRequest) String() string { return proto1.CompactTextString(m) }
+func (*MerkleNodesRequest) ProtoMessage()    {}
+
+func (m *MerkleNodesRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
 	}
-	return out, nil
+	return nil
 }
 
-func (c *cfsClient) Mkdir(ctx context.Context, in *MkdirRequest, opts ...grpc.CallOption) (*MkdirReply, error) {
-	out := new(MkdirReply)
-	err := grpc.Invoke(ctx, "/proto.cfs/Mkdir", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+type MerkleNodesReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	// size of the file data
+	Size int64 `protobuf:"varint,2,opt,name=size" json:"size,omitempty"`
+	// size of the data covered by a leaf
+	LeafSize int64 `protobuf:"varint,3,opt,name=leaf_size" json:"leaf_size,omitempty"`
+	// number of levels of the tree, the last one holding the root
+	Levels  int32    `protobuf:"varint,4,opt,name=levels" json:"levels,omitempty"`
+	Digests []uint32 `protobuf:"fixed32,5,rep,name=digests" json:"digests,omitempty"`
+}
+
+func (m *MerkleNodesReply) Reset()         { *m = MerkleNodesReply{} }
+func (m *MerkleNodesReply) String() string { return proto1.CompactTextString(m) }
+func (*MerkleNodesReply) ProtoMessage()    {}
+
+func (m *MerkleNodesReply) GetError() *Error {
+	if m != nil {
+		return m.Error
 	}
-	return out, nil
+	return nil
 }
 
-// Server API for Cfs service
+// Op is one operation of a batch. Exactly one field is set. The headers
+// of the requests are ignored in favor of the one of the batch.
+type Op struct {
+	Write    *WriteRequest    `protobuf:"bytes,1,opt,name=write" json:"write,omitempty"`
+	Read     *ReadRequest     `protobuf:"bytes,2,opt,name=read" json:"read,omitempty"`
+	Mkdir    *MkdirRequest    `protobuf:"bytes,3,opt,name=mkdir" json:"mkdir,omitempty"`
+	Rename   *RenameRequest   `protobuf:"bytes,4,opt,name=rename" json:"rename,omitempty"`
+	Remove   *RemoveRequest   `protobuf:"bytes,5,opt,name=remove" json:"remove,omitempty"`
+	Checksum *ChecksumRequest `protobuf:"bytes,6,opt,name=checksum" json:"checksum,omitempty"`
+}
 
-type CfsServer interface {
-	Write(context.Context, *WriteRequest) (*WriteReply, error)
-	Read(context.Context, *ReadRequest) (*ReadReply, error)
-	Rename(context.Context, *RenameRequest) (*RenameReply, error)
-	Remove(context.Context, *RemoveRequest) (*RemoveReply, error)
-	ReadDir(context.Context, *ReadDirRequest) (*ReadDirReply, error)
-	Mkdir(context.Context, *MkdirRequest) (*MkdirReply, error)
+func (m *Op) Reset()         { *m = Op{} }
+func (m *Op) String() string { return proto1.CompactTextString(m) }
+func (*Op) ProtoMessage()    {}
+
+func (m *Op) GetWrite() *WriteRequest {
+	if m != nil {
+		return m.Write
+	}
+	return nil
 }
 
-func RegisterCfsServer(s *grpc.Server, srv CfsServer) {
-	s.RegisterService(&_Cfs_serviceDesc, srv)
+func (m *Op) GetRead() *ReadRequest {
+	if m != nil {
+		return m.Read
+	}
+	return nil
 }
 
-func _Cfs_Write_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
-	in := new(WriteRequest)
-	if err := codec.Unmarshal(buf, in); err != nil {
-		return nil, err
+func (m *Op) GetMkdir() *MkdirRequest {
+	if m != nil {
+		return m.Mkdir
 	}
-	out, err := srv.(CfsServer).Write(ctx, in)
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+func (m *Op) GetRename() *RenameRequest {
+	if m != nil {
+		return m.Rename
 	}
-	return out, nil
+	return nil
 }
 
-func _Cfs_Read_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
-	in := new(ReadRequest)
-	if err := codec.Unmarshal(buf, in); err != nil {
-		return nil, err
+func (m *Op) GetRemove() *RemoveRequest {
+	if m != nil {
+		return m.Remove
 	}
-	out, err := srv.(CfsServer).Read(ctx, in)
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+func (m *Op) GetChecksum() *ChecksumRequest {
+	if m != nil {
+		return m.Checksum
 	}
-	return out, nil
+	return nil
 }
 
-func _Cfs_Rename_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
-	in := new(RenameRequest)
-	if err := codec.Unmarshal(buf, in); err != nil {
-		return nil, err
+// OpResult is the result of the op at the same position in the batch.
+// The field matching the op is set unless the op was not executed.
+type OpResult struct {
+	Write    *WriteReply    `protobuf:"bytes,1,opt,name=write" json:"write,omitempty"`
+	Read     *ReadReply     `protobuf:"bytes,2,opt,name=read" json:"read,omitempty"`
+	Mkdir    *MkdirReply    `protobuf:"bytes,3,opt,name=mkdir" json:"mkdir,omitempty"`
+	Rename   *RenameReply   `protobuf:"bytes,4,opt,name=rename" json:"rename,omitempty"`
+	Remove   *RemoveReply   `protobuf:"bytes,5,opt,name=remove" json:"remove,omitempty"`
+	Checksum *ChecksumReply `protobuf:"bytes,6,opt,name=checksum" json:"checksum,omitempty"`
+}
+
+func (m *OpResult) Reset()         { *m = OpResult{} }
+func (m *OpResult) String() string { return proto1.CompactTextString(m) }
+func (*OpResult) ProtoMessage()    {}
+
+func (m *OpResult) GetWrite() *WriteReply {
+	if m != nil {
+		return m.Write
 	}
-	out, err := srv.(CfsServer).Rename(ctx, in)
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+func (m *OpResult) GetRead() *ReadReply {
+	if m != nil {
+		return m.Read
 	}
-	return out, nil
+	return nil
 }
 
-func _Cfs_Remove_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
-	in := new(RemoveRequest)
-	if err := codec.Unmarshal(buf, in); err != nil {
-		return nil, err
+func (m *OpResult) GetMkdir() *MkdirReply {
+	if m != nil {
+		return m.Mkdir
 	}
-	out, err := srv.(CfsServer).Remove(ctx, in)
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+func (m *OpResult) GetRename() *RenameReply {
+	if m != nil {
+		return m.Rename
 	}
-	return out, nil
+	return nil
 }
 
-func _Cfs_ReadDir_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
-	in := new(ReadDirRequest)
-	if err := codec.Unmarshal(buf, in); err != nil {
-		return nil, err
+func (m *OpResult) GetRemove() *RemoveReply {
+	if m != nil {
+		return m.Remove
 	}
-	out, err := srv.(CfsServer).ReadDir(ctx, in)
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+func (m *OpResult) GetChecksum() *ChecksumReply {
+	if m != nil {
+		return m.Checksum
 	}
-	return out, nil
+	return nil
 }
 
-func _Cfs_Mkdir_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
-	in := new(MkdirRequest)
-	if err := codec.Unmarshal(buf, in); err != nil {
-		return nil, err
+// Batch executes ops in order. Ops failing do not stop the batch unless
+// it is atomic. The ops of an atomic batch must all target the same disk;
+// the first failing op stops it and the changes of the previous ops are
+// undone. A crash of the server in the middle of an atomic batch leaves the
+// changes made so far.
+type BatchRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Ops    []*Op          `protobuf:"bytes,2,rep,name=ops" json:"ops,omitempty"`
+	Atomic bool           `protobuf:"varint,3,opt,name=atomic" json:"atomic,omitempty"`
+}
+
+func (m *BatchRequest) Reset()         { *m = BatchRequest{} }
+func (m *BatchRequest) String() string { return proto1.CompactTextString(m) }
+func (*BatchRequest) ProtoMessage()    {}
+
+func (m *BatchRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
 	}
-	out, err := srv.(CfsServer).Mkdir(ctx, in)
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+func (m *BatchRequest) GetOps() []*Op {
+	if m != nil {
+		return m.Ops
 	}
-	return out, nil
+	return nil
 }
 
-var _Cfs_serviceDesc = grpc.ServiceDesc{
-	ServiceName: "proto.cfs",
-	HandlerType: (*CfsServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "Write",
-			Handler:    _Cfs_Write_Handler,
-		},
-		{
-			MethodName: "Read",
+type BatchReply struct {
+	// error is set if the batch was rejected or an atomic batch was undone.
+	Error   *Error      `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	Results []*OpResult `protobuf:"bytes,2,rep,name=results" json:"results,omitempty"`
+}
+
+func (m *BatchReply) Reset()         { *m = BatchReply{} }
+func (m *BatchReply) String() string { return proto1.CompactTextString(m) }
+func (*BatchReply) ProtoMessage()    {}
+
+func (m *BatchReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+func (m *BatchReply) GetResults() []*OpResult {
+	if m != nil {
+		return m.Results
+	}
+	return nil
+}
+
+// ReadV reads several extents of a file at once. A negative or too long
+// length reads up to the end of the file. Requests of more than 1024
+// extents or 64 MiB in total are refused.
+type ReadVRequest struct {
+	Header  *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Name    string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	Extents []*Extent      `protobuf:"bytes,3,rep,name=extents" json:"extents,omitempty"`
+}
+
+func (m *ReadVRequest) Reset()         { *m = ReadVRequest{} }
+func (m *ReadVRequest) String() string { return proto1.CompactTextString(m) }
+func (*ReadVRequest) ProtoMessage()    {}
+
+func (m *ReadVRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *ReadVRequest) GetExtents() []*Extent {
+	if m != nil {
+		return m.Extents
+	}
+	return nil
+}
+
+type ReadVReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	// data read from each extent, in the order of the request
+	Data [][]byte `protobuf:"bytes,2,rep,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *ReadVReply) Reset()         { *m = ReadVReply{} }
+func (m *ReadVReply) String() string { return proto1.CompactTextString(m) }
+func (*ReadVReply) ProtoMessage()    {}
+
+func (m *ReadVReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+type IOVec struct {
+	Offset int64  `protobuf:"varint,1,opt,name=offset" json:"offset,omitempty"`
+	Data   []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *IOVec) Reset()         { *m = IOVec{} }
+func (m *IOVec) String() string { return proto1.CompactTextString(m) }
+func (*IOVec) ProtoMessage()    {}
+
+// WriteV writes several buffers to a file at once. The buffers must not
+// overlap.
+type WriteVRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Name   string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	Vecs   []*IOVec       `protobuf:"bytes,3,rep,name=vecs" json:"vecs,omitempty"`
+	// require_lease requires the client to hold an exclusive lease on the file.
+	RequireLease bool `protobuf:"varint,4,opt,name=require_lease" json:"require_lease,omitempty"`
+}
+
+func (m *WriteVRequest) Reset()         { *m = WriteVRequest{} }
+func (m *WriteVRequest) String() string { return proto1.CompactTextString(m) }
+func (*WriteVRequest) ProtoMessage()    {}
+
+func (m *WriteVRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *WriteVRequest) GetVecs() []*IOVec {
+	if m != nil {
+		return m.Vecs
+	}
+	return nil
+}
+
+type WriteVReply struct {
+	Error        *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	BytesWritten int64  `protobuf:"varint,2,opt,name=bytes_written" json:"bytes_written,omitempty"`
+}
+
+func (m *WriteVReply) Reset()         { *m = WriteVReply{} }
+func (m *WriteVReply) String() string { return proto1.CompactTextString(m) }
+func (*WriteVReply) ProtoMessage()    {}
+
+func (m *WriteVReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+// Lock grants the client a lease on a file for ttl_ms milliseconds, or a
+// server default if zero. Exclusive leases conflict with any other lease
+// of the file, shared leases only with exclusive ones. A client holding
+// the only lease of a file can lock it again to change its kind. Leases
+// are advisory: only writes requiring a lease check them.
+type LockRequest struct {
+	Header    *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Name      string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	Exclusive bool           `protobuf:"varint,3,opt,name=exclusive" json:"exclusive,omitempty"`
+	TtlMs     int64          `protobuf:"varint,4,opt,name=ttl_ms" json:"ttl_ms,omitempty"`
+}
+
+func (m *LockRequest) Reset()         { *m = LockRequest{} }
+func (m *LockRequest) String() string { return proto1.CompactTextString(m) }
+func (*LockRequest) ProtoMessage()    {}
+
+func (m *LockRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type LockReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	// ttl of the lease granted, in milliseconds
+	TtlMs int64 `protobuf:"varint,2,opt,name=ttl_ms" json:"ttl_ms,omitempty"`
+}
+
+func (m *LockReply) Reset()         { *m = LockReply{} }
+func (m *LockReply) String() string { return proto1.CompactTextString(m) }
+func (*LockReply) ProtoMessage()    {}
+
+func (m *LockReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+// Unlock releases the lease of the client on a file.
+type UnlockRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Name   string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *UnlockRequest) Reset()         { *m = UnlockRequest{} }
+func (m *UnlockRequest) String() string { return proto1.CompactTextString(m) }
+func (*UnlockRequest) ProtoMessage()    {}
+
+func (m *UnlockRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type UnlockReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *UnlockReply) Reset()         { *m = UnlockReply{} }
+func (m *UnlockReply) String() string { return proto1.CompactTextString(m) }
+func (*UnlockReply) ProtoMessage()    {}
+
+func (m *UnlockReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+// RenewLease extends the lease of the client on a file by ttl_ms
+// milliseconds from now, or a server default if zero. An expired lease
+// cannot be renewed.
+type RenewLeaseRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Name   string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	TtlMs  int64          `protobuf:"varint,3,opt,name=ttl_ms" json:"ttl_ms,omitempty"`
+}
+
+func (m *RenewLeaseRequest) Reset()         { *m = RenewLeaseRequest{} }
+func (m *RenewLeaseRequest) String() string { return proto1.CompactTextString(m) }
+func (*RenewLeaseRequest) ProtoMessage()    {}
+
+func (m *RenewLeaseRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type RenewLeaseReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	// ttl of the lease granted, in milliseconds
+	TtlMs int64 `protobuf:"varint,2,opt,name=ttl_ms" json:"ttl_ms,omitempty"`
+}
+
+func (m *RenewLeaseReply) Reset()         { *m = RenewLeaseReply{} }
+func (m *RenewLeaseReply) String() string { return proto1.CompactTextString(m) }
+func (*RenewLeaseReply) ProtoMessage()    {}
+
+func (m *RenewLeaseReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+// Watch streams the changes of the files under a prefix of a disk. The
+// prefix is a disk name optionally followed by a path. If after_seq is
+// not zero, the recent events after it are replayed first, so a watcher
+// can resume from the last event it saw.
+type WatchRequest struct {
+	Header   *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Prefix   string         `protobuf:"bytes,2,opt,name=prefix" json:"prefix,omitempty"`
+	AfterSeq uint64         `protobuf:"varint,3,opt,name=after_seq" json:"after_seq,omitempty"`
+}
+
+func (m *WatchRequest) Reset()         { *m = WatchRequest{} }
+func (m *WatchRequest) String() string { return proto1.CompactTextString(m) }
+func (*WatchRequest) ProtoMessage()    {}
+
+func (m *WatchRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type WatchEvent struct {
+	// seq increases with every event of the server.
+	Seq uint64        `protobuf:"varint,1,opt,name=seq" json:"seq,omitempty"`
+	Op  WatchEvent_Op `protobuf:"varint,2,opt,name=op,enum=proto.WatchEvent_Op" json:"op,omitempty"`
+	// name of the file, starting with the disk name
+	Name string `protobuf:"bytes,3,opt,name=name" json:"name,omitempty"`
+	// new name of a renamed file
+	NewName string `protobuf:"bytes,4,opt,name=new_name" json:"new_name,omitempty"`
+	IsDir   bool   `protobuf:"varint,5,opt,name=is_dir" json:"is_dir,omitempty"`
+}
+
+func (m *WatchEvent) Reset()         { *m = WatchEvent{} }
+func (m *WatchEvent) String() string { return proto1.CompactTextString(m) }
+func (*WatchEvent) ProtoMessage()    {}
+
+// Walk streams the entries under a directory in pages, a directory coming
+// right before its entries. The entries are named by their path relative
+// to the directory and their size is the logical size.
+type WalkRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Name   string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	// prefix keeps the entries whose path starts with it.
+	Prefix string `protobuf:"bytes,3,opt,name=prefix" json:"prefix,omitempty"`
+	// pattern keeps the entries whose name matches the shell pattern.
+	Pattern string `protobuf:"bytes,4,opt,name=pattern" json:"pattern,omitempty"`
+}
+
+func (m *WalkRequest) Reset()         { *m = WalkRequest{} }
+func (m *WalkRequest) String() string { return proto1.CompactTextString(m) }
+func (*WalkRequest) ProtoMessage()    {}
+
+func (m *WalkRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type WalkReply struct {
+	Error     *Error      `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	FileInfos []*FileInfo `protobuf:"bytes,2,rep,name=fileInfos" json:"fileInfos,omitempty"`
+}
+
+func (m *WalkReply) Reset()         { *m = WalkReply{} }
+func (m *WalkReply) String() string { return proto1.CompactTextString(m) }
+func (*WalkReply) ProtoMessage()    {}
+
+func (m *WalkReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+func (m *WalkReply) GetFileInfos() []*FileInfo {
+	if m != nil {
+		return m.FileInfos
+	}
+	return nil
+}
+
+// DiskUsage reports the space used under a directory and, down to depth
+// levels, under each of its subdirectories.
+type DiskUsageRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Name   string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	Depth  int32          `protobuf:"varint,3,opt,name=depth" json:"depth,omitempty"`
+}
+
+func (m *DiskUsageRequest) Reset()         { *m = DiskUsageRequest{} }
+func (m *DiskUsageRequest) String() string { return proto1.CompactTextString(m) }
+func (*DiskUsageRequest) ProtoMessage()    {}
+
+func (m *DiskUsageRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type Usage struct {
+	// path of the directory relative to the one asked for
+	Path string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	// size of the data of the files
+	LogicalBytes int64 `protobuf:"varint,2,opt,name=logical_bytes" json:"logical_bytes,omitempty"`
+	// space allocated to the files on disk, including block headers and
+	// padding, less holes
+	DiskBytes int64 `protobuf:"varint,3,opt,name=disk_bytes" json:"disk_bytes,omitempty"`
+	Files     int64 `protobuf:"varint,4,opt,name=files" json:"files,omitempty"`
+	Dirs      int64 `protobuf:"varint,5,opt,name=dirs" json:"dirs,omitempty"`
+}
+
+func (m *Usage) Reset()         { *m = Usage{} }
+func (m *Usage) String() string { return proto1.CompactTextString(m) }
+func (*Usage) ProtoMessage()    {}
+
+type DiskUsageReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	// the directory asked for comes first, then its subdirectories in
+	// path order
+	Usages []*Usage `protobuf:"bytes,2,rep,name=usages" json:"usages,omitempty"`
+}
+
+func (m *DiskUsageReply) Reset()         { *m = DiskUsageReply{} }
+func (m *DiskUsageReply) String() string { return proto1.CompactTextString(m) }
+func (*DiskUsageReply) ProtoMessage()    {}
+
+func (m *DiskUsageReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+func (m *DiskUsageReply) GetUsages() []*Usage {
+	if m != nil {
+		return m.Usages
+	}
+	return nil
+}
+
+// TrashEntry is a file or directory removed to the trash of a disk.
+type TrashEntry struct {
+	// id identifies the entry in the trash of its disk.
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	// name the file had, starting with the disk name
+	Name string `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	// removed_time is when the file was removed, in nanoseconds since the
+	// Unix epoch.
+	RemovedTime int64 `protobuf:"varint,3,opt,name=removed_time" json:"removed_time,omitempty"`
+	IsDir       bool  `protobuf:"varint,4,opt,name=is_dir" json:"is_dir,omitempty"`
+}
+
+func (m *TrashEntry) Reset()         { *m = TrashEntry{} }
+func (m *TrashEntry) String() string { return proto1.CompactTextString(m) }
+func (*TrashEntry) ProtoMessage()    {}
+
+// ListTrash lists the trash of a disk, oldest entries first.
+type ListTrashRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Disk   string         `protobuf:"bytes,2,opt,name=disk" json:"disk,omitempty"`
+}
+
+func (m *ListTrashRequest) Reset()         { *m = ListTrashRequest{} }
+func (m *ListTrashRequest) String() string { return proto1.CompactTextString(m) }
+func (*ListTrashRequest) ProtoMessage()    {}
+
+func (m *ListTrashRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type ListTrashReply struct {
+	Error   *Error        `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	Entries []*TrashEntry `protobuf:"bytes,2,rep,name=entries" json:"entries,omitempty"`
+}
+
+func (m *ListTrashReply) Reset()         { *m = ListTrashReply{} }
+func (m *ListTrashReply) String() string { return proto1.CompactTextString(m) }
+func (*ListTrashReply) ProtoMessage()    {}
+
+func (m *ListTrashReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+func (m *ListTrashReply) GetEntries() []*TrashEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+// Undelete moves an entry of the trash of a disk back to the name it had,
+// or to name if it is set. It fails if the file exists.
+type UndeleteRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Disk   string         `protobuf:"bytes,2,opt,name=disk" json:"disk,omitempty"`
+	Id     string         `protobuf:"bytes,3,opt,name=id" json:"id,omitempty"`
+	// name to restore the file to, starting with the disk name
+	Name string `protobuf:"bytes,4,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *UndeleteRequest) Reset()         { *m = UndeleteRequest{} }
+func (m *UndeleteRequest) String() string { return proto1.CompactTextString(m) }
+func (*UndeleteRequest) ProtoMessage()    {}
+
+func (m *UndeleteRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type UndeleteReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	// name the file was restored to
+	Name string `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *UndeleteReply) Reset()         { *m = UndeleteReply{} }
+func (m *UndeleteReply) String() string { return proto1.CompactTextString(m) }
+func (*UndeleteReply) ProtoMessage()    {}
+
+func (m *UndeleteReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+// PurgeTrash deletes an entry of the trash of a disk for good, or all the
+// entries if all is set. Exactly one of id and all must be given.
+type PurgeTrashRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Disk   string         `protobuf:"bytes,2,opt,name=disk" json:"disk,omitempty"`
+	Id     string         `protobuf:"bytes,3,opt,name=id" json:"id,omitempty"`
+	All    bool           `protobuf:"varint,4,opt,name=all" json:"all,omitempty"`
+}
+
+func (m *PurgeTrashRequest) Reset()         { *m = PurgeTrashRequest{} }
+func (m *PurgeTrashRequest) String() string { return proto1.CompactTextString(m) }
+func (*PurgeTrashRequest) ProtoMessage()    {}
+
+func (m *PurgeTrashRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type PurgeTrashReply struct {
+	Error  *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	Purged int32  `protobuf:"varint,2,opt,name=purged" json:"purged,omitempty"`
+}
+
+func (m *PurgeTrashReply) Reset()         { *m = PurgeTrashReply{} }
+func (m *PurgeTrashReply) String() string { return proto1.CompactTextString(m) }
+func (*PurgeTrashReply) ProtoMessage()    {}
+
+func (m *PurgeTrashReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+// Snapshot takes a read-only copy of a directory or file, which shares the
+// data of the files until they are next written. The name may be a disk
+// name alone.
+type SnapshotRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Name   string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *SnapshotRequest) Reset()         { *m = SnapshotRequest{} }
+func (m *SnapshotRequest) String() string { return proto1.CompactTextString(m) }
+func (*SnapshotRequest) ProtoMessage()    {}
+
+func (m *SnapshotRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type SnapshotReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	// id of the snapshot on its disk
+	Id string `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *SnapshotReply) Reset()         { *m = SnapshotReply{} }
+func (m *SnapshotReply) String() string { return proto1.CompactTextString(m) }
+func (*SnapshotReply) ProtoMessage()    {}
+
+func (m *SnapshotReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+type SnapshotInfo struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	// name of the snapshotted file, starting with the disk name
+	Name string `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	// created_time is when the snapshot was taken, in nanoseconds since
+	// the Unix epoch.
+	CreatedTime int64 `protobuf:"varint,3,opt,name=created_time" json:"created_time,omitempty"`
+}
+
+func (m *SnapshotInfo) Reset()         { *m = SnapshotInfo{} }
+func (m *SnapshotInfo) String() string { return proto1.CompactTextString(m) }
+func (*SnapshotInfo) ProtoMessage()    {}
+
+// ListSnapshots lists the snapshots of a disk, oldest first.
+type ListSnapshotsRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Disk   string         `protobuf:"bytes,2,opt,name=disk" json:"disk,omitempty"`
+}
+
+func (m *ListSnapshotsRequest) Reset()         { *m = ListSnapshotsRequest{} }
+func (m *ListSnapshotsRequest) String() string { return proto1.CompactTextString(m) }
+func (*ListSnapshotsRequest) ProtoMessage()    {}
+
+func (m *ListSnapshotsRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type ListSnapshotsReply struct {
+	Error     *Error          `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	Snapshots []*SnapshotInfo `protobuf:"bytes,2,rep,name=snapshots" json:"snapshots,omitempty"`
+}
+
+func (m *ListSnapshotsReply) Reset()         { *m = ListSnapshotsReply{} }
+func (m *ListSnapshotsReply) String() string { return proto1.CompactTextString(m) }
+func (*ListSnapshotsReply) ProtoMessage()    {}
+
+func (m *ListSnapshotsReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+func (m *ListSnapshotsReply) GetSnapshots() []*SnapshotInfo {
+	if m != nil {
+		return m.Snapshots
+	}
+	return nil
+}
+
+type DeleteSnapshotRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Disk   string         `protobuf:"bytes,2,opt,name=disk" json:"disk,omitempty"`
+	Id     string         `protobuf:"bytes,3,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *DeleteSnapshotRequest) Reset()         { *m = DeleteSnapshotRequest{} }
+func (m *DeleteSnapshotRequest) String() string { return proto1.CompactTextString(m) }
+func (*DeleteSnapshotRequest) ProtoMessage()    {}
+
+func (m *DeleteSnapshotRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type DeleteSnapshotReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *DeleteSnapshotReply) Reset()         { *m = DeleteSnapshotReply{} }
+func (m *DeleteSnapshotReply) String() string { return proto1.CompactTextString(m) }
+func (*DeleteSnapshotReply) ProtoMessage()    {}
+
+func (m *DeleteSnapshotReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+// RestoreSnapshot copies a snapshot back to the name it was taken of, or
+// to name if it is set. The file there is removed, to the trash if the
+// disk has one.
+type RestoreSnapshotRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Disk   string         `protobuf:"bytes,2,opt,name=disk" json:"disk,omitempty"`
+	Id     string         `protobuf:"bytes,3,opt,name=id" json:"id,omitempty"`
+	// name to restore the snapshot to, starting with the disk name
+	Name string `protobuf:"bytes,4,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *RestoreSnapshotRequest) Reset()         { *m = RestoreSnapshotRequest{} }
+func (m *RestoreSnapshotRequest) String() string { return proto1.CompactTextString(m) }
+func (*RestoreSnapshotRequest) ProtoMessage()    {}
+
+func (m *RestoreSnapshotRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type RestoreSnapshotReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	// name the snapshot was restored to
+	Name string `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *RestoreSnapshotReply) Reset()         { *m = RestoreSnapshotReply{} }
+func (m *RestoreSnapshotReply) String() string { return proto1.CompactTextString(m) }
+func (*RestoreSnapshotReply) ProtoMessage()    {}
+
+func (m *RestoreSnapshotReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+// Link makes newname a hard link to the regular file oldname on the same
+// disk.
+type LinkRequest struct {
+	Header  *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Oldname string         `protobuf:"bytes,2,opt,name=oldname" json:"oldname,omitempty"`
+	Newname string         `protobuf:"bytes,3,opt,name=newname" json:"newname,omitempty"`
+}
+
+func (m *LinkRequest) Reset()         { *m = LinkRequest{} }
+func (m *LinkRequest) String() string { return proto1.CompactTextString(m) }
+func (*LinkRequest) ProtoMessage()    {}
+
+func (m *LinkRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type LinkReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *LinkReply) Reset()         { *m = LinkReply{} }
+func (m *LinkReply) String() string { return proto1.CompactTextString(m) }
+func (*LinkReply) ProtoMessage()    {}
+
+func (m *LinkReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+// Symlink makes name a symbolic link to target, a regular file on the same
+// disk. Reads and writes do not follow symbolic links.
+type SymlinkRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	// target of the link, starting with the disk name
+	Target string `protobuf:"bytes,2,opt,name=target" json:"target,omitempty"`
+	Name   string `protobuf:"bytes,3,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *SymlinkRequest) Reset()         { *m = SymlinkRequest{} }
+func (m *SymlinkRequest) String() string { return proto1.CompactTextString(m) }
+func (*SymlinkRequest) ProtoMessage()    {}
+
+func (m *SymlinkRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type SymlinkReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *SymlinkReply) Reset()         { *m = SymlinkReply{} }
+func (m *SymlinkReply) String() string { return proto1.CompactTextString(m) }
+func (*SymlinkReply) ProtoMessage()    {}
+
+func (m *SymlinkReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+// Clone copies the regular file src to dst on the same disk, sharing its
+// blocks where the filesystem supports reflinks. dst must not exist.
+type CloneRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Src    string         `protobuf:"bytes,2,opt,name=src" json:"src,omitempty"`
+	Dst    string         `protobuf:"bytes,3,opt,name=dst" json:"dst,omitempty"`
+}
+
+func (m *CloneRequest) Reset()         { *m = CloneRequest{} }
+func (m *CloneRequest) String() string { return proto1.CompactTextString(m) }
+func (*CloneRequest) ProtoMessage()    {}
+
+func (m *CloneRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type CloneReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *CloneReply) Reset()         { *m = CloneReply{} }
+func (m *CloneReply) String() string { return proto1.CompactTextString(m) }
+func (*CloneReply) ProtoMessage()    {}
+
+func (m *CloneReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+// Stat returns the file info of a file or directory, which may be a disk
+// name alone. It does not follow symbolic links.
+type StatRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Name   string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *StatRequest) Reset()         { *m = StatRequest{} }
+func (m *StatRequest) String() string { return proto1.CompactTextString(m) }
+func (*StatRequest) ProtoMessage()    {}
+
+func (m *StatRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type StatReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+	// info of the file, named by its base name. It is not set if the file
+	// does not exist.
+	Info *FileInfo `protobuf:"bytes,2,opt,name=info" json:"info,omitempty"`
+}
+
+func (m *StatReply) Reset()         { *m = StatReply{} }
+func (m *StatReply) String() string { return proto1.CompactTextString(m) }
+func (*StatReply) ProtoMessage()    {}
+
+func (m *StatReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+func (m *StatReply) GetInfo() *FileInfo {
+	if m != nil {
+		return m.Info
+	}
+	return nil
+}
+
+// Truncate changes the size of the data of a file, creating it if it does
+// not exist. Growing a file leaves a hole, which reads back as zeros.
+type TruncateRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Name   string         `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	Size   int64          `protobuf:"varint,3,opt,name=size" json:"size,omitempty"`
+	// require_lease requires the client to hold an exclusive lease on the file.
+	RequireLease bool `protobuf:"varint,4,opt,name=require_lease" json:"require_lease,omitempty"`
+}
+
+func (m *TruncateRequest) Reset()         { *m = TruncateRequest{} }
+func (m *TruncateRequest) String() string { return proto1.CompactTextString(m) }
+func (*TruncateRequest) ProtoMessage()    {}
+
+func (m *TruncateRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type TruncateReply struct {
+	Error *Error `protobuf:"bytes,1,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *TruncateReply) Reset()         { *m = TruncateReply{} }
+func (m *TruncateReply) String() string { return proto1.CompactTextString(m) }
+func (*TruncateReply) ProtoMessage()    {}
+
+func (m *TruncateReply) GetError() *Error {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
+func init() {
+	proto1.RegisterEnum("proto.WatchEvent_Op", WatchEvent_Op_name, WatchEvent_Op_value)
+}
+
+// Client API for Cfs service
+
+type CfsClient interface {
+	Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteReply, error)
+	Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (*ReadReply, error)
+	Rename(ctx context.Context, in *RenameRequest, opts ...grpc.CallOption) (*RenameReply, error)
+	Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveReply, error)
+	ReadDir(ctx context.Context, in *ReadDirRequest, opts ...grpc.CallOption) (*ReadDirReply, error)
+	Mkdir(ctx context.Context, in *MkdirRequest, opts ...grpc.CallOption) (*MkdirReply, error)
+	Extents(ctx context.Context, in *ExtentsRequest, opts ...grpc.CallOption) (*ExtentsReply, error)
+	Checksum(ctx context.Context, in *ChecksumRequest, opts ...grpc.CallOption) (*ChecksumReply, error)
+	MerkleNodes(ctx context.Context, in *MerkleNodesRequest, opts ...grpc.CallOption) (*MerkleNodesReply, error)
+	Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchReply, error)
+	ReadV(ctx context.Context, in *ReadVRequest, opts ...grpc.CallOption) (*ReadVReply, error)
+	WriteV(ctx context.Context, in *WriteVRequest, opts ...grpc.CallOption) (*WriteVReply, error)
+	Lock(ctx context.Context, in *LockRequest, opts ...grpc.CallOption) (*LockReply, error)
+	Unlock(ctx context.Context, in *UnlockRequest, opts ...grpc.CallOption) (*UnlockReply, error)
+	RenewLease(ctx context.Context, in *RenewLeaseRequest, opts ...grpc.CallOption) (*RenewLeaseReply, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Cfs_WatchClient, error)
+	Walk(ctx context.Context, in *WalkRequest, opts ...grpc.CallOption) (Cfs_WalkClient, error)
+	DiskUsage(ctx context.Context, in *DiskUsageRequest, opts ...grpc.CallOption) (*DiskUsageReply, error)
+	ListTrash(ctx context.Context, in *ListTrashRequest, opts ...grpc.CallOption) (*ListTrashReply, error)
+	Undelete(ctx context.Context, in *UndeleteRequest, opts ...grpc.CallOption) (*UndeleteReply, error)
+	PurgeTrash(ctx context.Context, in *PurgeTrashRequest, opts ...grpc.CallOption) (*PurgeTrashReply, error)
+	Snapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (*SnapshotReply, error)
+	ListSnapshots(ctx context.Context, in *ListSnapshotsRequest, opts ...grpc.CallOption) (*ListSnapshotsReply, error)
+	DeleteSnapshot(ctx context.Context, in *DeleteSnapshotRequest, opts ...grpc.CallOption) (*DeleteSnapshotReply, error)
+	RestoreSnapshot(ctx context.Context, in *RestoreSnapshotRequest, opts ...grpc.CallOption) (*RestoreSnapshotReply, error)
+	Link(ctx context.Context, in *LinkRequest, opts ...grpc.CallOption) (*LinkReply, error)
+	Symlink(ctx context.Context, in *SymlinkRequest, opts ...grpc.CallOption) (*SymlinkReply, error)
+	Clone(ctx context.Context, in *CloneRequest, opts ...grpc.CallOption) (*CloneReply, error)
+	Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*StatReply, error)
+	Truncate(ctx context.Context, in *TruncateRequest, opts ...grpc.CallOption) (*TruncateReply, error)
+}
+
+type cfsClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewCfsClient(cc *grpc.ClientConn) CfsClient {
+	return &cfsClient{cc}
+}
+
+func (c *cfsClient) Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteReply, error) {
+	out := new(WriteReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Write", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (*ReadReply, error) {
+	out := new(ReadReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Read", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Rename(ctx context.Context, in *RenameRequest, opts ...grpc.CallOption) (*RenameReply, error) {
+	out := new(RenameReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Rename", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveReply, error) {
+	out := new(RemoveReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Remove", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) ReadDir(ctx context.Context, in *ReadDirRequest, opts ...grpc.CallOption) (*ReadDirReply, error) {
+	out := new(ReadDirReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/ReadDir", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Mkdir(ctx context.Context, in *MkdirRequest, opts ...grpc.CallOption) (*MkdirReply, error) {
+	out := new(MkdirReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Mkdir", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Extents(ctx context.Context, in *ExtentsRequest, opts ...grpc.CallOption) (*ExtentsReply, error) {
+	out := new(ExtentsReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Extents", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Checksum(ctx context.Context, in *ChecksumRequest, opts ...grpc.CallOption) (*ChecksumReply, error) {
+	out := new(ChecksumReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Checksum", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) MerkleNodes(ctx context.Context, in *MerkleNodesRequest, opts ...grpc.CallOption) (*MerkleNodesReply, error) {
+	out := new(MerkleNodesReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/MerkleNodes", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchReply, error) {
+	out := new(BatchReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Batch", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) ReadV(ctx context.Context, in *ReadVRequest, opts ...grpc.CallOption) (*ReadVReply, error) {
+	out := new(ReadVReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/ReadV", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) WriteV(ctx context.Context, in *WriteVRequest, opts ...grpc.CallOption) (*WriteVReply, error) {
+	out := new(WriteVReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/WriteV", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Lock(ctx context.Context, in *LockRequest, opts ...grpc.CallOption) (*LockReply, error) {
+	out := new(LockReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Lock", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Unlock(ctx context.Context, in *UnlockRequest, opts ...grpc.CallOption) (*UnlockReply, error) {
+	out := new(UnlockReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Unlock", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) RenewLease(ctx context.Context, in *RenewLeaseRequest, opts ...grpc.CallOption) (*RenewLeaseReply, error) {
+	out := new(RenewLeaseReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/RenewLease", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Cfs_WatchClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Cfs_serviceDesc.Streams[0], c.cc, "/proto.cfs/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &cfsWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Cfs_WatchClient interface {
+	Recv() (*WatchEvent, error)
+	grpc.ClientStream
+}
+
+type cfsWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *cfsWatchClient) Recv() (*WatchEvent, error) {
+	m := new(WatchEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *cfsClient) Walk(ctx context.Context, in *WalkRequest, opts ...grpc.CallOption) (Cfs_WalkClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Cfs_serviceDesc.Streams[1], c.cc, "/proto.cfs/Walk", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &cfsWalkClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Cfs_WalkClient interface {
+	Recv() (*WalkReply, error)
+	grpc.ClientStream
+}
+
+type cfsWalkClient struct {
+	grpc.ClientStream
+}
+
+func (x *cfsWalkClient) Recv() (*WalkReply, error) {
+	m := new(WalkReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *cfsClient) DiskUsage(ctx context.Context, in *DiskUsageRequest, opts ...grpc.CallOption) (*DiskUsageReply, error) {
+	out := new(DiskUsageReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/DiskUsage", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) ListTrash(ctx context.Context, in *ListTrashRequest, opts ...grpc.CallOption) (*ListTrashReply, error) {
+	out := new(ListTrashReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/ListTrash", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Undelete(ctx context.Context, in *UndeleteRequest, opts ...grpc.CallOption) (*UndeleteReply, error) {
+	out := new(UndeleteReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Undelete", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) PurgeTrash(ctx context.Context, in *PurgeTrashRequest, opts ...grpc.CallOption) (*PurgeTrashReply, error) {
+	out := new(PurgeTrashReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/PurgeTrash", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Snapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (*SnapshotReply, error) {
+	out := new(SnapshotReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Snapshot", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) ListSnapshots(ctx context.Context, in *ListSnapshotsRequest, opts ...grpc.CallOption) (*ListSnapshotsReply, error) {
+	out := new(ListSnapshotsReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/ListSnapshots", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) DeleteSnapshot(ctx context.Context, in *DeleteSnapshotRequest, opts ...grpc.CallOption) (*DeleteSnapshotReply, error) {
+	out := new(DeleteSnapshotReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/DeleteSnapshot", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) RestoreSnapshot(ctx context.Context, in *RestoreSnapshotRequest, opts ...grpc.CallOption) (*RestoreSnapshotReply, error) {
+	out := new(RestoreSnapshotReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/RestoreSnapshot", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Link(ctx context.Context, in *LinkRequest, opts ...grpc.CallOption) (*LinkReply, error) {
+	out := new(LinkReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Link", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Symlink(ctx context.Context, in *SymlinkRequest, opts ...grpc.CallOption) (*SymlinkReply, error) {
+	out := new(SymlinkReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Symlink", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Clone(ctx context.Context, in *CloneRequest, opts ...grpc.CallOption) (*CloneReply, error) {
+	out := new(CloneReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Clone", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*StatReply, error) {
+	out := new(StatReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Stat", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cfsClient) Truncate(ctx context.Context, in *TruncateRequest, opts ...grpc.CallOption) (*TruncateReply, error) {
+	out := new(TruncateReply)
+	err := grpc.Invoke(ctx, "/proto.cfs/Truncate", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Cfs service
+
+type CfsServer interface {
+	Write(context.Context, *WriteRequest) (*WriteReply, error)
+	Read(context.Context, *ReadRequest) (*ReadReply, error)
+	Rename(context.Context, *RenameRequest) (*RenameReply, error)
+	Remove(context.Context, *RemoveRequest) (*RemoveReply, error)
+	ReadDir(context.Context, *ReadDirRequest) (*ReadDirReply, error)
+	Mkdir(context.Context, *MkdirRequest) (*MkdirReply, error)
+	Extents(context.Context, *ExtentsRequest) (*ExtentsReply, error)
+	Checksum(context.Context, *ChecksumRequest) (*ChecksumReply, error)
+	MerkleNodes(context.Context, *MerkleNodesRequest) (*MerkleNodesReply, error)
+	Batch(context.Context, *BatchRequest) (*BatchReply, error)
+	ReadV(context.Context, *ReadVRequest) (*ReadVReply, error)
+	WriteV(context.Context, *WriteVRequest) (*WriteVReply, error)
+	Lock(context.Context, *LockRequest) (*LockReply, error)
+	Unlock(context.Context, *UnlockRequest) (*UnlockReply, error)
+	RenewLease(context.Context, *RenewLeaseRequest) (*RenewLeaseReply, error)
+	Watch(*WatchRequest, Cfs_WatchServer) error
+	Walk(*WalkRequest, Cfs_WalkServer) error
+	DiskUsage(context.Context, *DiskUsageRequest) (*DiskUsageReply, error)
+	ListTrash(context.Context, *ListTrashRequest) (*ListTrashReply, error)
+	Undelete(context.Context, *UndeleteRequest) (*UndeleteReply, error)
+	PurgeTrash(context.Context, *PurgeTrashRequest) (*PurgeTrashReply, error)
+	Snapshot(context.Context, *SnapshotRequest) (*SnapshotReply, error)
+	ListSnapshots(context.Context, *ListSnapshotsRequest) (*ListSnapshotsReply, error)
+	DeleteSnapshot(context.Context, *DeleteSnapshotRequest) (*DeleteSnapshotReply, error)
+	RestoreSnapshot(context.Context, *RestoreSnapshotRequest) (*RestoreSnapshotReply, error)
+	Link(context.Context, *LinkRequest) (*LinkReply, error)
+	Symlink(context.Context, *SymlinkRequest) (*SymlinkReply, error)
+	Clone(context.Context, *CloneRequest) (*CloneReply, error)
+	Stat(context.Context, *StatRequest) (*StatReply, error)
+	Truncate(context.Context, *TruncateRequest) (*TruncateReply, error)
+}
+
+func RegisterCfsServer(s *grpc.Server, srv CfsServer) {
+	s.RegisterService(&_Cfs_serviceDesc, srv)
+}
+
+func _Cfs_Write_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(WriteRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Write(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Read_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(ReadRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Read(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Rename_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(RenameRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Rename(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Remove_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(RemoveRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Remove(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_ReadDir_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(ReadDirRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).ReadDir(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Mkdir_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(MkdirRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Mkdir(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Extents_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(ExtentsRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Extents(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Checksum_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(ChecksumRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Checksum(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_MerkleNodes_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(MerkleNodesRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).MerkleNodes(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Batch_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Batch(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_ReadV_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(ReadVRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).ReadV(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_WriteV_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(WriteVRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).WriteV(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Lock_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(LockRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Lock(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Unlock_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(UnlockRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Unlock(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_RenewLease_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(RenewLeaseRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).RenewLease(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CfsServer).Watch(m, &cfsWatchServer{stream})
+}
+
+type Cfs_WatchServer interface {
+	Send(*WatchEvent) error
+	grpc.ServerStream
+}
+
+type cfsWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *cfsWatchServer) Send(m *WatchEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Cfs_Walk_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WalkRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CfsServer).Walk(m, &cfsWalkServer{stream})
+}
+
+type Cfs_WalkServer interface {
+	Send(*WalkReply) error
+	grpc.ServerStream
+}
+
+type cfsWalkServer struct {
+	grpc.ServerStream
+}
+
+func (x *cfsWalkServer) Send(m *WalkReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Cfs_DiskUsage_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(DiskUsageRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).DiskUsage(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_ListTrash_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(ListTrashRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).ListTrash(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Undelete_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(UndeleteRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Undelete(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_PurgeTrash_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(PurgeTrashRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).PurgeTrash(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Snapshot_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(SnapshotRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Snapshot(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_ListSnapshots_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(ListSnapshotsRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).ListSnapshots(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_DeleteSnapshot_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(DeleteSnapshotRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).DeleteSnapshot(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_RestoreSnapshot_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(RestoreSnapshotRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).RestoreSnapshot(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Link_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(LinkRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Link(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Symlink_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(SymlinkRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Symlink(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Clone_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(CloneRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Clone(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Stat_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(StatRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Stat(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Cfs_Truncate_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(TruncateRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(CfsServer).Truncate(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var _Cfs_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.cfs",
+	HandlerType: (*CfsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Write",
+			Handler:    _Cfs_Write_Handler,
+		},
+		{
+			MethodName: "Read",
 			Handler:    _Cfs_Read_Handler,
 		},
 		{
@@ -622,6 +2569,105 @@ var _Cfs_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Mkdir",
 			Handler:    _Cfs_Mkdir_Handler,
 		},
+		{
+			MethodName: "Extents",
+			Handler:    _Cfs_Extents_Handler,
+		},
+		{
+			MethodName: "Checksum",
+			Handler:    _Cfs_Checksum_Handler,
+		},
+		{
+			MethodName: "MerkleNodes",
+			Handler:    _Cfs_MerkleNodes_Handler,
+		},
+		{
+			MethodName: "Batch",
+			Handler:    _Cfs_Batch_Handler,
+		},
+		{
+			MethodName: "ReadV",
+			Handler:    _Cfs_ReadV_Handler,
+		},
+		{
+			MethodName: "WriteV",
+			Handler:    _Cfs_WriteV_Handler,
+		},
+		{
+			MethodName: "Lock",
+			Handler:    _Cfs_Lock_Handler,
+		},
+		{
+			MethodName: "Unlock",
+			Handler:    _Cfs_Unlock_Handler,
+		},
+		{
+			MethodName: "RenewLease",
+			Handler:    _Cfs_RenewLease_Handler,
+		},
+		{
+			MethodName: "DiskUsage",
+			Handler:    _Cfs_DiskUsage_Handler,
+		},
+		{
+			MethodName: "ListTrash",
+			Handler:    _Cfs_ListTrash_Handler,
+		},
+		{
+			MethodName: "Undelete",
+			Handler:    _Cfs_Undelete_Handler,
+		},
+		{
+			MethodName: "PurgeTrash",
+			Handler:    _Cfs_PurgeTrash_Handler,
+		},
+		{
+			MethodName: "Snapshot",
+			Handler:    _Cfs_Snapshot_Handler,
+		},
+		{
+			MethodName: "ListSnapshots",
+			Handler:    _Cfs_ListSnapshots_Handler,
+		},
+		{
+			MethodName: "DeleteSnapshot",
+			Handler:    _Cfs_DeleteSnapshot_Handler,
+		},
+		{
+			MethodName: "RestoreSnapshot",
+			Handler:    _Cfs_RestoreSnapshot_Handler,
+		},
+		{
+			MethodName: "Link",
+			Handler:    _Cfs_Link_Handler,
+		},
+		{
+			MethodName: "Symlink",
+			Handler:    _Cfs_Symlink_Handler,
+		},
+		{
+			MethodName: "Clone",
+			Handler:    _Cfs_Clone_Handler,
+		},
+		{
+			MethodName: "Stat",
+			Handler:    _Cfs_Stat_Handler,
+		},
+		{
+			MethodName: "Truncate",
+			Handler:    _Cfs_Truncate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Cfs_Watch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Walk",
+			Handler:       _Cfs_Walk_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams: []grpc.StreamDesc{},
 }
@@ -48,6 +48,30 @@ func (m *DisksReply) GetDisks() []*Disk {
 	return nil
 }
 
+type RotateKeysRequest struct {
+	Header *RequestHeader `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+}
+
+func (m *RotateKeysRequest) Reset()         { *m = RotateKeysRequest{} }
+func (m *RotateKeysRequest) String() string { return proto1.CompactTextString(m) }
+func (*RotateKeysRequest) ProtoMessage()    {}
+
+func (m *RotateKeysRequest) GetHeader() *RequestHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+type RotateKeysReply struct {
+	// disks are the names of the rotated disks.
+	Disks []string `protobuf:"bytes,1,rep,name=disks" json:"disks,omitempty"`
+}
+
+func (m *RotateKeysReply) Reset()         { *m = RotateKeysReply{} }
+func (m *RotateKeysReply) String() string { return proto1.CompactTextString(m) }
+func (*RotateKeysReply) ProtoMessage()    {}
+
 func init() {
 }
 
@@ -55,6 +79,7 @@ func init() {
 
 type MetadataClient interface {
 	Disks(ctx context.Context, in *DisksRequest, opts ...grpc.CallOption) (*DisksReply, error)
+	RotateKeys(ctx context.Context, in *RotateKeysRequest, opts ...grpc.CallOption) (*RotateKeysReply, error)
 }
 
 type metadataClient struct {
@@ -74,10 +99,20 @@ func (c *metadataClient) Disks(ctx context.Context, in *DisksRequest, opts ...gr
 	return out, nil
 }
 
+func (c *metadataClient) RotateKeys(ctx context.Context, in *RotateKeysRequest, opts ...grpc.CallOption) (*RotateKeysReply, error) {
+	out := new(RotateKeysReply)
+	err := grpc.Invoke(ctx, "/proto.metadata/RotateKeys", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Metadata service
 
 type MetadataServer interface {
 	Disks(context.Context, *DisksRequest) (*DisksReply, error)
+	RotateKeys(context.Context, *RotateKeysRequest) (*RotateKeysReply, error)
 }
 
 func RegisterMetadataServer(s *grpc.Server, srv MetadataServer) {
@@ -96,6 +131,18 @@ func _Metadata_Disks_Handler(srv interface{}, ctx context.Context, codec grpc.Co
 	return out, nil
 }
 
+func _Metadata_RotateKeys_Handler(srv interface{}, ctx context.Context, codec grpc.Codec, buf []byte) (interface{}, error) {
+	in := new(RotateKeysRequest)
+	if err := codec.Unmarshal(buf, in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(MetadataServer).RotateKeys(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 var _Metadata_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "proto.metadata",
 	HandlerType: (*MetadataServer)(nil),
@@ -104,6 +151,10 @@ var _Metadata_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Disks",
 			Handler:    _Metadata_Disks_Handler,
 		},
+		{
+			MethodName: "RotateKeys",
+			Handler:    _Metadata_RotateKeys_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{},
 }
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/c-fs/cfs/disk"
+	"github.com/c-fs/cfs/enforce"
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/c-fs/cfs/stats"
+	"github.com/qiniu/log"
+	"golang.org/x/net/context"
+)
+
+// mutator is what a batch op changes a disk through. Both *disk.Disk and
+// *disk.Txn implement it, the latter undoing the changes on rollback.
+type mutator interface {
+	WriteAtIf(name string, p []byte, off int64, pre disk.Precondition) (int, uint64, error)
+	Mkdir(name string, all bool) error
+	RenameIf(oldname, newname string, pre disk.Precondition) error
+	RemoveIf(name string, all bool, pre disk.Precondition) error
+}
+
+func (s *server) Batch(ctx context.Context, req *pb.BatchRequest) (*pb.BatchReply, error) {
+	reply := &pb.BatchReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+
+	if !req.Atomic {
+		for _, op := range req.Ops {
+			r, err := s.runOp(req.Header.ClientID, op, nil, s.notify)
+			if err != nil {
+				log.Infof("server: batch error (%v)", err)
+			}
+			reply.Results = append(reply.Results, r)
+		}
+		return reply, nil
+	}
+
+	dn, err := batchDisk(req.Ops)
+	if err != nil {
+		log.Infof("server: batch error (%v)", err)
+		reply.Error = pbError("batch", "", err)
+		return reply, nil
+	}
+	d := s.Disk(dn)
+	if d == nil {
+		err = fmt.Errorf("cannot find disk %s", dn)
+		log.Infof("server: batch error (%v)", err)
+		reply.Error = pbError("batch", dn, err)
+		return reply, nil
+	}
+
+	// The events of an atomic batch are published once it commits.
+	var events []*pb.WatchEvent
+	emit := func(op pb.WatchEvent_Op, name, newName string, isDir bool) {
+		events = append(events, &pb.WatchEvent{Op: op, Name: name, NewName: newName, IsDir: isDir})
+	}
+	txn := d.Begin()
+	for _, op := range req.Ops {
+		r, err := s.runOp(req.Header.ClientID, op, txn, emit)
+		reply.Results = append(reply.Results, r)
+		if err != nil {
+			log.Infof("server: batch error (%v)", err)
+			if rerr := txn.Rollback(); rerr != nil {
+				log.Infof("server: batch rollback error (%v)", rerr)
+			}
+			reply.Error = pbError("batch", dn, err)
+			return reply, nil
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		log.Infof("server: batch commit error (%v)", err)
+	}
+	for _, e := range events {
+		s.notify(e.Op, e.Name, e.NewName, e.IsDir)
+	}
+	return reply, nil
+}
+
+// runOp executes op and returns its result. If txn is not nil, the changes
+// of op are made through it. The events of the changes go to emit.
+func (s *server) runOp(clientID int64, op *pb.Op, txn *disk.Txn,
+	emit func(op pb.WatchEvent_Op, name, newName string, isDir bool),
+) (*pb.OpResult, error) {
+	names, err := opNames(op)
+	if err != nil {
+		return &pb.OpResult{}, err
+	}
+	dn, fn, err := splitDiskAndFile(names[0])
+	if err != nil {
+		return opResult(op, pbError("batch", names[0], err)), err
+	}
+	d := s.Disk(dn)
+	if d == nil {
+		err = fmt.Errorf("cannot find disk %s", dn)
+		return opResult(op, pbError("batch", names[0], err)), err
+	}
+	var m mutator = d
+	if txn != nil {
+		m = txn
+	}
+
+	switch {
+	case op.Write != nil:
+		stats.Counter(dn, "write").Client(clientID).Add()
+		if op.Write.RequireLease {
+			if err := s.checkLease(names[0], clientID); err != nil {
+				return &pb.OpResult{Write: &pb.WriteReply{Error: pbError("write", names[0], err)}}, err
+			}
+		}
+		if err := checkWrite(op.Write.Offset, op.Write.Precondition); err != nil {
+			return &pb.OpResult{Write: &pb.WriteReply{Error: pbError("write", names[0], err)}}, err
+		}
+		existed, _ := s.stat(d, fn)
+		n, gen, err := m.WriteAtIf(fn, op.Write.Data, op.Write.Offset, precondition(op.Write.Precondition))
+		if err != nil {
+			return &pb.OpResult{Write: &pb.WriteReply{Error: pbError("write", names[0], err)}}, err
+		}
+		if !existed {
+			emit(pb.WatchEvent_CREATE, dn+"/"+fn, "", false)
+		}
+		emit(pb.WatchEvent_WRITE, dn+"/"+fn, "", false)
+		return &pb.OpResult{Write: &pb.WriteReply{BytesWritten: int64(n), Generation: gen}}, nil
+
+	case op.Read != nil:
+		stats.Counter(dn, "read").Client(clientID).Add()
+		data, gen, err := d.ReadWithGeneration(fn, op.Read.Offset, op.Read.Length)
+		if err != nil {
+			return &pb.OpResult{Read: &pb.ReadReply{Error: pbError("read", names[0], err)}}, err
+		}
+		return &pb.OpResult{Read: &pb.ReadReply{BytesRead: int64(len(data)), Data: data, Generation: gen}}, nil
+
+	case op.Mkdir != nil:
+		stats.Counter(dn, "mkdir").Client(clientID).Add()
+		existed, _ := s.stat(d, fn)
+		if err := m.Mkdir(fn, op.Mkdir.All); err != nil {
+			return &pb.OpResult{Mkdir: &pb.MkdirReply{Error: pbError("mkdir", names[0], err)}}, err
+		}
+		if !existed {
+			emit(pb.WatchEvent_CREATE, dn+"/"+fn, "", true)
+		}
+		return &pb.OpResult{Mkdir: &pb.MkdirReply{}}, nil
+
+	case op.Rename != nil:
+		stats.Counter(dn, "rename").Client(clientID).Add()
+		dn1, nfn, err := splitDiskAndFile(names[1])
+		if err == nil && dn1 != dn {
+			err = errors.New("not same disk")
+		}
+		if err == nil && op.Rename.RequireLease {
+			err = s.checkLeases(clientID, names[0], names[1])
+		}
+		if err == nil {
+			err = m.RenameIf(fn, nfn, precondition(op.Rename.Precondition))
+		}
+		if err != nil {
+			return &pb.OpResult{Rename: &pb.RenameReply{Error: pbError("rename", names[0], err)}}, err
+		}
+		_, isDir := s.stat(d, nfn)
+		emit(pb.WatchEvent_RENAME, dn+"/"+fn, dn+"/"+nfn, isDir)
+		return &pb.OpResult{Rename: &pb.RenameReply{}}, nil
+
+	case op.Checksum != nil:
+		stats.Counter(dn, "checksum").Client(clientID).Add()
+		crc, n, err := d.RangeChecksum(fn, op.Checksum.Offset, op.Checksum.Length)
+		if err != nil {
+			return &pb.OpResult{Checksum: &pb.ChecksumReply{Error: pbError("checksum", names[0], err)}}, err
+		}
+		return &pb.OpResult{Checksum: &pb.ChecksumReply{Checksum: crc, Length: n}}, nil
+
+	default:
+		stats.Counter(dn, "remove").Client(clientID).Add()
+		if op.Remove.RequireLease {
+			if err := s.checkLease(names[0], clientID); err != nil {
+				return &pb.OpResult{Remove: &pb.RemoveReply{Error: pbError("remove", names[0], err)}}, err
+			}
+		}
+		existed, isDir := s.stat(d, fn)
+		if err := m.RemoveIf(fn, op.Remove.All, precondition(op.Remove.Precondition)); err != nil {
+			return &pb.OpResult{Remove: &pb.RemoveReply{Error: pbError("remove", names[0], err)}}, err
+		}
+		if existed {
+			emit(pb.WatchEvent_REMOVE, dn+"/"+fn, "", isDir)
+		}
+		return &pb.OpResult{Remove: &pb.RemoveReply{}}, nil
+	}
+}
+
+// opNames returns the names op works on, the source first for renames.
+func opNames(op *pb.Op) ([]string, error) {
+	switch {
+	case op == nil:
+	case op.Write != nil:
+		return []string{op.Write.Name}, nil
+	case op.Read != nil:
+		return []string{op.Read.Name}, nil
+	case op.Mkdir != nil:
+		return []string{op.Mkdir.Name}, nil
+	case op.Rename != nil:
+		return []string{op.Rename.Oldname, op.Rename.Newname}, nil
+	case op.Remove != nil:
+		return []string{op.Remove.Name}, nil
+	case op.Checksum != nil:
+		return []string{op.Checksum.Name}, nil
+	}
+	return nil, errors.New("empty op")
+}
+
+// batchDisk returns the disk all ops work on, or an error if they work on
+// more than one.
+func batchDisk(ops []*pb.Op) (string, error) {
+	var dn string
+	for _, op := range ops {
+		names, err := opNames(op)
+		if err != nil {
+			return "", err
+		}
+		for _, name := range names {
+			n, _, err := splitDiskAndFile(name)
+			if err != nil {
+				return "", err
+			}
+			if dn != "" && n != dn {
+				return "", errors.New("atomic batch spans more than one disk")
+			}
+			dn = n
+		}
+	}
+	if dn == "" {
+		return "", errors.New("empty batch")
+	}
+	return dn, nil
+}
+
+// opResult returns a result reporting e for op.
+func opResult(op *pb.Op, e *pb.Error) *pb.OpResult {
+	switch {
+	case op.Write != nil:
+		return &pb.OpResult{Write: &pb.WriteReply{Error: e}}
+	case op.Read != nil:
+		return &pb.OpResult{Read: &pb.ReadReply{Error: e}}
+	case op.Mkdir != nil:
+		return &pb.OpResult{Mkdir: &pb.MkdirReply{Error: e}}
+	case op.Rename != nil:
+		return &pb.OpResult{Rename: &pb.RenameReply{Error: e}}
+	case op.Checksum != nil:
+		return &pb.OpResult{Checksum: &pb.ChecksumReply{Error: e}}
+	default:
+		return &pb.OpResult{Remove: &pb.RemoveReply{Error: e}}
+	}
+}
@@ -1,12 +1,58 @@
 package config
 
 type Server struct {
-	Port  string
-	Bind  string
-	Disks []Disk
+	Port string
+	Bind string
+	// HTTPPort is the port of the HTTP gateway to the services, on the
+	// same address as the grpc port. Empty disables the gateway.
+	HTTPPort string `toml:"http_port"`
+	// S3Port is the port of the S3 compatible API to the buckets of S3Disk,
+	// on the same address as the grpc port. Empty disables the API.
+	S3Port string `toml:"s3_port"`
+	S3Disk string `toml:"s3_disk"`
+	// S3ClientIDs takes the client ID of an S3 request from its access key
+	// ID, if it is a decimal number, so that the quota of the client is
+	// enforced. Requests are not authenticated, so a client can use the ID,
+	// and the quota, of another. When unset, S3 requests use client ID 0.
+	S3ClientIDs bool `toml:"s3_client_ids"`
+	// CacheSize is the size in bytes of the block cache shared by all disks.
+	// Zero disables the cache.
+	CacheSize int64 `toml:"cache_size"`
+	// KeyFile is the file holding the master keys of encrypted disks.
+	KeyFile string `toml:"key_file"`
+	// AdminPort is the port of the admin listener on AdminBind, loopback
+	// by default. It serves the same services as the grpc port, and is the
+	// only one to serve RotateKeys: client IDs are asserted by clients and
+	// not authenticated, so the right to rotate keys is that of reaching
+	// the admin listener. Empty disables the listener, and RotateKeys.
+	AdminPort string `toml:"admin_port"`
+	AdminBind string `toml:"admin_bind"`
+	// Inotify makes the events of the Watch rpc come from inotify, so that
+	// changes made outside of cfs are seen too. Linux only.
+	Inotify bool
+	Disks   []Disk
 }
 
 type Disk struct {
 	Name string
 	Root string
+	// IOMode is one of "buffered" (default), "direct" (O_DIRECT)
+	// or "dsync" (O_DSYNC).
+	IOMode string `toml:"io_mode"`
+	// BlockSize is the block size used when the disk is formatted.
+	// It must match the recorded block size of an existing disk.
+	BlockSize int `toml:"block_size"`
+	// Checksum is the block checksum algorithm used when the disk is
+	// formatted: "crc32c" (default), "xxhash64" or "sha256-128".
+	Checksum string
+	// Compression is the block compression algorithm used when the disk is
+	// formatted: "deflate" or "deflate-fast". Empty disables compression.
+	Compression string
+	// Encryption is the block encryption algorithm used when the disk is
+	// formatted: "aes-256-gcm". Empty disables encryption. Encrypted disks
+	// need a key file.
+	Encryption string
+	// TrashRetention is how long removed files are kept in the trash of
+	// the disk, as in time.ParseDuration. Empty disables the trash.
+	TrashRetention string `toml:"trash_retention"`
 }
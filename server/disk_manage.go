@@ -3,8 +3,10 @@ package main
 import (
 	"os"
 	"path"
+	"time"
 
 	"github.com/c-fs/cfs/disk"
+	"github.com/c-fs/cfs/server/config"
 	"github.com/qiniu/log"
 )
 
@@ -12,18 +14,84 @@ func (s *server) Disk(name string) *disk.Disk {
 	return s.disks[name]
 }
 
-func (s *server) AddDisk(name, root string) error {
-	s.disks[name] = &disk.Disk{Name: name, Root: root}
-	err := os.MkdirAll(root, 0700)
+func (s *server) AddDisk(conf config.Disk) error {
+	name, root := conf.Name, conf.Root
+	mode, err := disk.ParseIOMode(conf.IOMode)
 	if err != nil {
 		return err
 	}
+	d := &disk.Disk{
+		Name:        name,
+		Root:        root,
+		Cache:       s.cache,
+		IOMode:      mode,
+		BlockSize:   conf.BlockSize,
+		Checksum:    conf.Checksum,
+		Compression: conf.Compression,
+		Encryption:  conf.Encryption,
+		Keyring:     s.keyring,
+	}
+	var retention time.Duration
+	if conf.TrashRetention != "" {
+		retention, err = time.ParseDuration(conf.TrashRetention)
+		if err != nil {
+			return err
+		}
+		d.Trash = retention > 0
+	}
+	err = d.Init()
+	if err != nil {
+		return err
+	}
+	if len(d.TxnLeftovers) > 0 {
+		log.Infof("server: cleaned up files of batches cut short on disk %s: %v", name, d.TxnLeftovers)
+	}
+	if s.inotify {
+		if err := watchDisk(d, s.watch.publish); err != nil {
+			return err
+		}
+	}
+	s.disks[name] = d
+	if d.Compression != "" {
+		registerCompressionStats(d)
+	}
+	if d.Trash {
+		go purgeTrashEvery(d, retention, trashPurgeInterval)
+	}
 
 	pwd, err := os.Getwd()
 	if err != nil {
 		log.Panicf("server: cannot get current working directory (%v)", err)
 	}
 
-	log.Infof("server: created disk[%s] at root path[%s]", name, path.Join(pwd, root))
+	log.Infof("server: created disk[%s] at root path[%s] with %d bytes %s blocks and %v I/O",
+		name, path.Join(pwd, root), d.BlockSize, d.Checksum, mode)
+	if d.Compression != "" {
+		log.Infof("server: disk[%s] compresses blocks with %s", name, d.Compression)
+	}
+	if d.Encryption != "" {
+		log.Infof("server: disk[%s] encrypts blocks with %s", name, d.Encryption)
+	}
+	if d.Trash {
+		log.Infof("server: disk[%s] keeps removed files in its trash for %v", name, retention)
+	}
 	return nil
 }
+
+// RotateKeys rewraps the data keys of all encrypted disks with the current
+// key of r, which becomes the keyring of the server. It returns the names of
+// the disks rotated before the first error.
+func (s *server) RotateKeys(r *disk.Keyring) ([]string, error) {
+	var rotated []string
+	for name, d := range s.disks {
+		if d.Encryption == "" {
+			continue
+		}
+		if err := d.RotateKey(r); err != nil {
+			return rotated, err
+		}
+		rotated = append(rotated, name)
+	}
+	s.keyring = r
+	return rotated, nil
+}
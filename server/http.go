@@ -0,0 +1,462 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c-fs/cfs/enforce"
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/qiniu/log"
+	"golang.org/x/net/context"
+)
+
+// clientIDHeader is the HTTP header carrying the client ID of a request,
+// in decimal. Requests without it use client ID 0.
+const clientIDHeader = "X-Cfs-Client-Id"
+
+// httpChunkSize is the number of bytes read or written per rpc.
+const httpChunkSize = 1 << 20
+
+// httpUploadDir is the directory of each disk holding the files being
+// uploaded to replace others.
+const httpUploadDir = ".httpuploads"
+
+// The timeouts of the HTTP servers. Bodies of any size are streamed, so
+// only reading the headers of a request and idle connections are bounded.
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+// newHTTPServer returns an HTTP server of handler, which does not let
+// clients hold connections open without sending requests.
+func newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
+}
+
+// httpGateway serves the cfs, metadata and stats services over HTTP by
+// calling the same handlers as grpc, so that clients without grpc can
+// use cfs:
+//
+//	GET    /disks               the disks of the node, in JSON
+//	GET    /stats               the metrics of the node, in JSON
+//	GET    /files/<disk>/<name> a file, with Range support, or the
+//	                            entries of a directory in JSON
+//	HEAD   /files/<disk>/<name> the size and modification time of a file
+//	PUT    /files/<disk>/<name> replace a file, or write at ?offset=
+//	                            in place
+//	PUT    /files/<disk>/<name>/ make a directory and its parents
+//	DELETE /files/<disk>/<name> remove a file, or a tree with ?recursive=true
+//
+// Directory listings take the page_token, page_size, prefix, pattern and
+// recursive query parameters of ReadDir.
+type httpGateway struct {
+	cfs      *server
+	metadata *metadataServer
+	stats    pb.StatsServer
+}
+
+func newHTTPGateway(cfs *server, metadata *metadataServer, stats pb.StatsServer) http.Handler {
+	g := &httpGateway{cfs: cfs, metadata: metadata, stats: stats}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/disks", g.serveDisks)
+	mux.HandleFunc("/stats", g.serveStats)
+	mux.HandleFunc("/files/", g.serveFiles)
+	return mux
+}
+
+// errHTTP is an error of a request with the status code to reply with.
+type errHTTP struct {
+	code int
+	msg  string
+}
+
+func (e *errHTTP) Error() string { return e.msg }
+
+var (
+	errHTTPNotFound = &errHTTP{http.StatusNotFound, "no such file or directory"}
+	errHTTPFailed   = &errHTTP{http.StatusInternalServerError, "request failed, see the server log"}
+)
+
+// replyError replies to a request that failed with err.
+func replyError(w http.ResponseWriter, err error) {
+	e, ok := err.(*errHTTP)
+	if !ok {
+		e = &errHTTP{http.StatusInternalServerError, err.Error()}
+	}
+	http.Error(w, e.msg, e.code)
+}
+
+// httpError converts the error of a reply to an errHTTP.
+func httpError(pbErr *pb.Error) error {
+	switch {
+	case pbErr == nil:
+		return nil
+	case pbErr.PreconditionErr != nil:
+		return &errHTTP{http.StatusPreconditionFailed, pbErr.String()}
+	case pbErr.LeaseErr != nil:
+		return &errHTTP{http.StatusConflict, pbErr.String()}
+	}
+	return &errHTTP{http.StatusInternalServerError, pbErr.String()}
+}
+
+func replyJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Infof("server: http reply error (%v)", err)
+	}
+}
+
+// header returns the request header of the rpcs made for r, checking the
+// quota of its client.
+func header(r *http.Request) (*pb.RequestHeader, error) {
+	var id int64
+	if s := r.Header.Get(clientIDHeader); s != "" {
+		var err error
+		id, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, &errHTTP{http.StatusBadRequest, "bad " + clientIDHeader + " header"}
+		}
+	}
+	if !enforce.HasQuota(id) {
+		log.Infof("server: out of quota for client %d", id)
+		return nil, &errHTTP{http.StatusTooManyRequests, "out of quota"}
+	}
+	return &pb.RequestHeader{ClientID: id}, nil
+}
+
+func (g *httpGateway) serveDisks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reply, err := g.metadata.Disks(r.Context(), &pb.DisksRequest{})
+	if err != nil {
+		replyError(w, err)
+		return
+	}
+	replyJSON(w, reply)
+}
+
+func (g *httpGateway) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reply, err := g.stats.Metrics(r.Context(), &pb.MetricsRequest{})
+	if err != nil {
+		replyError(w, err)
+		return
+	}
+	replyJSON(w, reply)
+}
+
+func (g *httpGateway) serveFiles(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/files/")
+	h, err := header(r)
+	if err == nil {
+		switch r.Method {
+		case "GET", "HEAD":
+			err = g.get(w, r, h, name)
+		case "PUT":
+			err = g.put(w, r, h, name)
+		case "DELETE":
+			err = g.remove(w, r, h, name)
+		default:
+			err = &errHTTP{http.StatusMethodNotAllowed, "method not allowed"}
+		}
+	}
+	if err != nil {
+		log.Infof("server: http %s %s error (%v)", r.Method, name, err)
+		replyError(w, err)
+	}
+}
+
+// stat returns the info of the named file, or errHTTPNotFound.
+func (g *httpGateway) stat(ctx context.Context, h *pb.RequestHeader, name string) (*pb.FileInfo, error) {
+	dn, _, err := splitDiskAndDir(name)
+	if err != nil {
+		return nil, &errHTTP{http.StatusBadRequest, err.Error()}
+	}
+	if g.cfs.Disk(dn) == nil {
+		return nil, errHTTPNotFound
+	}
+	reply, err := g.cfs.Stat(ctx, &pb.StatRequest{Header: h, Name: name})
+	if err != nil {
+		return nil, err
+	}
+	if err := httpError(reply.Error); err != nil {
+		return nil, err
+	}
+	if reply.Info == nil {
+		return nil, errHTTPNotFound
+	}
+	return reply.Info, nil
+}
+
+func (g *httpGateway) get(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, name string) error {
+	ctx := r.Context()
+	fi, err := g.stat(ctx, h, name)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir {
+		return g.list(w, r, h, name)
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	f := &httpFile{s: g.cfs, ctx: ctx, h: h, name: name, size: fi.Size}
+	http.ServeContent(w, r, fi.Name, time.Unix(0, fi.ModTime), f)
+	return nil
+}
+
+func (g *httpGateway) list(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, name string) error {
+	q := r.URL.Query()
+	req := &pb.ReadDirRequest{
+		Header:    h,
+		Name:      name,
+		PageToken: q.Get("page_token"),
+		Prefix:    q.Get("prefix"),
+		Pattern:   q.Get("pattern"),
+		Recursive: q.Get("recursive") == "true",
+	}
+	if s := q.Get("page_size"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return &errHTTP{http.StatusBadRequest, "bad page_size"}
+		}
+		req.PageSize = int32(n)
+	}
+	reply, err := g.cfs.ReadDir(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	if err := httpError(reply.Error); err != nil {
+		return err
+	}
+	if r.Method == "HEAD" {
+		w.Header().Set("Content-Type", "application/json")
+		return nil
+	}
+	replyJSON(w, reply)
+	return nil
+}
+
+func (g *httpGateway) put(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, name string) error {
+	ctx := r.Context()
+	if strings.HasSuffix(name, "/") {
+		name = strings.TrimSuffix(name, "/")
+		reply, err := g.cfs.Mkdir(ctx, &pb.MkdirRequest{Header: h, Name: name, All: true})
+		if err != nil {
+			return err
+		}
+		if err := httpError(reply.Error); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	var off int64
+	truncate := true
+	if s := r.URL.Query().Get("offset"); s != "" {
+		var err error
+		off, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || off < 0 {
+			return &errHTTP{http.StatusBadRequest, "bad offset"}
+		}
+		truncate = false
+	}
+	fi, err := g.stat(ctx, h, name)
+	if err != nil && err != errHTTPNotFound {
+		return err
+	}
+	created := fi == nil
+	if fi != nil && fi.IsDir {
+		return &errHTTP{http.StatusConflict, "is a directory"}
+	}
+	if truncate {
+		err = g.replace(ctx, h, name, r.Body)
+	} else {
+		_, err = writeFrom(ctx, g.cfs, h, name, off, r.Body)
+	}
+	if err != nil {
+		return err
+	}
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return nil
+}
+
+// replace replaces the named file with what is read from r. The data is
+// written to a file of httpUploadDir first and renamed into place, so that
+// the file is never seen partly written.
+func (g *httpGateway) replace(ctx context.Context, h *pb.RequestHeader, name string, r io.Reader) error {
+	dn, _, _ := splitDiskAndDir(name)
+	dir := path.Join(dn, httpUploadDir)
+	mkdir, err := g.cfs.Mkdir(ctx, &pb.MkdirRequest{Header: h, Name: dir, All: true})
+	if err != nil {
+		return err
+	}
+	if err := httpError(mkdir.Error); err != nil {
+		return err
+	}
+	tmp := path.Join(dir, "put-"+newID())
+	if err := g.store(ctx, h, tmp, r); err != nil {
+		g.cfs.Remove(ctx, &pb.RemoveRequest{Header: h, Name: tmp})
+		return err
+	}
+	reply, err := g.cfs.Rename(ctx, &pb.RenameRequest{Header: h, Oldname: tmp, Newname: name})
+	if err == nil {
+		err = httpError(reply.Error)
+	}
+	if err != nil {
+		g.cfs.Remove(ctx, &pb.RemoveRequest{Header: h, Name: tmp})
+	}
+	return err
+}
+
+// store writes what is read from r to the new named file.
+func (g *httpGateway) store(ctx context.Context, h *pb.RequestHeader, name string, r io.Reader) error {
+	// the file is created even if r is empty
+	reply, err := g.cfs.Truncate(ctx, &pb.TruncateRequest{Header: h, Name: name})
+	if err != nil {
+		return err
+	}
+	if err := httpError(reply.Error); err != nil {
+		return err
+	}
+	_, err = writeFrom(ctx, g.cfs, h, name, 0, r)
+	return err
+}
+
+func (g *httpGateway) remove(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, name string) error {
+	ctx := r.Context()
+	if _, _, err := splitDiskAndFile(name); err != nil {
+		return &errHTTP{http.StatusBadRequest, err.Error()}
+	}
+	fi, err := g.stat(ctx, h, name)
+	if err != nil {
+		return err
+	}
+	all := r.URL.Query().Get("recursive") == "true"
+	if fi.IsDir && !all {
+		reply, err := g.cfs.ReadDir(ctx, &pb.ReadDirRequest{Header: h, Name: name, PageSize: 1})
+		if err != nil {
+			return err
+		}
+		if len(reply.FileInfos) > 0 {
+			return &errHTTP{http.StatusConflict, "directory not empty"}
+		}
+	}
+	reply, err := g.cfs.Remove(ctx, &pb.RemoveRequest{Header: h, Name: name, All: all})
+	if err != nil {
+		return err
+	}
+	if err := httpError(reply.Error); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// writeFrom writes what is read from r to the named file at off with the
+// Write handler, a chunk per rpc, and returns the number of bytes written.
+func writeFrom(ctx context.Context, s *server, h *pb.RequestHeader, name string, off int64, r io.Reader,
+) (int64, error) {
+	buf := make([]byte, httpChunkSize)
+	var written int64
+	for {
+		n, rerr := io.ReadFull(r, buf)
+		if n > 0 {
+			reply, err := s.Write(ctx, &pb.WriteRequest{Header: h, Name: name, Offset: off + written, Data: buf[:n]})
+			if err != nil {
+				return written, err
+			}
+			if err := httpError(reply.Error); err != nil {
+				return written, err
+			}
+			if reply.BytesWritten != int64(n) {
+				return written, errHTTPFailed
+			}
+			written += int64(n)
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			return written, nil
+		}
+		if e, ok := rerr.(*errHTTP); ok {
+			return written, e
+		}
+		if rerr != nil {
+			return written, &errHTTP{http.StatusBadRequest, rerr.Error()}
+		}
+	}
+}
+
+// httpFile is an io.ReadSeeker over the Read handler, reading a chunk per
+// rpc, for http.ServeContent to serve ranges of a file.
+type httpFile struct {
+	s    *server
+	ctx  context.Context
+	h    *pb.RequestHeader
+	name string
+	size int64
+
+	off int64
+	// buf holds the data read from off on.
+	buf []byte
+}
+
+func (f *httpFile) Read(p []byte) (int, error) {
+	if len(f.buf) == 0 {
+		if f.off >= f.size {
+			return 0, io.EOF
+		}
+		reply, err := f.s.Read(f.ctx, &pb.ReadRequest{Header: f.h, Name: f.name, Offset: f.off, Length: httpChunkSize})
+		if err != nil {
+			return 0, err
+		}
+		if err := httpError(reply.Error); err != nil {
+			return 0, err
+		}
+		if reply.BytesRead == 0 {
+			// the file shrank since it was stat'd
+			return 0, errHTTPFailed
+		}
+		f.buf = reply.Data[:reply.BytesRead]
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *httpFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if offset != f.off {
+		f.off = offset
+		f.buf = nil
+	}
+	return offset, nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/c-fs/cfs/server/config"
+	"golang.org/x/net/context"
+)
+
+// newTestServer returns a server of a disk named disk0 in a new temporary
+// directory, and a function removing the directory.
+func newTestServer(t *testing.T) (*server, func()) {
+	dir, err := ioutil.TempDir("", "cfs-server")
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	s := NewServer(nil, nil, false)
+	if err := s.AddDisk(config.Disk{Name: "disk0", Root: dir}); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("error = %v", err)
+	}
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// httpDo makes a request of method to the url of ts, and returns the
+// status code and body of the reply.
+func httpDo(t *testing.T, ts *httptest.Server, method, url string, header http.Header, body string) (int, string) {
+	resp, data := httpRequest(t, ts, method, url, header, body)
+	return resp.StatusCode, data
+}
+
+// httpRequest makes a request of method to the url of ts, and returns the
+// reply with its body read.
+func httpRequest(t *testing.T, ts *httptest.Server, method, url string, header http.Header, body string,
+) (*http.Response, string) {
+	req, err := http.NewRequest(method, ts.URL+url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, url, err)
+	}
+	return resp, string(data)
+}
+
+func TestHTTPGatewayPut(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	ts := httptest.NewServer(newHTTPGateway(s, nil, nil))
+	defer ts.Close()
+
+	tests := []struct {
+		url  string
+		body string
+		code int
+		// data is what the file holds after the request
+		data string
+	}{
+		{"/files/disk0/a", "hello", http.StatusCreated, "hello"},
+		{"/files/disk0/a", "hi", http.StatusNoContent, "hi"},
+		{"/files/disk0/a?offset=1", "EY", http.StatusNoContent, "hEY"},
+		{"/files/disk0/a?offset=5", "!", http.StatusNoContent, "hEY\x00\x00!"},
+		{"/files/disk0/a", "", http.StatusNoContent, ""},
+		{"/files/disk0/b?offset=2", "b", http.StatusCreated, "\x00\x00b"},
+		{"/files/disk0/a?offset=-1", "x", http.StatusBadRequest, ""},
+		{"/files/disk0/nodir/a", "x", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		if code, body := httpDo(t, ts, "PUT", tt.url, nil, tt.body); code != tt.code {
+			t.Errorf("PUT %s: code = %d (%s), want %d", tt.url, code, body, tt.code)
+			continue
+		}
+		if tt.code >= 300 {
+			continue
+		}
+		name := strings.SplitN(tt.url, "?", 2)[0]
+		if code, body := httpDo(t, ts, "GET", name, nil, ""); code != http.StatusOK || body != tt.data {
+			t.Errorf("GET %s after PUT %s = %d %q, want %q", name, tt.url, code, body, tt.data)
+		}
+	}
+
+	// the files uploaded to replace others were all renamed into place
+	reply, err := s.ReadDir(context.Background(), &pb.ReadDirRequest{Header: &pb.RequestHeader{}, Name: "disk0/" + httpUploadDir})
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if len(reply.FileInfos) != 0 {
+		t.Errorf("uploads = %v, want none", reply.FileInfos)
+	}
+
+	if code, body := httpDo(t, ts, "PUT", "/files/disk0/x/y/", nil, ""); code != http.StatusNoContent {
+		t.Errorf("mkdir code = %d (%s), want %d", code, body, http.StatusNoContent)
+	}
+	if code, _ := httpDo(t, ts, "PUT", "/files/disk0/x/y", nil, "x"); code != http.StatusConflict {
+		t.Errorf("PUT to a directory code = %d, want %d", code, http.StatusConflict)
+	}
+	if code, _ := httpDo(t, ts, "PUT", "/files/disk0/a/", nil, ""); code != http.StatusInternalServerError {
+		t.Errorf("mkdir over a file code = %d, want %d", code, http.StatusInternalServerError)
+	}
+}
+
+func TestHTTPGatewayGetRange(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	ts := httptest.NewServer(newHTTPGateway(s, nil, nil))
+	defer ts.Close()
+
+	// the file spans two chunks read by rpcs
+	data := make([]byte, httpChunkSize+10)
+	for i := range data {
+		data[i] = byte('a' + i%26)
+	}
+	if code, _ := httpDo(t, ts, "PUT", "/files/disk0/a", nil, string(data)); code != http.StatusCreated {
+		t.Fatalf("PUT code = %d, want %d", code, http.StatusCreated)
+	}
+
+	tests := []struct {
+		rangeHeader string
+		code        int
+		data        []byte
+	}{
+		{"", http.StatusOK, data},
+		{"bytes=2-5", http.StatusPartialContent, data[2:6]},
+		{"bytes=1048570-1048579", http.StatusPartialContent, data[httpChunkSize-6 : httpChunkSize+4]},
+		{"bytes=-3", http.StatusPartialContent, data[len(data)-3:]},
+		{"bytes=2000000-", http.StatusRequestedRangeNotSatisfiable, nil},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.rangeHeader != "" {
+			header.Set("Range", tt.rangeHeader)
+		}
+		code, body := httpDo(t, ts, "GET", "/files/disk0/a", header, "")
+		if code != tt.code {
+			t.Errorf("range %q: code = %d, want %d", tt.rangeHeader, code, tt.code)
+			continue
+		}
+		if tt.data != nil && !bytes.Equal([]byte(body), tt.data) {
+			t.Errorf("range %q: got %d bytes, want %d", tt.rangeHeader, len(body), len(tt.data))
+		}
+	}
+	if code, _ := httpDo(t, ts, "GET", "/files/disk0/missing", nil, ""); code != http.StatusNotFound {
+		t.Errorf("GET of a missing file code = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestHTTPGatewayDelete(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	ts := httptest.NewServer(newHTTPGateway(s, nil, nil))
+	defer ts.Close()
+
+	for _, url := range []string{"/files/disk0/dir/", "/files/disk0/empty/"} {
+		if code, _ := httpDo(t, ts, "PUT", url, nil, ""); code != http.StatusNoContent {
+			t.Fatalf("PUT %s code = %d, want %d", url, code, http.StatusNoContent)
+		}
+	}
+	for _, url := range []string{"/files/disk0/a", "/files/disk0/dir/b"} {
+		if code, _ := httpDo(t, ts, "PUT", url, nil, "x"); code != http.StatusCreated {
+			t.Fatalf("PUT %s code = %d, want %d", url, code, http.StatusCreated)
+		}
+	}
+
+	tests := []struct {
+		url  string
+		code int
+		// gone is the file that must be missing after the request
+		gone string
+	}{
+		{"/files/disk0/a", http.StatusNoContent, "/files/disk0/a"},
+		{"/files/disk0/a", http.StatusNotFound, ""},
+		{"/files/disk0/dir", http.StatusConflict, ""},
+		{"/files/disk0/empty", http.StatusNoContent, "/files/disk0/empty"},
+		{"/files/disk0/dir?recursive=true", http.StatusNoContent, "/files/disk0/dir/b"},
+		{"/files/disk0", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		if code, body := httpDo(t, ts, "DELETE", tt.url, nil, ""); code != tt.code {
+			t.Errorf("DELETE %s: code = %d (%s), want %d", tt.url, code, body, tt.code)
+		}
+		if tt.gone == "" {
+			continue
+		}
+		if code, _ := httpDo(t, ts, "HEAD", tt.gone, nil, ""); code != http.StatusNotFound {
+			t.Errorf("DELETE %s: HEAD %s code = %d, want %d", tt.url, tt.gone, code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestHTTPGatewayList(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	ts := httptest.NewServer(newHTTPGateway(s, nil, nil))
+	defer ts.Close()
+
+	if code, _ := httpDo(t, ts, "PUT", "/files/disk0/dir/", nil, ""); code != http.StatusNoContent {
+		t.Fatalf("mkdir code = %d, want %d", code, http.StatusNoContent)
+	}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if code, _ := httpDo(t, ts, "PUT", "/files/disk0/dir/"+name, nil, name); code != http.StatusCreated {
+			t.Fatalf("PUT %s code = %d, want %d", name, code, http.StatusCreated)
+		}
+	}
+
+	var names []string
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatalf("expect 3 pages of 2 entries, got more")
+		}
+		code, body := httpDo(t, ts, "GET", "/files/disk0/dir?page_size=2&page_token="+token, nil, "")
+		if code != http.StatusOK {
+			t.Fatalf("list code = %d (%s), want %d", code, body, http.StatusOK)
+		}
+		var reply pb.ReadDirReply
+		if err := json.Unmarshal([]byte(body), &reply); err != nil {
+			t.Fatalf("error = %v", err)
+		}
+		if len(reply.FileInfos) > 2 {
+			t.Errorf("page has %d entries, want at most 2", len(reply.FileInfos))
+		}
+		for _, fi := range reply.FileInfos {
+			names = append(names, fi.Name)
+		}
+		if reply.NextPageToken == "" {
+			break
+		}
+		token = reply.NextPageToken
+	}
+	if strings.Join(names, " ") != "a b c d e" {
+		t.Errorf("entries = %v, want [a b c d e]", names)
+	}
+
+	if code, _ := httpDo(t, ts, "GET", "/files/disk0/dir?page_size=x", nil, ""); code != http.StatusBadRequest {
+		t.Errorf("bad page_size code = %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestHTTPGatewayClientID(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	ts := httptest.NewServer(newHTTPGateway(s, nil, nil))
+	defer ts.Close()
+
+	tests := []struct {
+		id   string
+		code int
+	}{
+		{"", http.StatusCreated},
+		{"7", http.StatusNoContent},
+		{"-7", http.StatusNoContent},
+		{"abc", http.StatusBadRequest},
+		{"7x", http.StatusBadRequest},
+		{"99999999999999999999", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.id != "" {
+			header.Set(clientIDHeader, tt.id)
+		}
+		if code, body := httpDo(t, ts, "PUT", "/files/disk0/a", header, "x"); code != tt.code {
+			t.Errorf("client ID %q: code = %d (%s), want %d", tt.id, code, body, tt.code)
+		}
+	}
+}
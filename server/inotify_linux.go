@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/c-fs/cfs/disk"
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/qiniu/log"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// inotifyWatcher turns the inotify events of the directories of a disk
+// into watch events.
+type inotifyWatcher struct {
+	fd      int
+	d       *disk.Disk
+	publish func(op pb.WatchEvent_Op, name, newName string, isDir bool)
+	// dirs maps watch descriptors to directories relative to the root.
+	dirs map[int]string
+	// moved is the file moved away by the last event, which is a rename
+	// if the next event moves it back in.
+	moved *movedFile
+}
+
+type movedFile struct {
+	cookie uint32
+	name   string
+	isDir  bool
+}
+
+// watchDisk publishes the changes of the files of d as seen by inotify,
+// including the ones made outside of cfs.
+func watchDisk(d *disk.Disk, publish func(pb.WatchEvent_Op, string, string, bool)) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	w := &inotifyWatcher{fd: fd, d: d, publish: publish, dirs: make(map[int]string)}
+	if err := w.addTree("", false); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	go w.run()
+	return nil
+}
+
+// addTree watches dir and the directories under it, except the metadata
+// directory. If created is set, the files under dir are published as
+// created, since they may have been created before the watch was.
+func (w *inotifyWatcher) addTree(dir string, created bool) error {
+	return filepath.Walk(path.Join(w.d.Root, dir), func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if created {
+				// removed since
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(w.d.Root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			rel = ""
+		}
+		if rel == disk.MetaDir {
+			return filepath.SkipDir
+		}
+		if created && rel != dir {
+			w.publish(pb.WatchEvent_CREATE, w.d.Name+"/"+rel, "", fi.IsDir())
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, p, inotifyMask)
+		if err != nil {
+			if created {
+				return nil
+			}
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+		w.dirs[wd] = rel
+		return nil
+	})
+}
+
+func (w *inotifyWatcher) run() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := syscall.Read(w.fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			log.Infof("server: inotify error on disk %s (%v)", w.d.Name, err)
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			start := off + syscall.SizeofInotifyEvent
+			off = start + int(ev.Len)
+			name := strings.TrimRight(string(buf[start:off]), "\x00")
+			w.handle(int(ev.Wd), ev.Mask, ev.Cookie, name)
+		}
+		// The two halves of a rename come together, so a file moved away
+		// and not back in by now left the disk.
+		w.flushMoved()
+	}
+}
+
+func (w *inotifyWatcher) handle(wd int, mask, cookie uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.flushMoved()
+		w.publish(pb.WatchEvent_LOST, "", "", false)
+		return
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		return
+	}
+	dir, ok := w.dirs[wd]
+	if !ok || (dir == "" && name == disk.MetaDir) {
+		return
+	}
+	rel := path.Join(dir, name)
+	full := w.d.Name + "/" + rel
+	isDir := mask&syscall.IN_ISDIR != 0
+
+	if w.moved != nil && (mask&syscall.IN_MOVED_TO == 0 || cookie != w.moved.cookie) {
+		w.flushMoved()
+	}
+	switch {
+	case mask&syscall.IN_CREATE != 0:
+		w.publish(pb.WatchEvent_CREATE, full, "", isDir)
+		if isDir {
+			w.addTree(rel, true)
+		}
+	case mask&syscall.IN_CLOSE_WRITE != 0:
+		w.publish(pb.WatchEvent_WRITE, full, "", false)
+	case mask&syscall.IN_DELETE != 0:
+		w.publish(pb.WatchEvent_REMOVE, full, "", isDir)
+	case mask&syscall.IN_MOVED_FROM != 0:
+		w.moved = &movedFile{cookie: cookie, name: rel, isDir: isDir}
+	case mask&syscall.IN_MOVED_TO != 0:
+		if w.moved == nil {
+			w.publish(pb.WatchEvent_CREATE, full, "", isDir)
+			if isDir {
+				w.addTree(rel, true)
+			}
+			return
+		}
+		w.publish(pb.WatchEvent_RENAME, w.d.Name+"/"+w.moved.name, full, isDir)
+		if isDir {
+			for wd, d := range w.dirs {
+				if under(d, w.moved.name) {
+					w.dirs[wd] = rel + strings.TrimPrefix(d, w.moved.name)
+				}
+			}
+		}
+		w.moved = nil
+	}
+}
+
+// flushMoved publishes the file moved away, if any, as removed.
+func (w *inotifyWatcher) flushMoved() {
+	if w.moved == nil {
+		return
+	}
+	m := w.moved
+	w.moved = nil
+	w.publish(pb.WatchEvent_REMOVE, w.d.Name+"/"+m.name, "", m.isDir)
+	if !m.isDir {
+		return
+	}
+	for wd, d := range w.dirs {
+		if under(d, m.name) {
+			syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.dirs, wd)
+		}
+	}
+}
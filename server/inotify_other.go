@@ -0,0 +1,14 @@
+// +build !linux
+
+package main
+
+import (
+	"errors"
+
+	"github.com/c-fs/cfs/disk"
+	pb "github.com/c-fs/cfs/proto"
+)
+
+func watchDisk(d *disk.Disk, publish func(pb.WatchEvent_Op, string, string, bool)) error {
+	return errors.New("inotify is only supported on linux")
+}
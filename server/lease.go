@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/c-fs/cfs/enforce"
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/c-fs/cfs/stats"
+	"github.com/qiniu/log"
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultLeaseTTL = 30 * time.Second
+	maxLeaseTTL     = 5 * time.Minute
+)
+
+var (
+	errLeaseConflict = errors.New("lease held by another client")
+	errLeaseNotHeld  = errors.New("lease not held")
+)
+
+// lease is the lease of a file. Its holders are mapped to the time their
+// lease expires.
+type lease struct {
+	exclusive bool
+	holders   map[int64]time.Time
+}
+
+// leaseTable holds the leases of the files of a server by disk and file
+// name. Leases live in memory only: they expire unless renewed, so that
+// the leases of clients which went away are released on their own.
+type leaseTable struct {
+	mu     sync.Mutex
+	leases map[string]*lease
+	// done is closed to stop the expiry of leases.
+	done chan struct{}
+}
+
+func newLeaseTable() *leaseTable {
+	t := &leaseTable{leases: make(map[string]*lease), done: make(chan struct{})}
+	go t.expireEvery(time.Minute)
+	return t
+}
+
+// close stops the expiry of leases.
+func (t *leaseTable) close() {
+	close(t.done)
+}
+
+func leaseTTL(ms int64) time.Duration {
+	ttl := time.Duration(ms) * time.Millisecond
+	if ttl <= 0 {
+		return defaultLeaseTTL
+	}
+	if ttl > maxLeaseTTL {
+		return maxLeaseTTL
+	}
+	return ttl
+}
+
+// get returns the live lease of name, dropping expired holders, or nil.
+// t.mu must be held.
+func (t *leaseTable) get(name string, now time.Time) *lease {
+	l := t.leases[name]
+	if l == nil {
+		return nil
+	}
+	for id, expiry := range l.holders {
+		if !now.Before(expiry) {
+			delete(l.holders, id)
+		}
+	}
+	if len(l.holders) == 0 {
+		delete(t.leases, name)
+		return nil
+	}
+	return l
+}
+
+func (t *leaseTable) lock(name string, clientID int64, exclusive bool, ttl time.Duration) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	l := t.get(name, now)
+	if l == nil {
+		l = &lease{holders: make(map[int64]time.Time)}
+		t.leases[name] = l
+	}
+	_, held := l.holders[clientID]
+	others := len(l.holders)
+	if held {
+		others--
+	}
+	if others > 0 && (exclusive || l.exclusive) {
+		return errLeaseConflict
+	}
+	l.exclusive = exclusive
+	l.holders[clientID] = now.Add(ttl)
+	return nil
+}
+
+func (t *leaseTable) renew(name string, clientID int64, ttl time.Duration) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	l := t.get(name, now)
+	if l == nil {
+		return errLeaseNotHeld
+	}
+	if _, ok := l.holders[clientID]; !ok {
+		return errLeaseNotHeld
+	}
+	l.holders[clientID] = now.Add(ttl)
+	return nil
+}
+
+func (t *leaseTable) unlock(name string, clientID int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l := t.get(name, time.Now())
+	if l == nil {
+		return errLeaseNotHeld
+	}
+	if _, ok := l.holders[clientID]; !ok {
+		return errLeaseNotHeld
+	}
+	delete(l.holders, clientID)
+	if len(l.holders) == 0 {
+		delete(t.leases, name)
+	}
+	return nil
+}
+
+// holdsExclusive reports whether the client holds an exclusive lease
+// on name.
+func (t *leaseTable) holdsExclusive(name string, clientID int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l := t.get(name, time.Now())
+	if l == nil || !l.exclusive {
+		return false
+	}
+	_, ok := l.holders[clientID]
+	return ok
+}
+
+// expireEvery drops the expired leases of files nobody asks about, until
+// the table is closed.
+func (t *leaseTable) expireEvery(d time.Duration) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.done:
+			return
+		}
+		t.mu.Lock()
+		now := time.Now()
+		for name := range t.leases {
+			t.get(name, now)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// leaseName returns the name leases of the named file are kept under.
+func leaseName(name string) (string, string, error) {
+	dn, fn, err := splitDiskAndFile(name)
+	if err != nil {
+		return "", "", err
+	}
+	return dn, dn + "/" + fn, nil
+}
+
+// checkLease returns an error unless the client holds an exclusive lease
+// on the named file.
+func (s *server) checkLease(name string, clientID int64) error {
+	_, key, err := leaseName(name)
+	if err != nil {
+		return err
+	}
+	if !s.leases.holdsExclusive(key, clientID) {
+		return errLeaseNotHeld
+	}
+	return nil
+}
+
+// checkLeases returns an error unless the client holds exclusive leases
+// on all the named files.
+func (s *server) checkLeases(clientID int64, names ...string) error {
+	for _, name := range names {
+		if err := s.checkLease(name, clientID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *server) Lock(ctx context.Context, req *pb.LockRequest) (*pb.LockReply, error) {
+	reply := &pb.LockReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, key, err := leaseName(req.Name)
+	if err != nil {
+		log.Infof("server: lock error (%v)", err)
+		return reply, nil
+	}
+	if s.Disk(dn) == nil {
+		log.Infof("server: lock error (cannot find disk %s)", dn)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "lock").Client(req.Header.ClientID).Add()
+	ttl := leaseTTL(req.TtlMs)
+	if err := s.leases.lock(key, req.Header.ClientID, req.Exclusive, ttl); err != nil {
+		reply.Error = pbError("lock", req.Name, err)
+		return reply, nil
+	}
+	reply.TtlMs = int64(ttl / time.Millisecond)
+	return reply, nil
+}
+
+func (s *server) Unlock(ctx context.Context, req *pb.UnlockRequest) (*pb.UnlockReply, error) {
+	reply := &pb.UnlockReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, key, err := leaseName(req.Name)
+	if err != nil {
+		log.Infof("server: unlock error (%v)", err)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "unlock").Client(req.Header.ClientID).Add()
+	if err := s.leases.unlock(key, req.Header.ClientID); err != nil {
+		reply.Error = pbError("unlock", req.Name, err)
+	}
+	return reply, nil
+}
+
+func (s *server) RenewLease(ctx context.Context, req *pb.RenewLeaseRequest) (*pb.RenewLeaseReply, error) {
+	reply := &pb.RenewLeaseReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, key, err := leaseName(req.Name)
+	if err != nil {
+		log.Infof("server: renew lease error (%v)", err)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "renew_lease").Client(req.Header.ClientID).Add()
+	ttl := leaseTTL(req.TtlMs)
+	if err := s.leases.renew(key, req.Header.ClientID, ttl); err != nil {
+		reply.Error = pbError("renew", req.Name, err)
+		return reply, nil
+	}
+	reply.TtlMs = int64(ttl / time.Millisecond)
+	return reply, nil
+}
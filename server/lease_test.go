@@ -0,0 +1,241 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/c-fs/cfs/proto"
+	"golang.org/x/net/context"
+)
+
+func TestLeaseTable(t *testing.T) {
+	const ttl = time.Minute
+	type step struct {
+		op        string // lock, renew, unlock or holds
+		clientID  int64
+		exclusive bool
+		ttl       time.Duration
+		// sleep is waited for before the op
+		sleep time.Duration
+		err   error
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"shared leases", []step{
+			{op: "lock", clientID: 1, ttl: ttl},
+			{op: "lock", clientID: 2, ttl: ttl},
+			{op: "holds", clientID: 1, err: errLeaseNotHeld},
+		}},
+		{"exclusive after shared", []step{
+			{op: "lock", clientID: 1, ttl: ttl},
+			{op: "lock", clientID: 2, exclusive: true, ttl: ttl, err: errLeaseConflict},
+		}},
+		{"shared after exclusive", []step{
+			{op: "lock", clientID: 1, exclusive: true, ttl: ttl},
+			{op: "lock", clientID: 2, ttl: ttl, err: errLeaseConflict},
+			{op: "holds", clientID: 1},
+			{op: "holds", clientID: 2, err: errLeaseNotHeld},
+		}},
+		{"upgrade", []step{
+			{op: "lock", clientID: 1, ttl: ttl},
+			{op: "lock", clientID: 1, exclusive: true, ttl: ttl},
+			{op: "holds", clientID: 1},
+			{op: "lock", clientID: 2, ttl: ttl, err: errLeaseConflict},
+		}},
+		{"upgrade with other holders", []step{
+			{op: "lock", clientID: 1, ttl: ttl},
+			{op: "lock", clientID: 2, ttl: ttl},
+			{op: "lock", clientID: 1, exclusive: true, ttl: ttl, err: errLeaseConflict},
+			{op: "holds", clientID: 1, err: errLeaseNotHeld},
+		}},
+		{"downgrade", []step{
+			{op: "lock", clientID: 1, exclusive: true, ttl: ttl},
+			{op: "lock", clientID: 1, ttl: ttl},
+			{op: "lock", clientID: 2, ttl: ttl},
+		}},
+		{"expiry", []step{
+			{op: "lock", clientID: 1, exclusive: true, ttl: 10 * time.Millisecond},
+			{op: "holds", clientID: 1, sleep: 20 * time.Millisecond, err: errLeaseNotHeld},
+			{op: "renew", clientID: 1, ttl: ttl, err: errLeaseNotHeld},
+			{op: "lock", clientID: 2, exclusive: true, ttl: ttl},
+		}},
+		{"renewal", []step{
+			{op: "lock", clientID: 1, exclusive: true, ttl: 50 * time.Millisecond},
+			{op: "renew", clientID: 1, ttl: ttl, sleep: 30 * time.Millisecond},
+			{op: "lock", clientID: 2, ttl: ttl, sleep: 30 * time.Millisecond, err: errLeaseConflict},
+			{op: "renew", clientID: 2, ttl: ttl, err: errLeaseNotHeld},
+		}},
+		{"unlock", []step{
+			{op: "lock", clientID: 1, exclusive: true, ttl: ttl},
+			{op: "unlock", clientID: 2, err: errLeaseNotHeld},
+			{op: "unlock", clientID: 1},
+			{op: "unlock", clientID: 1, err: errLeaseNotHeld},
+			{op: "lock", clientID: 2, exclusive: true, ttl: ttl},
+		}},
+	}
+	for _, tt := range tests {
+		lt := &leaseTable{leases: make(map[string]*lease)}
+		for i, s := range tt.steps {
+			time.Sleep(s.sleep)
+			var err error
+			switch s.op {
+			case "lock":
+				err = lt.lock("disk0/a", s.clientID, s.exclusive, s.ttl)
+			case "renew":
+				err = lt.renew("disk0/a", s.clientID, s.ttl)
+			case "unlock":
+				err = lt.unlock("disk0/a", s.clientID)
+			case "holds":
+				if !lt.holdsExclusive("disk0/a", s.clientID) {
+					err = errLeaseNotHeld
+				}
+			}
+			if err != s.err {
+				t.Errorf("%s: #%d %s by %d: error = %v, want %v", tt.name, i, s.op, s.clientID, err, s.err)
+			}
+		}
+		// the leases of other files are apart
+		if err := lt.lock("disk0/b", 3, true, ttl); err != nil {
+			t.Errorf("%s: lock of another file error = %v", tt.name, err)
+		}
+	}
+}
+
+func TestLeaseTTL(t *testing.T) {
+	tests := []struct {
+		ms  int64
+		ttl time.Duration
+	}{
+		{0, defaultLeaseTTL},
+		{-1, defaultLeaseTTL},
+		{1500, 1500 * time.Millisecond},
+		{int64(time.Hour / time.Millisecond), maxLeaseTTL},
+	}
+	for _, tt := range tests {
+		if ttl := leaseTTL(tt.ms); ttl != tt.ttl {
+			t.Errorf("leaseTTL(%d) = %v, want %v", tt.ms, ttl, tt.ttl)
+		}
+	}
+}
+
+func TestLeaseExpiryStops(t *testing.T) {
+	lt := &leaseTable{leases: make(map[string]*lease), done: make(chan struct{})}
+	stopped := make(chan struct{})
+	go func() {
+		lt.expireEvery(time.Millisecond)
+		close(stopped)
+	}()
+	if err := lt.lock("disk0/a", 1, true, time.Millisecond); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	lt.mu.Lock()
+	left := len(lt.leases)
+	lt.mu.Unlock()
+	if left != 0 {
+		t.Errorf("%d leases left, want the expired one dropped", left)
+	}
+	lt.close()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Errorf("expiry still running after close")
+	}
+}
+
+func TestRequireLease(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	const holder, other = 1, 2
+
+	// leaseErr returns whether e is the error of a lease not held.
+	leaseErr := func(e *pb.Error) bool { return e != nil && e.LeaseErr != nil }
+	write := func(name string) {
+		reply, err := s.Write(ctx, &pb.WriteRequest{Header: &pb.RequestHeader{}, Name: name, Data: []byte("x")})
+		if err != nil || reply.Error != nil {
+			t.Fatalf("write %s error = %v, %v", name, err, reply.Error)
+		}
+	}
+	lock := func(name string) {
+		reply, err := s.Lock(ctx, &pb.LockRequest{Header: &pb.RequestHeader{ClientID: holder}, Name: name, Exclusive: true})
+		if err != nil || reply.Error != nil {
+			t.Fatalf("lock %s error = %v, %v", name, err, reply.Error)
+		}
+	}
+	write("disk0/a")
+	write("disk0/b")
+	lock("disk0/a")
+
+	tests := []struct {
+		name     string
+		clientID int64
+		// op makes the rpc and returns its error
+		op    func(h *pb.RequestHeader) *pb.Error
+		lease bool
+	}{
+		{"truncate by other", other, func(h *pb.RequestHeader) *pb.Error {
+			reply, _ := s.Truncate(ctx, &pb.TruncateRequest{Header: h, Name: "disk0/a", RequireLease: true})
+			return reply.Error
+		}, true},
+		{"truncate by holder", holder, func(h *pb.RequestHeader) *pb.Error {
+			reply, _ := s.Truncate(ctx, &pb.TruncateRequest{Header: h, Name: "disk0/a", Size: 2, RequireLease: true})
+			return reply.Error
+		}, false},
+		{"truncate of an unleased file", holder, func(h *pb.RequestHeader) *pb.Error {
+			reply, _ := s.Truncate(ctx, &pb.TruncateRequest{Header: h, Name: "disk0/b", RequireLease: true})
+			return reply.Error
+		}, true},
+		{"rename without a lease on newname", holder, func(h *pb.RequestHeader) *pb.Error {
+			reply, _ := s.Rename(ctx, &pb.RenameRequest{Header: h, Oldname: "disk0/a", Newname: "disk0/b", RequireLease: true})
+			return reply.Error
+		}, true},
+		{"rename without a lease on oldname", holder, func(h *pb.RequestHeader) *pb.Error {
+			reply, _ := s.Rename(ctx, &pb.RenameRequest{Header: h, Oldname: "disk0/b", Newname: "disk0/a", RequireLease: true})
+			return reply.Error
+		}, true},
+		{"batch remove by other", other, func(h *pb.RequestHeader) *pb.Error {
+			reply, _ := s.Batch(ctx, &pb.BatchRequest{Header: h, Ops: []*pb.Op{
+				{Remove: &pb.RemoveRequest{Header: h, Name: "disk0/a", RequireLease: true}},
+			}})
+			if len(reply.Results) == 0 || reply.Results[0].Remove == nil {
+				return nil
+			}
+			return reply.Results[0].Remove.Error
+		}, true},
+		{"remove by other", other, func(h *pb.RequestHeader) *pb.Error {
+			reply, _ := s.Remove(ctx, &pb.RemoveRequest{Header: h, Name: "disk0/a", RequireLease: true})
+			return reply.Error
+		}, true},
+		{"remove without a required lease", other, func(h *pb.RequestHeader) *pb.Error {
+			reply, _ := s.Remove(ctx, &pb.RemoveRequest{Header: h, Name: "disk0/b"})
+			return reply.Error
+		}, false},
+		{"remove by holder", holder, func(h *pb.RequestHeader) *pb.Error {
+			reply, _ := s.Remove(ctx, &pb.RemoveRequest{Header: h, Name: "disk0/a", RequireLease: true})
+			return reply.Error
+		}, false},
+	}
+	for _, tt := range tests {
+		e := tt.op(&pb.RequestHeader{ClientID: tt.clientID})
+		if leaseErr(e) != tt.lease || (!tt.lease && e != nil) {
+			t.Errorf("%s: error = %v, want lease error %v", tt.name, e, tt.lease)
+		}
+	}
+	size, err := s.Disk("disk0").Size("a")
+	if err == nil {
+		t.Errorf("disk0/a of size %d left, want it removed by its holder", size)
+	}
+
+	// a rename needs the leases of both names
+	write("disk0/a")
+	lock("disk0/b")
+	reply, _ := s.Rename(ctx, &pb.RenameRequest{
+		Header: &pb.RequestHeader{ClientID: holder}, Oldname: "disk0/a", Newname: "disk0/b", RequireLease: true,
+	})
+	if reply.Error != nil {
+		t.Errorf("rename by the holder of both leases error = %v", reply.Error)
+	}
+}
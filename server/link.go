@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/c-fs/cfs/enforce"
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/c-fs/cfs/stats"
+	"github.com/qiniu/log"
+	"golang.org/x/net/context"
+)
+
+// splitSameDisk splits two names that must be on the same disk.
+func splitSameDisk(name0, name1 string) (string, string, string, error) {
+	dn0, fn0, err := splitDiskAndFile(name0)
+	if err != nil {
+		return "", "", "", err
+	}
+	dn1, fn1, err := splitDiskAndFile(name1)
+	if err != nil {
+		return "", "", "", err
+	}
+	if dn0 != dn1 {
+		return "", "", "", fmt.Errorf("not same disk: %s, %s", name0, name1)
+	}
+	return dn0, fn0, fn1, nil
+}
+
+func (s *server) Link(ctx context.Context, req *pb.LinkRequest) (*pb.LinkReply, error) {
+	reply := &pb.LinkReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, ofn, nfn, err := splitSameDisk(req.Oldname, req.Newname)
+	if err != nil {
+		log.Infof("server: link error (%v)", err)
+		return reply, nil
+	}
+	d := s.Disk(dn)
+	if d == nil {
+		log.Infof("server: link error (cannot find disk %s)", dn)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "link").Client(req.Header.ClientID).Add()
+	if err := d.Link(ofn, nfn); err != nil {
+		log.Infof("server: link error (%v)", err)
+		reply.Error = pbError("link", req.Newname, err)
+		return reply, nil
+	}
+	s.notify(pb.WatchEvent_CREATE, dn+"/"+nfn, "", false)
+	return reply, nil
+}
+
+func (s *server) Symlink(ctx context.Context, req *pb.SymlinkRequest) (*pb.SymlinkReply, error) {
+	reply := &pb.SymlinkReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, tfn, fn, err := splitSameDisk(req.Target, req.Name)
+	if err != nil {
+		log.Infof("server: symlink error (%v)", err)
+		return reply, nil
+	}
+	d := s.Disk(dn)
+	if d == nil {
+		log.Infof("server: symlink error (cannot find disk %s)", dn)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "symlink").Client(req.Header.ClientID).Add()
+	if err := d.Symlink(tfn, fn); err != nil {
+		log.Infof("server: symlink error (%v)", err)
+		reply.Error = pbError("symlink", req.Name, err)
+		return reply, nil
+	}
+	s.notify(pb.WatchEvent_CREATE, dn+"/"+fn, "", false)
+	return reply, nil
+}
+
+func (s *server) Clone(ctx context.Context, req *pb.CloneRequest) (*pb.CloneReply, error) {
+	reply := &pb.CloneReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, sfn, dfn, err := splitSameDisk(req.Src, req.Dst)
+	if err != nil {
+		log.Infof("server: clone error (%v)", err)
+		return reply, nil
+	}
+	d := s.Disk(dn)
+	if d == nil {
+		log.Infof("server: clone error (cannot find disk %s)", dn)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "clone").Client(req.Header.ClientID).Add()
+	if err := d.Clone(sfn, dfn); err != nil {
+		log.Infof("server: clone error (%v)", err)
+		reply.Error = pbError("clone", req.Dst, err)
+		return reply, nil
+	}
+	s.notify(pb.WatchEvent_CREATE, dn+"/"+dfn, "", false)
+	return reply, nil
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/c-fs/cfs/disk"
 	"github.com/c-fs/cfs/enforce"
 	pb "github.com/c-fs/cfs/proto"
 	"github.com/c-fs/cfs/server/config"
@@ -53,16 +54,27 @@ func main() {
 
 	log.Infof("server: listening on %s", net.JoinHostPort(conf.Bind, conf.Port))
 
-	cfs := NewServer()
+	var cache *disk.Cache
+	if conf.CacheSize > 0 {
+		cache = disk.NewCache(conf.CacheSize)
+		registerCacheStats(cache)
+		log.Infof("server: block cache enabled with %d bytes", conf.CacheSize)
+	}
+	var keyring *disk.Keyring
+	if conf.KeyFile != "" {
+		keyring, err = disk.LoadKeyring(conf.KeyFile)
+		if err != nil {
+			log.Fatalf("server: cannot load key file[%s] (%v)", conf.KeyFile, err)
+		}
+	}
+	cfs := NewServer(cache, keyring, conf.Inotify)
 
 	for i, d := range conf.Disks {
-		name := d.Name
-		if name == "" {
-			name = strconv.FormatInt(rand.Int63(), 16)
+		if d.Name == "" {
 			// assign name back to conf, so metadataServer could export correct disk info
-			conf.Disks[i].Name = name
+			conf.Disks[i].Name = strconv.FormatInt(rand.Int63(), 16)
 		}
-		err = cfs.AddDisk(name, d.Root)
+		err = cfs.AddDisk(conf.Disks[i])
 		if err != nil {
 			log.Fatalf("server: failed to add disk (%v)", err)
 		}
@@ -75,9 +87,86 @@ func main() {
 	stats.Report(nil, 3*time.Second)
 
 	s := grpc.NewServer()
+	metadata := &metadataServer{disks: conf.Disks, cfs: cfs, keyFile: conf.KeyFile}
 	pb.RegisterCfsServer(s, cfs)
-	pb.RegisterMetadataServer(s, &metadataServer{disks: conf.Disks})
+	pb.RegisterMetadataServer(s, metadata)
 	pb.RegisterStatsServer(s, stats.Server())
+
+	if conf.AdminPort != "" {
+		bind := conf.AdminBind
+		if bind == "" {
+			bind = "127.0.0.1"
+		}
+		addr := net.JoinHostPort(bind, conf.AdminPort)
+		alis, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("server: failed to listen: %v", err)
+		}
+		log.Infof("server: serving admin on %s", addr)
+		as := grpc.NewServer()
+		pb.RegisterCfsServer(as, cfs)
+		pb.RegisterMetadataServer(as, &metadataServer{disks: conf.Disks, cfs: cfs, keyFile: conf.KeyFile, admin: true})
+		pb.RegisterStatsServer(as, stats.Server())
+		go func() {
+			err := as.Serve(alis)
+			log.Fatalf("server: admin listener stopped (%v)", err)
+		}()
+	}
+
+	if conf.HTTPPort != "" {
+		addr := net.JoinHostPort(conf.Bind, conf.HTTPPort)
+		hlis, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("server: failed to listen: %v", err)
+		}
+		log.Infof("server: serving http on %s", addr)
+		go func() {
+			err := newHTTPServer(newHTTPGateway(cfs, metadata, stats.Server())).Serve(hlis)
+			log.Fatalf("server: http gateway stopped (%v)", err)
+		}()
+	}
+	if conf.S3Port != "" {
+		if cfs.Disk(conf.S3Disk) == nil {
+			log.Fatalf("server: cannot find s3 disk %q", conf.S3Disk)
+		}
+		addr := net.JoinHostPort(conf.Bind, conf.S3Port)
+		slis, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("server: failed to listen: %v", err)
+		}
+		log.Infof("server: serving s3 on %s", addr)
+		go func() {
+			err := newHTTPServer(newS3Gateway(cfs, conf.S3Disk, conf.S3ClientIDs)).Serve(slis)
+			log.Fatalf("server: s3 gateway stopped (%v)", err)
+		}()
+	}
 	log.Infof("server: ready to serve clients")
 	s.Serve(lis)
 }
+
+// registerCompressionStats reports how well the blocks of a disk compress.
+func registerCompressionStats(d *disk.Disk) {
+	stats.GaugeFunc(d.Name+"_compress_raw_bytes", func() int64 { return int64(d.CompressionStats().Raw) })
+	stats.GaugeFunc(d.Name+"_compress_stored_bytes", func() int64 { return int64(d.CompressionStats().Stored) })
+	stats.GaugeFunc(d.Name+"_compress_ratio_percent", func() int64 {
+		s := d.CompressionStats()
+		if s.Raw == 0 {
+			return 0
+		}
+		return int64(s.Stored * 100 / s.Raw)
+	})
+}
+
+func registerCacheStats(c *disk.Cache) {
+	stats.GaugeFunc("cache_hits", func() int64 { return int64(c.Stats().Hits) })
+	stats.GaugeFunc("cache_misses", func() int64 { return int64(c.Stats().Misses) })
+	stats.GaugeFunc("cache_evictions", func() int64 { return int64(c.Stats().Evictions) })
+	stats.GaugeFunc("cache_bytes", func() int64 { return c.Stats().Size })
+	stats.GaugeFunc("cache_hit_rate_percent", func() int64 {
+		s := c.Stats()
+		if s.Hits+s.Misses == 0 {
+			return 0
+		}
+		return int64(s.Hits * 100 / (s.Hits + s.Misses))
+	})
+}
@@ -1,13 +1,23 @@
 package main
 
 import (
+	"errors"
+
+	"github.com/c-fs/cfs/disk"
 	pb "github.com/c-fs/cfs/proto"
 	"github.com/c-fs/cfs/server/config"
+	"github.com/qiniu/log"
 	"golang.org/x/net/context"
 )
 
 type metadataServer struct {
 	disks []config.Disk
+	cfs   *server
+	// keyFile is reloaded on every key rotation.
+	keyFile string
+	// admin is set on the metadata service of the admin listener, the
+	// only one to rotate keys.
+	admin bool
 }
 
 func (s *metadataServer) Disks(ctx context.Context, req *pb.DisksRequest) (*pb.DisksReply, error) {
@@ -17,3 +27,29 @@ func (s *metadataServer) Disks(ctx context.Context, req *pb.DisksRequest) (*pb.D
 	}
 	return &pb.DisksReply{Disks: disks}, nil
 }
+
+func (s *metadataServer) RotateKeys(ctx context.Context, req *pb.RotateKeysRequest) (*pb.RotateKeysReply, error) {
+	var clientID int64
+	if req.Header != nil {
+		clientID = req.Header.ClientID
+	}
+	if !s.admin {
+		log.Infof("server: rotate keys denied to client %d (not on the admin listener)", clientID)
+		return nil, errors.New("server: keys are only rotated through the admin listener")
+	}
+	if s.keyFile == "" {
+		return nil, errors.New("server: no key file configured")
+	}
+	r, err := disk.LoadKeyring(s.keyFile)
+	if err != nil {
+		log.Infof("server: rotate keys error (%v)", err)
+		return nil, err
+	}
+	rotated, err := s.cfs.RotateKeys(r)
+	if err != nil {
+		log.Infof("server: rotate keys error (%v)", err)
+		return nil, err
+	}
+	log.Infof("server: rotated keys of disks %v", rotated)
+	return &pb.RotateKeysReply{Disks: rotated}, nil
+}
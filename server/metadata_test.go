@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	pb "github.com/c-fs/cfs/proto"
+	"golang.org/x/net/context"
+)
+
+func TestRotateKeysAdminOnly(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		admin bool
+		// err is part of the error wanted
+		err string
+	}{
+		// whatever the client ID, the rpc is denied but on the admin listener
+		{false, "admin listener"},
+		{true, "no key file"},
+	}
+	for _, tt := range tests {
+		m := &metadataServer{cfs: s, admin: tt.admin}
+		_, err := m.RotateKeys(context.Background(), &pb.RotateKeysRequest{Header: &pb.RequestHeader{ClientID: 0x1234}})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("admin %v: error = %v, want %q", tt.admin, err, tt.err)
+		}
+	}
+}
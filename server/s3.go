@@ -0,0 +1,594 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c-fs/cfs/enforce"
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/qiniu/log"
+	"golang.org/x/net/context"
+)
+
+// s3Namespace is the XML namespace of the replies of the S3 API.
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// s3UploadDir is the directory of the disk holding the objects being
+// uploaded. It is never a bucket, as bucket names do not start with a dot.
+const s3UploadDir = ".s3uploads"
+
+// s3TimeFormat is the format of the times of the replies of the S3 API.
+const s3TimeFormat = "2006-01-02T15:04:05.000Z"
+
+var bucketNameRE = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// s3Gateway serves the files of a disk through an S3 compatible API, so
+// that tools speaking S3 can use cfs. Buckets are the top level
+// directories of the disk and objects are the files under them, named by
+// their path in the bucket. Requests are path style, such as
+// /bucket/dir/file, and go through the same handlers as grpc.
+//
+// Requests are not authenticated. If clientIDs is set, the access key ID of
+// a request, if it is a decimal number, is its client ID, whose quota is
+// enforced. Otherwise requests use client ID 0.
+//
+// The ETag of an object is made of the CRC32C of its data and its size.
+// The CRC32C is combined from the checksums stored with the blocks of the
+// object where the disk allows, but it still reads the whole object, so
+// listings take the ETags of the objects of a page with a single batch.
+type s3Gateway struct {
+	cfs       *server
+	disk      string
+	clientIDs bool
+}
+
+func newS3Gateway(cfs *server, disk string, clientIDs bool) http.Handler {
+	return &s3Gateway{cfs: cfs, disk: disk, clientIDs: clientIDs}
+}
+
+// s3Error is an error reply of the S3 API.
+type s3Error struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e *s3Error) Error() string { return e.code + ": " + e.msg }
+
+var (
+	errNoSuchBucket      = &s3Error{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist."}
+	errNoSuchKey         = &s3Error{http.StatusNotFound, "NoSuchKey", "The specified key does not exist."}
+	errNoSuchUpload      = &s3Error{http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist."}
+	errBucketNotEmpty    = &s3Error{http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty."}
+	errInvalidBucketName = &s3Error{http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid."}
+	errInvalidKey        = &s3Error{http.StatusBadRequest, "InvalidArgument", "The key cannot be the name of a cfs file."}
+	errBadDigest         = &s3Error{http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received."}
+	errIncompleteBody    = &s3Error{http.StatusBadRequest, "IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header."}
+	errS3NotImplemented  = &s3Error{http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented."}
+	errS3Failed          = &s3Error{http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again."}
+)
+
+// s3ErrorOf converts err to an s3Error.
+func s3ErrorOf(err error) *s3Error {
+	switch e := err.(type) {
+	case *s3Error:
+		return e
+	case *errHTTP:
+		switch e.code {
+		case http.StatusBadRequest:
+			return &s3Error{e.code, "InvalidRequest", e.msg}
+		case http.StatusNotFound:
+			return errNoSuchKey
+		case http.StatusPreconditionFailed:
+			return &s3Error{e.code, "PreconditionFailed", e.msg}
+		case http.StatusConflict:
+			return &s3Error{e.code, "OperationAborted", e.msg}
+		}
+	}
+	return errS3Failed
+}
+
+type s3ErrorReply struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string
+	Message  string
+	Resource string
+}
+
+func replyS3Error(w http.ResponseWriter, r *http.Request, err error) {
+	e := s3ErrorOf(err)
+	if r.Method == "HEAD" {
+		w.WriteHeader(e.status)
+		return
+	}
+	replyXML(w, e.status, &s3ErrorReply{Code: e.code, Message: e.msg, Resource: r.URL.Path})
+}
+
+func replyXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		log.Infof("server: s3 reply error (%v)", err)
+	}
+}
+
+// header returns the request header of the rpcs made for r, checking the
+// quota of its client.
+func (g *s3Gateway) header(r *http.Request) (*pb.RequestHeader, error) {
+	var id int64
+	if g.clientIDs {
+		id = accessKeyClientID(r)
+	}
+	if !enforce.HasQuota(id) {
+		log.Infof("server: out of quota for client %d", id)
+		return nil, &s3Error{http.StatusServiceUnavailable, "SlowDown", "Please reduce your request rate."}
+	}
+	return &pb.RequestHeader{ClientID: id}, nil
+}
+
+// accessKeyClientID returns the access key ID of r as a client ID, or 0
+// if it is not a decimal number.
+func accessKeyClientID(r *http.Request) int64 {
+	var key string
+	auth := r.Header.Get("Authorization")
+	if i := strings.Index(auth, "Credential="); i >= 0 {
+		// AWS4-HMAC-SHA256 Credential=<key>/<scope>, ...
+		key = auth[i+len("Credential="):]
+		if j := strings.IndexAny(key, "/,"); j >= 0 {
+			key = key[:j]
+		}
+	} else if strings.HasPrefix(auth, "AWS ") {
+		// AWS <key>:<signature>
+		key = strings.TrimPrefix(auth, "AWS ")
+		if j := strings.IndexByte(key, ':'); j >= 0 {
+			key = key[:j]
+		}
+	}
+	id, _ := strconv.ParseInt(key, 10, 64)
+	return id
+}
+
+func (g *s3Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket := strings.TrimPrefix(r.URL.Path, "/")
+	var key string
+	if i := strings.IndexByte(bucket, '/'); i >= 0 {
+		bucket, key = bucket[:i], bucket[i+1:]
+	}
+	h, err := g.header(r)
+	if err == nil {
+		switch {
+		case bucket == "":
+			err = g.serveService(w, r, h)
+		case !bucketNameRE.MatchString(bucket):
+			err = errInvalidBucketName
+		case key == "":
+			err = g.serveBucket(w, r, h, bucket)
+		default:
+			err = g.serveObject(w, r, h, bucket, key)
+		}
+	}
+	if err != nil {
+		log.Infof("server: s3 %s %s error (%v)", r.Method, r.URL.Path, err)
+		replyS3Error(w, r, err)
+	}
+}
+
+// name returns the cfs name of the named file of the disk.
+func (g *s3Gateway) name(elem ...string) string {
+	return path.Join(append([]string{g.disk}, elem...)...)
+}
+
+// stat returns the info of the named file of the disk, or nil if it does
+// not exist.
+func (g *s3Gateway) stat(ctx context.Context, h *pb.RequestHeader, name string) (*pb.FileInfo, error) {
+	reply, err := g.cfs.Stat(ctx, &pb.StatRequest{Header: h, Name: g.name(name)})
+	if err != nil {
+		return nil, err
+	}
+	if err := httpError(reply.Error); err != nil {
+		return nil, err
+	}
+	return reply.Info, nil
+}
+
+// checkBucket checks that the bucket exists.
+func (g *s3Gateway) checkBucket(ctx context.Context, h *pb.RequestHeader, bucket string) error {
+	fi, err := g.stat(ctx, h, bucket)
+	if err != nil {
+		return err
+	}
+	if fi == nil || !fi.IsDir {
+		return errNoSuchBucket
+	}
+	return nil
+}
+
+// etag returns the ETag of the named file of the disk.
+func (g *s3Gateway) etag(ctx context.Context, h *pb.RequestHeader, name string) (string, error) {
+	reply, err := g.cfs.Checksum(ctx, &pb.ChecksumRequest{Header: h, Name: g.name(name), Length: -1})
+	if err != nil {
+		return "", err
+	}
+	if err := httpError(reply.Error); err != nil {
+		return "", err
+	}
+	return etag(reply.Checksum, reply.Length), nil
+}
+
+// etag returns the ETag of data of size bytes whose CRC32C is crc.
+func etag(crc uint32, size int64) string {
+	return fmt.Sprintf(`"%08x-%d"`, crc, size)
+}
+
+// mkdir makes the named directory of the disk and its parents.
+func (g *s3Gateway) mkdir(ctx context.Context, h *pb.RequestHeader, name string) error {
+	reply, err := g.cfs.Mkdir(ctx, &pb.MkdirRequest{Header: h, Name: g.name(name), All: true})
+	if err != nil {
+		return err
+	}
+	return httpError(reply.Error)
+}
+
+// remove removes the named file of the disk, with everything under it if
+// all is set.
+func (g *s3Gateway) remove(ctx context.Context, h *pb.RequestHeader, name string, all bool) error {
+	reply, err := g.cfs.Remove(ctx, &pb.RemoveRequest{Header: h, Name: g.name(name), All: all})
+	if err != nil {
+		return err
+	}
+	return httpError(reply.Error)
+}
+
+// validKey reports whether key can be the name of a file in a bucket.
+func validKey(key string) bool {
+	return key == path.Clean(key) && key != ".." && !strings.HasPrefix(key, "../") && !strings.HasPrefix(key, "/")
+}
+
+// newID returns a random hex identifier.
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+type s3Owner struct {
+	ID          string
+	DisplayName string
+}
+
+type s3Bucket struct {
+	Name         string
+	CreationDate string
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Owner   s3Owner    `xml:"Owner"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+// serveService serves the requests on no bucket, listing the buckets.
+func (g *s3Gateway) serveService(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader) error {
+	if r.Method != "GET" {
+		return &s3Error{http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource."}
+	}
+	reply, err := g.cfs.ReadDir(r.Context(), &pb.ReadDirRequest{Header: h, Name: g.disk, PageSize: maxReadDirPageSize})
+	if err != nil {
+		return err
+	}
+	if err := httpError(reply.Error); err != nil {
+		return err
+	}
+	result := &listAllMyBucketsResult{Xmlns: s3Namespace, Owner: s3Owner{ID: "cfs", DisplayName: "cfs"}}
+	for _, fi := range reply.FileInfos {
+		if fi.IsDir && bucketNameRE.MatchString(fi.Name) {
+			result.Buckets = append(result.Buckets, s3Bucket{
+				Name:         fi.Name,
+				CreationDate: time.Unix(0, fi.ModTime).UTC().Format(s3TimeFormat),
+			})
+		}
+	}
+	replyXML(w, http.StatusOK, result)
+	return nil
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+}
+
+// serveBucket serves the requests on a bucket.
+func (g *s3Gateway) serveBucket(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, bucket string) error {
+	ctx := r.Context()
+	q := r.URL.Query()
+	switch r.Method {
+	case "GET":
+		if err := g.checkBucket(ctx, h, bucket); err != nil {
+			return err
+		}
+		if _, ok := q["location"]; ok {
+			replyXML(w, http.StatusOK, &locationConstraint{Xmlns: s3Namespace})
+			return nil
+		}
+		return g.listObjects(w, r, h, bucket)
+	case "HEAD":
+		if err := g.checkBucket(ctx, h, bucket); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusOK)
+		return nil
+	case "PUT":
+		if len(q) > 0 {
+			return errS3NotImplemented
+		}
+		// creating a bucket that exists succeeds, as it is ours
+		if err := g.mkdir(ctx, h, bucket); err != nil {
+			return err
+		}
+		w.Header().Set("Location", "/"+bucket)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	case "DELETE":
+		if len(q) > 0 {
+			return errS3NotImplemented
+		}
+		if err := g.checkBucket(ctx, h, bucket); err != nil {
+			return err
+		}
+		keys, err := g.listKeys(ctx, h, bucket, "")
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			return errBucketNotEmpty
+		}
+		if err := g.remove(ctx, h, bucket, true); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return errS3NotImplemented
+}
+
+// serveObject serves the requests on an object.
+func (g *s3Gateway) serveObject(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, bucket, key string) error {
+	q := r.URL.Query()
+	// keys ending with a slash are directories, made by PutObject
+	dir := strings.HasSuffix(key, "/")
+	if !validKey(strings.TrimSuffix(key, "/")) {
+		return errInvalidKey
+	}
+	_, upload := q["uploadId"]
+	switch r.Method {
+	case "GET", "HEAD":
+		if len(q) > 0 || dir {
+			return errS3NotImplemented
+		}
+		return g.getObject(w, r, h, bucket, key)
+	case "PUT":
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			return errS3NotImplemented
+		}
+		if upload {
+			return g.uploadPart(w, r, h, bucket, key)
+		}
+		if len(q) > 0 {
+			return errS3NotImplemented
+		}
+		return g.putObject(w, r, h, bucket, key)
+	case "POST":
+		if _, ok := q["uploads"]; ok && !dir {
+			return g.createUpload(w, r, h, bucket, key)
+		}
+		if upload && !dir {
+			return g.completeUpload(w, r, h, bucket, key)
+		}
+	case "DELETE":
+		if upload {
+			return g.abortUpload(w, r, h, bucket, key)
+		}
+		if len(q) > 0 {
+			return errS3NotImplemented
+		}
+		return g.deleteObject(w, r, h, bucket, key)
+	}
+	return errS3NotImplemented
+}
+
+func (g *s3Gateway) getObject(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, bucket, key string) error {
+	ctx := r.Context()
+	name := path.Join(bucket, key)
+	fi, err := g.stat(ctx, h, name)
+	if err != nil {
+		return err
+	}
+	if fi == nil || fi.IsDir || fi.Symlink != "" {
+		if err := g.checkBucket(ctx, h, bucket); err != nil {
+			return err
+		}
+		return errNoSuchKey
+	}
+	etag, err := g.etag(ctx, h, name)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	f := &httpFile{s: g.cfs, ctx: ctx, h: h, name: g.name(name), size: fi.Size}
+	http.ServeContent(w, r, "", time.Unix(0, fi.ModTime), f)
+	return nil
+}
+
+func (g *s3Gateway) putObject(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, bucket, key string) error {
+	ctx := r.Context()
+	if err := g.checkBucket(ctx, h, bucket); err != nil {
+		return err
+	}
+	if strings.HasSuffix(key, "/") {
+		if err := g.mkdir(ctx, h, path.Join(bucket, key)); err != nil {
+			return err
+		}
+		w.Header().Set("ETag", etag(0, 0))
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	if err := g.mkdir(ctx, h, s3UploadDir); err != nil {
+		return err
+	}
+	tmp := path.Join(s3UploadDir, "put-"+newID())
+	if err := g.store(ctx, h, tmp, r); err != nil {
+		g.remove(ctx, h, tmp, false)
+		return err
+	}
+	etag, err := g.commit(ctx, h, tmp, path.Join(bucket, key))
+	if err != nil {
+		g.remove(ctx, h, tmp, false)
+		return err
+	}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// store stores the body of r in the named file of the disk, checking it
+// against the length and MD5 sent with it.
+func (g *s3Gateway) store(ctx context.Context, h *pb.RequestHeader, name string, r *http.Request) error {
+	reply, err := g.cfs.Truncate(ctx, &pb.TruncateRequest{Header: h, Name: g.name(name)})
+	if err != nil {
+		return err
+	}
+	if err := httpError(reply.Error); err != nil {
+		return err
+	}
+
+	body, length := io.Reader(r.Body), r.ContentLength
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body = &chunkedReader{r: bufio.NewReader(r.Body)}
+		length, err = strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil {
+			length = -1
+		}
+	}
+	sum := md5.New()
+	n, err := writeFrom(ctx, g.cfs, h, g.name(name), 0, io.TeeReader(body, sum))
+	if err != nil {
+		return err
+	}
+	if length >= 0 && n != length {
+		return errIncompleteBody
+	}
+	if want := r.Header.Get("Content-MD5"); want != "" && want != base64.StdEncoding.EncodeToString(sum.Sum(nil)) {
+		return errBadDigest
+	}
+	return nil
+}
+
+// commit moves the file tmp of the disk to the object key of the bucket,
+// which is named name, and returns its ETag.
+func (g *s3Gateway) commit(ctx context.Context, h *pb.RequestHeader, tmp, name string) (string, error) {
+	if err := g.mkdir(ctx, h, path.Dir(name)); err != nil {
+		return "", err
+	}
+	reply, err := g.cfs.Rename(ctx, &pb.RenameRequest{Header: h, Oldname: g.name(tmp), Newname: g.name(name)})
+	if err != nil {
+		return "", err
+	}
+	if err := httpError(reply.Error); err != nil {
+		return "", err
+	}
+	return g.etag(ctx, h, name)
+}
+
+func (g *s3Gateway) deleteObject(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, bucket, key string) error {
+	ctx := r.Context()
+	if err := g.checkBucket(ctx, h, bucket); err != nil {
+		return err
+	}
+	name := path.Join(bucket, key)
+	fi, err := g.stat(ctx, h, name)
+	if err != nil {
+		return err
+	}
+	// deleting a missing object succeeds
+	switch {
+	case fi == nil:
+	case !fi.IsDir:
+		if err := g.remove(ctx, h, name, false); err != nil {
+			return err
+		}
+	case strings.HasSuffix(key, "/"):
+		// a directory still holding objects stays as their prefix
+		g.remove(ctx, h, name, false)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// chunkedReader decodes a body sent with the aws-chunked content encoding,
+// whose chunks are each preceded by their hex size and signature.
+type chunkedReader struct {
+	r *bufio.Reader
+	// n is the number of bytes left in the chunk.
+	n    int64
+	done bool
+}
+
+var errBadChunk = errors.New("bad aws-chunked encoding")
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.n == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return 0, errBadChunk
+		}
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+		if err != nil || n < 0 {
+			return 0, errBadChunk
+		}
+		if n == 0 {
+			c.done = true
+			return 0, io.EOF
+		}
+		c.n = n
+	}
+	if int64(len(p)) > c.n {
+		p = p[:c.n]
+	}
+	n, err := c.r.Read(p)
+	c.n -= int64(n)
+	if c.n == 0 && err == nil {
+		// each chunk ends with CRLF
+		if _, err := c.r.Discard(2); err != nil {
+			return n, errBadChunk
+		}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/qiniu/log"
+	"golang.org/x/net/context"
+)
+
+// maxS3Keys is the largest number of keys of a page of ListObjects.
+const maxS3Keys = 1000
+
+// s3ListParams are the query parameters ListObjects and ListObjectsV2
+// take. Others are refused.
+var s3ListParams = map[string]bool{
+	"list-type":          true,
+	"prefix":             true,
+	"delimiter":          true,
+	"max-keys":           true,
+	"marker":             true,
+	"continuation-token": true,
+	"start-after":        true,
+	"encoding-type":      true,
+	"fetch-owner":        true,
+}
+
+type s3Object struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type s3Prefix struct {
+	Prefix string
+}
+
+type listBucketResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Xmlns       string   `xml:"xmlns,attr"`
+	Name        string
+	Prefix      string
+	Delimiter   string `xml:",omitempty"`
+	MaxKeys     int
+	IsTruncated bool
+	// ListObjects
+	Marker     string `xml:",omitempty"`
+	NextMarker string `xml:",omitempty"`
+	// ListObjectsV2
+	KeyCount              int    `xml:",omitempty"`
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	StartAfter            string `xml:",omitempty"`
+
+	Contents       []s3Object
+	CommonPrefixes []s3Prefix
+}
+
+// listObjects serves ListObjects and ListObjectsV2. Keys are listed in
+// byte order, which is not the order of the listings of the disk, so every
+// page reads all the keys with the prefix.
+func (g *s3Gateway) listObjects(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, bucket string) error {
+	ctx := r.Context()
+	q := r.URL.Query()
+	for p := range q {
+		if !s3ListParams[p] {
+			return errS3NotImplemented
+		}
+	}
+	v2 := q.Get("list-type") == "2"
+	prefix, delim := q.Get("prefix"), q.Get("delimiter")
+	maxKeys := maxS3Keys
+	if s := q.Get("max-keys"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return &s3Error{http.StatusBadRequest, "InvalidArgument", "Invalid max-keys."}
+		}
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+
+	result := &listBucketResult{
+		Xmlns:     s3Namespace,
+		Name:      bucket,
+		Prefix:    prefix,
+		Delimiter: delim,
+		MaxKeys:   maxKeys,
+	}
+	// Keys up to after were listed by previous pages. A common prefix
+	// stands for all the keys starting with it: "\xff" sorts after
+	// them, as it is in no UTF-8 string.
+	var after string
+	if v2 {
+		result.StartAfter = q.Get("start-after")
+		after = result.StartAfter
+		if token := q.Get("continuation-token"); token != "" {
+			b, err := base64.URLEncoding.DecodeString(token)
+			if err != nil {
+				return &s3Error{http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect."}
+			}
+			result.ContinuationToken = token
+			after = string(b)
+		}
+	} else {
+		result.Marker = q.Get("marker")
+		after = result.Marker
+		if delim != "" && strings.HasSuffix(after, delim) {
+			after += "\xff"
+		}
+	}
+
+	keys, err := g.listKeys(ctx, h, bucket, prefix)
+	if err != nil {
+		return err
+	}
+	var last, lastPrefix string
+	for _, fi := range keys {
+		key := fi.Name
+		if key <= after {
+			continue
+		}
+		cp := ""
+		if delim != "" {
+			if i := strings.Index(key[len(prefix):], delim); i >= 0 {
+				cp = key[:len(prefix)+i+len(delim)]
+			}
+		}
+		if cp != "" && cp == lastPrefix {
+			continue
+		}
+		if len(result.Contents)+len(result.CommonPrefixes) == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		if cp != "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3Prefix{Prefix: cp})
+			last, lastPrefix = cp+"\xff", cp
+			continue
+		}
+		result.Contents = append(result.Contents, s3Object{
+			Key:          key,
+			LastModified: time.Unix(0, fi.ModTime).UTC().Format(s3TimeFormat),
+			Size:         fi.Size,
+			StorageClass: "STANDARD",
+		})
+		last = key
+	}
+	if result.Contents, err = g.setETags(ctx, h, bucket, result.Contents); err != nil {
+		return err
+	}
+	if result.IsTruncated {
+		if v2 {
+			result.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(last))
+		} else {
+			result.NextMarker = strings.TrimSuffix(last, "\xff")
+		}
+	}
+	if v2 {
+		result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+	}
+	replyXML(w, http.StatusOK, result)
+	return nil
+}
+
+// setETags sets the ETags of the objects of the bucket with a single batch
+// of checksums. Objects whose checksum cannot be taken, such as objects
+// removed since they were listed, are left out.
+func (g *s3Gateway) setETags(ctx context.Context, h *pb.RequestHeader, bucket string, objects []s3Object) ([]s3Object, error) {
+	if len(objects) == 0 {
+		return objects, nil
+	}
+	ops := make([]*pb.Op, len(objects))
+	for i, o := range objects {
+		ops[i] = &pb.Op{Checksum: &pb.ChecksumRequest{Header: h, Name: g.name(path.Join(bucket, o.Key)), Length: -1}}
+	}
+	reply, err := g.cfs.Batch(ctx, &pb.BatchRequest{Header: h, Ops: ops})
+	if err != nil {
+		return nil, err
+	}
+	if err := httpError(reply.Error); err != nil {
+		return nil, err
+	}
+	if len(reply.Results) != len(ops) {
+		// the batch was refused, for quota
+		return nil, errS3Failed
+	}
+	kept := objects[:0]
+	for i, o := range objects {
+		sum := reply.Results[i].Checksum
+		if sum == nil || sum.Error != nil {
+			log.Infof("server: s3 etag of %s/%s error (%v)", bucket, o.Key, sum.GetError())
+			continue
+		}
+		o.ETag, o.Size = etag(sum.Checksum, sum.Length), sum.Length
+		kept = append(kept, o)
+	}
+	return kept, nil
+}
+
+// listKeys returns the infos of the objects of the bucket whose key starts
+// with prefix, named by their key and sorted by it.
+func (g *s3Gateway) listKeys(ctx context.Context, h *pb.RequestHeader, bucket, prefix string) ([]*pb.FileInfo, error) {
+	var keys []*pb.FileInfo
+	req := &pb.ReadDirRequest{
+		Header:    h,
+		Name:      g.name(bucket),
+		PageSize:  maxReadDirPageSize,
+		Prefix:    prefix,
+		Recursive: true,
+	}
+	for {
+		reply, err := g.cfs.ReadDir(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if err := httpError(reply.Error); err != nil {
+			return nil, err
+		}
+		for _, fi := range reply.FileInfos {
+			if !fi.IsDir && fi.Symlink == "" {
+				keys = append(keys, fi)
+			}
+		}
+		if reply.NextPageToken == "" {
+			break
+		}
+		req.PageToken = reply.NextPageToken
+	}
+	sort.Sort(infosByName(keys))
+	return keys, nil
+}
+
+type infosByName []*pb.FileInfo
+
+func (s infosByName) Len() int           { return len(s) }
+func (s infosByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s infosByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	pb "github.com/c-fs/cfs/proto"
+	"golang.org/x/net/context"
+)
+
+// Multipart uploads are directories of s3UploadDir named by the upload ID.
+// They hold the bucket and key of the object in uploadKeyFile and a file
+// per part, which are joined into the object on completion. Uploads are
+// kept until they are completed or aborted.
+
+// uploadKeyFile is the file of an upload directory holding the name of
+// the object in its bucket.
+const uploadKeyFile = "key"
+
+// maxPartNumber is the largest part number of a multipart upload.
+const maxPartNumber = 10000
+
+// maxCompleteBody bounds the size of the body of CompleteMultipartUpload.
+const maxCompleteBody = 1 << 20
+
+var errInvalidPart = &s3Error{http.StatusBadRequest, "InvalidPart",
+	"One or more of the specified parts could not be found or did not match."}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+// partName returns the name of the file of part n of an upload.
+func partName(id string, n int) string {
+	return path.Join(s3UploadDir, id, fmt.Sprintf("part-%05d", n))
+}
+
+func (g *s3Gateway) createUpload(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, bucket, key string) error {
+	ctx := r.Context()
+	if err := g.checkBucket(ctx, h, bucket); err != nil {
+		return err
+	}
+	id := newID()
+	dir := path.Join(s3UploadDir, id)
+	if err := g.mkdir(ctx, h, dir); err != nil {
+		return err
+	}
+	object := path.Join(bucket, key)
+	n, err := writeFrom(ctx, g.cfs, h, g.name(dir, uploadKeyFile), 0, strings.NewReader(object))
+	if err != nil {
+		return err
+	}
+	if n != int64(len(object)) {
+		return errS3Failed
+	}
+	replyXML(w, http.StatusOK, &initiateMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Bucket:   bucket,
+		Key:      key,
+		UploadId: id,
+	})
+	return nil
+}
+
+// checkUpload checks that the upload of the request exists and is one of
+// the object key of the bucket, and returns its ID.
+func (g *s3Gateway) checkUpload(ctx context.Context, h *pb.RequestHeader, r *http.Request, bucket, key string,
+) (string, error) {
+	id := r.URL.Query().Get("uploadId")
+	if b, err := hex.DecodeString(id); err != nil || len(b) != 16 {
+		return "", errNoSuchUpload
+	}
+	name := path.Join(s3UploadDir, id, uploadKeyFile)
+	fi, err := g.stat(ctx, h, name)
+	if err != nil {
+		return "", err
+	}
+	if fi == nil {
+		return "", errNoSuchUpload
+	}
+	f := &httpFile{s: g.cfs, ctx: ctx, h: h, name: g.name(name), size: fi.Size}
+	object, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	if string(object) != path.Join(bucket, key) {
+		return "", errNoSuchUpload
+	}
+	return id, nil
+}
+
+func (g *s3Gateway) uploadPart(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, bucket, key string) error {
+	ctx := r.Context()
+	id, err := g.checkUpload(ctx, h, r, bucket, key)
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || n < 1 || n > maxPartNumber {
+		return &s3Error{http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000."}
+	}
+	part := partName(id, n)
+	if err := g.store(ctx, h, part, r); err != nil {
+		return err
+	}
+	etag, err := g.etag(ctx, h, part)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (g *s3Gateway) completeUpload(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, bucket, key string) error {
+	ctx := r.Context()
+	id, err := g.checkUpload(ctx, h, r, bucket, key)
+	if err != nil {
+		return err
+	}
+	var req completeMultipartUpload
+	if err := xml.NewDecoder(io.LimitReader(r.Body, maxCompleteBody)).Decode(&req); err != nil || len(req.Parts) == 0 {
+		return &s3Error{http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed."}
+	}
+
+	// check all the parts before joining them
+	parts := make([]*pb.FileInfo, len(req.Parts))
+	for i, p := range req.Parts {
+		if i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber {
+			return &s3Error{http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order."}
+		}
+		if p.PartNumber < 1 || p.PartNumber > maxPartNumber {
+			return errInvalidPart
+		}
+		fi, err := g.stat(ctx, h, partName(id, p.PartNumber))
+		if err != nil {
+			return err
+		}
+		if fi == nil {
+			return errInvalidPart
+		}
+		etag, err := g.etag(ctx, h, partName(id, p.PartNumber))
+		if err != nil {
+			return err
+		}
+		if strings.Trim(p.ETag, `"`) != strings.Trim(etag, `"`) {
+			return errInvalidPart
+		}
+		parts[i] = fi
+	}
+
+	object := path.Join(s3UploadDir, id, "object")
+	reply, err := g.cfs.Truncate(ctx, &pb.TruncateRequest{Header: h, Name: g.name(object)})
+	if err != nil {
+		return err
+	}
+	if err := httpError(reply.Error); err != nil {
+		return err
+	}
+	var off int64
+	for i, p := range req.Parts {
+		f := &httpFile{s: g.cfs, ctx: ctx, h: h, name: g.name(partName(id, p.PartNumber)), size: parts[i].Size}
+		n, err := writeFrom(ctx, g.cfs, h, g.name(object), off, f)
+		if err != nil {
+			return err
+		}
+		if n != parts[i].Size {
+			return errS3Failed
+		}
+		off += n
+	}
+	etag, err := g.commit(ctx, h, object, path.Join(bucket, key))
+	if err != nil {
+		return err
+	}
+	if err := g.remove(ctx, h, path.Join(s3UploadDir, id), true); err != nil {
+		return err
+	}
+	replyXML(w, http.StatusOK, &completeMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: "/" + path.Join(bucket, key),
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     etag,
+	})
+	return nil
+}
+
+func (g *s3Gateway) abortUpload(w http.ResponseWriter, r *http.Request, h *pb.RequestHeader, bucket, key string) error {
+	ctx := r.Context()
+	id, err := g.checkUpload(ctx, h, r, bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := g.remove(ctx, h, path.Join(s3UploadDir, id), true); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	pb "github.com/c-fs/cfs/proto"
+	"golang.org/x/net/context"
+)
+
+// newTestS3 returns an S3 gateway to disk0 of a test server holding the
+// bucket bkt, and a function closing it.
+func newTestS3(t *testing.T) (*server, *httptest.Server, func()) {
+	s, cleanup := newTestServer(t)
+	ts := httptest.NewServer(newS3Gateway(s, "disk0", false))
+	if code, body := httpDo(t, ts, "PUT", "/bkt", nil, ""); code != http.StatusOK {
+		ts.Close()
+		cleanup()
+		t.Fatalf("create bucket code = %d (%s), want %d", code, body, http.StatusOK)
+	}
+	return s, ts, func() {
+		ts.Close()
+		cleanup()
+	}
+}
+
+// s3Put puts data as the object of url, and returns its ETag.
+func s3Put(t *testing.T, ts *httptest.Server, url, data string) string {
+	resp, body := httpRequest(t, ts, "PUT", url, nil, data)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT %s code = %d (%s), want %d", url, resp.StatusCode, body, http.StatusOK)
+	}
+	return resp.Header.Get("ETag")
+}
+
+// s3ETag returns the ETag of an object holding data.
+func s3ETag(data string) string {
+	return etag(crc32.Checksum([]byte(data), crc32.MakeTable(crc32.Castagnoli)), int64(len(data)))
+}
+
+func TestS3PutObject(t *testing.T) {
+	s, ts, cleanup := newTestS3(t)
+	defer cleanup()
+
+	md5Of := func(data string) string {
+		sum := md5.Sum([]byte(data))
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+	tests := []struct {
+		url    string
+		data   string
+		header http.Header
+		code   int
+	}{
+		{"/bkt/a", "hello", nil, http.StatusOK},
+		{"/bkt/a", "hi", nil, http.StatusOK},
+		{"/bkt/dir/b", "b", http.Header{"Content-Md5": {md5Of("b")}}, http.StatusOK},
+		{"/bkt/empty", "", nil, http.StatusOK},
+		{"/bkt/c", "c", http.Header{"Content-Md5": {md5Of("x")}}, http.StatusBadRequest},
+		{"/nobkt/a", "a", nil, http.StatusNotFound},
+		{"/bkt/../a", "a", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, body := httpRequest(t, ts, "PUT", tt.url, tt.header, tt.data)
+		if resp.StatusCode != tt.code {
+			t.Errorf("PUT %s: code = %d (%s), want %d", tt.url, resp.StatusCode, body, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		if etag := resp.Header.Get("ETag"); etag != s3ETag(tt.data) {
+			t.Errorf("PUT %s: ETag = %s, want %s", tt.url, etag, s3ETag(tt.data))
+		}
+		if code, body := httpDo(t, ts, "GET", tt.url, nil, ""); code != http.StatusOK || body != tt.data {
+			t.Errorf("GET %s = %d %q, want %q", tt.url, code, body, tt.data)
+		}
+	}
+
+	// the uploaded files were all renamed into place or removed
+	reply, err := s.ReadDir(context.Background(), &pb.ReadDirRequest{Header: &pb.RequestHeader{}, Name: "disk0/" + s3UploadDir})
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	if len(reply.FileInfos) != 0 {
+		t.Errorf("uploads = %v, want none", reply.FileInfos)
+	}
+}
+
+func TestS3GetObjectRange(t *testing.T) {
+	_, ts, cleanup := newTestS3(t)
+	defer cleanup()
+	const data = "0123456789"
+	etag := s3Put(t, ts, "/bkt/a", data)
+
+	tests := []struct {
+		rangeHeader string
+		code        int
+		data        string
+	}{
+		{"", http.StatusOK, data},
+		{"bytes=2-5", http.StatusPartialContent, "2345"},
+		{"bytes=7-", http.StatusPartialContent, "789"},
+		{"bytes=-2", http.StatusPartialContent, "89"},
+		{"bytes=10-", http.StatusRequestedRangeNotSatisfiable, ""},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.rangeHeader != "" {
+			header.Set("Range", tt.rangeHeader)
+		}
+		resp, body := httpRequest(t, ts, "GET", "/bkt/a", header, "")
+		if resp.StatusCode != tt.code {
+			t.Errorf("range %q: code = %d, want %d", tt.rangeHeader, resp.StatusCode, tt.code)
+			continue
+		}
+		if tt.code == http.StatusRequestedRangeNotSatisfiable {
+			continue
+		}
+		if body != tt.data {
+			t.Errorf("range %q: body = %q, want %q", tt.rangeHeader, body, tt.data)
+		}
+		if got := resp.Header.Get("ETag"); got != etag {
+			t.Errorf("range %q: ETag = %s, want %s", tt.rangeHeader, got, etag)
+		}
+	}
+	if code, body := httpDo(t, ts, "GET", "/bkt/missing", nil, ""); code != http.StatusNotFound || !strings.Contains(body, "NoSuchKey") {
+		t.Errorf("GET of a missing key = %d %s, want %d NoSuchKey", code, body, http.StatusNotFound)
+	}
+}
+
+func TestS3HeadObject(t *testing.T) {
+	_, ts, cleanup := newTestS3(t)
+	defer cleanup()
+	etag := s3Put(t, ts, "/bkt/dir/a", "hello")
+
+	tests := []struct {
+		url  string
+		code int
+	}{
+		{"/bkt/dir/a", http.StatusOK},
+		{"/bkt/dir", http.StatusNotFound},
+		{"/bkt/missing", http.StatusNotFound},
+		{"/nobkt/a", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		resp, body := httpRequest(t, ts, "HEAD", tt.url, nil, "")
+		if resp.StatusCode != tt.code {
+			t.Errorf("HEAD %s: code = %d, want %d", tt.url, resp.StatusCode, tt.code)
+		}
+		if body != "" {
+			t.Errorf("HEAD %s: body = %q, want none", tt.url, body)
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		if got := resp.Header.Get("ETag"); got != etag {
+			t.Errorf("HEAD %s: ETag = %s, want %s", tt.url, got, etag)
+		}
+		if resp.ContentLength != 5 {
+			t.Errorf("HEAD %s: length = %d, want 5", tt.url, resp.ContentLength)
+		}
+	}
+}
+
+func TestS3DeleteObject(t *testing.T) {
+	_, ts, cleanup := newTestS3(t)
+	defer cleanup()
+	s3Put(t, ts, "/bkt/a", "a")
+	s3Put(t, ts, "/bkt/dir/b", "b")
+
+	tests := []struct {
+		url  string
+		code int
+		// gone is the object that must be missing after the request
+		gone string
+	}{
+		{"/bkt/a", http.StatusNoContent, "/bkt/a"},
+		// deleting a missing object succeeds
+		{"/bkt/a", http.StatusNoContent, ""},
+		{"/bkt/dir/", http.StatusNoContent, ""},
+		{"/bkt/dir/b", http.StatusNoContent, "/bkt/dir/b"},
+		{"/nobkt/a", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		if code, body := httpDo(t, ts, "DELETE", tt.url, nil, ""); code != tt.code {
+			t.Errorf("DELETE %s: code = %d (%s), want %d", tt.url, code, body, tt.code)
+		}
+		if tt.gone == "" {
+			continue
+		}
+		if code, _ := httpDo(t, ts, "HEAD", tt.gone, nil, ""); code != http.StatusNotFound {
+			t.Errorf("DELETE %s: HEAD %s code = %d, want %d", tt.url, tt.gone, code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestS3Multipart(t *testing.T) {
+	_, ts, cleanup := newTestS3(t)
+	defer cleanup()
+
+	code, body := httpDo(t, ts, "POST", "/bkt/big?uploads", nil, "")
+	if code != http.StatusOK {
+		t.Fatalf("create upload code = %d (%s), want %d", code, body, http.StatusOK)
+	}
+	var created initiateMultipartUploadResult
+	if err := xml.Unmarshal([]byte(body), &created); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	id := created.UploadId
+
+	parts := []string{"first part,", "second part"}
+	etags := make([]string, len(parts))
+	for i, p := range parts {
+		url := fmt.Sprintf("/bkt/big?partNumber=%d&uploadId=%s", i+1, id)
+		etags[i] = s3Put(t, ts, url, p)
+		if etags[i] != s3ETag(p) {
+			t.Errorf("part %d: ETag = %s, want %s", i+1, etags[i], s3ETag(p))
+		}
+	}
+
+	complete := func(etags ...string) string {
+		var b bytes.Buffer
+		b.WriteString("<CompleteMultipartUpload>")
+		for i, etag := range etags {
+			fmt.Fprintf(&b, "<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", i+1, etag)
+		}
+		b.WriteString("</CompleteMultipartUpload>")
+		return b.String()
+	}
+	tests := []struct {
+		name  string
+		id    string
+		etags []string
+		code  int
+		error string
+	}{
+		{"wrong part ETag", id, []string{etags[0], s3ETag("other")}, http.StatusBadRequest, "InvalidPart"},
+		{"missing part", id, []string{etags[0], etags[1], etags[1]}, http.StatusBadRequest, "InvalidPart"},
+		{"unknown upload", strings.Repeat("00", 16), etags, http.StatusNotFound, "NoSuchUpload"},
+		{"complete", id, etags, http.StatusOK, ""},
+		{"completed", id, etags, http.StatusNotFound, "NoSuchUpload"},
+	}
+	for _, tt := range tests {
+		code, body := httpDo(t, ts, "POST", "/bkt/big?uploadId="+tt.id, nil, complete(tt.etags...))
+		if code != tt.code || !strings.Contains(body, tt.error) {
+			t.Errorf("%s: complete = %d %s, want %d %s", tt.name, code, body, tt.code, tt.error)
+		}
+	}
+
+	data := strings.Join(parts, "")
+	resp, body := httpRequest(t, ts, "GET", "/bkt/big", nil, "")
+	if resp.StatusCode != http.StatusOK || body != data {
+		t.Errorf("GET = %d %q, want %q", resp.StatusCode, body, data)
+	}
+	if etag := resp.Header.Get("ETag"); etag != s3ETag(data) {
+		t.Errorf("ETag = %s, want %s", etag, s3ETag(data))
+	}
+}
+
+func TestS3ListObjectsV2(t *testing.T) {
+	_, ts, cleanup := newTestS3(t)
+	defer cleanup()
+	keys := []string{"a", "b", "c/d", "c/e", "f"}
+	for _, key := range keys {
+		s3Put(t, ts, "/bkt/"+key, key)
+	}
+
+	list := func(query url.Values) *listBucketResult {
+		query.Set("list-type", "2")
+		code, body := httpDo(t, ts, "GET", "/bkt?"+query.Encode(), nil, "")
+		if code != http.StatusOK {
+			t.Fatalf("list %s code = %d (%s), want %d", query.Encode(), code, body, http.StatusOK)
+		}
+		var result listBucketResult
+		if err := xml.Unmarshal([]byte(body), &result); err != nil {
+			t.Fatalf("error = %v", err)
+		}
+		return &result
+	}
+
+	tests := []struct {
+		delimiter string
+		// entries are the keys and common prefixes in order
+		entries []string
+	}{
+		{"", keys},
+		{"/", []string{"a", "b", "c/", "f"}},
+	}
+	for _, tt := range tests {
+		var entries []string
+		query := url.Values{"max-keys": {"2"}, "delimiter": {tt.delimiter}}
+		for pages := 0; ; pages++ {
+			if pages == len(tt.entries) {
+				t.Fatalf("delimiter %q: expect at most %d pages", tt.delimiter, len(tt.entries))
+			}
+			result := list(query)
+			if result.KeyCount != len(result.Contents)+len(result.CommonPrefixes) || result.KeyCount > 2 {
+				t.Errorf("delimiter %q: key count = %d of %d keys and %d prefixes", tt.delimiter,
+					result.KeyCount, len(result.Contents), len(result.CommonPrefixes))
+			}
+			for _, o := range result.Contents {
+				entries = append(entries, o.Key)
+				if o.ETag != s3ETag(o.Key) {
+					t.Errorf("delimiter %q: ETag of %s = %s, want %s", tt.delimiter, o.Key, o.ETag, s3ETag(o.Key))
+				}
+			}
+			for _, p := range result.CommonPrefixes {
+				entries = append(entries, p.Prefix)
+			}
+			if !result.IsTruncated {
+				break
+			}
+			if result.NextContinuationToken == "" {
+				t.Fatalf("delimiter %q: truncated page without continuation token", tt.delimiter)
+			}
+			query.Set("continuation-token", result.NextContinuationToken)
+		}
+		// keys and prefixes come in separate lists of a page
+		sort.Strings(entries)
+		if strings.Join(entries, " ") != strings.Join(tt.entries, " ") {
+			t.Errorf("delimiter %q: entries = %v, want %v", tt.delimiter, entries, tt.entries)
+		}
+	}
+
+	if result := list(url.Values{"start-after": {"c/d"}}); len(result.Contents) != 2 || result.Contents[0].Key != "c/e" {
+		t.Errorf("start-after c/d: contents = %+v, want c/e and f", result.Contents)
+	}
+	if code, _ := httpDo(t, ts, "GET", "/bkt?list-type=2&continuation-token=%25", nil, ""); code != http.StatusBadRequest {
+		t.Errorf("bad continuation token code = %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestS3ClientID(t *testing.T) {
+	tests := []struct {
+		auth      string
+		clientIDs bool
+		id        int64
+	}{
+		{"AWS4-HMAC-SHA256 Credential=42/20260101/us-east-1/s3/aws4_request, SignedHeaders=host, Signature=x", true, 42},
+		{"AWS 42:signature", true, 42},
+		{"AWS4-HMAC-SHA256 Credential=AKIAEXAMPLE/20260101/us-east-1/s3/aws4_request", true, 0},
+		{"", true, 0},
+		{"AWS 42:signature", false, 0},
+	}
+	for _, tt := range tests {
+		g := &s3Gateway{clientIDs: tt.clientIDs}
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("error = %v", err)
+		}
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+		h, err := g.header(r)
+		if err != nil {
+			t.Errorf("%q: error = %v", tt.auth, err)
+			continue
+		}
+		if h.ClientID != tt.id {
+			t.Errorf("%q with client IDs %v: client ID = %d, want %d", tt.auth, tt.clientIDs, h.ClientID, tt.id)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"io"
+	"path"
 
 	"github.com/c-fs/cfs/disk"
 	"github.com/c-fs/cfs/enforce"
@@ -15,10 +17,34 @@ type server struct {
 	// server contains a map of disks.
 	// The key in the map is the name of the disk.
 	disks map[string]*disk.Disk
+	// cache is shared by all disks. It is nil if caching is disabled.
+	cache *disk.Cache
+	// keyring holds the master keys of encrypted disks. It is nil if
+	// no key file is configured.
+	keyring *disk.Keyring
+	// leases holds the leases granted to clients on files.
+	leases *leaseTable
+	// watch holds the recent changes of files for watchers.
+	watch *watchHub
+	// inotify is set if the changes of files are taken from inotify
+	// rather than from the handlers.
+	inotify bool
 }
 
-func NewServer() *server {
-	return &server{disks: make(map[string]*disk.Disk)}
+func NewServer(cache *disk.Cache, keyring *disk.Keyring, inotify bool) *server {
+	return &server{
+		disks:   make(map[string]*disk.Disk),
+		cache:   cache,
+		keyring: keyring,
+		leases:  newLeaseTable(),
+		watch:   newWatchHub(),
+		inotify: inotify,
+	}
+}
+
+// Close stops the expiry of the leases of the server.
+func (s *server) Close() {
+	s.leases.close()
 }
 
 func (s *server) Write(ctx context.Context, req *pb.WriteRequest) (*pb.WriteReply, error) {
@@ -39,13 +65,30 @@ func (s *server) Write(ctx context.Context, req *pb.WriteRequest) (*pb.WriteRepl
 	}
 
 	stats.Counter(dn, "write").Client(req.Header.ClientID).Add()
-	n, err := d.WriteAt(fn, req.Data, req.Offset)
+	if req.RequireLease {
+		if err := s.checkLease(req.Name, req.Header.ClientID); err != nil {
+			return &pb.WriteReply{Error: pbError("write", req.Name, err)}, nil
+		}
+	}
+	if err := checkWrite(req.Offset, req.Precondition); err != nil {
+		log.Infof("server: write error (%v)", err)
+		return &pb.WriteReply{Error: pbError("write", req.Name, err)}, nil
+	}
+	existed, _ := s.stat(d, fn)
+	n, gen, err := d.WriteAtIf(fn, req.Data, req.Offset, precondition(req.Precondition))
 	// TODO: add error
+	if err == disk.ErrPrecondition {
+		return &pb.WriteReply{Error: pbError("write", req.Name, err)}, nil
+	}
 	if err != nil {
 		log.Infof("server: write error (%v)", err)
 		return &pb.WriteReply{}, nil
 	}
-	reply := &pb.WriteReply{BytesWritten: int64(n)}
+	if !existed {
+		s.notify(pb.WatchEvent_CREATE, dn+"/"+fn, "", false)
+	}
+	s.notify(pb.WatchEvent_WRITE, dn+"/"+fn, "", false)
+	reply := &pb.WriteReply{BytesWritten: int64(n), Generation: gen}
 	return reply, nil
 }
 
@@ -67,19 +110,55 @@ func (s *server) Read(ctx context.Context, req *pb.ReadRequest) (*pb.ReadReply,
 	}
 
 	stats.Counter(dn, "read").Client(req.Header.ClientID).Add()
-	// TODO: reuse buffer
-	data := make([]byte, req.Length)
-	n, err := d.ReadAt(fn, data, req.Offset)
-	// TODO: add error
-	if err == io.EOF {
-		log.Infof("server: read %d bytes until EOF", n)
-		return &pb.ReadReply{BytesRead: int64(n), Data: data[:n]}, nil
-	}
+	// The reply keeps data until grpc has marshalled it, so it cannot be
+	// taken from a pool. The disk sizes it by what the file holds instead
+	// of trusting the requested length, and reads it along with the
+	// generation under the lock of the file, so that they match.
+	data, gen, err := d.ReadWithGeneration(fn, req.Offset, req.Length)
 	if err != nil {
+		// A short read must not pass for the end of the file.
 		log.Infof("server: read error (%v)", err)
-		return &pb.ReadReply{}, nil
+		return &pb.ReadReply{Error: pbError("read", req.Name, err)}, nil
 	}
-	reply := &pb.ReadReply{BytesRead: int64(n), Data: data}
+	reply := &pb.ReadReply{BytesRead: int64(len(data)), Data: data, Generation: gen}
+	return reply, nil
+}
+
+func (s *server) Truncate(ctx context.Context, req *pb.TruncateRequest) (*pb.TruncateReply, error) {
+	reply := &pb.TruncateReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, fn, err := splitDiskAndFile(req.Name)
+	if err != nil {
+		log.Infof("server: truncate error (%v)", err)
+		return reply, nil
+	}
+
+	d := s.Disk(dn)
+	if d == nil {
+		log.Infof("server: truncate error (cannot find disk %s)", dn)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "truncate").Client(req.Header.ClientID).Add()
+	if req.RequireLease {
+		if err := s.checkLease(req.Name, req.Header.ClientID); err != nil {
+			reply.Error = pbError("truncate", req.Name, err)
+			return reply, nil
+		}
+	}
+	existed, _ := s.stat(d, fn)
+	if err := d.Truncate(fn, req.Size); err != nil {
+		log.Infof("server: truncate error (%v)", err)
+		reply.Error = pbError("truncate", req.Name, err)
+		return reply, nil
+	}
+	if !existed {
+		s.notify(pb.WatchEvent_CREATE, dn+"/"+fn, "", false)
+	}
+	s.notify(pb.WatchEvent_WRITE, dn+"/"+fn, "", false)
 	return reply, nil
 }
 
@@ -110,11 +189,21 @@ func (s *server) Rename(ctx context.Context, req *pb.RenameRequest) (*pb.RenameR
 	}
 
 	stats.Counter(dn0, "rename").Client(req.Header.ClientID).Add()
-	err = d.Rename(ofn, nfn)
+	if req.RequireLease {
+		if err := s.checkLeases(req.Header.ClientID, req.Oldname, req.Newname); err != nil {
+			return &pb.RenameReply{Error: pbError("rename", req.Oldname, err)}, nil
+		}
+	}
+	err = d.RenameIf(ofn, nfn, precondition(req.Precondition))
+	if err == disk.ErrPrecondition {
+		return &pb.RenameReply{Error: pbError("rename", req.Newname, err)}, nil
+	}
 	if err != nil {
 		log.Infof("server: rename error (%v)", err)
-		return &pb.RenameReply{}, nil
+		return &pb.RenameReply{Error: pbError("rename", req.Newname, err)}, nil
 	}
+	_, isDir := s.stat(d, nfn)
+	s.notify(pb.WatchEvent_RENAME, dn0+"/"+ofn, dn0+"/"+nfn, isDir)
 	reply := &pb.RenameReply{}
 	return reply, nil
 }
@@ -137,22 +226,40 @@ func (s *server) Remove(ctx context.Context, req *pb.RemoveRequest) (*pb.RemoveR
 	}
 
 	stats.Counter(dn, "remove").Client(req.Header.ClientID).Add()
-	err = d.Remove(fn, req.All)
+	if req.RequireLease {
+		if err := s.checkLease(req.Name, req.Header.ClientID); err != nil {
+			return &pb.RemoveReply{Error: pbError("remove", req.Name, err)}, nil
+		}
+	}
+	existed, isDir := s.stat(d, fn)
+	err = d.RemoveIf(fn, req.All, precondition(req.Precondition))
+	if err == disk.ErrPrecondition {
+		return &pb.RemoveReply{Error: pbError("remove", req.Name, err)}, nil
+	}
 	if err != nil {
-		log.Infof("server: read error (%v)", err)
-		return &pb.RemoveReply{}, nil
+		log.Infof("server: remove error (%v)", err)
+		return &pb.RemoveReply{Error: pbError("remove", req.Name, err)}, nil
+	}
+	if existed {
+		s.notify(pb.WatchEvent_REMOVE, dn+"/"+fn, "", isDir)
 	}
 	reply := &pb.RemoveReply{}
 	return reply, nil
 }
 
+// The page sizes of ReadDir, in entries.
+const (
+	defaultReadDirPageSize = 1000
+	maxReadDirPageSize     = 10000
+)
+
 func (s *server) ReadDir(ctx context.Context, req *pb.ReadDirRequest) (*pb.ReadDirReply, error) {
 	reply := &pb.ReadDirReply{}
 	if !enforce.HasQuota(req.Header.ClientID) {
 		log.Infof("server: out of quota for client %d", req.Header.ClientID)
 		return reply, nil
 	}
-	dn, fn, err := splitDiskAndFile(req.Name)
+	dn, fn, err := splitDiskAndDir(req.Name)
 	if err != nil {
 		log.Infof("server: readDir error (%v)", err)
 		return reply, nil
@@ -165,21 +272,30 @@ func (s *server) ReadDir(ctx context.Context, req *pb.ReadDirRequest) (*pb.ReadD
 	}
 
 	stats.Counter(dn, "readdir").Client(req.Header.ClientID).Add()
-	stats, err := d.ReadDir(fn)
+	pageSize := int(req.PageSize)
+	if pageSize <= 0 {
+		pageSize = defaultReadDirPageSize
+	}
+	if pageSize > maxReadDirPageSize {
+		pageSize = maxReadDirPageSize
+	}
+	entries, next, err := d.List(fn, disk.ListOptions{
+		PageToken: req.PageToken,
+		PageSize:  pageSize,
+		Prefix:    req.Prefix,
+		Pattern:   req.Pattern,
+		Recursive: req.Recursive,
+	})
 	if err != nil {
 		log.Infof("server: readDir error (%v)", err)
 		return reply, nil
 	}
 
-	reply.FileInfos = make([]*pb.FileInfo, len(stats))
-	for i, stat := range stats {
-		reply.FileInfos[i] = &pb.FileInfo{
-			Name: stat.Name(),
-			// TODO: Add size
-			TotalSize: stat.Size(),
-			IsDir:     stat.IsDir(),
-		}
+	reply.FileInfos = make([]*pb.FileInfo, len(entries))
+	for i, e := range entries {
+		reply.FileInfos[i] = fileInfo(d, path.Join(fn, e.Path), e)
 	}
+	reply.NextPageToken = next
 	return reply, nil
 }
 
@@ -202,9 +318,244 @@ func (s *server) Mkdir(ctx context.Context, req *pb.MkdirRequest) (*pb.MkdirRepl
 		return reply, nil
 	}
 	stats.Counter(dn, "mkdir").Client(req.Header.ClientID).Add()
+	existed, _ := s.stat(d, fn)
 	err = d.Mkdir(fn, req.All)
 	if err != nil {
 		log.Infof("server: mkdir error (%v)", err)
+		reply.Error = pbError("mkdir", req.Name, err)
+		return reply, nil
+	}
+	if !existed {
+		s.notify(pb.WatchEvent_CREATE, dn+"/"+fn, "", true)
+	}
+	return reply, nil
+}
+
+func (s *server) Extents(ctx context.Context, req *pb.ExtentsRequest) (*pb.ExtentsReply, error) {
+	reply := &pb.ExtentsReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, fn, err := splitDiskAndFile(req.Name)
+	if err != nil {
+		log.Infof("server: extents error (%v)", err)
+		return reply, nil
+	}
+
+	d := s.Disk(dn)
+	if d == nil {
+		log.Infof("server: extents error (cannot find disk %s)", dn)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "extents").Client(req.Header.ClientID).Add()
+	size, err := d.Size(fn)
+	if err != nil {
+		log.Infof("server: extents error (%v)", err)
+		return reply, nil
+	}
+	extents, err := d.Extents(fn)
+	if err != nil {
+		log.Infof("server: extents error (%v)", err)
+		return reply, nil
+	}
+	reply.Size = size
+	reply.Extents = make([]*pb.Extent, len(extents))
+	for i, e := range extents {
+		reply.Extents[i] = &pb.Extent{Offset: e.Offset, Length: e.Length}
+	}
+	return reply, nil
+}
+
+func (s *server) Checksum(ctx context.Context, req *pb.ChecksumRequest) (*pb.ChecksumReply, error) {
+	reply := &pb.ChecksumReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, fn, err := splitDiskAndFile(req.Name)
+	if err != nil {
+		log.Infof("server: checksum error (%v)", err)
+		return reply, nil
+	}
+
+	d := s.Disk(dn)
+	if d == nil {
+		log.Infof("server: checksum error (cannot find disk %s)", dn)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "checksum").Client(req.Header.ClientID).Add()
+	crc, n, err := d.RangeChecksum(fn, req.Offset, req.Length)
+	if err != nil {
+		log.Infof("server: checksum error (%v)", err)
+		reply.Error = pbError("checksum", req.Name, err)
+		return reply, nil
+	}
+	reply.Checksum = crc
+	reply.Length = n
+	return reply, nil
+}
+
+// maxMerkleNodes bounds the number of digests returned by MerkleNodes.
+const maxMerkleNodes = 1 << 16
+
+func (s *server) MerkleNodes(ctx context.Context, req *pb.MerkleNodesRequest) (*pb.MerkleNodesReply, error) {
+	reply := &pb.MerkleNodesReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, fn, err := splitDiskAndFile(req.Name)
+	if err != nil {
+		log.Infof("server: merkle nodes error (%v)", err)
+		return reply, nil
+	}
+
+	d := s.Disk(dn)
+	if d == nil {
+		log.Infof("server: merkle nodes error (cannot find disk %s)", dn)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "merkle").Client(req.Header.ClientID).Add()
+	count := int(req.Count)
+	if count > maxMerkleNodes {
+		count = maxMerkleNodes
+	}
+	tree, digests, err := d.MerkleNodes(fn, int(req.Level), int(req.Start), count)
+	if err != nil {
+		log.Infof("server: merkle nodes error (%v)", err)
+		return reply, nil
+	}
+	reply.Size = tree.Size
+	reply.LeafSize = tree.LeafSize
+	reply.Levels = int32(tree.Levels)
+	reply.Digests = digests
+	return reply, nil
+}
+
+// The limits of ReadV, so that a request cannot make the server hold
+// more than maxReadVSize bytes.
+const (
+	maxReadVExtents = 1024
+	maxReadVSize    = 64 << 20
+)
+
+var (
+	errTooManyExtents = errors.New("too many extents")
+	errReadVTooLarge  = errors.New("extents too large")
+)
+
+func (s *server) ReadV(ctx context.Context, req *pb.ReadVRequest) (*pb.ReadVReply, error) {
+	reply := &pb.ReadVReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, fn, err := splitDiskAndFile(req.Name)
+	if err != nil {
+		log.Infof("server: readv error (%v)", err)
+		return reply, nil
+	}
+
+	d := s.Disk(dn)
+	if d == nil {
+		log.Infof("server: readv error (cannot find disk %s)", dn)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "readv").Client(req.Header.ClientID).Add()
+	if len(req.Extents) > maxReadVExtents {
+		reply.Error = pbError("readv", req.Name, errTooManyExtents)
+		return reply, nil
+	}
+	// Size the buffers by what the file holds, as Read does.
+	size, err := d.Size(fn)
+	if err != nil {
+		log.Infof("server: readv error (%v)", err)
+		reply.Error = pbError("readv", req.Name, err)
+		return reply, nil
+	}
+	lengths := make([]int64, len(req.Extents))
+	var total int64
+	for i, e := range req.Extents {
+		if e.Offset < 0 {
+			reply.Error = pbError("readv", req.Name, disk.ErrNegativeOffset)
+			return reply, nil
+		}
+		length := e.Length
+		if remain := size - e.Offset; length < 0 || remain < length {
+			length = remain
+		}
+		if length < 0 {
+			length = 0
+		}
+		lengths[i] = length
+		if total += length; total > maxReadVSize {
+			reply.Error = pbError("readv", req.Name, errReadVTooLarge)
+			return reply, nil
+		}
+	}
+	vecs := make([]disk.IOVec, len(req.Extents))
+	for i, e := range req.Extents {
+		vecs[i] = disk.IOVec{Offset: e.Offset, Data: make([]byte, lengths[i])}
+	}
+	ns, err := d.ReadV(fn, vecs)
+	if err != nil && err != io.EOF {
+		log.Infof("server: readv error (%v)", err)
+		reply.Error = pbError("readv", req.Name, err)
+		return reply, nil
+	}
+	reply.Data = make([][]byte, len(vecs))
+	for i, v := range vecs {
+		reply.Data[i] = v.Data[:ns[i]]
+	}
+	return reply, nil
+}
+
+func (s *server) WriteV(ctx context.Context, req *pb.WriteVRequest) (*pb.WriteVReply, error) {
+	reply := &pb.WriteVReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, fn, err := splitDiskAndFile(req.Name)
+	if err != nil {
+		log.Infof("server: writev error (%v)", err)
+		return reply, nil
+	}
+
+	d := s.Disk(dn)
+	if d == nil {
+		log.Infof("server: writev error (cannot find disk %s)", dn)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "writev").Client(req.Header.ClientID).Add()
+	if req.RequireLease {
+		if err := s.checkLease(req.Name, req.Header.ClientID); err != nil {
+			reply.Error = pbError("writev", req.Name, err)
+			return reply, nil
+		}
+	}
+	vecs := make([]disk.IOVec, len(req.Vecs))
+	for i, v := range req.Vecs {
+		vecs[i] = disk.IOVec{Offset: v.Offset, Data: v.Data}
+	}
+	existed, _ := s.stat(d, fn)
+	n, err := d.WriteV(fn, vecs)
+	reply.BytesWritten = int64(n)
+	if n > 0 {
+		if !existed {
+			s.notify(pb.WatchEvent_CREATE, dn+"/"+fn, "", false)
+		}
+		s.notify(pb.WatchEvent_WRITE, dn+"/"+fn, "", false)
+	}
+	if err != nil {
+		log.Infof("server: writev error (%v)", err)
+		reply.Error = pbError("writev", req.Name, err)
 		return reply, nil
 	}
 	return reply, nil
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"path"
+
+	"github.com/c-fs/cfs/enforce"
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/c-fs/cfs/stats"
+	"github.com/qiniu/log"
+	"golang.org/x/net/context"
+)
+
+func (s *server) Snapshot(ctx context.Context, req *pb.SnapshotRequest) (*pb.SnapshotReply, error) {
+	reply := &pb.SnapshotReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, fn, err := splitDiskAndDir(req.Name)
+	if err != nil {
+		log.Infof("server: snapshot error (%v)", err)
+		return reply, nil
+	}
+	d := s.Disk(dn)
+	if d == nil {
+		log.Infof("server: snapshot error (cannot find disk %s)", dn)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "snapshot").Client(req.Header.ClientID).Add()
+	id, err := d.Snapshot(fn)
+	if err != nil {
+		log.Infof("server: snapshot error (%v)", err)
+		reply.Error = pbError("snapshot", req.Name, err)
+		return reply, nil
+	}
+	reply.Id = id
+	return reply, nil
+}
+
+func (s *server) ListSnapshots(ctx context.Context, req *pb.ListSnapshotsRequest) (*pb.ListSnapshotsReply, error) {
+	reply := &pb.ListSnapshotsReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	d := s.Disk(req.Disk)
+	if d == nil {
+		log.Infof("server: listSnapshots error (cannot find disk %s)", req.Disk)
+		return reply, nil
+	}
+
+	stats.Counter(req.Disk, "list_snapshots").Client(req.Header.ClientID).Add()
+	snaps, err := d.ListSnapshots()
+	if err != nil {
+		log.Infof("server: listSnapshots error (%v)", err)
+		reply.Error = pbError("listsnapshots", req.Disk, err)
+		return reply, nil
+	}
+	reply.Snapshots = make([]*pb.SnapshotInfo, len(snaps))
+	for i, sn := range snaps {
+		reply.Snapshots[i] = &pb.SnapshotInfo{
+			Id:          sn.ID,
+			Name:        path.Join(req.Disk, sn.Name),
+			CreatedTime: sn.Created.UnixNano(),
+		}
+	}
+	return reply, nil
+}
+
+func (s *server) DeleteSnapshot(ctx context.Context, req *pb.DeleteSnapshotRequest) (*pb.DeleteSnapshotReply, error) {
+	reply := &pb.DeleteSnapshotReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	d := s.Disk(req.Disk)
+	if d == nil {
+		log.Infof("server: deleteSnapshot error (cannot find disk %s)", req.Disk)
+		return reply, nil
+	}
+
+	stats.Counter(req.Disk, "delete_snapshot").Client(req.Header.ClientID).Add()
+	if err := d.DeleteSnapshot(req.Id); err != nil {
+		log.Infof("server: deleteSnapshot error (%v)", err)
+		reply.Error = pbError("deletesnapshot", req.Id, err)
+	}
+	return reply, nil
+}
+
+func (s *server) RestoreSnapshot(ctx context.Context, req *pb.RestoreSnapshotRequest) (*pb.RestoreSnapshotReply, error) {
+	reply := &pb.RestoreSnapshotReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	d := s.Disk(req.Disk)
+	if d == nil {
+		log.Infof("server: restoreSnapshot error (cannot find disk %s)", req.Disk)
+		return reply, nil
+	}
+	var fn string
+	if req.Name != "" {
+		dn, name, err := splitDiskAndFile(req.Name)
+		if err != nil {
+			log.Infof("server: restoreSnapshot error (%v)", err)
+			return reply, nil
+		}
+		if dn != req.Disk {
+			log.Infof("server: restoreSnapshot error (%s is not on disk %s)", req.Name, req.Disk)
+			return reply, nil
+		}
+		fn = name
+	}
+
+	stats.Counter(req.Disk, "restore_snapshot").Client(req.Header.ClientID).Add()
+	existed := false
+	var wasDir bool
+	if fn != "" {
+		existed, wasDir = s.stat(d, fn)
+	}
+	fn, err := d.RestoreSnapshot(req.Id, fn)
+	if err != nil {
+		log.Infof("server: restoreSnapshot error (%v)", err)
+		reply.Error = pbError("restoresnapshot", req.Id, err)
+		return reply, nil
+	}
+	reply.Name = path.Join(req.Disk, fn)
+	if existed {
+		s.notify(pb.WatchEvent_REMOVE, reply.Name, "", wasDir)
+	}
+	_, isDir := s.stat(d, fn)
+	s.notify(pb.WatchEvent_CREATE, reply.Name, "", isDir)
+	return reply, nil
+}
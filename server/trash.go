@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"path"
+	"time"
+
+	"github.com/c-fs/cfs/disk"
+	"github.com/c-fs/cfs/enforce"
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/c-fs/cfs/stats"
+	"github.com/qiniu/log"
+	"golang.org/x/net/context"
+)
+
+// trashPurgeInterval is how often the trash of disks is purged of the
+// files kept longer than the retention.
+const trashPurgeInterval = time.Minute
+
+var errPurgeTarget = errors.New("purge needs either a trash entry id or all")
+
+// purgeTrashEvery purges the trash of d of the files removed more than
+// retention ago.
+func purgeTrashEvery(d *disk.Disk, retention, interval time.Duration) {
+	for range time.Tick(interval) {
+		n, err := d.PurgeTrashBefore(time.Now().Add(-retention))
+		if err != nil {
+			log.Infof("server: purge trash error on disk %s (%v)", d.Name, err)
+		}
+		if n > 0 {
+			log.Infof("server: purged %d files from the trash of disk %s", n, d.Name)
+		}
+	}
+}
+
+func (s *server) ListTrash(ctx context.Context, req *pb.ListTrashRequest) (*pb.ListTrashReply, error) {
+	reply := &pb.ListTrashReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	d := s.Disk(req.Disk)
+	if d == nil {
+		log.Infof("server: listTrash error (cannot find disk %s)", req.Disk)
+		return reply, nil
+	}
+
+	stats.Counter(req.Disk, "list_trash").Client(req.Header.ClientID).Add()
+	entries, err := d.ListTrash()
+	if err != nil {
+		log.Infof("server: listTrash error (%v)", err)
+		reply.Error = pbError("listtrash", req.Disk, err)
+		return reply, nil
+	}
+	reply.Entries = make([]*pb.TrashEntry, len(entries))
+	for i, e := range entries {
+		reply.Entries[i] = &pb.TrashEntry{
+			Id:          e.ID,
+			Name:        path.Join(req.Disk, e.Name),
+			RemovedTime: e.Removed.UnixNano(),
+			IsDir:       e.IsDir,
+		}
+	}
+	return reply, nil
+}
+
+func (s *server) Undelete(ctx context.Context, req *pb.UndeleteRequest) (*pb.UndeleteReply, error) {
+	reply := &pb.UndeleteReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	d := s.Disk(req.Disk)
+	if d == nil {
+		log.Infof("server: undelete error (cannot find disk %s)", req.Disk)
+		return reply, nil
+	}
+	var fn string
+	if req.Name != "" {
+		dn, name, err := splitDiskAndFile(req.Name)
+		if err != nil {
+			log.Infof("server: undelete error (%v)", err)
+			return reply, nil
+		}
+		if dn != req.Disk {
+			log.Infof("server: undelete error (%s is not on disk %s)", req.Name, req.Disk)
+			return reply, nil
+		}
+		fn = name
+	}
+
+	stats.Counter(req.Disk, "undelete").Client(req.Header.ClientID).Add()
+	fn, err := d.Undelete(req.Id, fn)
+	if err != nil {
+		log.Infof("server: undelete error (%v)", err)
+		reply.Error = pbError("undelete", req.Id, err)
+		return reply, nil
+	}
+	reply.Name = path.Join(req.Disk, fn)
+	_, isDir := s.stat(d, fn)
+	s.notify(pb.WatchEvent_CREATE, reply.Name, "", isDir)
+	return reply, nil
+}
+
+func (s *server) PurgeTrash(ctx context.Context, req *pb.PurgeTrashRequest) (*pb.PurgeTrashReply, error) {
+	reply := &pb.PurgeTrashReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	d := s.Disk(req.Disk)
+	if d == nil {
+		log.Infof("server: purgeTrash error (cannot find disk %s)", req.Disk)
+		return reply, nil
+	}
+
+	stats.Counter(req.Disk, "purge_trash").Client(req.Header.ClientID).Add()
+	if (req.Id != "") == req.All {
+		reply.Error = pbError("purgetrash", req.Disk, errPurgeTarget)
+		return reply, nil
+	}
+	if !req.All {
+		if err := d.PurgeTrash(req.Id); err != nil {
+			log.Infof("server: purgeTrash error (%v)", err)
+			reply.Error = pbError("purgetrash", req.Id, err)
+			return reply, nil
+		}
+		reply.Purged = 1
+		return reply, nil
+	}
+	n, err := d.PurgeTrashBefore(time.Now())
+	reply.Purged = int32(n)
+	if err != nil {
+		log.Infof("server: purgeTrash error (%v)", err)
+		reply.Error = pbError("purgetrash", req.Disk, err)
+	}
+	return reply, nil
+}
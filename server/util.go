@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"path"
 	"strings"
+
+	"github.com/c-fs/cfs/disk"
+	pb "github.com/c-fs/cfs/proto"
 )
 
 func splitDiskAndFile(name string) (string, string, error) {
@@ -22,5 +25,56 @@ func splitDiskAndFile(name string) (string, string, error) {
 	if len(names) != 2 {
 		return "", "", fmt.Errorf("bad name: %s", name)
 	}
+	// the metadata directory of a disk is not accessible to clients
+	if names[1] == disk.MetaDir || strings.HasPrefix(names[1], disk.MetaDir+"/") {
+		return "", "", fmt.Errorf("reserved name: %s", name)
+	}
 	return names[0], names[1], nil
 }
+
+// splitDiskAndDir is splitDiskAndFile allowing the name of a disk alone,
+// which names the root directory of the disk.
+func splitDiskAndDir(name string) (string, string, error) {
+	cname := strings.Trim(path.Clean(name), "/")
+	if cname != "" && cname != "." && !strings.Contains(cname, "/") {
+		return cname, "", nil
+	}
+	return splitDiskAndFile(name)
+}
+
+// precondition converts p, which may be nil, to a disk precondition.
+func precondition(p *pb.Precondition) disk.Precondition {
+	if p == nil {
+		return disk.Precondition{}
+	}
+	return disk.Precondition{
+		MustNotExist:   p.MustNotExist,
+		CheckSize:      p.CheckSize,
+		Size:           p.Size,
+		Generation:     p.Generation,
+		CheckChecksum:  p.CheckChecksum,
+		ChecksumOffset: p.ChecksumOffset,
+		ChecksumLength: p.ChecksumLength,
+		Checksum:       p.Checksum,
+	}
+}
+
+// checkWrite returns an error if a write at off with the precondition p,
+// which may be nil, would start before the file.
+func checkWrite(off int64, p *pb.Precondition) error {
+	if off < 0 || p != nil && p.CheckChecksum && p.ChecksumOffset < 0 {
+		return disk.ErrNegativeOffset
+	}
+	return nil
+}
+
+// pbError converts an error of op on path to a reply error.
+func pbError(op, path string, err error) *pb.Error {
+	switch err {
+	case disk.ErrPrecondition:
+		return &pb.Error{PreconditionErr: &pb.PreconditionError{Op: op, Path: path}}
+	case errLeaseConflict, errLeaseNotHeld:
+		return &pb.Error{LeaseErr: &pb.LeaseError{Op: op, Path: path}}
+	}
+	return &pb.Error{PathErr: &pb.PathError{Op: op, Path: path, Error: err.Error()}}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path"
+
+	"github.com/c-fs/cfs/disk"
+	"github.com/c-fs/cfs/enforce"
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/c-fs/cfs/stats"
+	"github.com/qiniu/log"
+	"golang.org/x/net/context"
+)
+
+// maxUsageDepth bounds the depth of DiskUsage, so that a reply holds a
+// bounded number of directories for reasonable trees.
+const maxUsageDepth = 64
+
+func (s *server) Walk(req *pb.WalkRequest, stream pb.Cfs_WalkServer) error {
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return nil
+	}
+	dn, fn, err := splitDiskAndDir(req.Name)
+	if err != nil {
+		log.Infof("server: walk error (%v)", err)
+		return nil
+	}
+	d := s.Disk(dn)
+	if d == nil {
+		log.Infof("server: walk error (cannot find disk %s)", dn)
+		return nil
+	}
+
+	stats.Counter(dn, "walk").Client(req.Header.ClientID).Add()
+	opts := disk.ListOptions{
+		PageSize:  defaultReadDirPageSize,
+		Prefix:    req.Prefix,
+		Pattern:   req.Pattern,
+		Recursive: true,
+	}
+	for {
+		entries, next, err := d.List(fn, opts)
+		if err != nil {
+			log.Infof("server: walk error (%v)", err)
+			return stream.Send(&pb.WalkReply{Error: pbError("walk", req.Name, err)})
+		}
+		reply := &pb.WalkReply{FileInfos: make([]*pb.FileInfo, len(entries))}
+		for i, e := range entries {
+			reply.FileInfos[i] = fileInfo(d, path.Join(fn, e.Path), e)
+		}
+		if err := stream.Send(reply); err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		opts.PageToken = next
+	}
+}
+
+// fileInfo returns the file info of the entry e, which is the named file
+// of d.
+func fileInfo(d *disk.Disk, name string, e disk.DirEntry) *pb.FileInfo {
+	fi := &pb.FileInfo{
+		Name:      e.Path,
+		TotalSize: e.Info.Size(),
+		ModTime:   e.Info.ModTime().UnixNano(),
+		IsDir:     e.Info.IsDir(),
+	}
+	if e.Info.Mode().IsRegular() {
+		size, err := d.Size(name)
+		if err != nil && !os.IsNotExist(err) {
+			log.Infof("server: size error (%v)", err)
+		}
+		fi.Size = size
+	}
+	fi.Symlink = symlink(d, name, e.Info)
+	return fi
+}
+
+// symlink returns the target of the named file of d, with the disk name,
+// if it is a symbolic link.
+func symlink(d *disk.Disk, name string, fi os.FileInfo) string {
+	if fi.Mode()&os.ModeSymlink == 0 {
+		return ""
+	}
+	target, err := d.Readlink(name)
+	if err != nil {
+		log.Infof("server: readlink error (%v)", err)
+		return ""
+	}
+	return path.Join(d.Name, target)
+}
+
+func (s *server) Stat(ctx context.Context, req *pb.StatRequest) (*pb.StatReply, error) {
+	reply := &pb.StatReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, fn, err := splitDiskAndDir(req.Name)
+	if err != nil {
+		log.Infof("server: stat error (%v)", err)
+		return reply, nil
+	}
+	d := s.Disk(dn)
+	if d == nil {
+		log.Infof("server: stat error (cannot find disk %s)", dn)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "stat").Client(req.Header.ClientID).Add()
+	fi, err := d.Stat(fn)
+	if os.IsNotExist(err) {
+		return reply, nil
+	}
+	if err != nil {
+		log.Infof("server: stat error (%v)", err)
+		reply.Error = pbError("stat", req.Name, err)
+		return reply, nil
+	}
+	reply.Info = fileInfo(d, fn, disk.DirEntry{Path: path.Base(path.Join(dn, fn)), Info: fi})
+	return reply, nil
+}
+
+func (s *server) DiskUsage(ctx context.Context, req *pb.DiskUsageRequest) (*pb.DiskUsageReply, error) {
+	reply := &pb.DiskUsageReply{}
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return reply, nil
+	}
+	dn, fn, err := splitDiskAndDir(req.Name)
+	if err != nil {
+		log.Infof("server: diskUsage error (%v)", err)
+		return reply, nil
+	}
+	d := s.Disk(dn)
+	if d == nil {
+		log.Infof("server: diskUsage error (cannot find disk %s)", dn)
+		return reply, nil
+	}
+
+	stats.Counter(dn, "disk_usage").Client(req.Header.ClientID).Add()
+	depth := int(req.Depth)
+	if depth < 0 {
+		depth = 0
+	}
+	if depth > maxUsageDepth {
+		depth = maxUsageDepth
+	}
+	usages, err := d.Usage(fn, depth)
+	if err != nil {
+		log.Infof("server: diskUsage error (%v)", err)
+		reply.Error = pbError("du", req.Name, err)
+		return reply, nil
+	}
+	reply.Usages = make([]*pb.Usage, len(usages))
+	for i, u := range usages {
+		reply.Usages[i] = &pb.Usage{
+			Path:         u.Path,
+			LogicalBytes: u.Logical,
+			DiskBytes:    u.Allocated,
+			Files:        u.Files,
+			Dirs:         u.Dirs,
+		}
+	}
+	return reply, nil
+}
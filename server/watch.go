@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-fs/cfs/disk"
+	"github.com/c-fs/cfs/enforce"
+	pb "github.com/c-fs/cfs/proto"
+	"github.com/c-fs/cfs/stats"
+	"github.com/qiniu/log"
+)
+
+// maxWatchEvents is the number of recent events kept for watchers to
+// catch up or resume from.
+const maxWatchEvents = 4096
+
+// watchHub keeps the recent change events of a server in a ring and wakes
+// up the watchers when new ones come.
+type watchHub struct {
+	mu     sync.Mutex
+	events []*pb.WatchEvent
+	// start is the index of the oldest of the n events in the ring.
+	start, n int
+	// next is the seq of the next event. It starts from the time the
+	// server started so that seqs keep increasing across restarts.
+	next uint64
+	// wake is closed and replaced when an event is published.
+	wake chan struct{}
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{
+		events: make([]*pb.WatchEvent, maxWatchEvents),
+		next:   uint64(time.Now().UnixNano()),
+		wake:   make(chan struct{}),
+	}
+}
+
+func (h *watchHub) publish(op pb.WatchEvent_Op, name, newName string, isDir bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e := &pb.WatchEvent{Seq: h.next, Op: op, Name: name, NewName: newName, IsDir: isDir}
+	h.events[(h.start+h.n)%len(h.events)] = e
+	if h.n < len(h.events) {
+		h.n++
+	} else {
+		h.start = (h.start + 1) % len(h.events)
+	}
+	h.next++
+	close(h.wake)
+	h.wake = make(chan struct{})
+}
+
+// head returns the seq of the next event.
+func (h *watchHub) head() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.next
+}
+
+// since returns the events from seq on under prefix, the seq of the first
+// event looked at, which is past seq if the events from seq on were
+// dropped, the seq to continue from and a channel closed when more events
+// come.
+func (h *watchHub) since(seq uint64, prefix string) ([]*pb.WatchEvent, uint64, uint64, <-chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	oldest := h.next - uint64(h.n)
+	// A seq from the future comes from before a restart with the clock
+	// set back; what it missed is unknown too.
+	if seq < oldest || seq > h.next {
+		seq = oldest
+	}
+	from := seq
+	var events []*pb.WatchEvent
+	for ; seq < h.next; seq++ {
+		e := h.events[(h.start+int(seq-oldest))%len(h.events)]
+		if e.Op == pb.WatchEvent_LOST || under(e.Name, prefix) || under(e.NewName, prefix) {
+			events = append(events, e)
+		}
+	}
+	return events, from, h.next, h.wake
+}
+
+// under reports whether name is prefix or under it.
+func under(name, prefix string) bool {
+	return name == prefix || strings.HasPrefix(name, prefix+"/")
+}
+
+// notify publishes a change made by a handler. Changes are left to
+// inotify if it watches the disks.
+func (s *server) notify(op pb.WatchEvent_Op, name, newName string, isDir bool) {
+	if s.inotify {
+		return
+	}
+	s.watch.publish(op, name, newName, isDir)
+}
+
+// stat reports whether the named file of d exists and is a directory, for
+// the events of a change to it. It does not look if inotify makes the
+// events.
+func (s *server) stat(d *disk.Disk, name string) (exists, isDir bool) {
+	if s.inotify {
+		return false, false
+	}
+	fi, err := os.Stat(path.Join(d.Root, name))
+	if err != nil {
+		return false, false
+	}
+	return true, fi.IsDir()
+}
+
+func (s *server) Watch(req *pb.WatchRequest, stream pb.Cfs_WatchServer) error {
+	if !enforce.HasQuota(req.Header.ClientID) {
+		log.Infof("server: out of quota for client %d", req.Header.ClientID)
+		return nil
+	}
+	prefix := strings.TrimPrefix(path.Clean("/"+req.Prefix), "/")
+	dn := strings.SplitN(prefix, "/", 2)[0]
+	if s.Disk(dn) == nil {
+		log.Infof("server: watch error (cannot find disk %s)", dn)
+		return nil
+	}
+
+	stats.Counter(dn, "watch").Client(req.Header.ClientID).Add()
+	seq := req.AfterSeq + 1
+	if req.AfterSeq == 0 {
+		seq = s.watch.head()
+	}
+	for {
+		events, from, next, wake := s.watch.since(seq, prefix)
+		if from != seq {
+			if err := stream.Send(&pb.WatchEvent{Seq: from - 1, Op: pb.WatchEvent_LOST}); err != nil {
+				return err
+			}
+		}
+		for _, e := range events {
+			if err := stream.Send(e); err != nil {
+				return err
+			}
+		}
+		seq = next
+		select {
+		case <-wake:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c-fs/cfs/disk"
+	pb "github.com/c-fs/cfs/proto"
+	"golang.org/x/net/context"
+)
+
+// newTestWatchHub returns a hub keeping size events, whose first seq is 100.
+func newTestWatchHub(size int) *watchHub {
+	return &watchHub{
+		events: make([]*pb.WatchEvent, size),
+		next:   100,
+		wake:   make(chan struct{}),
+	}
+}
+
+func TestWatchHubSince(t *testing.T) {
+	tests := []struct {
+		name      string
+		published int
+		seq       uint64
+		prefix    string
+		from      uint64
+		seqs      []uint64
+	}{
+		{"empty", 0, 100, "disk0", 100, nil},
+		{"all", 3, 100, "disk0", 100, []uint64{100, 101, 102}},
+		{"from the middle", 3, 101, "disk0", 101, []uint64{101, 102}},
+		{"up to date", 3, 103, "disk0", 103, nil},
+		{"prefix", 4, 100, "disk0/b", 100, []uint64{101, 103}},
+		// the ring of 4 events wrapped around, dropping 100 and 101
+		{"wraparound", 6, 102, "disk0", 102, []uint64{102, 103, 104, 105}},
+		{"dropped", 6, 100, "disk0", 102, []uint64{102, 103, 104, 105}},
+		{"wraparound twice", 11, 108, "disk0", 108, []uint64{108, 109, 110}},
+		// seqs from the future come from before a restart
+		{"future", 3, 200, "disk0", 100, []uint64{100, 101, 102}},
+	}
+	for _, tt := range tests {
+		h := newTestWatchHub(4)
+		for i := 0; i < tt.published; i++ {
+			name := "disk0/a"
+			if i%2 == 1 {
+				name = "disk0/b"
+			}
+			h.publish(pb.WatchEvent_WRITE, name, "", false)
+		}
+		events, from, next, _ := h.since(tt.seq, tt.prefix)
+		if from != tt.from {
+			t.Errorf("%s: from = %d, want %d", tt.name, from, tt.from)
+		}
+		if want := uint64(100 + tt.published); next != want {
+			t.Errorf("%s: next = %d, want %d", tt.name, next, want)
+		}
+		var seqs []uint64
+		for _, e := range events {
+			seqs = append(seqs, e.Seq)
+		}
+		if len(seqs) != len(tt.seqs) {
+			t.Errorf("%s: seqs = %v, want %v", tt.name, seqs, tt.seqs)
+			continue
+		}
+		for i := range seqs {
+			if seqs[i] != tt.seqs[i] {
+				t.Errorf("%s: seqs = %v, want %v", tt.name, seqs, tt.seqs)
+				break
+			}
+		}
+	}
+}
+
+func TestWatchHubWake(t *testing.T) {
+	h := newTestWatchHub(4)
+	_, _, _, wake := h.since(100, "disk0")
+	select {
+	case <-wake:
+		t.Fatalf("expect no wake up before an event")
+	default:
+	}
+	h.publish(pb.WatchEvent_CREATE, "disk0/a", "", false)
+	select {
+	case <-wake:
+	case <-time.After(time.Second):
+		t.Fatalf("expect a wake up after an event")
+	}
+}
+
+// watchStream collects the events sent to a watcher until it has want of
+// them, then ends the watch.
+type watchStream struct {
+	pb.Cfs_WatchServer
+	ctx    context.Context
+	cancel func()
+	want   int
+	events []*pb.WatchEvent
+}
+
+func (s *watchStream) Context() context.Context { return s.ctx }
+
+func (s *watchStream) Send(e *pb.WatchEvent) error {
+	s.events = append(s.events, e)
+	if len(s.events) == s.want {
+		s.cancel()
+	}
+	return nil
+}
+
+func TestWatchResume(t *testing.T) {
+	tests := []struct {
+		name     string
+		afterSeq uint64
+		// lost is the seq of the LOST event sent first, if any
+		lost uint64
+		seqs []uint64
+	}{
+		{"resume", 103, 0, []uint64{104, 105}},
+		{"resume after dropped events", 100, 101, []uint64{102, 103, 104, 105}},
+	}
+	for _, tt := range tests {
+		s := &server{
+			disks: map[string]*disk.Disk{"disk0": {Name: "disk0"}},
+			watch: newTestWatchHub(4),
+		}
+		for i := 0; i < 6; i++ {
+			s.watch.publish(pb.WatchEvent_WRITE, "disk0/a", "", false)
+		}
+		want := len(tt.seqs)
+		if tt.lost != 0 {
+			want++
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		stream := &watchStream{ctx: ctx, cancel: cancel, want: want}
+		req := &pb.WatchRequest{Header: &pb.RequestHeader{}, Prefix: "disk0", AfterSeq: tt.afterSeq}
+		if err := s.Watch(req, stream); err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+		}
+		cancel()
+		if len(stream.events) != want {
+			t.Errorf("%s: got %d events, want %d", tt.name, len(stream.events), want)
+			continue
+		}
+		events := stream.events
+		if tt.lost != 0 {
+			if events[0].Op != pb.WatchEvent_LOST || events[0].Seq != tt.lost {
+				t.Errorf("%s: first event = %v, want LOST at %d", tt.name, events[0], tt.lost)
+			}
+			events = events[1:]
+		}
+		for i, e := range events {
+			if e.Op != pb.WatchEvent_WRITE || e.Seq != tt.seqs[i] {
+				t.Errorf("%s: event #%d = %v, want WRITE at %d", tt.name, i, e, tt.seqs[i])
+			}
+		}
+	}
+}
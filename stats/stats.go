@@ -60,6 +60,11 @@ func (c *CounterType) Add() {
 	}
 }
 
+// GaugeFunc registers f to report the current value of the named gauge.
+func GaugeFunc(name string, f func() int64) {
+	metrics.Gauge(name).SetFunc(f)
+}
+
 func ClientCounterName(id int64) string {
 	return clientCounterPrefix + strconv.FormatInt(id, 16)
 }
@@ -86,11 +91,14 @@ func (s *server) ContainerInfo(ctx context.Context, req *pb.ContainerInfoRequest
 }
 
 func (s *server) Metrics(ctx context.Context, req *pb.MetricsRequest) (*pb.MetricsReply, error) {
-	counters, _ := metrics.Snapshot()
-	cms := make([]*pb.Metric, 0, len(counters))
+	counters, gauges := metrics.Snapshot()
+	cms := make([]*pb.Metric, 0, len(counters)+len(gauges))
 	for n, v := range counters {
 		cms = append(cms, &pb.Metric{Name: n, Val: strconv.FormatUint(v, 10)})
 	}
+	for n, v := range gauges {
+		cms = append(cms, &pb.Metric{Name: n, Val: strconv.FormatInt(v, 10)})
+	}
 	sort.Sort(metricsByName(cms))
 	r := &pb.MetricsReply{Counters: cms}
 	return r, nil